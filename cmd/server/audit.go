@@ -0,0 +1,34 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/raisultan/abac/pkg/audit"
+)
+
+// runAuditCommand runs `audit verify`, printing the report and returning a
+// non-zero exit code when the chain is broken.
+func runAuditCommand(args []string, s audit.Service) int {
+	if len(args) != 1 || args[0] != "verify" {
+		fmt.Fprintln(os.Stderr, usage("audit verify"))
+		return 2
+	}
+
+	report, err := s.Verify(context.Background())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	enc.Encode(report)
+
+	if !report.OK {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"github.com/raisultan/abac/pkg/config"
+	"github.com/raisultan/abac/pkg/event"
+	"github.com/raisultan/abac/pkg/ldap"
+	"github.com/raisultan/abac/pkg/oidc"
+	"github.com/raisultan/abac/pkg/token"
+	"github.com/raisultan/abac/pkg/webauthn"
+)
+
+func tokenConfig(c config.Config) token.Config {
+	return token.Config{
+		AccessTTL:   c.Auth.AccessTokenTTL,
+		RefreshTTL:  c.Auth.RefreshTokenTTL,
+		Key:         []byte(c.Auth.JWTKey),
+		PreviousKey: []byte(c.Auth.PreviousJWTKey),
+	}
+}
+
+func eventConfig(c config.Config) event.Config {
+	return event.Config{
+		Sinks:        c.Events.Sinks,
+		WebhookURL:   c.Events.WebhookURL,
+		PollInterval: c.Events.PollInterval,
+		Retention:    c.Events.Retention,
+	}
+}
+
+func ldapConfig(c config.Config) ldap.Config {
+	lc := c.LDAP
+	return ldap.Config{
+		URL:             lc.URL,
+		StartTLS:        lc.StartTLS,
+		BindDNTemplate:  lc.BindDNTemplate,
+		BindDN:          lc.BindDN,
+		BindPassword:    lc.BindPassword,
+		UserBaseDN:      lc.UserBaseDN,
+		UserFilter:      lc.UserFilter,
+		EmailAttr:       lc.EmailAttr,
+		FirstNameAttr:   lc.FirstNameAttr,
+		LastNameAttr:    lc.LastNameAttr,
+		GroupBaseDN:     lc.GroupBaseDN,
+		GroupFilter:     lc.GroupFilter,
+		GroupNameAttr:   lc.GroupNameAttr,
+		GroupMemberAttr: lc.GroupMemberAttr,
+		SyncInterval:    lc.SyncInterval,
+	}
+}
+
+func oidcConfig(c config.Config) oidc.Config {
+	oc := c.OIDC
+	return oidc.Config{
+		Issuer:       oc.Issuer,
+		ClientID:     oc.ClientID,
+		ClientSecret: oc.ClientSecret,
+		RedirectURL:  oc.RedirectURL,
+		Scopes:       oc.Scopes,
+		Claims: oidc.ClaimMapping{
+			Email:     oc.EmailClaim,
+			FirstName: oc.FirstNameClaim,
+			LastName:  oc.LastNameClaim,
+			Groups:    oc.GroupsClaim,
+		},
+		GroupMapping:        oc.GroupMapping,
+		ProvisionUnverified: oc.ProvisionUnverified,
+	}
+}
+
+// webauthnConfig names the relying party after its ID and allows its
+// HTTPS origin unless they are set.
+func webauthnConfig(c config.Config) webauthn.Config {
+	wc := webauthn.Config{
+		RPID:                    c.WebAuthn.RPID,
+		RPName:                  c.WebAuthn.RPName,
+		Origins:                 c.WebAuthn.Origins,
+		RequireUserVerification: c.WebAuthn.RequireUserVerification,
+		Timeout:                 c.WebAuthn.Timeout,
+	}
+	if wc.RPName == "" {
+		wc.RPName = wc.RPID
+	}
+	if len(wc.Origins) == 0 && wc.RPID != "" {
+		wc.Origins = []string{"https://" + wc.RPID}
+	}
+	return wc
+}
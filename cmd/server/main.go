@@ -3,35 +3,58 @@ package main
 import (
 	"context"
 	"flag"
-	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
-	"time"
+	"syscall"
 
+	"github.com/raisultan/abac/pkg/attribute"
+	"github.com/raisultan/abac/pkg/audit"
+	"github.com/raisultan/abac/pkg/authorize"
+	"github.com/raisultan/abac/pkg/bulk"
+	"github.com/raisultan/abac/pkg/cache"
+	"github.com/raisultan/abac/pkg/config"
+	"github.com/raisultan/abac/pkg/deactivate"
 	"github.com/raisultan/abac/pkg/delete"
+	"github.com/raisultan/abac/pkg/event"
 	"github.com/raisultan/abac/pkg/http/rest"
 	"github.com/raisultan/abac/pkg/jwt_refresh"
+	"github.com/raisultan/abac/pkg/ldap"
 	"github.com/raisultan/abac/pkg/list"
 	"github.com/raisultan/abac/pkg/login"
+	"github.com/raisultan/abac/pkg/metrics"
+	"github.com/raisultan/abac/pkg/oauth"
+	"github.com/raisultan/abac/pkg/oidc"
 	"github.com/raisultan/abac/pkg/register"
+	"github.com/raisultan/abac/pkg/resource"
 	"github.com/raisultan/abac/pkg/retrieve"
-	"github.com/raisultan/abac/pkg/storage/postgres"
+	"github.com/raisultan/abac/pkg/scim"
+	"github.com/raisultan/abac/pkg/token"
+	"github.com/raisultan/abac/pkg/tracing"
 	"github.com/raisultan/abac/pkg/update"
+	"github.com/raisultan/abac/pkg/webauthn"
+	"github.com/raisultan/abac/pkg/webhook"
 )
 
-const defaultPort = ":8080"
-
 func main() {
-	var wait time.Duration
-	flag.DurationVar(
-		&wait,
-		"gracefulShutDown",
-		time.Second*15,
-		"duration during which server will try to gracefully shutdown",
-	)
-	flag.Parse()
+	conf, err := config.Load(flag.CommandLine, os.Args[1:])
+	if err != nil {
+		log.Fatal("loading configuration failed: ", err)
+	}
+	token.Configure(tokenConfig(conf))
+
+	flushSpans, err := tracing.Setup(context.Background(), tracing.Config{
+		Exporter:    conf.Tracing.Exporter,
+		Endpoint:    conf.Tracing.Endpoint,
+		Insecure:    conf.Tracing.Insecure,
+		SampleRatio: conf.Tracing.SampleRatio,
+		ServiceName: conf.Tracing.ServiceName,
+	})
+	if err != nil {
+		log.Fatal("setting up tracing failed: ", err)
+	}
 
 	var registerer register.Service
 	var loginer login.Service
@@ -40,16 +63,143 @@ func main() {
 	var retriever retrieve.Service
 	var updater update.Service
 	var deleter delete.Service
+	var deactivator deactivate.Service
+	var attributer attribute.Service
+	var resourcer resource.Service
+	var authorizer authorize.Service
+	var bulker bulk.Service
+	var auditor audit.Service
+	var eventer event.Service
+	var webhooker webhook.Service
+	var oauther oauth.Service
+	var oidcLoginer oidc.Service
+	var provisioner scim.Service
+	var passkeyLoginer webauthn.Service
+
+	migrating := flag.Arg(0) == "migrate"
+	s, err := newStorage(conf, migrating)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if migrating {
+		os.Exit(runMigrateCommand(flag.Args()[1:], s))
+	}
+	if p, ok := s.(pooled); ok {
+		metrics.RegisterDB(p.DB(), conf.Storage.Driver)
+	}
 
-	s, _ := postgres.NewStorage()
+	auditor = audit.NewService(s, []byte(conf.Audit.SigningKey))
+
+	if flag.Arg(0) == "audit" {
+		os.Exit(runAuditCommand(flag.Args()[1:], auditor))
+	}
+
+	// bgCtx stops background jobs on shutdown
+	bgCtx, stopBackground := context.WithCancel(context.Background())
+
+	var authenticators []login.Authenticator
+	if c := ldapConfig(conf); c.Enabled() {
+		d := ldap.NewDirectory(c)
+		authenticators = append(authenticators, d)
+
+		if c.GroupBaseDN != "" {
+			go ldap.NewSyncer(d, s).Run(bgCtx, c.SyncInterval)
+		}
+	}
 
 	registerer = register.NewService(s)
-	loginer = login.NewService(s)
+	loginer = login.NewService(s, authenticators...)
 	jwtRefresher = jwt_refresh.NewService(s)
 	lister = list.NewService(s)
 	retriever = retrieve.NewService(s)
 	updater = update.NewService(s)
-	deleter = delete.Service(s)
+	deleter = delete.NewService(s)
+	deactivator = deactivate.NewService(s)
+	attributer = attribute.NewService(s)
+	resourcer = resource.NewService(s)
+
+	ps, err := authorize.NewPolicySet(conf.Policy.File)
+	if err != nil {
+		log.Fatal(err)
+	}
+	policies := authorize.NewPolicies(ps)
+
+	// entries are dropped from the cache by the events of the changes. The
+	// dispatcher hands an event to the sinks of one server only, so when the
+	// database is shared every server listens for the events instead.
+	var decisions *cache.Cache
+	var cacheSink event.Sink
+	if conf.Cache.Size > 0 {
+		decisions = cache.New(cache.Config{Size: conf.Cache.Size, TTL: conf.Cache.TTL})
+		authorizer = decisions.Service(authorize.NewService(decisions.Subjects(attributer), resourcer, policies))
+		metrics.RegisterCache("decisions", func() (uint64, uint64, int) {
+			st := decisions.Stats().Decisions
+			return st.Hits, st.Misses, st.Size
+		})
+		metrics.RegisterCache("subjects", func() (uint64, uint64, int) {
+			st := decisions.Stats().Subjects
+			return st.Hits, st.Misses, st.Size
+		})
+
+		if l, ok := s.(eventListener); ok {
+			go func() {
+				if err := l.ListenEvents(bgCtx, decisions, decisions.Purge); err != nil {
+					log.Println("listening for events failed:", err)
+				}
+			}()
+		} else {
+			cacheSink = decisions
+		}
+	} else {
+		authorizer = authorize.NewService(attributer, resourcer, policies)
+	}
+
+	webhooker = webhook.NewService(s, nil)
+	go webhook.RunDeliveries(bgCtx, webhooker, conf.Webhooks.PollInterval, conf.Webhooks.Retention)
+
+	// webhook subscriptions are fed from the outbox, so it is always dispatched
+	ec := eventConfig(conf)
+	sinks, err := ec.NewSinks()
+	if err != nil {
+		log.Fatal(err)
+	}
+	sinks["subscriptions"] = webhook.NewSink(webhooker)
+	if cacheSink != nil {
+		sinks["cache"] = cacheSink
+	}
+	eventer = event.NewService(s, sinks)
+	if _, err := eventer.PublishPolicies(bgCtx, ps); err != nil {
+		log.Println("publishing policies failed:", err)
+	}
+	go event.RunDispatcher(bgCtx, eventer, ec.PollInterval, ec.Retention)
+
+	// SIGHUP and changes of the files reload the configuration and policies
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	r := &reloader{args: os.Args[1:], policies: policies, decisions: decisions, eventer: eventer, conf: conf}
+	go r.run(bgCtx, hup)
+	bulker = bulk.NewService(s)
+	oauther = oauth.NewService(s)
+	provisioner = scim.NewService(s, registerer, updater, deleter, deactivator)
+
+	go delete.RunPurge(bgCtx, deleter, conf.Users.Retention, conf.Users.PurgeInterval)
+
+	if conf.Audit.SigningKey != "" {
+		go audit.RunCheckpoints(bgCtx, auditor, conf.Audit.CheckpointInterval)
+	}
+
+	if c := webauthnConfig(conf); c.Enabled() {
+		passkeyLoginer = webauthn.NewService(s, c)
+	}
+
+	if c := oidcConfig(conf); c.Enabled() {
+		p, err := oidc.NewProvider(c)
+		if err != nil {
+			log.Fatal(err)
+		}
+		oidcLoginer = oidc.NewService(s, p)
+	}
 
 	router := rest.Handler(
 		registerer,
@@ -59,14 +209,30 @@ func main() {
 		retriever,
 		updater,
 		deleter,
+		deactivator,
+		attributer,
+		resourcer,
+		authorizer,
+		bulker,
+		auditor,
+		webhooker,
+		oauther,
+		oidcLoginer,
+		provisioner,
+		passkeyLoginer,
+		decisions,
 	)
 
+	// reqCtx cancels the requests still running once the shutdown wait is over
+	reqCtx, cancelRequests := context.WithCancel(context.Background())
+
 	srv := &http.Server{
-		Addr:         fmt.Sprintf("0.0.0.0%v", defaultPort),
-		WriteTimeout: time.Second * 15,
-		ReadTimeout:  time.Second * 15,
-		IdleTimeout:  time.Second * 60,
+		Addr:         conf.Server.Addr,
+		WriteTimeout: conf.Server.WriteTimeout,
+		ReadTimeout:  conf.Server.ReadTimeout,
+		IdleTimeout:  conf.Server.IdleTimeout,
 		Handler:      router,
+		BaseContext:  func(net.Listener) context.Context { return reqCtx },
 	}
 
 	go func() {
@@ -80,10 +246,15 @@ func main() {
 	signal.Notify(c, os.Interrupt)
 
 	<-c
+	stopBackground()
 
-	ctx, cancel := context.WithTimeout(context.Background(), wait)
+	ctx, cancel := context.WithTimeout(context.Background(), conf.Server.ShutdownTimeout)
 	defer cancel()
 	srv.Shutdown(ctx)
+	cancelRequests()
+	if err := flushSpans(ctx); err != nil {
+		log.Println("flushing spans failed:", err)
+	}
 	log.Println("shutting down")
 	os.Exit(0)
 }
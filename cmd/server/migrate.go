@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/raisultan/abac/pkg/storage/migrate"
+)
+
+// usage names the binary the way it was started.
+func usage(command string) string {
+	return fmt.Sprintf("usage: %s %s", filepath.Base(os.Args[0]), command)
+}
+
+var migrateUsage = usage("migrate up|down|status|goto N")
+
+// migrator is implemented by the backends with migrations.
+type migrator interface {
+	Migrator() (*migrate.Migrator, error)
+}
+
+// runMigrateCommand runs `migrate up|down|status|goto N` against the
+// storage, down reverts the last applied migration and goto 0 all of them.
+func runMigrateCommand(args []string, s repository) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		return 2
+	}
+
+	ms, ok := s.(migrator)
+	if !ok {
+		fmt.Fprintln(os.Stderr, "the storage driver has no migrations")
+		return 1
+	}
+	m, err := ms.Migrator()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	ctx := context.Background()
+	switch {
+	case args[0] == "up" && len(args) == 1:
+		err = m.Up(ctx)
+	case args[0] == "down" && len(args) == 1:
+		err = m.Down(ctx)
+	case args[0] == "goto" && len(args) == 2:
+		version, convErr := strconv.Atoi(args[1])
+		if convErr != nil {
+			fmt.Fprintln(os.Stderr, migrateUsage)
+			return 2
+		}
+		err = m.Goto(ctx, version)
+	case args[0] == "status" && len(args) == 1:
+		var status migrate.Status
+		if status, err = m.Status(ctx); err == nil {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			enc.Encode(status)
+		}
+	default:
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		return 2
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"io/ioutil"
+	"log"
+	"os"
+	"reflect"
+	"sync"
+
+	"github.com/raisultan/abac/pkg/authorize"
+	"github.com/raisultan/abac/pkg/cache"
+	"github.com/raisultan/abac/pkg/config"
+	"github.com/raisultan/abac/pkg/event"
+	"github.com/raisultan/abac/pkg/token"
+)
+
+// reloader swaps the configuration and the policies the server runs with
+// for the ones in their files, nothing is swapped unless both are valid.
+// Only the token settings and the policies apply right away, the rest of
+// the configuration on restart.
+type reloader struct {
+	args      []string
+	policies  *authorize.Policies
+	decisions *cache.Cache
+	eventer   event.Service
+
+	mu   sync.Mutex
+	conf config.Config
+}
+
+// run reloads on every signal from hup and, with a watch interval, every
+// change of the configuration or policy file until ctx is done.
+func (r *reloader) run(ctx context.Context, hup <-chan os.Signal) {
+	changed := make(chan struct{}, 1)
+	if files := r.files(); len(files) > 0 && r.conf.Server.WatchInterval > 0 {
+		go config.RunWatcher(ctx, files, r.conf.Server.WatchInterval, func() {
+			select {
+			case changed <- struct{}{}:
+			default:
+			}
+		})
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+		case <-changed:
+		}
+
+		if err := r.reload(ctx); err != nil {
+			log.Println("reloading configuration failed, keeping the current one:", err)
+			continue
+		}
+		log.Println("configuration reloaded")
+	}
+}
+
+func (r *reloader) reload(ctx context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	fs := flag.NewFlagSet("main", flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	c, err := config.Load(fs, r.args)
+	if err != nil {
+		return err
+	}
+	ps, err := authorize.NewPolicySet(c.Policy.File)
+	if err != nil {
+		return err
+	}
+
+	if restartNeeded(r.conf, c) {
+		log.Println("settings besides the tokens and policies changed, they take effect on restart")
+	}
+
+	token.Configure(tokenConfig(c))
+	r.policies.Store(ps)
+	r.conf = c
+
+	// the policy.published event is only emitted by the first server to
+	// load the new policies, the others drop their decisions themselves
+	if r.decisions != nil {
+		r.decisions.PurgeDecisions()
+	}
+
+	if _, err := r.eventer.PublishPolicies(ctx, ps); err != nil {
+		log.Println("publishing policies failed:", err)
+	}
+	return nil
+}
+
+func (r *reloader) files() []string {
+	var files []string
+	for _, f := range []string{r.conf.Path, r.conf.Policy.File} {
+		if f != "" {
+			files = append(files, f)
+		}
+	}
+	return files
+}
+
+// restartNeeded reports whether settings changed that only apply on
+// restart, which is all of them but the token settings and the policy file.
+func restartNeeded(old, c config.Config) bool {
+	old.Auth.AccessTokenTTL, old.Auth.RefreshTokenTTL = c.Auth.AccessTokenTTL, c.Auth.RefreshTokenTTL
+	old.Auth.JWTKey, old.Auth.PreviousJWTKey = c.Auth.JWTKey, c.Auth.PreviousJWTKey
+	old.Auth.InsecureDevKey = c.Auth.InsecureDevKey
+	old.Policy = c.Policy
+	return !reflect.DeepEqual(old, c)
+}
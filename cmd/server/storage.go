@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/raisultan/abac/pkg/attribute"
+	"github.com/raisultan/abac/pkg/audit"
+	"github.com/raisultan/abac/pkg/bulk"
+	"github.com/raisultan/abac/pkg/config"
+	"github.com/raisultan/abac/pkg/deactivate"
+	"github.com/raisultan/abac/pkg/delete"
+	"github.com/raisultan/abac/pkg/event"
+	"github.com/raisultan/abac/pkg/jwt_refresh"
+	"github.com/raisultan/abac/pkg/ldap"
+	"github.com/raisultan/abac/pkg/list"
+	"github.com/raisultan/abac/pkg/login"
+	"github.com/raisultan/abac/pkg/oauth"
+	"github.com/raisultan/abac/pkg/oidc"
+	"github.com/raisultan/abac/pkg/register"
+	"github.com/raisultan/abac/pkg/resource"
+	"github.com/raisultan/abac/pkg/retrieve"
+	"github.com/raisultan/abac/pkg/scim"
+	"github.com/raisultan/abac/pkg/storage"
+	"github.com/raisultan/abac/pkg/storage/memory"
+	"github.com/raisultan/abac/pkg/storage/postgres"
+	"github.com/raisultan/abac/pkg/storage/sqlite"
+	"github.com/raisultan/abac/pkg/update"
+	"github.com/raisultan/abac/pkg/webauthn"
+	"github.com/raisultan/abac/pkg/webhook"
+)
+
+// repository is what the services are built on, every storage backend
+// implements all of it.
+type repository interface {
+	storage.Transactor
+
+	attribute.Repository
+	audit.Repository
+	bulk.Repository
+	deactivate.Repository
+	delete.Repository
+	event.Repository
+	jwt_refresh.Repository
+	ldap.Repository
+	list.Repository
+	login.Repository
+	oauth.Repository
+	oidc.Repository
+	register.Repository
+	resource.Repository
+	retrieve.Repository
+	scim.Repository
+	update.Repository
+	webauthn.Repository
+	webhook.Repository
+}
+
+// newStorage opens the configured backend. Unless migrating, which leaves the
+// schema to the migrate command, it migrates and seeds the admin as
+// configured.
+func newStorage(c config.Config, migrating bool) (repository, error) {
+	sc := c.Storage
+	switch sc.Driver {
+	case storage.Postgres:
+		s, err := postgres.NewStorage(postgres.Config{
+			URL:             c.Postgres.URL,
+			MaxOpenConns:    c.Postgres.MaxOpenConns,
+			MaxIdleConns:    c.Postgres.MaxIdleConns,
+			ConnMaxLifetime: c.Postgres.ConnMaxLifetime,
+			BcryptCost:      c.Auth.BcryptCost,
+		})
+		if err != nil {
+			return nil, err
+		}
+		if sc.AutoMigrate && !migrating {
+			m, err := s.Migrator()
+			if err != nil {
+				return nil, err
+			}
+			if err := m.Up(context.Background()); err != nil {
+				return nil, err
+			}
+		}
+		return s, nil
+	case storage.Memory:
+		s := memory.NewStorage()
+		if sc.AdminEmail != "" {
+			if err := seedAdmin(s, sc.AdminEmail, sc.AdminPassword); err != nil {
+				return nil, err
+			}
+		}
+		return s, nil
+	case storage.SQLite:
+		s, err := sqlite.NewStorage(sqlite.Config{
+			Path:           sc.SQLitePath,
+			BcryptCost:     c.Auth.BcryptCost,
+			SkipMigrations: migrating,
+		})
+		if err != nil {
+			return nil, err
+		}
+		if sc.AdminEmail != "" && !migrating {
+			if err := seedAdmin(s, sc.AdminEmail, sc.AdminPassword); err != nil {
+				return nil, err
+			}
+		}
+		return s, nil
+	}
+
+	return nil, fmt.Errorf("%w: %s", storage.UnknownDriverErr, sc.Driver)
+}
+
+// eventListener is implemented by the backends that tell every server
+// sharing the database about the events appended to it.
+type eventListener interface {
+	ListenEvents(ctx context.Context, sink event.Sink, reconnected func()) error
+}
+
+// pooled is implemented by the backends with a connection pool.
+type pooled interface {
+	DB() *sql.DB
+}
+
+// adminSeeder is implemented by the backends that can create the admin.
+type adminSeeder interface {
+	repository
+	SetUserAdmin(ctx context.Context, id int, admin bool) error
+}
+
+// seedAdmin creates the admin unless a user with the email already exists,
+// the SQLite database outlives restarts.
+func seedAdmin(s adminSeeder, email, password string) error {
+	ctx := context.Background()
+	exists, err := s.CheckUserExists(ctx, register.UserRegisterRequest{Email: email})
+	if err != nil || exists {
+		return err
+	}
+
+	u, err := s.CreateUser(ctx, register.UserRegisterRequest{
+		Email:     email,
+		Password:  password,
+		FirstName: "Admin",
+		LastName:  "Admin",
+	})
+	if err != nil {
+		return err
+	}
+
+	if _, _, err := s.ApproveUser(ctx, u.ID); err != nil {
+		return err
+	}
+	return s.SetUserAdmin(ctx, u.ID, true)
+}
@@ -0,0 +1,72 @@
+package attribute
+
+import (
+	"errors"
+	"regexp"
+)
+
+const (
+	StringType = "string"
+	IntType    = "int"
+	BoolType   = "bool"
+	EnumType   = "enum"
+	ListType   = "list"
+)
+
+var InvalidDefinitionErr = errors.New("Invalid attribute definition")
+var ReservedNameErr = errors.New("Attribute name is reserved")
+var UnknownAttributeErr = errors.New("Unknown attribute")
+
+var nameRe = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9_]{0,62}$`)
+
+// reservedNames are the subject attributes every user has, custom
+// attributes can not shadow them.
+var reservedNames = map[string]bool{
+	"id":         true,
+	"email":      true,
+	"firstName":  true,
+	"lastName":   true,
+	"isAdmin":    true,
+	"isApproved": true,
+	"groups":     true,
+}
+
+// Definition describes a custom user attribute. Values restricts enum
+// values and list items when set.
+type Definition struct {
+	Name        string      `json:"name"`
+	Type        string      `json:"type"`
+	Required    bool        `json:"required"`
+	Default     interface{} `json:"default,omitempty"`
+	Values      []string    `json:"values,omitempty"`
+	Description string      `json:"description,omitempty"`
+}
+
+func (d *Definition) validate() error {
+	if !nameRe.MatchString(d.Name) {
+		return InvalidDefinitionErr
+	}
+	if reservedNames[d.Name] {
+		return ReservedNameErr
+	}
+
+	switch d.Type {
+	case StringType, IntType, BoolType, ListType:
+	case EnumType:
+		if len(d.Values) == 0 {
+			return InvalidDefinitionErr
+		}
+	default:
+		return InvalidDefinitionErr
+	}
+
+	if d.Default != nil {
+		v, err := d.coerce(d.Default)
+		if err != nil {
+			return InvalidDefinitionErr
+		}
+		d.Default = v
+	}
+
+	return nil
+}
@@ -0,0 +1,199 @@
+package attribute
+
+import (
+	"context"
+
+	"github.com/raisultan/abac/pkg/event"
+	"github.com/raisultan/abac/pkg/storage"
+)
+
+// Subject is a user as seen by the decision point.
+type Subject struct {
+	ID         int
+	Email      string
+	FirstName  string
+	LastName   string
+	IsAdmin    bool
+	IsApproved bool
+	Groups     []string
+	Attributes map[string]interface{}
+}
+
+type Service interface {
+	ListDefinitions(ctx context.Context) ([]Definition, error)
+	SaveDefinition(context.Context, Definition) (Definition, error)
+	DeleteDefinition(ctx context.Context, name string) error
+
+	GetUserAttributes(ctx context.Context, userID int) (map[string]interface{}, error)
+	ReplaceUserAttributes(ctx context.Context, userID int, attrs map[string]interface{}) (map[string]interface{}, error)
+	PatchUserAttributes(ctx context.Context, userID int, patch map[string]interface{}) (map[string]interface{}, error)
+
+	// SubjectAttributes returns the built-in and custom attributes of the
+	// user with the given email, ready to be used in policy decisions.
+	SubjectAttributes(ctx context.Context, email string) (map[string]interface{}, error)
+}
+
+type Repository interface {
+	storage.Transactor
+
+	ListAttributeDefinitions(ctx context.Context) ([]Definition, error)
+	SaveAttributeDefinition(context.Context, Definition) error
+	DeleteAttributeDefinition(ctx context.Context, name string) error
+
+	GetUserAttributes(ctx context.Context, userID int) (map[string]interface{}, error)
+	// GetUserAttributesForUpdate keeps other writers off the attributes
+	// until the transaction ends.
+	GetUserAttributesForUpdate(ctx context.Context, userID int) (map[string]interface{}, error)
+	SetUserAttributes(ctx context.Context, userID int, attrs map[string]interface{}) error
+	GetSubject(ctx context.Context, email string) (Subject, error)
+
+	AppendEvent(context.Context, event.Event) error
+}
+
+type service struct {
+	r Repository
+}
+
+func NewService(r Repository) Service {
+	return &service{r}
+}
+
+func (s *service) ListDefinitions(ctx context.Context) ([]Definition, error) {
+	return s.r.ListAttributeDefinitions(ctx)
+}
+
+func (s *service) SaveDefinition(ctx context.Context, d Definition) (Definition, error) {
+	if err := d.validate(); err != nil {
+		return Definition{}, err
+	}
+	err := s.r.WithinTx(ctx, func(ctx context.Context) error {
+		if err := s.r.SaveAttributeDefinition(ctx, d); err != nil {
+			return err
+		}
+		return s.r.AppendEvent(ctx, event.New(event.AttributeSaved, event.AttributeSubject(d.Name), d))
+	})
+	if err != nil {
+		return Definition{}, err
+	}
+	return d, nil
+}
+
+func (s *service) DeleteDefinition(ctx context.Context, name string) error {
+	return s.r.WithinTx(ctx, func(ctx context.Context) error {
+		if err := s.r.DeleteAttributeDefinition(ctx, name); err != nil {
+			return err
+		}
+		return s.r.AppendEvent(ctx, event.New(
+			event.AttributeDeleted,
+			event.AttributeSubject(name),
+			map[string]interface{}{"name": name},
+		))
+	})
+}
+
+func (s *service) GetUserAttributes(ctx context.Context, userID int) (map[string]interface{}, error) {
+	defs, err := s.r.ListAttributeDefinitions(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	attrs, err := s.r.GetUserAttributes(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return withDefaults(defs, attrs), nil
+}
+
+func (s *service) ReplaceUserAttributes(ctx context.Context, userID int, attrs map[string]interface{}) (map[string]interface{}, error) {
+	defs, err := s.r.ListAttributeDefinitions(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	valid, err := Validate(defs, attrs)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.setUserAttributes(ctx, userID, valid); err != nil {
+		return nil, err
+	}
+
+	return withDefaults(defs, valid), nil
+}
+
+// PatchUserAttributes merges patch into the stored attributes, null values
+// remove an attribute. Stored values of deleted definitions are dropped.
+func (s *service) PatchUserAttributes(ctx context.Context, userID int, patch map[string]interface{}) (map[string]interface{}, error) {
+	var defs []Definition
+	var valid map[string]interface{}
+
+	err := s.r.WithinTx(ctx, func(ctx context.Context) error {
+		var err error
+		defs, err = s.r.ListAttributeDefinitions(ctx)
+		if err != nil {
+			return err
+		}
+
+		attrs, err := s.r.GetUserAttributesForUpdate(ctx, userID)
+		if err != nil {
+			return err
+		}
+
+		attrs = defined(defs, attrs)
+		for k, v := range patch {
+			if v == nil {
+				delete(attrs, k)
+			} else {
+				attrs[k] = v
+			}
+		}
+
+		valid, err = Validate(defs, attrs)
+		if err != nil {
+			return err
+		}
+		return s.setUserAttributes(ctx, userID, valid)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return withDefaults(defs, valid), nil
+}
+
+func (s *service) setUserAttributes(ctx context.Context, userID int, attrs map[string]interface{}) error {
+	return s.r.WithinTx(ctx, func(ctx context.Context) error {
+		if err := s.r.SetUserAttributes(ctx, userID, attrs); err != nil {
+			return err
+		}
+		return s.r.AppendEvent(ctx, event.New(
+			event.UserAttributesUpdated,
+			event.UserSubject(userID),
+			map[string]interface{}{"id": userID, "attributes": attrs},
+		))
+	})
+}
+
+func (s *service) SubjectAttributes(ctx context.Context, email string) (map[string]interface{}, error) {
+	defs, err := s.r.ListAttributeDefinitions(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	sub, err := s.r.GetSubject(ctx, email)
+	if err != nil {
+		return nil, err
+	}
+
+	attrs := withDefaults(defs, sub.Attributes)
+	attrs["id"] = int64(sub.ID)
+	attrs["email"] = sub.Email
+	attrs["firstName"] = sub.FirstName
+	attrs["lastName"] = sub.LastName
+	attrs["isAdmin"] = sub.IsAdmin
+	attrs["isApproved"] = sub.IsApproved
+	attrs["groups"] = sub.Groups
+
+	return attrs, nil
+}
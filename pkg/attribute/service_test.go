@@ -0,0 +1,99 @@
+package attribute_test
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/raisultan/abac/pkg/attribute"
+	"github.com/raisultan/abac/pkg/register"
+	"github.com/raisultan/abac/pkg/storage/memory"
+)
+
+func setup(t *testing.T, names ...string) (attribute.Service, *memory.Storage, int) {
+	s := memory.NewStorage()
+	u, err := s.CreateUser(context.Background(), register.UserRegisterRequest{
+		Email:    "ada@example.com",
+		Password: "password",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	svc := attribute.NewService(s)
+	for _, name := range names {
+		if _, err := svc.SaveDefinition(context.Background(), attribute.Definition{Name: name, Type: attribute.StringType}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return svc, s, u.ID
+}
+
+func TestPatchUserAttributesAfterDeletedDefinition(t *testing.T) {
+	ctx := context.Background()
+	svc, s, id := setup(t, "clearance", "team")
+
+	if _, err := svc.PatchUserAttributes(ctx, id, map[string]interface{}{"clearance": "high", "team": "red"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.DeleteDefinition(ctx, "team"); err != nil {
+		t.Fatal(err)
+	}
+	attrs, err := svc.PatchUserAttributes(ctx, id, map[string]interface{}{"clearance": "low"})
+	if err != nil {
+		t.Fatalf("patching after deleting a definition: %v", err)
+	}
+	if len(attrs) != 1 || attrs["clearance"] != "low" {
+		t.Errorf("got %v, want clearance low", attrs)
+	}
+
+	// values a definition left behind, from before it was deleted, do not
+	// block the user either
+	if err := s.SetUserAttributes(ctx, id, map[string]interface{}{"clearance": "low", "team": "red"}); err != nil {
+		t.Fatal(err)
+	}
+	if attrs, err := svc.PatchUserAttributes(ctx, id, map[string]interface{}{"clearance": "high"}); err != nil || len(attrs) != 1 {
+		t.Errorf("patching over a left behind value: got %v (%v), want clearance high", attrs, err)
+	}
+	stored, err := s.GetUserAttributes(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := stored["team"]; ok {
+		t.Errorf("stored %v, want the left behind value dropped", stored)
+	}
+
+	if _, err := svc.PatchUserAttributes(ctx, id, map[string]interface{}{"team": "blue"}); err == nil {
+		t.Error("patched an attribute without a definition")
+	}
+}
+
+func TestPatchUserAttributesConcurrently(t *testing.T) {
+	const n = 20
+	names := []string{}
+	for i := 0; i < n; i++ {
+		names = append(names, fmt.Sprintf("attr%d", i))
+	}
+	svc, _, id := setup(t, names...)
+
+	var wg sync.WaitGroup
+	for _, name := range names {
+		wg.Add(1)
+		go func(name string) {
+			defer wg.Done()
+			if _, err := svc.PatchUserAttributes(context.Background(), id, map[string]interface{}{name: "x"}); err != nil {
+				t.Error(err)
+			}
+		}(name)
+	}
+	wg.Wait()
+
+	attrs, err := svc.GetUserAttributes(context.Background(), id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(attrs) != n {
+		t.Errorf("%d of %d attributes kept, concurrent patches were lost", len(attrs), n)
+	}
+}
@@ -0,0 +1,187 @@
+package attribute
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+type FieldError struct {
+	Field string `json:"field"`
+	Error string `json:"error"`
+}
+
+// ValidationErr lists every attribute that does not match the schema.
+type ValidationErr struct {
+	Details []FieldError `json:"details"`
+}
+
+func (e *ValidationErr) Error() string {
+	msgs := []string{}
+	for _, d := range e.Details {
+		msgs = append(msgs, d.Error)
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Validate checks attrs against the schema and returns them with values
+// converted to their canonical Go types: string, int64, bool and []string.
+func Validate(defs []Definition, attrs map[string]interface{}) (map[string]interface{}, error) {
+	byName := map[string]Definition{}
+	for _, d := range defs {
+		byName[d.Name] = d
+	}
+
+	out := map[string]interface{}{}
+	errs := []FieldError{}
+
+	names := make([]string, 0, len(attrs))
+	for n := range attrs {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+
+	for _, n := range names {
+		d, ok := byName[n]
+		if !ok {
+			errs = append(errs, FieldError{n, fmt.Sprintf("%s is not a known attribute", n)})
+			continue
+		}
+		if attrs[n] == nil {
+			continue
+		}
+
+		v, err := d.coerce(attrs[n])
+		if err != nil {
+			errs = append(errs, FieldError{n, err.Error()})
+			continue
+		}
+		out[n] = v
+	}
+
+	for _, d := range defs {
+		if _, ok := out[d.Name]; !ok && d.Required && d.Default == nil {
+			errs = append(errs, FieldError{d.Name, fmt.Sprintf("%s is a required attribute", d.Name)})
+		}
+	}
+
+	if len(errs) > 0 {
+		return nil, &ValidationErr{errs}
+	}
+	return out, nil
+}
+
+// defined returns the attributes that have a definition.
+func defined(defs []Definition, attrs map[string]interface{}) map[string]interface{} {
+	out := map[string]interface{}{}
+	for _, d := range defs {
+		if v, ok := attrs[d.Name]; ok {
+			out[d.Name] = v
+		}
+	}
+	return out
+}
+
+// withDefaults returns the stored attributes that still match the schema,
+// with defaults filled in for the missing ones.
+func withDefaults(defs []Definition, attrs map[string]interface{}) map[string]interface{} {
+	out := map[string]interface{}{}
+	for _, d := range defs {
+		if raw, ok := attrs[d.Name]; ok && raw != nil {
+			if v, err := d.coerce(raw); err == nil {
+				out[d.Name] = v
+				continue
+			}
+		}
+		if d.Default != nil {
+			if v, err := d.coerce(d.Default); err == nil {
+				out[d.Name] = v
+			}
+		}
+	}
+	return out
+}
+
+func (d Definition) coerce(v interface{}) (interface{}, error) {
+	switch d.Type {
+	case StringType:
+		if s, ok := v.(string); ok {
+			return s, nil
+		}
+	case BoolType:
+		if b, ok := v.(bool); ok {
+			return b, nil
+		}
+	case IntType:
+		if i, ok := toInt(v); ok {
+			return i, nil
+		}
+	case EnumType:
+		if s, ok := v.(string); ok {
+			if !contains(d.Values, s) {
+				return nil, fmt.Errorf("%s must be one of [%s]", d.Name, strings.Join(d.Values, " "))
+			}
+			return s, nil
+		}
+	case ListType:
+		items, ok := toStrings(v)
+		if !ok {
+			break
+		}
+		for _, s := range items {
+			if len(d.Values) > 0 && !contains(d.Values, s) {
+				return nil, fmt.Errorf("%s items must be one of [%s]", d.Name, strings.Join(d.Values, " "))
+			}
+		}
+		return items, nil
+	}
+
+	return nil, fmt.Errorf("%s must be of type %s", d.Name, d.Type)
+}
+
+func toInt(v interface{}) (int64, bool) {
+	switch n := v.(type) {
+	case int:
+		return int64(n), true
+	case int64:
+		return n, true
+	case float64:
+		if n != math.Trunc(n) || math.Abs(n) > 1<<53 {
+			return 0, false
+		}
+		return int64(n), true
+	case json.Number:
+		i, err := n.Int64()
+		return i, err == nil
+	}
+	return 0, false
+}
+
+func toStrings(v interface{}) ([]string, bool) {
+	switch l := v.(type) {
+	case []string:
+		return l, true
+	case []interface{}:
+		items := make([]string, 0, len(l))
+		for _, i := range l {
+			s, ok := i.(string)
+			if !ok {
+				return nil, false
+			}
+			items = append(items, s)
+		}
+		return items, true
+	}
+	return nil, false
+}
+
+func contains(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
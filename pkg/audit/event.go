@@ -0,0 +1,84 @@
+package audit
+
+import (
+	"encoding/json"
+	"reflect"
+	"time"
+)
+
+const (
+	LoginEvent         = "login"
+	TokenRefreshEvent  = "token.refresh"
+	UserCreateEvent    = "user.create"
+	UserUpdateEvent    = "user.update"
+	UserDeleteEvent    = "user.delete"
+	UserRestoreEvent   = "user.restore"
+	UserDisableEvent   = "user.deactivate"
+	UserEnableEvent    = "user.activate"
+	UserApproveEvent   = "user.approve"
+	UserAttrsEvent     = "user.attributes"
+	UserImportEvent    = "user.import"
+	AuthorizationEvent = "authorization"
+
+	Success = "success"
+	Failure = "failure"
+	Allow   = "allow"
+	Deny    = "deny"
+)
+
+// Event is a single audit record. Actor is who made the request, a user
+// email or "client:<id>" for OAuth clients, Subject whom it was about.
+type Event struct {
+	ID         int64                  `json:"id"`
+	Time       time.Time              `json:"time"`
+	Type       string                 `json:"type"`
+	Actor      string                 `json:"actor,omitempty"`
+	Subject    string                 `json:"subject,omitempty"`
+	Action     string                 `json:"action,omitempty"`
+	Resource   string                 `json:"resource,omitempty"`
+	Result     string                 `json:"result"`
+	RemoteAddr string                 `json:"remoteAddr,omitempty"`
+	Details    map[string]interface{} `json:"details,omitempty"`
+
+	// PrevHash and Hash chain every event to the one before it
+	PrevHash Hash `json:"prevHash,omitempty"`
+	Hash     Hash `json:"hash,omitempty"`
+}
+
+type Change struct {
+	From interface{} `json:"from"`
+	To   interface{} `json:"to"`
+}
+
+// Diff compares the JSON representation of two values and returns the
+// fields that differ.
+func Diff(before, after interface{}) map[string]interface{} {
+	b, a := toMap(before), toMap(after)
+	diff := map[string]interface{}{}
+
+	for k, v := range a {
+		if !reflect.DeepEqual(b[k], v) {
+			diff[k] = Change{From: b[k], To: v}
+		}
+	}
+	for k, v := range b {
+		if _, ok := a[k]; !ok {
+			diff[k] = Change{From: v, To: nil}
+		}
+	}
+
+	return diff
+}
+
+func toMap(v interface{}) map[string]interface{} {
+	m := map[string]interface{}{}
+	if v == nil {
+		return m
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return m
+	}
+	json.Unmarshal(b, &m)
+	return m
+}
@@ -0,0 +1,167 @@
+package audit
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+)
+
+var SigningKeyRequiredErr = errors.New("Audit signing key is not configured")
+
+const (
+	DefaultLimit = 100
+	MaxLimit     = 1000
+)
+
+type ListRequest struct {
+	Type     string
+	Actor    string
+	Subject  string
+	Resource string
+	Result   string
+	From     *time.Time
+	To       *time.Time
+
+	// Before lists events older than the event with this ID
+	Before int64
+	Limit  int
+}
+
+type ListResponse struct {
+	Data []Event `json:"data"`
+	Next string  `json:"next,omitempty"`
+
+	NextBefore int64 `json:"-"`
+}
+
+type Service interface {
+	// Record stores an event. Failures are logged rather than returned so
+	// auditing never fails the request being audited.
+	Record(context.Context, Event)
+	ListEvents(context.Context, ListRequest) (ListResponse, error)
+
+	// Checkpoint signs the current end of the chain unless it already is.
+	Checkpoint(ctx context.Context) (created bool, err error)
+
+	// Verify walks the whole chain and checks every link and checkpoint.
+	Verify(ctx context.Context) (VerifyReport, error)
+}
+
+type Repository interface {
+	// AppendAuditEvent assigns the event its ID and chains it to the last
+	// event with HashEvent, appends are serialized so the chain stays linear.
+	AppendAuditEvent(context.Context, Event) error
+	ListAuditEvents(context.Context, ListRequest) ([]Event, error)
+	ListAuditEventsAfter(ctx context.Context, afterID int64, limit int) ([]Event, error)
+	LastAuditEvent(ctx context.Context) (Event, error)
+
+	// AuditChainStart returns the ID the chain starts at, events before it
+	// were recorded before chaining was introduced and have no hash.
+	AuditChainStart(ctx context.Context) (int64, error)
+
+	CreateAuditCheckpoint(context.Context, Checkpoint) error
+	ListAuditCheckpoints(ctx context.Context) ([]Checkpoint, error)
+}
+
+type service struct {
+	r   Repository
+	key []byte
+}
+
+// NewService creates the audit service, key signs checkpoints and can be
+// empty when checkpoints are not used.
+func NewService(r Repository, key []byte) Service {
+	return &service{r, key}
+}
+
+func (s *service) Record(ctx context.Context, e Event) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	if err := s.r.AppendAuditEvent(detached{ctx}, e); err != nil {
+		log.Printf("recording %s audit event failed: %s", e.Type, err)
+	}
+}
+
+// detached keeps the values of a context but not its cancellation, so
+// events are recorded even when the client has gone away.
+type detached struct {
+	context.Context
+}
+
+func (detached) Deadline() (time.Time, bool) { return time.Time{}, false }
+func (detached) Done() <-chan struct{}       { return nil }
+func (detached) Err() error                  { return nil }
+
+func (s *service) ListEvents(ctx context.Context, lr ListRequest) (ListResponse, error) {
+	if lr.Limit < 1 {
+		lr.Limit = DefaultLimit
+	}
+	if lr.Limit > MaxLimit {
+		lr.Limit = MaxLimit
+	}
+
+	page := lr
+	page.Limit++
+	events, err := s.r.ListAuditEvents(ctx, page)
+	if err != nil {
+		return ListResponse{}, err
+	}
+
+	resp := ListResponse{Data: events}
+	if len(events) > lr.Limit {
+		resp.Data = events[:lr.Limit]
+		resp.NextBefore = resp.Data[lr.Limit-1].ID
+	}
+
+	return resp, nil
+}
+
+func (s *service) Checkpoint(ctx context.Context) (bool, error) {
+	if len(s.key) == 0 {
+		return false, SigningKeyRequiredErr
+	}
+
+	last, err := s.r.LastAuditEvent(ctx)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil || last.Hash == nil {
+		return false, err
+	}
+
+	checkpoints, err := s.r.ListAuditCheckpoints(ctx)
+	if err != nil {
+		return false, err
+	}
+	if n := len(checkpoints); n > 0 && checkpoints[n-1].LastEventID == last.ID {
+		return false, nil
+	}
+
+	err = s.r.CreateAuditCheckpoint(ctx, Checkpoint{
+		LastEventID: last.ID,
+		Hash:        last.Hash,
+		Signature:   signCheckpoint(s.key, last.ID, last.Hash),
+	})
+	return err == nil, err
+}
+
+// RunCheckpoints creates a checkpoint every interval until ctx is done.
+func RunCheckpoints(ctx context.Context, s Service, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+
+		if _, err := s.Checkpoint(ctx); err != nil {
+			log.Println("creating audit checkpoint failed:", err)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+)
+
+const verifyBatchSize = 1000
+
+// VerifyReport is the result of walking the chain. Broken is set for the
+// first event or checkpoint that does not match.
+type VerifyReport struct {
+	OK                 bool        `json:"ok"`
+	EventsChecked      int         `json:"eventsChecked"`
+	UnchainedEvents    int         `json:"unchainedEvents"`
+	CheckpointsChecked int         `json:"checkpointsChecked"`
+	Broken             *BrokenLink `json:"broken,omitempty"`
+}
+
+type BrokenLink struct {
+	EventID      int64  `json:"eventId,omitempty"`
+	CheckpointID int64  `json:"checkpointId,omitempty"`
+	Reason       string `json:"reason"`
+}
+
+func (s *service) Verify(ctx context.Context) (VerifyReport, error) {
+	report := VerifyReport{}
+
+	checkpoints, err := s.r.ListAuditCheckpoints(ctx)
+	if err != nil {
+		return report, err
+	}
+	byEvent := map[int64][]Checkpoint{}
+	for _, c := range checkpoints {
+		byEvent[c.LastEventID] = append(byEvent[c.LastEventID], c)
+	}
+
+	start, err := s.r.AuditChainStart(ctx)
+	if err != nil {
+		return report, err
+	}
+
+	var prev []byte
+	var afterID int64
+
+	for {
+		events, err := s.r.ListAuditEventsAfter(ctx, afterID, verifyBatchSize)
+		if err != nil {
+			return report, err
+		}
+
+		for _, e := range events {
+			afterID = e.ID
+			report.EventsChecked++
+
+			// only events recorded before chaining was introduced have no hash
+			if e.ID < start {
+				report.UnchainedEvents++
+				continue
+			}
+			if e.Hash == nil {
+				report.Broken = &BrokenLink{EventID: e.ID, Reason: "event has no hash"}
+				return report, nil
+			}
+
+			// the first event links to nothing, so events cut off the start
+			// of the chain are caught as well
+			if !bytes.Equal(e.PrevHash, prev) {
+				reason := "previous hash does not match the previous event"
+				if prev == nil {
+					reason = "first event of the chain links to a missing event"
+				}
+				report.Broken = &BrokenLink{EventID: e.ID, Reason: reason}
+				return report, nil
+			}
+			if !bytes.Equal(HashEvent(e.PrevHash, e), e.Hash) {
+				report.Broken = &BrokenLink{EventID: e.ID, Reason: "hash does not match the event"}
+				return report, nil
+			}
+			prev = e.Hash
+
+			for _, c := range byEvent[e.ID] {
+				if !bytes.Equal(c.Hash, e.Hash) {
+					report.Broken = &BrokenLink{CheckpointID: c.ID, EventID: e.ID, Reason: "checkpoint hash does not match the event"}
+					return report, nil
+				}
+			}
+			delete(byEvent, e.ID)
+		}
+
+		if len(events) < verifyBatchSize {
+			break
+		}
+	}
+
+	for _, c := range checkpoints {
+		if _, missing := byEvent[c.LastEventID]; missing {
+			report.Broken = &BrokenLink{CheckpointID: c.ID, EventID: c.LastEventID, Reason: "checkpointed event is missing"}
+			return report, nil
+		}
+		if len(s.key) > 0 && !hmac.Equal(signCheckpoint(s.key, c.LastEventID, c.Hash), c.Signature) {
+			report.Broken = &BrokenLink{CheckpointID: c.ID, Reason: "checkpoint signature is invalid"}
+			return report, nil
+		}
+		report.CheckpointsChecked++
+	}
+
+	report.OK = true
+	return report, nil
+}
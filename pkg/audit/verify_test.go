@@ -0,0 +1,141 @@
+package audit_test
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/raisultan/abac/pkg/audit"
+)
+
+// chain is a repository whose stored events a test can change at will,
+// like someone with access to the database.
+type chain struct {
+	start       int64
+	events      []audit.Event
+	checkpoints []audit.Checkpoint
+}
+
+func (c *chain) AppendAuditEvent(ctx context.Context, e audit.Event) error {
+	var prev audit.Hash
+	e.ID = c.start
+	if n := len(c.events); n > 0 {
+		prev = c.events[n-1].Hash
+		e.ID = c.events[n-1].ID + 1
+	}
+	e.PrevHash = prev
+	e.Hash = audit.HashEvent(prev, e)
+	c.events = append(c.events, e)
+	return nil
+}
+
+func (c *chain) ListAuditEvents(ctx context.Context, lr audit.ListRequest) ([]audit.Event, error) {
+	return nil, nil
+}
+
+func (c *chain) ListAuditEventsAfter(ctx context.Context, afterID int64, limit int) ([]audit.Event, error) {
+	events := []audit.Event{}
+	for _, e := range c.events {
+		if e.ID > afterID && len(events) < limit {
+			events = append(events, e)
+		}
+	}
+	return events, nil
+}
+
+func (c *chain) LastAuditEvent(ctx context.Context) (audit.Event, error) {
+	if len(c.events) == 0 {
+		return audit.Event{}, sql.ErrNoRows
+	}
+	return c.events[len(c.events)-1], nil
+}
+
+func (c *chain) AuditChainStart(ctx context.Context) (int64, error) {
+	return c.start, nil
+}
+
+func (c *chain) CreateAuditCheckpoint(ctx context.Context, cp audit.Checkpoint) error {
+	cp.ID = int64(len(c.checkpoints) + 1)
+	c.checkpoints = append(c.checkpoints, cp)
+	return nil
+}
+
+func (c *chain) ListAuditCheckpoints(ctx context.Context) ([]audit.Checkpoint, error) {
+	return c.checkpoints, nil
+}
+
+// record stores the events recorded before the chain starts, appends n
+// chained events and checkpoints them.
+func record(t *testing.T, start int64, n int) (*chain, audit.Service) {
+	c := &chain{start: start}
+	for id := int64(1); id < start; id++ {
+		c.events = append(c.events, audit.Event{ID: id, Type: audit.LoginEvent, Result: audit.Success})
+	}
+
+	svc := audit.NewService(c, []byte("key"))
+	for i := 0; i < n; i++ {
+		svc.Record(context.Background(), audit.Event{Type: audit.LoginEvent, Actor: "ada@example.com", Result: audit.Success})
+	}
+	if _, err := svc.Checkpoint(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return c, svc
+}
+
+func verify(t *testing.T, svc audit.Service) audit.VerifyReport {
+	report, err := svc.Verify(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return report
+}
+
+func TestVerifyAcceptsEventsBeforeTheChain(t *testing.T) {
+	_, svc := record(t, 3, 3)
+
+	report := verify(t, svc)
+	if !report.OK || report.EventsChecked != 5 || report.UnchainedEvents != 2 || report.CheckpointsChecked != 1 {
+		t.Errorf("got %+v, want 5 events of which 2 unchained", report)
+	}
+}
+
+func TestVerifyDetectsRemovedHashes(t *testing.T) {
+	for _, start := range []int64{1, 3} {
+		c, svc := record(t, start, 4)
+
+		// the hashes of the first chained events are removed so they can be
+		// rewritten, the event after them still has a valid hash
+		for i := start - 1; i < start+1; i++ {
+			c.events[i].PrevHash, c.events[i].Hash = nil, nil
+			c.events[i].Actor = "mallory@example.com"
+		}
+
+		report := verify(t, svc)
+		if report.OK || report.Broken == nil || report.Broken.EventID != start {
+			t.Errorf("chain starting at %d: got %+v, want event %d to be broken", start, report, start)
+		}
+	}
+}
+
+func TestVerifyDetectsRemovedFirstEvents(t *testing.T) {
+	for _, start := range []int64{1, 3} {
+		c, svc := record(t, start, 4)
+
+		c.events = append(c.events[:start-1], c.events[start+1:]...)
+
+		report := verify(t, svc)
+		if report.OK || report.Broken == nil || report.Broken.EventID != start+2 {
+			t.Errorf("chain starting at %d: got %+v, want event %d to be broken", start, report, start+2)
+		}
+	}
+}
+
+func TestVerifyDetectsChangedEvents(t *testing.T) {
+	c, svc := record(t, 1, 4)
+	c.events[2].Result = audit.Failure
+
+	report := verify(t, svc)
+	if report.OK || report.Broken == nil || report.Broken.EventID != 3 {
+		t.Errorf("got %+v, want event 3 to be broken", report)
+	}
+}
@@ -0,0 +1,235 @@
+package authorize
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// Request holds the attributes a decision is made on.
+type Request struct {
+	Subject      map[string]interface{}
+	Action       string
+	ResourceType string
+	Resource     map[string]interface{}
+}
+
+type Decision struct {
+	Allowed  bool   `json:"allowed"`
+	Decision string `json:"decision"`
+
+	// Policy is the ID of the policy that decided, empty when none applied
+	Policy string `json:"policy,omitempty"`
+}
+
+// Evaluate decides the request with deny overriding allow and denying by
+// default when no policy applies.
+func (ps *PolicySet) Evaluate(req Request) Decision {
+	d := Decision{Decision: Deny}
+
+	for _, p := range ps.Policies {
+		if !p.applies(req) {
+			continue
+		}
+
+		if p.Effect == Deny {
+			return Decision{Decision: Deny, Policy: p.ID}
+		}
+		if !d.Allowed {
+			d = Decision{Allowed: true, Decision: Allow, Policy: p.ID}
+		}
+	}
+
+	return d
+}
+
+func (p *Policy) applies(req Request) bool {
+	if !matches(p.Actions, req.Action) || !matches(p.ResourceTypes, req.ResourceType) {
+		return false
+	}
+	return p.Condition == nil || p.Condition.eval(req)
+}
+
+func matches(patterns []string, v string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, p := range patterns {
+		if p == "*" || p == v {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Condition) eval(req Request) bool {
+	switch {
+	case len(c.All) > 0:
+		for i := range c.All {
+			if !c.All[i].eval(req) {
+				return false
+			}
+		}
+		return true
+	case len(c.Any) > 0:
+		for i := range c.Any {
+			if c.Any[i].eval(req) {
+				return true
+			}
+		}
+		return false
+	case c.Not != nil:
+		return !c.Not.eval(req)
+	}
+
+	left, ok := lookup(req, c.Attr)
+	if c.Op == "exists" {
+		return ok
+	}
+	if !ok {
+		return false
+	}
+
+	right := c.Value
+	if c.Ref != "" {
+		if right, ok = lookup(req, c.Ref); !ok {
+			return false
+		}
+	}
+
+	switch c.Op {
+	case "eq":
+		return equal(left, right)
+	case "ne":
+		return !equal(left, right)
+	case "gt", "ge", "lt", "le":
+		l, lok := number(left)
+		r, rok := number(right)
+		if !lok || !rok {
+			return false
+		}
+		switch c.Op {
+		case "gt":
+			return l > r
+		case "ge":
+			return l >= r
+		case "lt":
+			return l < r
+		}
+		return l <= r
+	case "in":
+		return containsValue(list(right), left)
+	case "contains":
+		return containsValue(list(left), right)
+	case "intersects":
+		for _, v := range list(left) {
+			if containsValue(list(right), v) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func validPath(path string) bool {
+	return path == "action" ||
+		(strings.HasPrefix(path, "subject.") && len(path) > len("subject.")) ||
+		(strings.HasPrefix(path, "resource.") && len(path) > len("resource."))
+}
+
+func lookup(req Request, path string) (interface{}, bool) {
+	if path == "action" {
+		return req.Action, true
+	}
+
+	var attrs map[string]interface{}
+	var name string
+	if strings.HasPrefix(path, "subject.") {
+		attrs, name = req.Subject, strings.TrimPrefix(path, "subject.")
+	} else {
+		attrs, name = req.Resource, strings.TrimPrefix(path, "resource.")
+	}
+
+	v, ok := attrs[name]
+	if !ok || v == nil {
+		return nil, false
+	}
+	return v, true
+}
+
+func equal(a, b interface{}) bool {
+	if x, ok := number(a); ok {
+		y, ok := number(b)
+		return ok && x == y
+	}
+	if la, ok := a.([]string); ok {
+		a = toInterfaces(la)
+	}
+	if lb, ok := b.([]string); ok {
+		b = toInterfaces(lb)
+	}
+	if la, ok := a.([]interface{}); ok {
+		lb, ok := b.([]interface{})
+		if !ok || len(la) != len(lb) {
+			return false
+		}
+		for i := range la {
+			if !equal(la[i], lb[i]) {
+				return false
+			}
+		}
+		return true
+	}
+
+	switch x := a.(type) {
+	case string:
+		y, ok := b.(string)
+		return ok && x == y
+	case bool:
+		y, ok := b.(bool)
+		return ok && x == y
+	}
+	return false
+}
+
+func number(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case float64:
+		return n, true
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	}
+	return 0, false
+}
+
+func list(v interface{}) []interface{} {
+	switch l := v.(type) {
+	case []interface{}:
+		return l
+	case []string:
+		return toInterfaces(l)
+	}
+	return nil
+}
+
+func toInterfaces(l []string) []interface{} {
+	out := make([]interface{}, len(l))
+	for i, s := range l {
+		out[i] = s
+	}
+	return out
+}
+
+func containsValue(l []interface{}, v interface{}) bool {
+	for _, i := range l {
+		if equal(i, v) {
+			return true
+		}
+	}
+	return false
+}
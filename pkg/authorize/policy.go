@@ -0,0 +1,159 @@
+package authorize
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"sync/atomic"
+)
+
+const (
+	Allow = "allow"
+	Deny  = "deny"
+)
+
+var InvalidPolicyErr = errors.New("Invalid policy")
+
+var conditionOps = map[string]bool{
+	"eq":         true,
+	"ne":         true,
+	"gt":         true,
+	"ge":         true,
+	"lt":         true,
+	"le":         true,
+	"in":         true,
+	"contains":   true,
+	"intersects": true,
+	"exists":     true,
+}
+
+// PolicySet is the list of policies decisions are made against, a request
+// is denied unless an allow policy matches and no deny policy does.
+type PolicySet struct {
+	Policies []Policy `json:"policies"`
+}
+
+// Policies holds the policy set decisions are made against, it can be
+// replaced while requests are decided.
+type Policies struct {
+	v atomic.Value
+}
+
+func NewPolicies(ps *PolicySet) *Policies {
+	p := &Policies{}
+	p.Store(ps)
+	return p
+}
+
+func (p *Policies) Load() *PolicySet {
+	return p.v.Load().(*PolicySet)
+}
+
+func (p *Policies) Store(ps *PolicySet) {
+	p.v.Store(ps)
+}
+
+// Policy applies to requests for one of Actions on a resource of one of
+// ResourceTypes, both match anything when empty or "*", and whose
+// attributes satisfy Condition.
+type Policy struct {
+	ID            string     `json:"id"`
+	Description   string     `json:"description,omitempty"`
+	Effect        string     `json:"effect"`
+	Actions       []string   `json:"actions,omitempty"`
+	ResourceTypes []string   `json:"resourceTypes,omitempty"`
+	Condition     *Condition `json:"condition,omitempty"`
+}
+
+// Condition is either a combination of other conditions or a comparison of
+// the attribute at Attr with a literal Value or the attribute at Ref.
+// Attributes are addressed as "subject.<name>", "resource.<name>" or "action".
+type Condition struct {
+	All []Condition `json:"all,omitempty"`
+	Any []Condition `json:"any,omitempty"`
+	Not *Condition  `json:"not,omitempty"`
+
+	Op    string      `json:"op,omitempty"`
+	Attr  string      `json:"attr,omitempty"`
+	Value interface{} `json:"value,omitempty"`
+	Ref   string      `json:"ref,omitempty"`
+}
+
+func LoadPolicies(path string) (*PolicySet, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParsePolicies(b)
+}
+
+func ParsePolicies(b []byte) (*PolicySet, error) {
+	ps := PolicySet{}
+	if err := json.Unmarshal(b, &ps); err != nil {
+		return nil, fmt.Errorf("%w: %s", InvalidPolicyErr, err)
+	}
+
+	ids := map[string]bool{}
+	for _, p := range ps.Policies {
+		if p.ID == "" || ids[p.ID] {
+			return nil, fmt.Errorf("%w: missing or duplicate id %q", InvalidPolicyErr, p.ID)
+		}
+		ids[p.ID] = true
+
+		if p.Effect != Allow && p.Effect != Deny {
+			return nil, fmt.Errorf("%w: %s: effect must be allow or deny", InvalidPolicyErr, p.ID)
+		}
+		if p.Condition != nil {
+			if err := p.Condition.validate(); err != nil {
+				return nil, fmt.Errorf("%w: %s: %s", InvalidPolicyErr, p.ID, err)
+			}
+		}
+	}
+
+	return &ps, nil
+}
+
+func (c *Condition) validate() error {
+	parts := 0
+	for _, set := range []bool{len(c.All) > 0, len(c.Any) > 0, c.Not != nil, c.Op != ""} {
+		if set {
+			parts++
+		}
+	}
+	if parts != 1 {
+		return errors.New("condition must have exactly one of all, any, not or op")
+	}
+
+	for i := range c.All {
+		if err := c.All[i].validate(); err != nil {
+			return err
+		}
+	}
+	for i := range c.Any {
+		if err := c.Any[i].validate(); err != nil {
+			return err
+		}
+	}
+	if c.Not != nil {
+		return c.Not.validate()
+	}
+
+	if c.Op == "" {
+		return nil
+	}
+	if !conditionOps[c.Op] {
+		return fmt.Errorf("unknown op %q", c.Op)
+	}
+	if !validPath(c.Attr) {
+		return fmt.Errorf("invalid attr %q", c.Attr)
+	}
+	if c.Op != "exists" && (c.Ref == "") == (c.Value == nil) {
+		return errors.New("comparison must have exactly one of value or ref")
+	}
+	if c.Ref != "" && !validPath(c.Ref) {
+		return fmt.Errorf("invalid ref %q", c.Ref)
+	}
+
+	return nil
+}
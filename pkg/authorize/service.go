@@ -0,0 +1,120 @@
+package authorize
+
+import (
+	"context"
+
+	"github.com/raisultan/abac/pkg/resource"
+	"github.com/raisultan/abac/pkg/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+type AuthorizeRequest struct {
+	// Subject is the email of the user, defaults to the caller
+	Subject  string       `json:"subject" validate:"omitempty,email"`
+	Action   string       `json:"action" validate:"required"`
+	Resource resource.Ref `json:"resource" validate:"required"`
+}
+
+type Service interface {
+	Authorize(context.Context, AuthorizeRequest) (Decision, error)
+}
+
+type SubjectSource interface {
+	SubjectAttributes(ctx context.Context, email string) (map[string]interface{}, error)
+}
+
+type ResourceSource interface {
+	ResourceChain(context.Context, resource.Ref) ([]resource.Resource, error)
+}
+
+type service struct {
+	subjects  SubjectSource
+	resources ResourceSource
+	policies  *Policies
+}
+
+func NewService(subjects SubjectSource, resources ResourceSource, policies *Policies) Service {
+	return &service{subjects, resources, policies}
+}
+
+func (s *service) Authorize(ctx context.Context, ar AuthorizeRequest) (d Decision, err error) {
+	ctx, span := tracing.Start(
+		ctx,
+		"authorize",
+		attribute.String("abac.action", ar.Action),
+		attribute.String("abac.resource_type", ar.Resource.Type),
+	)
+	defer func() { tracing.End(span, err) }()
+
+	subject, err := s.subjects.SubjectAttributes(ctx, ar.Subject)
+	if err != nil {
+		return Decision{}, err
+	}
+
+	chain, err := s.resources.ResourceChain(ctx, ar.Resource)
+	if err != nil {
+		return Decision{}, err
+	}
+
+	ps := s.policies.Load()
+	_, eval := tracing.Start(ctx, "evaluate policies", attribute.Int("abac.policies", len(ps.Policies)))
+	d = ps.Evaluate(Request{
+		Subject:      subject,
+		Action:       ar.Action,
+		ResourceType: ar.Resource.Type,
+		Resource:     ResourceAttributes(chain),
+	})
+	eval.SetAttributes(attribute.String("abac.decision", d.Decision), attribute.String("abac.policy", d.Policy))
+	eval.End()
+
+	return d, nil
+}
+
+// ResourceAttributes flattens a resource and its ancestors, closest first,
+// into the attributes policies see. Attributes are inherited from ancestors
+// unless the resource or a closer ancestor sets them, so "editors" set on a
+// folder applies to every document in it. Besides its own attributes a
+// resource has "type", "externalId", "ownerId", "ownerIds" with the owners
+// of the resource and all its ancestors, and "ancestors" listing them as
+// "type/externalId".
+func ResourceAttributes(chain []resource.Resource) map[string]interface{} {
+	attrs := map[string]interface{}{}
+	ownerIDs := []interface{}{}
+	ancestors := []interface{}{}
+
+	for i := len(chain) - 1; i >= 0; i-- {
+		for k, v := range chain[i].Attributes {
+			attrs[k] = v
+		}
+	}
+
+	for i, r := range chain {
+		if r.OwnerID != nil {
+			ownerIDs = append(ownerIDs, int64(*r.OwnerID))
+		}
+		if i > 0 {
+			ancestors = append(ancestors, r.Type+"/"+r.ExternalID)
+		}
+	}
+
+	res := chain[0]
+	attrs["type"] = res.Type
+	attrs["externalId"] = res.ExternalID
+	attrs["ownerIds"] = ownerIDs
+	attrs["ancestors"] = ancestors
+	delete(attrs, "ownerId")
+	if res.OwnerID != nil {
+		attrs["ownerId"] = int64(*res.OwnerID)
+	}
+
+	return attrs
+}
+
+// NewPolicySet loads the policies from the file at path, without one every
+// request is denied.
+func NewPolicySet(path string) (*PolicySet, error) {
+	if path == "" {
+		return &PolicySet{}, nil
+	}
+	return LoadPolicies(path)
+}
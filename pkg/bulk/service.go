@@ -0,0 +1,83 @@
+package bulk
+
+import (
+	"context"
+
+	"github.com/raisultan/abac/pkg/event"
+	"github.com/raisultan/abac/pkg/storage"
+)
+
+type Service interface {
+	ImportUsers(ctx context.Context, rows []ImportRow, dryRun bool) (ImportResult, error)
+	ExportUsers(context.Context, RowWriter) error
+}
+
+type Repository interface {
+	storage.Transactor
+
+	// UpsertUsers creates or updates all users or none and returns them,
+	// when dryRun is set nothing is stored. A dry run rolls back its own
+	// transaction, so it must not run within another one. Rows that can not
+	// be imported fail with a RowErr.
+	UpsertUsers(ctx context.Context, rows []ImportRow, dryRun bool) ([]ImportedUser, error)
+
+	// ExportUsers calls fn for every user that is not deleted, ordered by ID.
+	ExportUsers(ctx context.Context, fn func(ExportRow) error) error
+	AppendEvent(context.Context, event.Event) error
+}
+
+type service struct {
+	r Repository
+}
+
+func NewService(r Repository) Service {
+	return &service{r}
+}
+
+// ImportUsers emits user.created and user.updated for every imported user
+// in the transaction of the import, a dry run emits nothing.
+func (s *service) ImportUsers(ctx context.Context, rows []ImportRow, dryRun bool) (ImportResult, error) {
+	var users []ImportedUser
+	var err error
+	if dryRun {
+		users, err = s.r.UpsertUsers(ctx, rows, true)
+	} else {
+		err = s.r.WithinTx(ctx, func(ctx context.Context) error {
+			var err error
+			if users, err = s.r.UpsertUsers(ctx, rows, false); err != nil {
+				return err
+			}
+
+			for _, u := range users {
+				typ := event.UserUpdated
+				if u.Created {
+					typ = event.UserCreated
+				}
+				if err := s.r.AppendEvent(ctx, event.New(typ, event.UserSubject(u.ID), u)); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	}
+	if err != nil {
+		return ImportResult{}, err
+	}
+
+	res := ImportResult{DryRun: dryRun}
+	for _, u := range users {
+		if u.Created {
+			res.Created++
+		} else {
+			res.Updated++
+		}
+	}
+	return res, nil
+}
+
+func (s *service) ExportUsers(ctx context.Context, w RowWriter) error {
+	if err := s.r.ExportUsers(ctx, w.Write); err != nil {
+		return err
+	}
+	return w.Flush()
+}
@@ -0,0 +1,84 @@
+package bulk_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/raisultan/abac/pkg/bulk"
+	"github.com/raisultan/abac/pkg/event"
+	"github.com/raisultan/abac/pkg/register"
+	"github.com/raisultan/abac/pkg/storage/memory"
+)
+
+func TestImportUsersEmitsEvents(t *testing.T) {
+	ctx := context.Background()
+	s := memory.NewStorage()
+	existing, err := s.CreateUser(ctx, register.UserRegisterRequest{Email: "ada@example.com", Password: "password"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	svc := bulk.NewService(s)
+	rows := []bulk.ImportRow{
+		{Line: 2, Email: "ada@example.com", FirstName: "Augusta", LastName: "Lovelace"},
+		{Line: 3, Email: "alan@example.com", FirstName: "Alan", LastName: "Turing"},
+	}
+
+	res, err := svc.ImportUsers(ctx, rows, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Created != 1 || res.Updated != 1 {
+		t.Errorf("dry run: created %d, updated %d, want 1 and 1", res.Created, res.Updated)
+	}
+	if events := claimEvents(t, s); len(events) != 0 {
+		t.Errorf("dry run emitted %v", events)
+	}
+
+	res, err = svc.ImportUsers(ctx, rows, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Created != 1 || res.Updated != 1 {
+		t.Errorf("created %d, updated %d, want 1 and 1", res.Created, res.Updated)
+	}
+
+	alan, err := s.GetUserIDByEmail(ctx, "alan@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	events := claimEvents(t, s)
+	want := map[string]string{
+		event.UserSubject(existing.ID): event.UserUpdated,
+		event.UserSubject(alan):        event.UserCreated,
+	}
+	if len(events) != len(want) {
+		t.Fatalf("events %v, want %v", events, want)
+	}
+	for subject, typ := range want {
+		if events[subject] != typ {
+			t.Errorf("event of %s is %q, want %q", subject, events[subject], typ)
+		}
+	}
+}
+
+// claimEvents returns the types of the events appended since the last call
+// by subject.
+func claimEvents(t *testing.T, s *memory.Storage) map[string]string {
+	t.Helper()
+
+	claimed, err := s.ClaimEvents(context.Background(), 100, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	events := map[string]string{}
+	for _, e := range claimed {
+		events[e.Subject] = e.Type
+		// later events of the subject wait for this one
+		if err := s.MarkEventPublished(context.Background(), e.ID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return events
+}
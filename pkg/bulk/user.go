@@ -0,0 +1,61 @@
+package bulk
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+var DeletedUserErr = errors.New("Email belongs to a deleted user")
+
+// ImportRow is a user to create or, when the email is taken, update. New
+// users without a password can only sign in through an external identity
+// provider or a passkey.
+type ImportRow struct {
+	Line int `json:"-"`
+
+	Email     string `json:"email" validate:"required,email"`
+	Password  string `json:"password" validate:"omitempty,password"`
+	FirstName string `json:"firstName" validate:"required"`
+	LastName  string `json:"lastName" validate:"required"`
+}
+
+// ImportedUser is a user an import created or updated, it is the data of
+// the event announcing it.
+type ImportedUser struct {
+	ID        int    `json:"id"`
+	Email     string `json:"email"`
+	FirstName string `json:"firstName"`
+	LastName  string `json:"lastName"`
+	Created   bool   `json:"-"`
+}
+
+type ExportRow struct {
+	ID         int       `json:"id"`
+	Email      string    `json:"email"`
+	FirstName  string    `json:"firstName"`
+	LastName   string    `json:"lastName"`
+	IsAdmin    bool      `json:"isAdmin"`
+	IsApproved bool      `json:"isApproved"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+type ImportResult struct {
+	DryRun  bool `json:"dryRun"`
+	Created int  `json:"created"`
+	Updated int  `json:"updated"`
+}
+
+// RowErr tells which line of an import failed.
+type RowErr struct {
+	Line int
+	Err  error
+}
+
+func (e *RowErr) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Err)
+}
+
+func (e *RowErr) Unwrap() error {
+	return e.Err
+}
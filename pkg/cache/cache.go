@@ -0,0 +1,204 @@
+// Package cache keeps authorization decisions and the attributes of their
+// subjects in memory. Entries are dropped when the event of a change they
+// depend on is dispatched and expire after the TTL otherwise, which is also
+// how changes of resources reach cached decisions.
+package cache
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/raisultan/abac/pkg/authorize"
+	"github.com/raisultan/abac/pkg/event"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Config sizes the cache, Size is the number of decisions and of subjects
+// kept each.
+type Config struct {
+	Size int
+	TTL  time.Duration
+}
+
+type Cache struct {
+	decisions *lru
+	subjects  *lru
+
+	// stamps numbers the loads of subject attributes
+	stamps uint64
+}
+
+// Report holds the Stats of both caches.
+type Report struct {
+	Decisions Stats `json:"decisions"`
+	Subjects  Stats `json:"subjects"`
+}
+
+func New(c Config) *Cache {
+	return &Cache{
+		decisions: newLRU(c.Size, c.TTL),
+		subjects:  newLRU(c.Size, c.TTL),
+	}
+}
+
+func (c *Cache) Stats() Report {
+	return Report{Decisions: c.decisions.report(), Subjects: c.subjects.report()}
+}
+
+type bypassKey struct{}
+
+// Bypass makes the lookups made with the returned context skip the cache,
+// for debugging decisions.
+func Bypass(ctx context.Context) context.Context {
+	return context.WithValue(ctx, bypassKey{}, true)
+}
+
+func bypassed(ctx context.Context) bool {
+	b, _ := ctx.Value(bypassKey{}).(bool)
+	return b
+}
+
+// subject is the attributes of a user, stamp tells this load of them apart
+// from the others.
+type subject struct {
+	attrs map[string]interface{}
+	stamp uint64
+}
+
+// decision is only good while the subject it was made on is still cached
+// with the same stamp, so dropping a subject drops its decisions too.
+type decision struct {
+	d     authorize.Decision
+	stamp uint64
+}
+
+type decisionKey struct {
+	subject      string
+	action       string
+	resourceType string
+	externalID   string
+}
+
+// stampKey carries the stamp of the subject a decision is made on from
+// the subject source back to the decision cache.
+type stampKey struct{}
+
+// Service caches the decisions of s, which has to get its subjects from
+// the source returned by Subjects.
+func (c *Cache) Service(s authorize.Service) authorize.Service {
+	return &service{c, s}
+}
+
+type service struct {
+	c    *Cache
+	next authorize.Service
+}
+
+func (s *service) Authorize(ctx context.Context, ar authorize.AuthorizeRequest) (authorize.Decision, error) {
+	if bypassed(ctx) {
+		return s.next.Authorize(ctx, ar)
+	}
+
+	key := decisionKey{ar.Subject, ar.Action, ar.Resource.Type, ar.Resource.ExternalID}
+	v, gen, ok := s.c.decisions.get(key)
+	if ok {
+		d := v.(decision)
+		sub, _, ok := s.c.subjects.get(ar.Subject)
+		if ok && sub.(subject).stamp == d.stamp {
+			s.c.decisions.count(true)
+			trace.SpanFromContext(ctx).SetAttributes(attribute.Bool("abac.cache_hit", true))
+			return d.d, nil
+		}
+	}
+	s.c.decisions.count(false)
+	trace.SpanFromContext(ctx).SetAttributes(attribute.Bool("abac.cache_hit", false))
+
+	var stamp uint64
+	d, err := s.next.Authorize(context.WithValue(ctx, stampKey{}, &stamp), ar)
+	if err != nil {
+		return authorize.Decision{}, err
+	}
+	if stamp != 0 {
+		s.c.decisions.add(key, decision{d, stamp}, gen)
+	}
+
+	return d, nil
+}
+
+// Subjects caches the subject attributes of s.
+func (c *Cache) Subjects(s authorize.SubjectSource) authorize.SubjectSource {
+	return &subjects{c, s}
+}
+
+type subjects struct {
+	c    *Cache
+	next authorize.SubjectSource
+}
+
+func (s *subjects) SubjectAttributes(ctx context.Context, email string) (map[string]interface{}, error) {
+	if bypassed(ctx) {
+		return s.next.SubjectAttributes(ctx, email)
+	}
+
+	v, gen, ok := s.c.subjects.get(email)
+	s.c.subjects.count(ok)
+	if ok {
+		sub := v.(subject)
+		setStamp(ctx, sub.stamp)
+		return sub.attrs, nil
+	}
+
+	attrs, err := s.next.SubjectAttributes(ctx, email)
+	if err != nil {
+		return nil, err
+	}
+
+	sub := subject{attrs, atomic.AddUint64(&s.c.stamps, 1)}
+	if s.c.subjects.add(email, sub, gen) {
+		setStamp(ctx, sub.stamp)
+	}
+	return attrs, nil
+}
+
+func setStamp(ctx context.Context, stamp uint64) {
+	if p, ok := ctx.Value(stampKey{}).(*uint64); ok {
+		*p = stamp
+	}
+}
+
+// PurgeDecisions drops every decision, for when the policies are replaced.
+func (c *Cache) PurgeDecisions() {
+	c.decisions.purge()
+}
+
+// Purge drops everything, for when events may have been missed.
+func (c *Cache) Purge() {
+	c.decisions.purge()
+	c.subjects.purge()
+}
+
+// Publish drops what the event makes stale, the cache is one of the sinks
+// of the event dispatcher.
+func (c *Cache) Publish(_ context.Context, e event.Event) error {
+	switch e.Type {
+	case event.PolicyPublished:
+		c.decisions.purge()
+	case event.UserApproved, event.UserUpdated, event.UserDeleted, event.UserRestored, event.UserDeactivated,
+		event.UserActivated, event.UserAttributesUpdated:
+		id, err := strconv.Atoi(strings.TrimPrefix(e.Subject, "user:"))
+		if err != nil {
+			c.subjects.purge()
+			return nil
+		}
+		c.subjects.removeIf(func(_, v interface{}) bool {
+			return v.(subject).attrs["id"] == int64(id)
+		})
+	case event.AttributeSaved, event.AttributeDeleted, event.GroupUpdated, event.GroupDeleted:
+		c.subjects.purge()
+	}
+	return nil
+}
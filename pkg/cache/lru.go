@@ -0,0 +1,139 @@
+package cache
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// Stats counts the lookups of one of the caches.
+type Stats struct {
+	Hits   uint64 `json:"hits"`
+	Misses uint64 `json:"misses"`
+	Size   int    `json:"size"`
+}
+
+// lru holds up to size entries for ttl each and evicts the least recently
+// used one when it is full.
+type lru struct {
+	mu      sync.Mutex
+	size    int
+	ttl     time.Duration
+	entries map[interface{}]*list.Element
+	order   *list.List
+
+	// gen is bumped by every invalidation, values loaded before one are
+	// not stored after it
+	gen   uint64
+	stats Stats
+}
+
+type entry struct {
+	key     interface{}
+	value   interface{}
+	expires time.Time
+}
+
+func newLRU(size int, ttl time.Duration) *lru {
+	return &lru{
+		size:    size,
+		ttl:     ttl,
+		entries: map[interface{}]*list.Element{},
+		order:   list.New(),
+	}
+}
+
+// get returns the value of key and the generation a value loaded on a miss
+// has to be added with. Lookups are counted by the callers, which know
+// whether a value is still good.
+func (c *lru) get(key interface{}) (interface{}, uint64, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.entries[key]
+	if !ok {
+		return nil, c.gen, false
+	}
+
+	e := el.Value.(*entry)
+	if time.Now().After(e.expires) {
+		c.remove(el)
+		return nil, c.gen, false
+	}
+	c.order.MoveToFront(el)
+	return e.value, c.gen, true
+}
+
+func (c *lru) count(hit bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if hit {
+		c.stats.Hits++
+	} else {
+		c.stats.Misses++
+	}
+}
+
+// add stores value unless the cache was invalidated since gen and reports
+// whether it did.
+func (c *lru) add(key, value interface{}, gen uint64) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if gen != c.gen {
+		return false
+	}
+
+	expires := time.Now().Add(c.ttl)
+	if el, ok := c.entries[key]; ok {
+		e := el.Value.(*entry)
+		e.value, e.expires = value, expires
+		c.order.MoveToFront(el)
+		return true
+	}
+
+	c.entries[key] = c.order.PushFront(&entry{key, value, expires})
+	if c.order.Len() > c.size {
+		c.remove(c.order.Back())
+	}
+	return true
+}
+
+// removeIf drops the entries match returns true for.
+func (c *lru) removeIf(match func(key, value interface{}) bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.gen++
+	for el := c.order.Front(); el != nil; {
+		next := el.Next()
+		if e := el.Value.(*entry); match(e.key, e.value) {
+			c.remove(el)
+		}
+		el = next
+	}
+}
+
+func (c *lru) purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.gen++
+	c.entries = map[interface{}]*list.Element{}
+	c.order.Init()
+}
+
+func (c *lru) remove(el *list.Element) {
+	c.order.Remove(el)
+	delete(c.entries, el.Value.(*entry).key)
+}
+
+func (c *lru) report() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	s := c.stats
+	s.Size = c.order.Len()
+	return s
+}
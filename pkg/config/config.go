@@ -0,0 +1,486 @@
+// Package config loads the configuration of the server. Every setting has a
+// default and can be set in a YAML file, an environment variable and, for
+// the common ones, a flag; flags win over the environment, which wins over
+// the file.
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/raisultan/abac/pkg/storage"
+	"github.com/raisultan/abac/pkg/tracing"
+	"golang.org/x/crypto/bcrypt"
+	"gopkg.in/yaml.v2"
+)
+
+var InvalidErr = errors.New("Invalid configuration")
+
+// Config holds the settings of the server. Fields of the sections are
+// tagged with their key in the file, their environment variable and their
+// flag. In variables lists are separated by commas or spaces and maps are
+// key=value pairs separated by commas.
+type Config struct {
+	// Path is the file the configuration was loaded from, if any
+	Path string `yaml:"-"`
+
+	Server   Server   `yaml:"server"`
+	Storage  Storage  `yaml:"storage"`
+	Postgres Postgres `yaml:"postgres"`
+	Auth     Auth     `yaml:"auth"`
+	Cache    Cache    `yaml:"cache"`
+	Tracing  Tracing  `yaml:"tracing"`
+	Policy   Policy   `yaml:"policy"`
+	Audit    Audit    `yaml:"audit"`
+	Events   Events   `yaml:"events"`
+	Webhooks Webhooks `yaml:"webhooks"`
+	Users    Users    `yaml:"users"`
+	LDAP     LDAP     `yaml:"ldap"`
+	OIDC     OIDC     `yaml:"oidc"`
+	WebAuthn WebAuthn `yaml:"webauthn"`
+}
+
+type Server struct {
+	Addr            string        `yaml:"addr" env:"SERVER_ADDR" flag:"addr"`
+	ReadTimeout     time.Duration `yaml:"readTimeout" env:"SERVER_READ_TIMEOUT"`
+	WriteTimeout    time.Duration `yaml:"writeTimeout" env:"SERVER_WRITE_TIMEOUT"`
+	IdleTimeout     time.Duration `yaml:"idleTimeout" env:"SERVER_IDLE_TIMEOUT"`
+	ShutdownTimeout time.Duration `yaml:"shutdownTimeout" env:"SERVER_SHUTDOWN_TIMEOUT" flag:"gracefulShutDown"`
+
+	// WatchInterval is how often the configuration and policy files are
+	// checked for changes, zero only reloads them on SIGHUP
+	WatchInterval time.Duration `yaml:"watchInterval" env:"SERVER_WATCH_INTERVAL"`
+}
+
+type Storage struct {
+	Driver      string `yaml:"driver" env:"STORAGE_DRIVER" flag:"storage"`
+	AutoMigrate bool   `yaml:"autoMigrate" env:"STORAGE_AUTO_MIGRATE"`
+	SQLitePath  string `yaml:"sqlitePath" env:"SQLITE_PATH"`
+
+	// the admin is created on start by backends that start out empty, so
+	// there is someone to sign in with
+	AdminEmail    string `yaml:"adminEmail" env:"STORAGE_ADMIN_EMAIL"`
+	AdminPassword string `yaml:"adminPassword" env:"STORAGE_ADMIN_PASSWORD"`
+}
+
+// Postgres sizes the connection pool, zero values keep the defaults of
+// database/sql.
+type Postgres struct {
+	URL             string        `yaml:"url" env:"POSTGRES_URL"`
+	MaxOpenConns    int           `yaml:"maxOpenConns" env:"POSTGRES_MAX_OPEN_CONNS"`
+	MaxIdleConns    int           `yaml:"maxIdleConns" env:"POSTGRES_MAX_IDLE_CONNS"`
+	ConnMaxLifetime time.Duration `yaml:"connMaxLifetime" env:"POSTGRES_CONN_MAX_LIFETIME"`
+}
+
+type Auth struct {
+	AccessTokenTTL  time.Duration `yaml:"accessTokenTTL" env:"AUTH_ACCESS_TOKEN_TTL"`
+	RefreshTokenTTL time.Duration `yaml:"refreshTokenTTL" env:"AUTH_REFRESH_TOKEN_TTL"`
+	BcryptCost      int           `yaml:"bcryptCost" env:"AUTH_BCRYPT_COST"`
+
+	// JWTKey signs tokens. Tokens signed with PreviousJWTKey are still
+	// accepted, so the key can be rotated without signing everyone out.
+	JWTKey         string `yaml:"jwtKey" env:"AUTH_JWT_KEY"`
+	PreviousJWTKey string `yaml:"previousJwtKey" env:"AUTH_PREVIOUS_JWT_KEY"`
+
+	// InsecureDevKey signs tokens with the built-in development key when
+	// JWTKey is empty, anyone can forge those tokens
+	InsecureDevKey bool `yaml:"insecureDevKey" env:"AUTH_INSECURE_DEV_KEY"`
+}
+
+// Cache keeps decisions and subject attributes, a zero size turns it off.
+type Cache struct {
+	Size int           `yaml:"size" env:"CACHE_SIZE"`
+	TTL  time.Duration `yaml:"ttl" env:"CACHE_TTL"`
+}
+
+// Tracing exports spans of requests, an empty exporter turns it off.
+type Tracing struct {
+	// Exporter is otlp, sending to the collector at Endpoint over HTTP, or
+	// stdout
+	Exporter    string  `yaml:"exporter" env:"TRACING_EXPORTER"`
+	Endpoint    string  `yaml:"endpoint" env:"TRACING_ENDPOINT"`
+	Insecure    bool    `yaml:"insecure" env:"TRACING_INSECURE"`
+	SampleRatio float64 `yaml:"sampleRatio" env:"TRACING_SAMPLE_RATIO"`
+	ServiceName string  `yaml:"serviceName" env:"TRACING_SERVICE_NAME"`
+}
+
+// Policy names the JSON file policies are loaded from, without one every
+// request is denied.
+type Policy struct {
+	File string `yaml:"file" env:"POLICY_FILE"`
+}
+
+// Audit signs checkpoints of the audit log with SigningKey, an empty key
+// turns checkpoints off.
+type Audit struct {
+	SigningKey         string        `yaml:"signingKey" env:"AUDIT_SIGNING_KEY"`
+	CheckpointInterval time.Duration `yaml:"checkpointInterval" env:"AUDIT_CHECKPOINT_INTERVAL"`
+}
+
+// Events are published to Sinks, out of log and webhook, the webhook sink
+// posts them to WebhookURL.
+type Events struct {
+	Sinks        []string      `yaml:"sinks" env:"EVENT_SINKS"`
+	WebhookURL   string        `yaml:"webhookUrl" env:"EVENT_WEBHOOK_URL"`
+	PollInterval time.Duration `yaml:"pollInterval" env:"EVENT_POLL_INTERVAL"`
+	Retention    time.Duration `yaml:"retention" env:"EVENT_RETENTION"`
+}
+
+type Webhooks struct {
+	PollInterval time.Duration `yaml:"pollInterval" env:"WEBHOOK_POLL_INTERVAL"`
+	Retention    time.Duration `yaml:"retention" env:"WEBHOOK_RETENTION"`
+}
+
+// Users are purged Retention after they were deleted.
+type Users struct {
+	Retention     time.Duration `yaml:"retention" env:"USER_RETENTION"`
+	PurgeInterval time.Duration `yaml:"purgeInterval" env:"USER_PURGE_INTERVAL"`
+}
+
+// LDAP is the directory logins fall back to, an empty URL turns it off.
+type LDAP struct {
+	URL             string        `yaml:"url" env:"LDAP_URL"`
+	StartTLS        bool          `yaml:"startTls" env:"LDAP_START_TLS"`
+	BindDNTemplate  string        `yaml:"bindDnTemplate" env:"LDAP_BIND_DN_TEMPLATE"`
+	BindDN          string        `yaml:"bindDn" env:"LDAP_BIND_DN"`
+	BindPassword    string        `yaml:"bindPassword" env:"LDAP_BIND_PASSWORD"`
+	UserBaseDN      string        `yaml:"userBaseDn" env:"LDAP_USER_BASE_DN"`
+	UserFilter      string        `yaml:"userFilter" env:"LDAP_USER_FILTER"`
+	EmailAttr       string        `yaml:"emailAttr" env:"LDAP_EMAIL_ATTR"`
+	FirstNameAttr   string        `yaml:"firstNameAttr" env:"LDAP_FIRST_NAME_ATTR"`
+	LastNameAttr    string        `yaml:"lastNameAttr" env:"LDAP_LAST_NAME_ATTR"`
+	GroupBaseDN     string        `yaml:"groupBaseDn" env:"LDAP_GROUP_BASE_DN"`
+	GroupFilter     string        `yaml:"groupFilter" env:"LDAP_GROUP_FILTER"`
+	GroupNameAttr   string        `yaml:"groupNameAttr" env:"LDAP_GROUP_NAME_ATTR"`
+	GroupMemberAttr string        `yaml:"groupMemberAttr" env:"LDAP_GROUP_MEMBER_ATTR"`
+	SyncInterval    time.Duration `yaml:"syncInterval" env:"LDAP_SYNC_INTERVAL"`
+}
+
+// OIDC is the upstream provider users may sign in with, an empty issuer
+// turns it off.
+type OIDC struct {
+	Issuer              string            `yaml:"issuer" env:"OIDC_ISSUER"`
+	ClientID            string            `yaml:"clientId" env:"OIDC_CLIENT_ID"`
+	ClientSecret        string            `yaml:"clientSecret" env:"OIDC_CLIENT_SECRET"`
+	RedirectURL         string            `yaml:"redirectUrl" env:"OIDC_REDIRECT_URL"`
+	Scopes              []string          `yaml:"scopes" env:"OIDC_SCOPES"`
+	EmailClaim          string            `yaml:"emailClaim" env:"OIDC_EMAIL_CLAIM"`
+	FirstNameClaim      string            `yaml:"firstNameClaim" env:"OIDC_FIRST_NAME_CLAIM"`
+	LastNameClaim       string            `yaml:"lastNameClaim" env:"OIDC_LAST_NAME_CLAIM"`
+	GroupsClaim         string            `yaml:"groupsClaim" env:"OIDC_GROUPS_CLAIM"`
+	GroupMapping        map[string]string `yaml:"groupMapping" env:"OIDC_GROUP_MAPPING"`
+	ProvisionUnverified bool              `yaml:"provisionUnverified" env:"OIDC_PROVISION_UNVERIFIED"`
+}
+
+// WebAuthn is the relying party of passkeys, an empty RP ID turns them off.
+// The name defaults to the RP ID and the origins to https://<RP ID>.
+type WebAuthn struct {
+	RPID                    string        `yaml:"rpId" env:"WEBAUTHN_RP_ID"`
+	RPName                  string        `yaml:"rpName" env:"WEBAUTHN_RP_NAME"`
+	Origins                 []string      `yaml:"origins" env:"WEBAUTHN_ORIGINS"`
+	RequireUserVerification bool          `yaml:"requireUserVerification" env:"WEBAUTHN_REQUIRE_USER_VERIFICATION"`
+	Timeout                 time.Duration `yaml:"timeout" env:"WEBAUTHN_TIMEOUT"`
+}
+
+func Default() Config {
+	return Config{
+		Server: Server{
+			Addr:            "0.0.0.0:8080",
+			ReadTimeout:     15 * time.Second,
+			WriteTimeout:    15 * time.Second,
+			IdleTimeout:     60 * time.Second,
+			ShutdownTimeout: 15 * time.Second,
+			WatchInterval:   5 * time.Second,
+		},
+		Storage: Storage{
+			Driver:     storage.Postgres,
+			SQLitePath: "abac.db",
+		},
+		Postgres: Postgres{
+			MaxIdleConns: 2,
+		},
+		Auth: Auth{
+			AccessTokenTTL:  5 * time.Minute,
+			RefreshTokenTTL: 30 * time.Minute,
+			BcryptCost:      8,
+		},
+		Cache: Cache{
+			Size: 10000,
+			TTL:  time.Minute,
+		},
+		Tracing: Tracing{
+			Endpoint:    "localhost:4318",
+			SampleRatio: 1,
+			ServiceName: "abac",
+		},
+		Audit: Audit{
+			CheckpointInterval: time.Hour,
+		},
+		Events: Events{
+			PollInterval: 5 * time.Second,
+			Retention:    7 * 24 * time.Hour,
+		},
+		Webhooks: Webhooks{
+			PollInterval: 5 * time.Second,
+			Retention:    30 * 24 * time.Hour,
+		},
+		Users: Users{
+			Retention:     30 * 24 * time.Hour,
+			PurgeInterval: time.Hour,
+		},
+		LDAP: LDAP{
+			UserFilter:      "(mail={email})",
+			EmailAttr:       "mail",
+			FirstNameAttr:   "givenName",
+			LastNameAttr:    "sn",
+			GroupFilter:     "(objectClass=groupOfNames)",
+			GroupNameAttr:   "cn",
+			GroupMemberAttr: "member",
+			SyncInterval:    15 * time.Minute,
+		},
+		OIDC: OIDC{
+			Scopes:         []string{"openid", "email", "profile"},
+			EmailClaim:     "email",
+			FirstNameClaim: "given_name",
+			LastNameClaim:  "family_name",
+			GroupsClaim:    "groups",
+		},
+		WebAuthn: WebAuthn{
+			Timeout: 5 * time.Minute,
+		},
+	}
+}
+
+// Load parses args with fs and returns the validated configuration. The
+// file is the one the -config flag or CONFIG_FILE names, if any.
+func Load(fs *flag.FlagSet, args []string) (Config, error) {
+	c := Default()
+
+	path := fs.String("config", os.Getenv("CONFIG_FILE"), "path of the YAML configuration file")
+	flags := map[string]*string{}
+	for _, f := range fields(&c) {
+		if name := f.tag.Get("flag"); name != "" {
+			flags[name] = fs.String(name, f.String(), fmt.Sprintf("sets %s, also %s", f.key, f.tag.Get("env")))
+		}
+	}
+	if err := fs.Parse(args); err != nil {
+		return Config{}, err
+	}
+
+	c.Path = *path
+	if c.Path != "" {
+		if err := c.loadFile(c.Path); err != nil {
+			return Config{}, err
+		}
+	}
+
+	var problems []string
+	for _, f := range fields(&c) {
+		if v, ok := os.LookupEnv(f.tag.Get("env")); ok {
+			if err := f.set(v); err != nil {
+				problems = append(problems, fmt.Sprintf("%s: %s", f.tag.Get("env"), err))
+			}
+		}
+	}
+
+	set := map[string]bool{}
+	fs.Visit(func(fl *flag.Flag) { set[fl.Name] = true })
+	for _, f := range fields(&c) {
+		if name := f.tag.Get("flag"); set[name] {
+			if err := f.set(*flags[name]); err != nil {
+				problems = append(problems, fmt.Sprintf("-%s: %s", name, err))
+			}
+		}
+	}
+
+	if len(problems) > 0 {
+		return Config{}, fmt.Errorf("%w: %s", InvalidErr, strings.Join(problems, "; "))
+	}
+	return c, c.Validate()
+}
+
+func (c *Config) loadFile(path string) error {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	// unknown keys are reported, they are most likely typos
+	if err := yaml.UnmarshalStrict(b, c); err != nil {
+		return fmt.Errorf("%w: %s: %s", InvalidErr, path, err)
+	}
+	return nil
+}
+
+// Validate reports every invalid setting at once.
+func (c Config) Validate() error {
+	var problems []string
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			problems = append(problems, fmt.Sprintf(format, args...))
+		}
+	}
+
+	check(c.Server.Addr != "", "server.addr must be set")
+	check(c.Server.ReadTimeout > 0, "server.readTimeout must be positive")
+	check(c.Server.WriteTimeout > 0, "server.writeTimeout must be positive")
+	check(c.Server.IdleTimeout > 0, "server.idleTimeout must be positive")
+	check(c.Server.ShutdownTimeout >= 0, "server.shutdownTimeout must not be negative")
+	check(c.Server.WatchInterval >= 0, "server.watchInterval must not be negative")
+
+	switch c.Storage.Driver {
+	case storage.Postgres:
+		check(c.Postgres.URL != "", "postgres.url must be set for the postgres storage")
+	case storage.SQLite:
+		check(c.Storage.SQLitePath != "", "storage.sqlitePath must be set for the sqlite storage")
+	case storage.Memory:
+	default:
+		check(false, "storage.driver %q is not one of postgres, sqlite and memory", c.Storage.Driver)
+	}
+	check(c.Storage.AdminEmail == "" || c.Storage.AdminPassword != "", "storage.adminPassword must be set with storage.adminEmail")
+
+	check(c.Postgres.MaxOpenConns >= 0, "postgres.maxOpenConns must not be negative")
+	check(c.Postgres.MaxIdleConns >= 0, "postgres.maxIdleConns must not be negative")
+	check(
+		c.Postgres.MaxOpenConns == 0 || c.Postgres.MaxIdleConns <= c.Postgres.MaxOpenConns,
+		"postgres.maxIdleConns must not exceed postgres.maxOpenConns",
+	)
+	check(c.Postgres.ConnMaxLifetime >= 0, "postgres.connMaxLifetime must not be negative")
+
+	check(c.Auth.AccessTokenTTL > 0, "auth.accessTokenTTL must be positive")
+	check(c.Auth.RefreshTokenTTL >= c.Auth.AccessTokenTTL, "auth.refreshTokenTTL must not be shorter than auth.accessTokenTTL")
+	check(
+		c.Auth.BcryptCost >= bcrypt.MinCost && c.Auth.BcryptCost <= bcrypt.MaxCost,
+		"auth.bcryptCost must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost,
+	)
+	check(c.Auth.JWTKey != "" || c.Auth.InsecureDevKey, "auth.jwtKey must be set, auth.insecureDevKey signs with the development key instead")
+	check(c.Auth.JWTKey == "" || len(c.Auth.JWTKey) >= 32, "auth.jwtKey must be at least 32 characters")
+	check(c.Auth.PreviousJWTKey == "" || c.Auth.JWTKey != "", "auth.previousJwtKey must be set with auth.jwtKey")
+
+	check(c.Cache.Size >= 0, "cache.size must not be negative")
+	check(c.Cache.Size == 0 || c.Cache.TTL > 0, "cache.ttl must be positive")
+
+	switch c.Tracing.Exporter {
+	case "", tracing.OTLP, tracing.Stdout:
+	default:
+		check(false, "tracing.exporter %q is not one of otlp and stdout", c.Tracing.Exporter)
+	}
+	check(c.Tracing.Exporter != tracing.OTLP || c.Tracing.Endpoint != "", "tracing.endpoint must be set for the otlp exporter")
+	check(c.Tracing.SampleRatio >= 0 && c.Tracing.SampleRatio <= 1, "tracing.sampleRatio must be between 0 and 1")
+	check(c.Tracing.Exporter == "" || c.Tracing.ServiceName != "", "tracing.serviceName must be set")
+
+	check(c.Audit.SigningKey == "" || c.Audit.CheckpointInterval > 0, "audit.checkpointInterval must be positive")
+
+	for _, sink := range c.Events.Sinks {
+		check(sink == "log" || sink == "webhook", "events.sinks %q is not one of log and webhook", sink)
+		check(sink != "webhook" || c.Events.WebhookURL != "", "events.webhookUrl must be set for the webhook sink")
+	}
+	check(c.Events.PollInterval > 0, "events.pollInterval must be positive")
+	check(c.Events.Retention > 0, "events.retention must be positive")
+
+	check(c.Webhooks.PollInterval > 0, "webhooks.pollInterval must be positive")
+	check(c.Webhooks.Retention > 0, "webhooks.retention must be positive")
+
+	check(c.Users.Retention >= 0, "users.retention must not be negative")
+	check(c.Users.PurgeInterval > 0, "users.purgeInterval must be positive")
+
+	if c.LDAP.URL != "" {
+		check(c.LDAP.BindDNTemplate != "" || c.LDAP.UserBaseDN != "", "ldap.userBaseDn must be set without ldap.bindDnTemplate")
+		check(c.LDAP.GroupBaseDN == "" || c.LDAP.SyncInterval > 0, "ldap.syncInterval must be positive")
+	}
+
+	if c.OIDC.Issuer != "" {
+		check(c.OIDC.ClientID != "", "oidc.clientId must be set with oidc.issuer")
+		check(c.OIDC.RedirectURL != "", "oidc.redirectUrl must be set with oidc.issuer")
+	}
+
+	check(c.WebAuthn.RPID == "" || c.WebAuthn.Timeout > 0, "webauthn.timeout must be positive")
+
+	if len(problems) > 0 {
+		return fmt.Errorf("%w: %s", InvalidErr, strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// field is a setting of a section, key is its path in the file.
+type field struct {
+	key string
+	tag reflect.StructTag
+	v   reflect.Value
+}
+
+func fields(c *Config) []field {
+	var fs []field
+	sections := reflect.ValueOf(c).Elem()
+	for i := 0; i < sections.NumField(); i++ {
+		section := sections.Field(i)
+		if section.Kind() != reflect.Struct {
+			continue
+		}
+		prefix := sections.Type().Field(i).Tag.Get("yaml")
+		for j := 0; j < section.NumField(); j++ {
+			sf := section.Type().Field(j)
+			fs = append(fs, field{prefix + "." + sf.Tag.Get("yaml"), sf.Tag, section.Field(j)})
+		}
+	}
+	return fs
+}
+
+func (f field) String() string {
+	return fmt.Sprint(f.v.Interface())
+}
+
+func (f field) set(s string) error {
+	switch p := f.v.Addr().Interface().(type) {
+	case *string:
+		*p = s
+	case *bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return fmt.Errorf("%q is not a boolean", s)
+		}
+		*p = b
+	case *int:
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return fmt.Errorf("%q is not a number", s)
+		}
+		*p = n
+	case *float64:
+		n, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return fmt.Errorf("%q is not a number", s)
+		}
+		*p = n
+	case *time.Duration:
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return fmt.Errorf("%q is not a duration", s)
+		}
+		*p = d
+	case *[]string:
+		*p = strings.FieldsFunc(s, func(r rune) bool { return r == ',' || unicode.IsSpace(r) })
+	case *map[string]string:
+		m := map[string]string{}
+		for _, pair := range strings.Split(s, ",") {
+			if strings.TrimSpace(pair) == "" {
+				continue
+			}
+			kv := strings.SplitN(pair, "=", 2)
+			if len(kv) != 2 || strings.TrimSpace(kv[0]) == "" || strings.TrimSpace(kv[1]) == "" {
+				return fmt.Errorf("%q is not a list of key=value pairs", s)
+			}
+			m[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+		}
+		*p = m
+	}
+	return nil
+}
@@ -0,0 +1,144 @@
+package config_test
+
+import (
+	"errors"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/raisultan/abac/pkg/config"
+)
+
+const jwtKey = "0123456789abcdef0123456789abcdef"
+
+func setenv(t *testing.T, env map[string]string) {
+	t.Helper()
+	for k, v := range env {
+		old, ok := os.LookupEnv(k)
+		os.Setenv(k, v)
+		k := k
+		t.Cleanup(func() {
+			if ok {
+				os.Setenv(k, old)
+			} else {
+				os.Unsetenv(k)
+			}
+		})
+	}
+}
+
+func load(args ...string) (config.Config, error) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	return config.Load(fs, args)
+}
+
+func TestLoadRequiresJWTKey(t *testing.T) {
+	setenv(t, map[string]string{"STORAGE_DRIVER": "memory"})
+
+	_, err := load()
+	if !errors.Is(err, config.InvalidErr) || !strings.Contains(err.Error(), "auth.jwtKey must be set") {
+		t.Errorf("without a key: got %v, want auth.jwtKey to be required", err)
+	}
+
+	setenv(t, map[string]string{"AUTH_INSECURE_DEV_KEY": "true"})
+	if _, err := load(); err != nil {
+		t.Errorf("with the development key: %v", err)
+	}
+
+	setenv(t, map[string]string{"AUTH_INSECURE_DEV_KEY": "false", "AUTH_JWT_KEY": jwtKey})
+	if _, err := load(); err != nil {
+		t.Errorf("with a key: %v", err)
+	}
+}
+
+func TestLoadFeatureSettings(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	err := ioutil.WriteFile(path, []byte(`
+storage:
+  driver: memory
+auth:
+  jwtKey: `+jwtKey+`
+policy:
+  file: policies.json
+oidc:
+  issuer: https://idp.example.org
+  clientId: abac
+  redirectUrl: https://abac.example.org/oidc/callback
+  scopes: [openid, email]
+  groupMapping:
+    idp-admins: admins
+ldap:
+  url: ldaps://ldap.example.org
+  userBaseDn: ou=people,dc=example,dc=org
+`), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	setenv(t, map[string]string{
+		"EVENT_SINKS":        "log, webhook",
+		"EVENT_WEBHOOK_URL":  "https://hooks.example.org",
+		"OIDC_SCOPES":        "openid email profile groups",
+		"WEBAUTHN_ORIGINS":   "https://a.example.org,https://b.example.org",
+		"LDAP_SYNC_INTERVAL": "1m",
+	})
+
+	c, err := load("-config", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if c.Policy.File != "policies.json" {
+		t.Errorf("policy.file %q, want policies.json", c.Policy.File)
+	}
+	if want := []string{"log", "webhook"}; !reflect.DeepEqual(c.Events.Sinks, want) {
+		t.Errorf("events.sinks %q, want %q", c.Events.Sinks, want)
+	}
+	if want := []string{"openid", "email", "profile", "groups"}; !reflect.DeepEqual(c.OIDC.Scopes, want) {
+		t.Errorf("oidc.scopes %q, want %q", c.OIDC.Scopes, want)
+	}
+	if want := map[string]string{"idp-admins": "admins"}; !reflect.DeepEqual(c.OIDC.GroupMapping, want) {
+		t.Errorf("oidc.groupMapping %v, want %v", c.OIDC.GroupMapping, want)
+	}
+	if want := []string{"https://a.example.org", "https://b.example.org"}; !reflect.DeepEqual(c.WebAuthn.Origins, want) {
+		t.Errorf("webauthn.origins %q, want %q", c.WebAuthn.Origins, want)
+	}
+	if c.LDAP.SyncInterval != time.Minute || c.LDAP.UserFilter != "(mail={email})" {
+		t.Errorf("ldap.syncInterval %s and userFilter %q, want 1m and the default", c.LDAP.SyncInterval, c.LDAP.UserFilter)
+	}
+	if c.Users.Retention != 30*24*time.Hour {
+		t.Errorf("users.retention %s, want the default of 720h", c.Users.Retention)
+	}
+}
+
+func TestLoadRejectsInvalidFeatureSettings(t *testing.T) {
+	setenv(t, map[string]string{
+		"STORAGE_DRIVER":     "memory",
+		"AUTH_JWT_KEY":       jwtKey,
+		"EVENT_SINKS":        "webhook,kafka",
+		"OIDC_ISSUER":        "https://idp.example.org",
+		"OIDC_GROUP_MAPPING": "idp-admins",
+	})
+
+	_, err := load()
+	if !errors.Is(err, config.InvalidErr) {
+		t.Fatalf("got %v, want %v", err, config.InvalidErr)
+	}
+	if !strings.Contains(err.Error(), "OIDC_GROUP_MAPPING") {
+		t.Errorf("%v does not report OIDC_GROUP_MAPPING", err)
+	}
+
+	setenv(t, map[string]string{"OIDC_GROUP_MAPPING": "idp-admins=admins"})
+	_, err = load()
+	for _, problem := range []string{`"kafka"`, "events.webhookUrl", "oidc.clientId", "oidc.redirectUrl"} {
+		if err == nil || !strings.Contains(err.Error(), problem) {
+			t.Errorf("%v does not report %s", err, problem)
+		}
+	}
+}
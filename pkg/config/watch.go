@@ -0,0 +1,52 @@
+package config
+
+import (
+	"context"
+	"os"
+	"time"
+)
+
+// RunWatcher calls changed whenever one of the files at paths is modified,
+// created or removed. Files are checked every interval until ctx is done.
+func RunWatcher(ctx context.Context, paths []string, interval time.Duration, changed func()) {
+	last := stat(paths)
+
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+
+		current := stat(paths)
+		for p, s := range current {
+			if s != last[p] {
+				changed()
+				break
+			}
+		}
+		last = current
+	}
+}
+
+// fileState is what a change of a file is told by, the zero value stands
+// for a missing file.
+type fileState struct {
+	modTime time.Time
+	size    int64
+}
+
+func stat(paths []string) map[string]fileState {
+	states := make(map[string]fileState, len(paths))
+	for _, p := range paths {
+		if fi, err := os.Stat(p); err == nil {
+			states[p] = fileState{fi.ModTime(), fi.Size()}
+		} else {
+			states[p] = fileState{}
+		}
+	}
+	return states
+}
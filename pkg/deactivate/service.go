@@ -0,0 +1,47 @@
+package deactivate
+
+import (
+	"context"
+
+	"github.com/raisultan/abac/pkg/event"
+	"github.com/raisultan/abac/pkg/storage"
+)
+
+// Service disables users without deleting them, disabled users can not
+// log in or refresh their tokens.
+type Service interface {
+	DeactivateUser(context.Context, int) error
+	ActivateUser(context.Context, int) error
+}
+
+type Repository interface {
+	storage.Transactor
+
+	SetUserDisabled(ctx context.Context, id int, disabled bool) error
+	AppendEvent(context.Context, event.Event) error
+}
+
+type service struct {
+	r Repository
+}
+
+func NewService(r Repository) Service {
+	return &service{r}
+}
+
+func (s *service) DeactivateUser(ctx context.Context, id int) error {
+	return s.setDisabled(ctx, id, true, event.UserDeactivated)
+}
+
+func (s *service) ActivateUser(ctx context.Context, id int) error {
+	return s.setDisabled(ctx, id, false, event.UserActivated)
+}
+
+func (s *service) setDisabled(ctx context.Context, id int, disabled bool, typ string) error {
+	return s.r.WithinTx(ctx, func(ctx context.Context) error {
+		if err := s.r.SetUserDisabled(ctx, id, disabled); err != nil {
+			return err
+		}
+		return s.r.AppendEvent(ctx, event.New(typ, event.UserSubject(id), map[string]interface{}{"id": id}))
+	})
+}
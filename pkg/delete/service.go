@@ -1,11 +1,29 @@
 package delete
 
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/raisultan/abac/pkg/event"
+	"github.com/raisultan/abac/pkg/storage"
+)
+
 type Service interface {
-	DeleteUser(int) error
+	DeleteUser(context.Context, int) error
+	RestoreUser(context.Context, int) error
+	PurgeDeletedUsers(ctx context.Context, before time.Time) (int64, error)
 }
 
+// Repository soft deletes users, they keep their email reserved and can be
+// restored until they are purged.
 type Repository interface {
-	DeleteUser(int) error
+	storage.Transactor
+
+	DeleteUser(context.Context, int) error
+	RestoreUser(context.Context, int) error
+	PurgeDeletedUsers(ctx context.Context, before time.Time) (int64, error)
+	AppendEvent(context.Context, event.Event) error
 }
 
 type service struct {
@@ -16,6 +34,46 @@ func NewService(r Repository) Service {
 	return &service{r}
 }
 
-func (s *service) DeleteUser(id int) error {
-	return s.r.DeleteUser(id)
+func (s *service) DeleteUser(ctx context.Context, id int) error {
+	return s.r.WithinTx(ctx, func(ctx context.Context) error {
+		if err := s.r.DeleteUser(ctx, id); err != nil {
+			return err
+		}
+		return s.r.AppendEvent(ctx, event.New(event.UserDeleted, event.UserSubject(id), map[string]interface{}{"id": id}))
+	})
+}
+
+func (s *service) RestoreUser(ctx context.Context, id int) error {
+	return s.r.WithinTx(ctx, func(ctx context.Context) error {
+		if err := s.r.RestoreUser(ctx, id); err != nil {
+			return err
+		}
+		return s.r.AppendEvent(ctx, event.New(event.UserRestored, event.UserSubject(id), map[string]interface{}{"id": id}))
+	})
+}
+
+func (s *service) PurgeDeletedUsers(ctx context.Context, before time.Time) (int64, error) {
+	return s.r.PurgeDeletedUsers(ctx, before)
+}
+
+// RunPurge permanently removes users deleted longer than retention ago,
+// every interval until ctx is done.
+func RunPurge(ctx context.Context, s Service, retention, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		n, err := s.PurgeDeletedUsers(ctx, time.Now().Add(-retention))
+		if err != nil {
+			log.Println("purging deleted users failed:", err)
+		} else if n > 0 {
+			log.Printf("purged %d deleted users", n)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
 }
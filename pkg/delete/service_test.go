@@ -0,0 +1,64 @@
+package delete_test
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/raisultan/abac/pkg/delete"
+	"github.com/raisultan/abac/pkg/event"
+	"github.com/raisultan/abac/pkg/register"
+	"github.com/raisultan/abac/pkg/storage/memory"
+)
+
+// published returns the types of the events appended since the last call.
+func published(t *testing.T, s *memory.Storage) []string {
+	t.Helper()
+
+	events, err := s.ClaimEvents(context.Background(), 10, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	types := []string{}
+	for _, e := range events {
+		types = append(types, e.Type)
+		if err := s.MarkEventPublished(context.Background(), e.ID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return types
+}
+
+func TestDeleteAndRestoreEmitEvents(t *testing.T) {
+	ctx := context.Background()
+	s := memory.NewStorage()
+	u, err := s.CreateUser(ctx, register.UserRegisterRequest{Email: "ada@example.com", Password: "password"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	published(t, s)
+	svc := delete.NewService(s)
+
+	if err := svc.DeleteUser(ctx, u.ID); err != nil {
+		t.Fatal(err)
+	}
+	if got := published(t, s); len(got) != 1 || got[0] != event.UserDeleted {
+		t.Errorf("deleting emitted %v, want %s", got, event.UserDeleted)
+	}
+
+	if err := svc.RestoreUser(ctx, u.ID); err != nil {
+		t.Fatal(err)
+	}
+	if got := published(t, s); len(got) != 1 || got[0] != event.UserRestored {
+		t.Errorf("restoring emitted %v, want %s", got, event.UserRestored)
+	}
+
+	// restoring a user that is not deleted changes nothing
+	if err := svc.RestoreUser(ctx, u.ID); err != sql.ErrNoRows {
+		t.Errorf("restoring again: got %v, want %v", err, sql.ErrNoRows)
+	}
+	if got := published(t, s); len(got) != 0 {
+		t.Errorf("restoring again emitted %v", got)
+	}
+}
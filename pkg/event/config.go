@@ -0,0 +1,40 @@
+package event
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Config selects the sinks events are published to, out of log and
+// webhook.
+type Config struct {
+	Sinks        []string
+	WebhookURL   string
+	PollInterval time.Duration
+	Retention    time.Duration
+}
+
+var (
+	UnknownSinkErr        = errors.New("Unknown event sink")
+	WebhookURLRequiredErr = errors.New("EVENT_WEBHOOK_URL is required for the webhook sink")
+)
+
+// NewSinks builds the configured sinks by name.
+func (c Config) NewSinks() (map[string]Sink, error) {
+	sinks := map[string]Sink{}
+	for _, name := range c.Sinks {
+		switch name {
+		case "log":
+			sinks[name] = LogSink{}
+		case "webhook":
+			if c.WebhookURL == "" {
+				return nil, WebhookURLRequiredErr
+			}
+			sinks[name] = NewWebhookSink(c.WebhookURL)
+		default:
+			return nil, fmt.Errorf("%w: %s", UnknownSinkErr, name)
+		}
+	}
+	return sinks, nil
+}
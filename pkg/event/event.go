@@ -0,0 +1,80 @@
+package event
+
+import (
+	"strconv"
+	"time"
+)
+
+const (
+	UserCreated           = "user.created"
+	UserApproved          = "user.approved"
+	UserUpdated           = "user.updated"
+	UserDeleted           = "user.deleted"
+	UserRestored          = "user.restored"
+	UserDeactivated       = "user.deactivated"
+	UserActivated         = "user.activated"
+	UserAttributesUpdated = "user.attributes_updated"
+	AttributeSaved        = "attribute.saved"
+	AttributeDeleted      = "attribute.deleted"
+	GroupUpdated          = "group.updated"
+	GroupDeleted          = "group.deleted"
+	PolicyPublished       = "policy.published"
+)
+
+// Types lists every event type that is emitted.
+var Types = []string{
+	UserCreated,
+	UserApproved,
+	UserUpdated,
+	UserDeleted,
+	UserRestored,
+	UserDeactivated,
+	UserActivated,
+	UserAttributesUpdated,
+	AttributeSaved,
+	AttributeDeleted,
+	GroupUpdated,
+	GroupDeleted,
+	PolicyPublished,
+}
+
+func IsType(typ string) bool {
+	for _, t := range Types {
+		if t == typ {
+			return true
+		}
+	}
+	return false
+}
+
+// Event is a domain event. It is stored in the outbox in the same
+// transaction as the change it describes and published to the sinks
+// afterwards, at least once.
+type Event struct {
+	ID      int64       `json:"id"`
+	Type    string      `json:"type"`
+	Subject string      `json:"subject"`
+	Time    time.Time   `json:"time"`
+	Data    interface{} `json:"data"`
+
+	// Attempts counts the failed deliveries so far, PublishedTo names the
+	// sinks that already have the event
+	Attempts    int      `json:"-"`
+	PublishedTo []string `json:"-"`
+}
+
+func New(typ, subject string, data interface{}) Event {
+	return Event{Type: typ, Subject: subject, Time: time.Now(), Data: data}
+}
+
+func UserSubject(id int) string {
+	return "user:" + strconv.Itoa(id)
+}
+
+func AttributeSubject(name string) string {
+	return "attribute:" + name
+}
+
+func GroupSubject(name string) string {
+	return "group:" + name
+}
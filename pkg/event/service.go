@@ -0,0 +1,208 @@
+package event
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/raisultan/abac/pkg/authorize"
+)
+
+const (
+	dispatchBatchSize = 100
+
+	// claimed events are not handed out again for this long, so a crashed
+	// dispatcher does not hold them forever
+	claimLease = time.Minute
+
+	minRetryDelay = 5 * time.Second
+	maxRetryDelay = time.Hour
+)
+
+type Service interface {
+	// PublishPolicies appends a policy.published event unless the policy
+	// set is the one last published.
+	PublishPolicies(context.Context, *authorize.PolicySet) (bool, error)
+
+	// Dispatch publishes a batch of pending events to every sink that does
+	// not have them yet and returns how many were published to all.
+	Dispatch(ctx context.Context) (int, error)
+
+	// PurgePublished removes events published before the given time.
+	PurgePublished(ctx context.Context, before time.Time) (int64, error)
+}
+
+type Repository interface {
+	AppendEvent(context.Context, Event) error
+	LatestEvent(ctx context.Context, typ string) (Event, error)
+
+	// ClaimEvents returns pending events that are due, oldest first, and
+	// keeps other dispatchers from claiming them for lease. Events are held
+	// back while an earlier event of their subject is pending, so the sinks
+	// get the events of a subject in order.
+	ClaimEvents(ctx context.Context, limit int, lease time.Duration) ([]Event, error)
+	MarkEventPublished(ctx context.Context, id int64) error
+
+	// RetryEvent counts a failed delivery, records the sinks the event was
+	// published to and makes it due at the given time.
+	RetryEvent(ctx context.Context, id int64, at time.Time, reason string, publishedTo []string) error
+	PurgePublishedEvents(ctx context.Context, before time.Time) (int64, error)
+}
+
+type service struct {
+	r     Repository
+	names []string
+	sinks map[string]Sink
+}
+
+// NewService publishes events to sinks, which are told apart by name when
+// a delivery is recorded.
+func NewService(r Repository, sinks map[string]Sink) Service {
+	names := make([]string, 0, len(sinks))
+	for name := range sinks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return &service{r, names, sinks}
+}
+
+func (s *service) PublishPolicies(ctx context.Context, ps *authorize.PolicySet) (bool, error) {
+	b, err := json.Marshal(ps)
+	if err != nil {
+		return false, err
+	}
+	sum := sha256.Sum256(b)
+	digest := hex.EncodeToString(sum[:])
+
+	last, err := s.r.LatestEvent(ctx, PolicyPublished)
+	if err != nil && err != sql.ErrNoRows {
+		return false, err
+	}
+	if data, ok := last.Data.(map[string]interface{}); ok && data["digest"] == digest {
+		return false, nil
+	}
+
+	ids := make([]string, 0, len(ps.Policies))
+	for _, p := range ps.Policies {
+		ids = append(ids, p.ID)
+	}
+
+	err = s.r.AppendEvent(ctx, New(PolicyPublished, "policies", map[string]interface{}{
+		"digest":   digest,
+		"policies": ids,
+	}))
+	return err == nil, err
+}
+
+func (s *service) Dispatch(ctx context.Context) (int, error) {
+	events, err := s.r.ClaimEvents(ctx, dispatchBatchSize, claimLease)
+	if err != nil {
+		return 0, err
+	}
+	sort.Slice(events, func(i, j int) bool { return events[i].ID < events[j].ID })
+
+	published := 0
+	for _, e := range events {
+		if publishedTo, err := s.publish(ctx, e); err != nil {
+			at := time.Now().Add(retryDelay(e.Attempts))
+			if err := s.r.RetryEvent(ctx, e.ID, at, err.Error(), publishedTo); err != nil {
+				return published, err
+			}
+			continue
+		}
+
+		if err := s.r.MarkEventPublished(ctx, e.ID); err != nil {
+			return published, err
+		}
+		published++
+	}
+
+	return published, nil
+}
+
+// publish hands e to the sinks that do not have it yet and returns the
+// sinks that have it now. A failing sink does not keep e from the others.
+func (s *service) publish(ctx context.Context, e Event) ([]string, error) {
+	publishedTo := append([]string{}, e.PublishedTo...)
+	failed := []string{}
+
+	for _, name := range s.names {
+		if contains(e.PublishedTo, name) {
+			continue
+		}
+		if err := s.sinks[name].Publish(ctx, e); err != nil {
+			failed = append(failed, name+": "+err.Error())
+			continue
+		}
+		publishedTo = append(publishedTo, name)
+	}
+
+	if len(failed) > 0 {
+		return publishedTo, errors.New(strings.Join(failed, "; "))
+	}
+	return publishedTo, nil
+}
+
+func contains(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *service) PurgePublished(ctx context.Context, before time.Time) (int64, error) {
+	return s.r.PurgePublishedEvents(ctx, before)
+}
+
+// retryDelay doubles with every failed attempt, up to maxRetryDelay.
+func retryDelay(attempts int) time.Duration {
+	d := minRetryDelay
+	for i := 0; i < attempts && d < maxRetryDelay; i++ {
+		d *= 2
+	}
+	if d > maxRetryDelay {
+		d = maxRetryDelay
+	}
+	return d
+}
+
+// RunDispatcher publishes pending events every interval and removes
+// events published longer than retention ago, until ctx is done.
+func RunDispatcher(ctx context.Context, s Service, interval, retention time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		// keep going while events are published, each one can release the
+		// next event of its subject
+		for {
+			n, err := s.Dispatch(ctx)
+			if err != nil {
+				log.Println("dispatching events failed:", err)
+			}
+			if err != nil || n == 0 {
+				break
+			}
+		}
+
+		if _, err := s.PurgePublished(ctx, time.Now().Add(-retention)); err != nil {
+			log.Println("purging published events failed:", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
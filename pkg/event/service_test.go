@@ -0,0 +1,97 @@
+package event_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/raisultan/abac/pkg/event"
+	"github.com/raisultan/abac/pkg/storage/memory"
+)
+
+// recorder keeps the types of the events it got, failing while broken.
+type recorder struct {
+	mu     sync.Mutex
+	broken bool
+	got    []string
+}
+
+func (r *recorder) Publish(_ context.Context, e event.Event) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.broken {
+		return errors.New("unavailable")
+	}
+	r.got = append(r.got, e.Type)
+	return nil
+}
+
+// dueNow makes failed events due again right away and keeps the reasons.
+type dueNow struct {
+	*memory.Storage
+	reasons []string
+}
+
+func (r *dueNow) RetryEvent(ctx context.Context, id int64, _ time.Time, reason string, publishedTo []string) error {
+	r.reasons = append(r.reasons, reason)
+	return r.Storage.RetryEvent(ctx, id, time.Now().Add(-time.Second), reason, publishedTo)
+}
+
+func dispatch(t *testing.T, svc event.Service, want int) {
+	t.Helper()
+	n, err := svc.Dispatch(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != want {
+		t.Fatalf("published %d events, want %d", n, want)
+	}
+}
+
+func TestDispatchRetriesFailedSinkAlone(t *testing.T) {
+	ctx := context.Background()
+	r := &dueNow{Storage: memory.NewStorage()}
+	healthy, broken := &recorder{}, &recorder{broken: true}
+	svc := event.NewService(r, map[string]event.Sink{"healthy": healthy, "broken": broken})
+
+	for _, e := range []event.Event{
+		event.New(event.UserCreated, event.UserSubject(1), nil),
+		event.New(event.UserUpdated, event.UserSubject(1), nil),
+		event.New(event.UserCreated, event.UserSubject(2), nil),
+	} {
+		if err := r.AppendEvent(ctx, e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the update waits for the creation of its user, the healthy sink gets
+	// the others right away and is not handed them again
+	dispatch(t, svc, 0)
+	dispatch(t, svc, 0)
+	if want := []string{event.UserCreated, event.UserCreated}; !reflect.DeepEqual(healthy.got, want) {
+		t.Errorf("healthy sink got %v, want %v", healthy.got, want)
+	}
+	if len(r.reasons) != 4 || !strings.Contains(r.reasons[0], "broken: unavailable") {
+		t.Errorf("retried for %q, want the broken sink reported 4 times", r.reasons)
+	}
+
+	broken.mu.Lock()
+	broken.broken = false
+	broken.mu.Unlock()
+
+	dispatch(t, svc, 2)
+	dispatch(t, svc, 1)
+	dispatch(t, svc, 0)
+
+	want := []string{event.UserCreated, event.UserCreated, event.UserUpdated}
+	if !reflect.DeepEqual(healthy.got, want) {
+		t.Errorf("healthy sink got %v, want %v", healthy.got, want)
+	}
+	if !reflect.DeepEqual(broken.got, want) {
+		t.Errorf("repaired sink got %v, want %v", broken.got, want)
+	}
+}
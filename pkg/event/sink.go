@@ -0,0 +1,84 @@
+package event
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+// Sink publishes events somewhere outside the outbox. A failed Publish is
+// retried later, on that sink alone, and sinks have to cope with
+// duplicates all the same.
+type Sink interface {
+	Publish(ctx context.Context, e Event) error
+}
+
+// LogSink writes every event to the standard logger.
+type LogSink struct{}
+
+func (LogSink) Publish(_ context.Context, e Event) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	log.Println("event:", string(b))
+	return nil
+}
+
+// ChannelSink hands events to consumers in the same process.
+type ChannelSink chan Event
+
+func NewChannelSink(buffer int) ChannelSink {
+	return make(ChannelSink, buffer)
+}
+
+func (c ChannelSink) Publish(ctx context.Context, e Event) error {
+	select {
+	case c <- e:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// WebhookSink posts every event as JSON to a URL and fails on any
+// non-2xx response.
+type WebhookSink struct {
+	URL    string
+	Client *http.Client
+}
+
+func NewWebhookSink(url string) *WebhookSink {
+	return &WebhookSink{URL: url, Client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+func (w *WebhookSink) Publish(ctx context.Context, e Event) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, w.URL, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Event-Type", e.Type)
+	req.Header.Set("X-Event-Id", fmt.Sprint(e.ID))
+
+	resp, err := w.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook responded with %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,157 @@
+package rest
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/raisultan/abac/pkg/attribute"
+	"github.com/raisultan/abac/pkg/audit"
+	"github.com/raisultan/abac/pkg/retrieve"
+)
+
+const AttributeNotFoundErrMsg = "Attribute not found"
+
+func listAttributeDefinitions(s attribute.Service) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := validateAuth(r); err != nil {
+			respondWithErrorMessage(w, http.StatusUnauthorized, err.Error())
+			return
+		}
+
+		defs, err := s.ListDefinitions(r.Context())
+		if err != nil {
+			respondWithErrorMessage(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		respondWithJSON(w, http.StatusOK, defs)
+	}
+}
+
+func saveAttributeDefinition(s attribute.Service, retr retrieve.Service) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := authenticateAdmin(r, retr); err != nil {
+			respondWithAuthError(w, err)
+			return
+		}
+
+		var d attribute.Definition
+		decoder := json.NewDecoder(r.Body)
+		decoder.UseNumber()
+		if err := decoder.Decode(&d); err != nil {
+			respondWithErrorMessage(w, http.StatusBadRequest, InvalidReqPayloadErrMsg)
+			return
+		}
+		defer r.Body.Close()
+
+		d.Name = mux.Vars(r)["name"]
+		d, err := s.SaveDefinition(r.Context(), d)
+		if err != nil {
+			switch err {
+			case attribute.InvalidDefinitionErr, attribute.ReservedNameErr:
+				respondWithErrorMessage(w, http.StatusBadRequest, err.Error())
+			default:
+				respondWithErrorMessage(w, http.StatusInternalServerError, err.Error())
+			}
+			return
+		}
+
+		respondWithJSON(w, http.StatusOK, d)
+	}
+}
+
+func deleteAttributeDefinition(s attribute.Service, retr retrieve.Service) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := authenticateAdmin(r, retr); err != nil {
+			respondWithAuthError(w, err)
+			return
+		}
+
+		if err := s.DeleteDefinition(r.Context(), mux.Vars(r)["name"]); err != nil {
+			if err == sql.ErrNoRows {
+				respondWithErrorMessage(w, http.StatusNotFound, AttributeNotFoundErrMsg)
+				return
+			}
+			respondWithErrorMessage(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		respondWithJSON(w, http.StatusOK, map[string]string{"result": "success"})
+	}
+}
+
+func getUserAttributes(s attribute.Service) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := validateAuth(r); err != nil {
+			respondWithErrorMessage(w, http.StatusUnauthorized, err.Error())
+			return
+		}
+
+		id, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			respondWithErrorMessage(w, http.StatusBadRequest, InvalidUserIDErrMsg)
+			return
+		}
+
+		attrs, err := s.GetUserAttributes(r.Context(), id)
+		if err != nil {
+			respondWithUserError(w, err)
+			return
+		}
+
+		respondWithJSON(w, http.StatusOK, attrs)
+	}
+}
+
+// setUserAttributes replaces the attributes of a user on PUT and merges
+// them on PATCH. Only admins can change attributes as they grant access.
+func setUserAttributes(s attribute.Service, retr retrieve.Service, au audit.Service) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := authenticateAdmin(r, retr); err != nil {
+			respondWithAuthError(w, err)
+			return
+		}
+
+		id, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			respondWithErrorMessage(w, http.StatusBadRequest, InvalidUserIDErrMsg)
+			return
+		}
+
+		var attrs map[string]interface{}
+		decoder := json.NewDecoder(r.Body)
+		decoder.UseNumber()
+		if err := decoder.Decode(&attrs); err != nil || attrs == nil {
+			respondWithErrorMessage(w, http.StatusBadRequest, InvalidReqPayloadErrMsg)
+			return
+		}
+		defer r.Body.Close()
+
+		before, err := s.GetUserAttributes(r.Context(), id)
+		if err != nil {
+			respondWithUserError(w, err)
+			return
+		}
+
+		if r.Method == http.MethodPatch {
+			attrs, err = s.PatchUserAttributes(r.Context(), id, attrs)
+		} else {
+			attrs, err = s.ReplaceUserAttributes(r.Context(), id, attrs)
+		}
+		if err != nil {
+			if vErr, ok := err.(*attribute.ValidationErr); ok {
+				respondWithJSON(w, http.StatusBadRequest, vErr)
+				return
+			}
+			respondWithUserError(w, err)
+			return
+		}
+
+		recordUserChange(r, au, audit.UserAttrsEvent, id, "", before, attrs)
+
+		respondWithJSON(w, http.StatusOK, attrs)
+	}
+}
@@ -0,0 +1,128 @@
+package rest
+
+import (
+	"net"
+	"net/http"
+	"strconv"
+
+	"github.com/raisultan/abac/pkg/audit"
+	"github.com/raisultan/abac/pkg/metrics"
+	"github.com/raisultan/abac/pkg/retrieve"
+	"github.com/raisultan/abac/pkg/token"
+)
+
+// newAuditEvent starts an event for the request, filling in who made it.
+func newAuditEvent(r *http.Request, typ, result string) audit.Event {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	return audit.Event{
+		Type:       typ,
+		Actor:      requestActor(r),
+		Result:     result,
+		RemoteAddr: host,
+	}
+}
+
+// recordLogin records a login event and counts it by method and result.
+func recordLogin(r *http.Request, au audit.Service, e audit.Event) {
+	method, _ := e.Details["method"].(string)
+	metrics.Logins.WithLabelValues(method, e.Result).Inc()
+	au.Record(r.Context(), e)
+}
+
+// requestActor is the OAuth client or user the request was made by, the
+// credentials are assumed to have been checked already.
+func requestActor(r *http.Request) string {
+	if id, _, ok := r.BasicAuth(); ok {
+		return "client:" + id
+	}
+	if tp, err := extractTokenPayload(r); err == nil {
+		return tp.Email
+	}
+	return ""
+}
+
+// tokenEmail returns the email a token was issued to, if it is valid.
+func tokenEmail(t string) string {
+	if tp, err := token.Parse(t); err == nil {
+		return tp.Email
+	}
+	return ""
+}
+
+func userResource(id int) string {
+	return "user/" + strconv.Itoa(id)
+}
+
+func listAuditEvents(s audit.Service, retr retrieve.Service) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := authenticateAdmin(r, retr); err != nil {
+			respondWithAuthError(w, err)
+			return
+		}
+
+		q := r.URL.Query()
+		lr := audit.ListRequest{
+			Type:     q.Get("type"),
+			Actor:    q.Get("actor"),
+			Subject:  q.Get("subject"),
+			Resource: q.Get("resource"),
+			Result:   q.Get("result"),
+		}
+
+		var err error
+		if lr.From, err = parseTimeParam(q.Get("from")); err != nil {
+			respondWithErrorMessage(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if lr.To, err = parseTimeParam(q.Get("to")); err != nil {
+			respondWithErrorMessage(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if v := q.Get("limit"); v != "" {
+			if lr.Limit, err = strconv.Atoi(v); err != nil {
+				respondWithErrorMessage(w, http.StatusBadRequest, InvalidQueryParamErr.Error())
+				return
+			}
+		}
+		if v := q.Get("before"); v != "" {
+			if lr.Before, err = strconv.ParseInt(v, 10, 64); err != nil {
+				respondWithErrorMessage(w, http.StatusBadRequest, InvalidQueryParamErr.Error())
+				return
+			}
+		}
+
+		resp, err := s.ListEvents(r.Context(), lr)
+		if err != nil {
+			respondWithErrorMessage(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		if resp.NextBefore > 0 {
+			q.Set("before", strconv.FormatInt(resp.NextBefore, 10))
+			resp.Next = r.URL.Path + "?" + q.Encode()
+		}
+
+		respondWithJSON(w, http.StatusOK, resp)
+	}
+}
+
+func verifyAuditLog(s audit.Service, retr retrieve.Service) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := authenticateAdmin(r, retr); err != nil {
+			respondWithAuthError(w, err)
+			return
+		}
+
+		report, err := s.Verify(r.Context())
+		if err != nil {
+			respondWithErrorMessage(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		respondWithJSON(w, http.StatusOK, report)
+	}
+}
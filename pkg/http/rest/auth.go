@@ -1,42 +1,122 @@
 package rest
 
 import (
+	"database/sql"
 	"encoding/json"
 	"errors"
-	"fmt"
 	"net/http"
-	"strconv"
 	"strings"
 
-	"github.com/dgrijalva/jwt-go"
+	"github.com/gorilla/mux"
+	"github.com/raisultan/abac/pkg/oauth"
+	"github.com/raisultan/abac/pkg/retrieve"
+	"github.com/raisultan/abac/pkg/token"
 )
 
-var jwtKey = []byte("23a93f6d2673b09c1d3d063cf7a97fc20d0054dfce65c3737455dbec25439938")
 var UserUnauthorizedErr = errors.New("User is not authorized")
 var AccessExpectedErr = errors.New("User is not authorized")
+var AdminExpectedErr = errors.New("User is not an admin")
+var TokenRevokedErr = errors.New("Token has been revoked")
 
-type tokenPayload struct {
-	Email        string
-	Expiration   uint64
-	IsAuthorized bool
-	Type         string
+func validateAuth(r *http.Request) error {
+	_, err := authenticate(r)
+	return err
 }
 
-func validateAuth(r *http.Request) error {
+// authenticate validates the access token of the request and returns its payload.
+func authenticate(r *http.Request) (*token.Payload, error) {
 	tp, err := extractTokenPayload(r)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	if !tp.IsAuthorized {
-		return UserUnauthorizedErr
+		return nil, UserUnauthorizedErr
+	}
+	if tp.Type != token.AccessType {
+		return nil, AccessExpectedErr
+	}
+
+	return tp, nil
+}
+
+// revocationMiddleware rejects requests whose bearer token was revoked, so
+// that every endpoint authenticating with it honours revocation. Invalid
+// tokens are left to the handlers.
+func revocationMiddleware(oa oauth.Service) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			tp, err := extractTokenPayload(r)
+			if err != nil || tp.ID == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			revoked, err := oa.IsTokenRevoked(r.Context(), tp.ID)
+			if err != nil {
+				respondWithErrorMessage(w, http.StatusInternalServerError, err.Error())
+				return
+			}
+			if revoked {
+				respondWithErrorMessage(w, http.StatusUnauthorized, TokenRevokedErr.Error())
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// authenticateAdmin validates the access token of the request and checks
+// that it was issued to an admin.
+func authenticateAdmin(r *http.Request, s retrieve.Service) error {
+	tp, err := authenticate(r)
+	if err != nil {
+		return err
+	}
+
+	u, err := s.RetrieveUserByEmail(r.Context(), tp.Email)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return UserUnauthorizedErr
+		}
+		return err
 	}
-	if tp.Type != "access" {
-		return AccessExpectedErr
+	if !u.IsAdmin {
+		return AdminExpectedErr
 	}
 
 	return nil
 }
 
+// authenticateClientOrUser accepts OAuth client credentials via HTTP Basic
+// auth, which other services call us with, or a user access token. The
+// returned payload is nil for clients.
+func authenticateClientOrUser(r *http.Request, oa oauth.Service) (*token.Payload, error) {
+	if id, secret, ok := r.BasicAuth(); ok {
+		return nil, oa.AuthenticateClient(r.Context(), id, secret)
+	}
+	return authenticate(r)
+}
+
+// authenticateClientOrAdmin is like authenticateClientOrUser but only
+// accepts admins.
+func authenticateClientOrAdmin(r *http.Request, oa oauth.Service, retr retrieve.Service) error {
+	if id, secret, ok := r.BasicAuth(); ok {
+		return oa.AuthenticateClient(r.Context(), id, secret)
+	}
+	return authenticateAdmin(r, retr)
+}
+
+// respondWithAuthError responds with 403 to authenticated users that lack
+// the required rights and with 401 otherwise.
+func respondWithAuthError(w http.ResponseWriter, err error) {
+	if err == AdminExpectedErr {
+		respondWithErrorMessage(w, http.StatusForbidden, err.Error())
+		return
+	}
+	respondWithErrorMessage(w, http.StatusUnauthorized, err.Error())
+}
+
 func respondWithErrorMessage(w http.ResponseWriter, code int, message string) {
 	respondWithJSON(w, code, map[string]string{"error": message})
 }
@@ -58,74 +138,6 @@ func extractToken(r *http.Request) string {
 	return ""
 }
 
-func verifyToken(r *http.Request) (*jwt.Token, error) {
-	tokenStr := extractToken(r)
-	token, err := jwt.Parse(tokenStr, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, errors.New(
-				fmt.Sprintf(
-					"unexpected signing method: %v",
-					token.Header["alg"],
-				),
-			)
-		}
-		return jwtKey, nil
-	})
-
-	if err != nil {
-		return nil, err
-	}
-
-	return token, nil
-}
-
-func isTokenValid(r *http.Request) error {
-	token, err := verifyToken(r)
-	if err != nil {
-		return err
-	}
-	if _, ok := token.Claims.(jwt.Claims); !ok && !token.Valid {
-		return err
-	}
-	return nil
-}
-
-func extractTokenPayload(r *http.Request) (*tokenPayload, error) {
-	token, err := verifyToken(r)
-	if err != nil {
-		return nil, err
-	}
-
-	claims, ok := token.Claims.(jwt.MapClaims)
-	if ok && token.Valid {
-		email, ok := claims["email"].(string)
-		if !ok {
-			return nil, err
-		}
-
-		exp, err := strconv.ParseUint(fmt.Sprintf("%.f", claims["exp"]), 10, 64)
-		if err != nil {
-			return nil, err
-		}
-
-		isAuth, ok := claims["isAuthorized"].(bool)
-		if !ok {
-			return nil, err
-		}
-
-		tType, ok := claims["type"].(string)
-		if !ok {
-			return nil, err
-		}
-
-		tp := tokenPayload{
-			Email:        email,
-			Expiration:   exp,
-			IsAuthorized: isAuth,
-			Type:         tType,
-		}
-		return &tp, nil
-	}
-
-	return nil, err
+func extractTokenPayload(r *http.Request) (*token.Payload, error) {
+	return token.Parse(extractToken(r))
 }
@@ -0,0 +1,106 @@
+package rest
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+
+	"github.com/raisultan/abac/pkg/audit"
+	"github.com/raisultan/abac/pkg/authorize"
+	"github.com/raisultan/abac/pkg/cache"
+	"github.com/raisultan/abac/pkg/metrics"
+	"github.com/raisultan/abac/pkg/oauth"
+	"github.com/raisultan/abac/pkg/resource"
+	"github.com/raisultan/abac/pkg/retrieve"
+)
+
+const SubjectRequiredErrMsg = "Subject is required"
+
+// authorizeRequest decides whether a subject may perform an action on a
+// resource. Users can ask for themselves, admins and OAuth clients for anyone.
+func authorizeRequest(
+	s authorize.Service,
+	oa oauth.Service,
+	retr retrieve.Service,
+	rv *reqValidator,
+	au audit.Service,
+) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tp, err := authenticateClientOrUser(r, oa)
+		if err != nil {
+			respondWithErrorMessage(w, http.StatusUnauthorized, err.Error())
+			return
+		}
+
+		var ar authorize.AuthorizeRequest
+		decoder := json.NewDecoder(r.Body)
+		if err := decoder.Decode(&ar); err != nil {
+			respondWithErrorMessage(w, http.StatusBadRequest, InvalidReqPayloadErrMsg)
+			return
+		}
+		defer r.Body.Close()
+
+		isValid, vErr := validateRequest(ar, rv)
+		if !isValid {
+			respondWithJSON(w, http.StatusBadRequest, vErr)
+			return
+		}
+
+		if tp != nil {
+			if ar.Subject == "" {
+				ar.Subject = tp.Email
+			} else if ar.Subject != tp.Email {
+				if err := authenticateAdmin(r, retr); err != nil {
+					respondWithAuthError(w, err)
+					return
+				}
+			}
+		} else if ar.Subject == "" {
+			respondWithErrorMessage(w, http.StatusBadRequest, SubjectRequiredErrMsg)
+			return
+		}
+
+		// Cache-Control: no-cache decides without the cache, for debugging
+		ctx := r.Context()
+		if r.Header.Get("Cache-Control") == "no-cache" {
+			ctx = cache.Bypass(ctx)
+		}
+
+		d, err := s.Authorize(ctx, ar)
+		if err != nil {
+			switch err {
+			case sql.ErrNoRows:
+				respondWithErrorMessage(w, http.StatusNotFound, UserNotFoundErrMsg)
+			case resource.NotFoundErr:
+				respondWithErrorMessage(w, http.StatusNotFound, err.Error())
+			default:
+				respondWithErrorMessage(w, http.StatusInternalServerError, err.Error())
+			}
+			return
+		}
+
+		metrics.Decisions.WithLabelValues(d.Decision).Inc()
+
+		e := newAuditEvent(r, audit.AuthorizationEvent, d.Decision)
+		e.Subject, e.Action = ar.Subject, ar.Action
+		e.Resource = ar.Resource.Type + "/" + ar.Resource.ExternalID
+		if d.Policy != "" {
+			e.Details = map[string]interface{}{"policy": d.Policy}
+		}
+		au.Record(r.Context(), e)
+
+		respondWithJSON(w, http.StatusOK, d)
+	}
+}
+
+// getCacheStats reports the hits and misses of the decision cache.
+func getCacheStats(dc *cache.Cache, retr retrieve.Service) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := authenticateAdmin(r, retr); err != nil {
+			respondWithAuthError(w, err)
+			return
+		}
+
+		respondWithJSON(w, http.StatusOK, dc.Stats())
+	}
+}
@@ -0,0 +1,140 @@
+package rest
+
+import (
+	"errors"
+	"log"
+	"mime"
+	"net/http"
+	"strconv"
+
+	"github.com/raisultan/abac/pkg/audit"
+	"github.com/raisultan/abac/pkg/bulk"
+	"github.com/raisultan/abac/pkg/retrieve"
+)
+
+const maxImportBytes = 10 << 20
+
+var bulkContentTypes = map[string]string{
+	"text/csv":             bulk.CSV,
+	"application/x-ndjson": bulk.NDJSON,
+	"application/jsonl":    bulk.NDJSON,
+}
+
+type rowError struct {
+	Line    int                    `json:"line"`
+	Error   string                 `json:"error,omitempty"`
+	Details []fieldValidationError `json:"details,omitempty"`
+}
+
+type importError struct {
+	Errors []rowError `json:"errors"`
+}
+
+// importUsers creates or updates users from a CSV or NDJSON body. Nothing
+// is imported unless every row is valid, with dryRun=true nothing is
+// imported at all.
+func importUsers(s bulk.Service, retr retrieve.Service, rv *reqValidator, au audit.Service) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := authenticateAdmin(r, retr); err != nil {
+			respondWithAuthError(w, err)
+			return
+		}
+
+		ct, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		format, ok := bulkContentTypes[ct]
+		if !ok {
+			respondWithErrorMessage(w, http.StatusUnsupportedMediaType, UnsupportedMediaTypeErrMsg)
+			return
+		}
+
+		dryRun := false
+		if v := r.URL.Query().Get("dryRun"); v != "" {
+			var err error
+			if dryRun, err = strconv.ParseBool(v); err != nil {
+				respondWithErrorMessage(w, http.StatusBadRequest, InvalidQueryParamErr.Error())
+				return
+			}
+		}
+
+		rows, err := bulk.ReadRows(http.MaxBytesReader(w, r.Body, maxImportBytes), format)
+		defer r.Body.Close()
+		if err != nil {
+			respondWithImportError(w, err)
+			return
+		}
+
+		rowErrs := []rowError{}
+		for _, row := range rows {
+			if isValid, vErr := validateRequest(row, rv); !isValid {
+				rowErrs = append(rowErrs, rowError{Line: row.Line, Details: vErr.Details})
+			}
+		}
+		if len(rowErrs) > 0 {
+			respondWithJSON(w, http.StatusBadRequest, importError{rowErrs})
+			return
+		}
+
+		res, err := s.ImportUsers(r.Context(), rows, dryRun)
+		if err != nil {
+			respondWithImportError(w, err)
+			return
+		}
+
+		if !dryRun {
+			e := newAuditEvent(r, audit.UserImportEvent, audit.Success)
+			e.Details = map[string]interface{}{"created": res.Created, "updated": res.Updated}
+			au.Record(r.Context(), e)
+		}
+
+		respondWithJSON(w, http.StatusOK, res)
+	}
+}
+
+// exportUsers streams all users without password hashes as CSV or, by
+// default, NDJSON.
+func exportUsers(s bulk.Service, retr retrieve.Service) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := authenticateAdmin(r, retr); err != nil {
+			respondWithAuthError(w, err)
+			return
+		}
+
+		var contentType string
+		format := r.URL.Query().Get("format")
+		switch format {
+		case bulk.CSV:
+			contentType = "text/csv"
+		case bulk.NDJSON, "":
+			format, contentType = bulk.NDJSON, "application/x-ndjson"
+		default:
+			respondWithErrorMessage(w, http.StatusBadRequest, bulk.UnknownFormatErr.Error())
+			return
+		}
+
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("Content-Disposition", "attachment; filename=users."+format)
+
+		rw, err := bulk.NewRowWriter(w, format)
+		if err != nil {
+			log.Println("exporting users failed:", err)
+			return
+		}
+
+		// the status is sent with the first row, later failures can only be logged
+		if err := s.ExportUsers(r.Context(), rw); err != nil {
+			log.Println("exporting users failed:", err)
+		}
+	}
+}
+
+func respondWithImportError(w http.ResponseWriter, err error) {
+	var rowErr *bulk.RowErr
+	switch {
+	case errors.As(err, &rowErr):
+		respondWithJSON(w, http.StatusBadRequest, importError{[]rowError{{Line: rowErr.Line, Error: rowErr.Err.Error()}}})
+	case err == bulk.TooManyRowsErr:
+		respondWithErrorMessage(w, http.StatusRequestEntityTooLarge, err.Error())
+	default:
+		respondWithErrorMessage(w, http.StatusInternalServerError, err.Error())
+	}
+}
@@ -0,0 +1,62 @@
+package rest
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const PreconditionFailedErrMsg = "Precondition failed"
+
+func versionETag(version int) string {
+	return `"` + strconv.Itoa(version) + `"`
+}
+
+// parseIfMatch returns the versions listed by the If-Match header, nil when
+// the header is absent or "*" so that any version matches. ok is false when
+// no listed tag can match, weak tags never match as If-Match uses strong
+// comparison.
+func parseIfMatch(r *http.Request) (versions []int, ok bool) {
+	h := strings.TrimSpace(r.Header.Get("If-Match"))
+	if h == "" || h == "*" {
+		return nil, true
+	}
+
+	for _, t := range strings.Split(h, ",") {
+		t = strings.TrimSpace(t)
+		if len(t) < 3 || t[0] != '"' || t[len(t)-1] != '"' {
+			continue
+		}
+		if v, err := strconv.Atoi(t[1 : len(t)-1]); err == nil && v > 0 {
+			versions = append(versions, v)
+		}
+	}
+
+	return versions, len(versions) > 0
+}
+
+// matchVersion checks the current version against the versions of
+// parseIfMatch and returns the version the change is to be based on, zero
+// when any version matches.
+func matchVersion(versions []int, current int) (int, bool) {
+	if versions == nil {
+		return 0, true
+	}
+	for _, v := range versions {
+		if v == current {
+			return v, true
+		}
+	}
+	return 0, false
+}
+
+// etagMatches implements the weak comparison of If-None-Match.
+func etagMatches(header, etag string) bool {
+	for _, t := range strings.Split(header, ",") {
+		t = strings.TrimPrefix(strings.TrimSpace(t), "W/")
+		if t == "*" || t == etag {
+			return true
+		}
+	}
+	return false
+}
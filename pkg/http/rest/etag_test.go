@@ -0,0 +1,43 @@
+package rest
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestParseIfMatch(t *testing.T) {
+	for header, want := range map[string]struct {
+		versions []int
+		ok       bool
+	}{
+		"":                 {nil, true},
+		"*":                {nil, true},
+		`"3"`:              {[]int{3}, true},
+		`"3", "5"`:         {[]int{3, 5}, true},
+		`W/"3", "5"`:       {[]int{5}, true},
+		`W/"3"`:            {nil, false},
+		`"x", "0"`:         {nil, false},
+		`"1" ,  "2",W/"4"`: {[]int{1, 2}, true},
+	} {
+		r := httptest.NewRequest("PUT", "/users/1", nil)
+		r.Header.Set("If-Match", header)
+
+		versions, ok := parseIfMatch(r)
+		if !reflect.DeepEqual(versions, want.versions) || ok != want.ok {
+			t.Errorf("parseIfMatch(%q) = %v, %v, want %v, %v", header, versions, ok, want.versions, want.ok)
+		}
+	}
+}
+
+func TestMatchVersion(t *testing.T) {
+	if v, ok := matchVersion(nil, 7); v != 0 || !ok {
+		t.Errorf("any version: got %d, %v, want 0, true", v, ok)
+	}
+	if v, ok := matchVersion([]int{3, 7}, 7); v != 7 || !ok {
+		t.Errorf("listed version: got %d, %v, want 7, true", v, ok)
+	}
+	if _, ok := matchVersion([]int{3, 5}, 7); ok {
+		t.Error("unlisted version matched")
+	}
+}
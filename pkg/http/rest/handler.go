@@ -3,18 +3,34 @@ package rest
 import (
 	"database/sql"
 	"encoding/json"
+	"io/ioutil"
 	"log"
+	"mime"
 	"net/http"
 	"strconv"
 
 	"github.com/gorilla/mux"
+	"github.com/raisultan/abac/pkg/attribute"
+	"github.com/raisultan/abac/pkg/audit"
+	"github.com/raisultan/abac/pkg/authorize"
+	"github.com/raisultan/abac/pkg/bulk"
+	"github.com/raisultan/abac/pkg/cache"
+	"github.com/raisultan/abac/pkg/deactivate"
 	"github.com/raisultan/abac/pkg/delete"
 	"github.com/raisultan/abac/pkg/jwt_refresh"
 	"github.com/raisultan/abac/pkg/list"
 	"github.com/raisultan/abac/pkg/login"
+	"github.com/raisultan/abac/pkg/metrics"
+	"github.com/raisultan/abac/pkg/oauth"
+	"github.com/raisultan/abac/pkg/oidc"
 	"github.com/raisultan/abac/pkg/register"
+	"github.com/raisultan/abac/pkg/resource"
 	"github.com/raisultan/abac/pkg/retrieve"
+	"github.com/raisultan/abac/pkg/scim"
 	"github.com/raisultan/abac/pkg/update"
+	"github.com/raisultan/abac/pkg/webauthn"
+	"github.com/raisultan/abac/pkg/webhook"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gorilla/mux/otelmux"
 )
 
 const (
@@ -22,6 +38,8 @@ const (
 	InvalidReqPayloadErrMsg = "Invalid request payload"
 	UserNotFoundErrMsg      = "User not found"
 	InvalidCredsErrMsg      = "Invalid user credentials"
+
+	UnsupportedMediaTypeErrMsg = "Unsupported media type"
 )
 
 func Handler(
@@ -32,6 +50,18 @@ func Handler(
 	retr retrieve.Service,
 	upd update.Service,
 	del delete.Service,
+	deac deactivate.Service,
+	attr attribute.Service,
+	res resource.Service,
+	az authorize.Service,
+	bs bulk.Service,
+	au audit.Service,
+	wh webhook.Service,
+	oa oauth.Service,
+	oi oidc.Service,
+	sc scim.Service,
+	wa webauthn.Service,
+	dc *cache.Cache,
 ) *mux.Router {
 	rv, err := newReqValidator()
 	if err != nil {
@@ -43,43 +73,87 @@ func Handler(
 
 	r := mux.NewRouter()
 	r.HandleFunc("/users", listUsers(lst)).Methods("GET")
+	r.HandleFunc("/users/import", importUsers(bs, retr, &rv, au)).Methods("POST")
+	r.HandleFunc("/users/export", exportUsers(bs, retr)).Methods("GET")
 	r.HandleFunc("/users/{id:[0-9]+}", retrieveUser(retr)).Methods("GET")
-	r.HandleFunc("/users/{id:[0-9]+}", updateUser(upd, &rv)).Methods("PUT")
-	r.HandleFunc("/users/{id:[0-9]+}", deleteUser(del)).Methods("DELETE")
+	r.HandleFunc("/users/{id:[0-9]+}", updateUser(upd, retr, &rv, au)).Methods("PUT")
+	r.HandleFunc("/users/{id:[0-9]+}", patchUser(upd, retr, &rv, au)).Methods("PATCH")
+	r.HandleFunc("/users/{id:[0-9]+}", deleteUser(del, retr, au)).Methods("DELETE")
+	r.HandleFunc("/users/{id:[0-9]+}/restore", restoreUser(del, retr, au)).Methods("POST")
+	r.HandleFunc("/users/{id:[0-9]+}/deactivate", deactivateUser(deac, retr, au)).Methods("POST")
+	r.HandleFunc("/users/{id:[0-9]+}/activate", activateUser(deac, retr, au)).Methods("POST")
+	r.HandleFunc("/users/{id:[0-9]+}/approve", approveUser(upd, retr, au)).Methods("POST")
+	r.HandleFunc("/users/{id:[0-9]+}/attributes", getUserAttributes(attr)).Methods("GET")
+	r.HandleFunc("/users/{id:[0-9]+}/attributes", setUserAttributes(attr, retr, au)).Methods("PUT", "PATCH")
+
+	r.HandleFunc("/attributes", listAttributeDefinitions(attr)).Methods("GET")
+	r.HandleFunc("/attributes/{name}", saveAttributeDefinition(attr, retr)).Methods("PUT")
+	r.HandleFunc("/attributes/{name}", deleteAttributeDefinition(attr, retr)).Methods("DELETE")
+
+	r.HandleFunc("/register", registerUser(reg, &rv, au)).Methods("POST")
+	r.HandleFunc("/login", loginUser(login, &rv, au)).Methods("POST")
+	r.HandleFunc("/refresh", refreshUserJWT(ref, &rv, au)).Methods("POST")
+
+	// external identity login is only available when an upstream provider is configured
+	if oi != nil {
+		r.HandleFunc("/oidc/login", startOIDCLogin(oi)).Methods("GET")
+		r.HandleFunc("/oidc/callback", completeOIDCLogin(oi, &rv, au)).Methods("GET")
+	}
 
-	r.HandleFunc("/register", registerUser(reg, &rv)).Methods("POST")
-	r.HandleFunc("/login", loginUser(login, &rv)).Methods("POST")
-	r.HandleFunc("/refresh", refreshUserJWT(ref, &rv)).Methods("POST")
+	// passkey login is only available when a relying party is configured
+	if wa != nil {
+		r.HandleFunc("/webauthn/register/begin", beginWebAuthnRegistration(wa)).Methods("POST")
+		r.HandleFunc("/webauthn/register/finish", finishWebAuthnRegistration(wa, &rv)).Methods("POST")
+		r.HandleFunc("/webauthn/login/begin", beginWebAuthnLogin(wa, &rv)).Methods("POST")
+		r.HandleFunc("/webauthn/login/finish", finishWebAuthnLogin(wa, &rv, au)).Methods("POST")
+	}
 
-	r.Use(loggingMiddleware)
+	r.HandleFunc("/resources", listResources(res, oa)).Methods("GET")
+	r.HandleFunc("/resources/bulk", bulkUpsertResources(res, oa, retr, &rv)).Methods("POST")
+	r.HandleFunc("/resources/{type}/{externalId}", getResource(res, oa)).Methods("GET")
+	r.HandleFunc("/resources/{type}/{externalId}", putResource(res, oa, retr, &rv)).Methods("PUT")
+	r.HandleFunc("/resources/{type}/{externalId}", deleteResource(res, oa, retr)).Methods("DELETE")
 
-	return r
-}
+	r.HandleFunc("/authorize", authorizeRequest(az, oa, retr, &rv, au)).Methods("POST")
+	if dc != nil {
+		r.HandleFunc("/authorize/cache", getCacheStats(dc, retr)).Methods("GET")
+	}
 
-func listUsers(s list.Service) func(w http.ResponseWriter, r *http.Request) {
-	return func(w http.ResponseWriter, r *http.Request) {
-		if err := validateAuth(r); err != nil {
-			respondWithErrorMessage(w, http.StatusUnauthorized, err.Error())
-			return
-		}
+	r.HandleFunc("/audit", listAuditEvents(au, retr)).Methods("GET")
+	r.HandleFunc("/audit/verify", verifyAuditLog(au, retr)).Methods("GET")
 
-		limit, _ := strconv.Atoi(r.FormValue("limit"))
-		offset, _ := strconv.Atoi(r.FormValue("offser"))
+	r.HandleFunc("/webhooks", listWebhooks(wh, retr)).Methods("GET")
+	r.HandleFunc("/webhooks", saveWebhook(wh, retr, &rv)).Methods("POST")
+	r.HandleFunc("/webhooks/{id:[0-9]+}", getWebhook(wh, retr)).Methods("GET")
+	r.HandleFunc("/webhooks/{id:[0-9]+}", saveWebhook(wh, retr, &rv)).Methods("PUT")
+	r.HandleFunc("/webhooks/{id:[0-9]+}", deleteWebhook(wh, retr)).Methods("DELETE")
+	r.HandleFunc("/webhooks/{id:[0-9]+}/deliveries", listWebhookDeliveries(wh, retr)).Methods("GET")
+	r.HandleFunc(
+		"/webhooks/{id:[0-9]+}/deliveries/{deliveryId:[0-9]+}/redeliver",
+		redeliverWebhook(wh, retr),
+	).Methods("POST")
 
-		if limit > 10 || limit < 1 {
-			limit = 10
-		}
-		if offset < 0 {
-			offset = 0
-		}
+	r.HandleFunc("/oauth/introspect", introspectToken(oa, &rv)).Methods("POST")
+	r.HandleFunc("/oauth/revoke", revokeToken(oa, &rv)).Methods("POST")
 
-		users, err := s.ListUsers(limit, offset)
-		if err != nil {
-			respondWithErrorMessage(w, http.StatusInternalServerError, err.Error())
-		}
+	registerSCIMRoutes(r, sc, oa, retr, &rv, au)
 
-		respondWithJSON(w, http.StatusOK, users)
-	}
+	r.Handle("/metrics", metrics.Handler()).Methods("GET")
+
+	// the span of a request continues the trace of its traceparent header
+	r.Use(otelmux.Middleware("abac"))
+	r.Use(loggingMiddleware)
+	r.Use(metricsMiddleware)
+	r.Use(revocationMiddleware(oa))
+
+	// middlewares only run for matched routes, unmatched requests are
+	// counted by their handlers
+	r.NotFoundHandler = metricsMiddleware(http.NotFoundHandler())
+	r.MethodNotAllowedHandler = metricsMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}))
+
+	return r
 }
 
 func retrieveUser(s retrieve.Service) func(w http.ResponseWriter, r *http.Request) {
@@ -96,7 +170,7 @@ func retrieveUser(s retrieve.Service) func(w http.ResponseWriter, r *http.Reques
 			return
 		}
 
-		u, err := s.RetrieveUser(id)
+		u, err := s.RetrieveUser(r.Context(), id)
 		if err != nil {
 			switch err {
 			case sql.ErrNoRows:
@@ -107,11 +181,18 @@ func retrieveUser(s retrieve.Service) func(w http.ResponseWriter, r *http.Reques
 			return
 		}
 
+		etag := versionETag(u.Version)
+		w.Header().Set("ETag", etag)
+		if inm := r.Header.Get("If-None-Match"); inm != "" && etagMatches(inm, etag) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
 		respondWithJSON(w, http.StatusOK, u)
 	}
 }
 
-func updateUser(s update.Service, rv *reqValidator) func(w http.ResponseWriter, r *http.Request) {
+func updateUser(s update.Service, retr retrieve.Service, rv *reqValidator, au audit.Service) func(w http.ResponseWriter, r *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if err := validateAuth(r); err != nil {
 			respondWithErrorMessage(w, http.StatusUnauthorized, err.Error())
@@ -125,6 +206,12 @@ func updateUser(s update.Service, rv *reqValidator) func(w http.ResponseWriter,
 			return
 		}
 
+		versions, ok := parseIfMatch(r)
+		if !ok {
+			respondWithErrorMessage(w, http.StatusPreconditionFailed, PreconditionFailedErrMsg)
+			return
+		}
+
 		var ur update.UserUpdateRequest
 		decoder := json.NewDecoder(r.Body)
 		if err := decoder.Decode(&ur); err != nil {
@@ -139,20 +226,118 @@ func updateUser(s update.Service, rv *reqValidator) func(w http.ResponseWriter,
 			return
 		}
 
-		ur.ID = id
-		u, err := s.UpdateUser(ur)
+		before, err := retr.RetrieveUser(r.Context(), id)
+		if err != nil {
+			respondWithUserError(w, err)
+			return
+		}
+
+		// the version is still checked by the update, the user may change
+		// in between
+		version, ok := matchVersion(versions, before.Version)
+		if !ok {
+			respondWithErrorMessage(w, http.StatusPreconditionFailed, PreconditionFailedErrMsg)
+			return
+		}
 
+		ur.ID = id
+		ur.Version = version
+		u, err := s.UpdateUser(r.Context(), ur)
 		if err != nil {
+			respondWithUpdateError(w, err)
+			return
+		}
+
+		recordUserChange(r, au, audit.UserUpdateEvent, u.ID, u.Email, before, u)
+
+		w.Header().Set("ETag", versionETag(u.Version))
+		respondWithJSON(w, http.StatusOK, u)
+	}
+}
+
+func patchUser(s update.Service, retr retrieve.Service, rv *reqValidator, au audit.Service) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := validateAuth(r); err != nil {
 			respondWithErrorMessage(w, http.StatusUnauthorized, err.Error())
 			return
 		}
 
+		vars := mux.Vars(r)
+		id, err := strconv.Atoi(vars["id"])
+		if err != nil {
+			respondWithErrorMessage(w, http.StatusBadRequest, InvalidUserIDErrMsg)
+			return
+		}
+
+		ct, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if ct != "application/merge-patch+json" && ct != "application/json" {
+			respondWithErrorMessage(w, http.StatusUnsupportedMediaType, UnsupportedMediaTypeErrMsg)
+			return
+		}
+
+		versions, ok := parseIfMatch(r)
+		if !ok {
+			respondWithErrorMessage(w, http.StatusPreconditionFailed, PreconditionFailedErrMsg)
+			return
+		}
+
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			respondWithErrorMessage(w, http.StatusBadRequest, InvalidReqPayloadErrMsg)
+			return
+		}
+		defer r.Body.Close()
+
+		pr, err := update.ParsePatch(body)
+		if err != nil {
+			respondWithErrorMessage(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		isValid, vErr := validateRequest(pr, rv)
+		if !isValid {
+			respondWithJSON(w, http.StatusBadRequest, vErr)
+			return
+		}
+
+		before, err := retr.RetrieveUser(r.Context(), id)
+		if err != nil {
+			respondWithUserError(w, err)
+			return
+		}
+
+		// the version is still checked by the update, the user may change
+		// in between
+		version, ok := matchVersion(versions, before.Version)
+		if !ok {
+			respondWithErrorMessage(w, http.StatusPreconditionFailed, PreconditionFailedErrMsg)
+			return
+		}
+
+		pr.ID = id
+		pr.Version = version
+		u, err := s.PatchUser(r.Context(), pr)
+		if err != nil {
+			respondWithUpdateError(w, err)
+			return
+		}
+
+		recordUserChange(r, au, audit.UserUpdateEvent, u.ID, u.Email, before, u)
+
+		w.Header().Set("ETag", versionETag(u.Version))
 		respondWithJSON(w, http.StatusOK, u)
+	}
+}
 
+func respondWithUpdateError(w http.ResponseWriter, err error) {
+	if err == update.VersionMismatchErr {
+		respondWithErrorMessage(w, http.StatusPreconditionFailed, err.Error())
+		return
 	}
+	respondWithUserError(w, err)
 }
 
-func deleteUser(s delete.Service) func(w http.ResponseWriter, r *http.Request) {
+func deleteUser(s delete.Service, retr retrieve.Service, au audit.Service) func(w http.ResponseWriter, r *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if err := validateAuth(r); err != nil {
 			respondWithErrorMessage(w, http.StatusUnauthorized, err.Error())
@@ -166,16 +351,145 @@ func deleteUser(s delete.Service) func(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		if err := s.DeleteUser(id); err != nil {
-			respondWithErrorMessage(w, http.StatusUnauthorized, err.Error())
+		before, err := retr.RetrieveUser(r.Context(), id)
+		if err != nil {
+			respondWithUserError(w, err)
+			return
+		}
+
+		if err := s.DeleteUser(r.Context(), id); err != nil {
+			respondWithUserError(w, err)
 			return
 		}
 
+		recordUserChange(r, au, audit.UserDeleteEvent, id, before.Email, before, nil)
+
+		respondWithJSON(w, http.StatusOK, map[string]string{"result": "success"})
+	}
+}
+
+func restoreUser(s delete.Service, retr retrieve.Service, au audit.Service) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := authenticateAdmin(r, retr); err != nil {
+			respondWithAuthError(w, err)
+			return
+		}
+
+		vars := mux.Vars(r)
+		id, err := strconv.Atoi(vars["id"])
+		if err != nil {
+			respondWithErrorMessage(w, http.StatusBadRequest, InvalidUserIDErrMsg)
+			return
+		}
+
+		if err := s.RestoreUser(r.Context(), id); err != nil {
+			respondWithUserError(w, err)
+			return
+		}
+
+		recordUserChange(r, au, audit.UserRestoreEvent, id, "", nil, nil)
+
+		respondWithJSON(w, http.StatusOK, map[string]string{"result": "success"})
+	}
+}
+
+func deactivateUser(s deactivate.Service, retr retrieve.Service, au audit.Service) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := authenticateAdmin(r, retr); err != nil {
+			respondWithAuthError(w, err)
+			return
+		}
+
+		vars := mux.Vars(r)
+		id, err := strconv.Atoi(vars["id"])
+		if err != nil {
+			respondWithErrorMessage(w, http.StatusBadRequest, InvalidUserIDErrMsg)
+			return
+		}
+
+		if err := s.DeactivateUser(r.Context(), id); err != nil {
+			respondWithUserError(w, err)
+			return
+		}
+
+		recordUserChange(r, au, audit.UserDisableEvent, id, "", nil, nil)
+
+		respondWithJSON(w, http.StatusOK, map[string]string{"result": "success"})
+	}
+}
+
+func activateUser(s deactivate.Service, retr retrieve.Service, au audit.Service) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := authenticateAdmin(r, retr); err != nil {
+			respondWithAuthError(w, err)
+			return
+		}
+
+		vars := mux.Vars(r)
+		id, err := strconv.Atoi(vars["id"])
+		if err != nil {
+			respondWithErrorMessage(w, http.StatusBadRequest, InvalidUserIDErrMsg)
+			return
+		}
+
+		if err := s.ActivateUser(r.Context(), id); err != nil {
+			respondWithUserError(w, err)
+			return
+		}
+
+		recordUserChange(r, au, audit.UserEnableEvent, id, "", nil, nil)
+
 		respondWithJSON(w, http.StatusOK, map[string]string{"result": "success"})
 	}
 }
 
-func registerUser(s register.Service, rv *reqValidator) func(w http.ResponseWriter, r *http.Request) {
+func approveUser(s update.Service, retr retrieve.Service, au audit.Service) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := authenticateAdmin(r, retr); err != nil {
+			respondWithAuthError(w, err)
+			return
+		}
+
+		vars := mux.Vars(r)
+		id, err := strconv.Atoi(vars["id"])
+		if err != nil {
+			respondWithErrorMessage(w, http.StatusBadRequest, InvalidUserIDErrMsg)
+			return
+		}
+
+		u, err := s.ApproveUser(r.Context(), id)
+		if err != nil {
+			respondWithUserError(w, err)
+			return
+		}
+
+		recordUserChange(r, au, audit.UserApproveEvent, u.ID, u.Email, nil, nil)
+
+		w.Header().Set("ETag", versionETag(u.Version))
+		respondWithJSON(w, http.StatusOK, u)
+	}
+}
+
+// recordUserChange audits a change to a user, with the difference between
+// the user before and after when they are known.
+func recordUserChange(r *http.Request, au audit.Service, typ string, id int, email string, before, after interface{}) {
+	e := newAuditEvent(r, typ, audit.Success)
+	e.Subject, e.Resource = email, userResource(id)
+	if before != nil || after != nil {
+		e.Details = audit.Diff(before, after)
+	}
+	au.Record(r.Context(), e)
+}
+
+func respondWithUserError(w http.ResponseWriter, err error) {
+	if err == sql.ErrNoRows {
+		respondWithErrorMessage(w, http.StatusNotFound, UserNotFoundErrMsg)
+		return
+	}
+	respondWithErrorMessage(w, http.StatusInternalServerError, err.Error())
+}
+
+func registerUser(s register.Service, rv *reqValidator, au audit.Service) func(w http.ResponseWriter, r *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var ur register.UserRegisterRequest
 		decoder := json.NewDecoder(r.Body)
@@ -192,17 +506,22 @@ func registerUser(s register.Service, rv *reqValidator) func(w http.ResponseWrit
 			return
 		}
 
-		u, err := s.RegisterUser(ur)
+		u, err := s.RegisterUser(r.Context(), ur)
 		if err != nil {
 			respondWithErrorMessage(w, http.StatusInternalServerError, err.Error())
 			return
 		}
 
+		e := newAuditEvent(r, audit.UserCreateEvent, audit.Success)
+		e.Subject, e.Resource = u.Email, userResource(u.ID)
+		e.Details = audit.Diff(nil, u)
+		au.Record(r.Context(), e)
+
 		respondWithJSON(w, http.StatusCreated, u)
 	}
 }
 
-func loginUser(s login.Service, rv *reqValidator) func(w http.ResponseWriter, r *http.Request) {
+func loginUser(s login.Service, rv *reqValidator, au audit.Service) func(w http.ResponseWriter, r *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var ur login.UserLoginRequest
 		decoder := json.NewDecoder(r.Body)
@@ -219,22 +538,32 @@ func loginUser(s login.Service, rv *reqValidator) func(w http.ResponseWriter, r
 			return
 		}
 
-		u, err := s.LoginUser(ur)
+		e := newAuditEvent(r, audit.LoginEvent, audit.Success)
+		e.Subject = ur.Email
+		e.Details = map[string]interface{}{"method": "password"}
+
+		u, err := s.LoginUser(r.Context(), ur)
 		if err != nil {
+			e.Result, e.Details["error"] = audit.Failure, err.Error()
+			recordLogin(r, au, e)
+
 			switch err {
-			case sql.ErrNoRows:
+			case sql.ErrNoRows, login.InvalidCredsErr:
 				respondWithErrorMessage(w, http.StatusUnauthorized, InvalidCredsErrMsg)
+			case login.DisabledUserErr:
+				respondWithErrorMessage(w, http.StatusUnauthorized, err.Error())
 			default:
 				respondWithErrorMessage(w, http.StatusInternalServerError, err.Error())
 			}
 			return
 		}
 
+		recordLogin(r, au, e)
 		respondWithJSON(w, http.StatusOK, u)
 	}
 }
 
-func refreshUserJWT(s jwt_refresh.Service, rv *reqValidator) func(w http.ResponseWriter, r *http.Request) {
+func refreshUserJWT(s jwt_refresh.Service, rv *reqValidator, au audit.Service) func(w http.ResponseWriter, r *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var ur jwt_refresh.UserJWTRefreshRequest
 		decoder := json.NewDecoder(r.Body)
@@ -251,12 +580,30 @@ func refreshUserJWT(s jwt_refresh.Service, rv *reqValidator) func(w http.Respons
 			return
 		}
 
-		at, err := s.RefreshJWT(ur)
+		e := newAuditEvent(r, audit.TokenRefreshEvent, audit.Success)
+		e.Subject = tokenEmail(ur.Refresh)
+
+		at, err := s.RefreshJWT(r.Context(), ur)
 		if err != nil {
-			respondWithErrorMessage(w, http.StatusBadRequest, err.Error())
+			e.Result, e.Details = audit.Failure, map[string]interface{}{"error": err.Error()}
+			au.Record(r.Context(), e)
+			respondWithRefreshError(w, err)
 			return
 		}
 
+		au.Record(r.Context(), e)
+
 		respondWithJSON(w, http.StatusCreated, at)
 	}
 }
+
+// respondWithRefreshError responds with 401 to refresh tokens that can not
+// be used, whatever the reason.
+func respondWithRefreshError(w http.ResponseWriter, err error) {
+	switch err {
+	case jwt_refresh.InvalidRefreshErr, jwt_refresh.RefreshExpectedErr, jwt_refresh.RevokedRefreshErr, jwt_refresh.DisabledUserErr:
+		respondWithErrorMessage(w, http.StatusUnauthorized, err.Error())
+	default:
+		respondWithErrorMessage(w, http.StatusInternalServerError, err.Error())
+	}
+}
@@ -0,0 +1,289 @@
+package rest_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/raisultan/abac/pkg/attribute"
+	"github.com/raisultan/abac/pkg/audit"
+	"github.com/raisultan/abac/pkg/authorize"
+	"github.com/raisultan/abac/pkg/bulk"
+	"github.com/raisultan/abac/pkg/deactivate"
+	"github.com/raisultan/abac/pkg/delete"
+	"github.com/raisultan/abac/pkg/http/rest"
+	"github.com/raisultan/abac/pkg/jwt_refresh"
+	"github.com/raisultan/abac/pkg/list"
+	"github.com/raisultan/abac/pkg/login"
+	"github.com/raisultan/abac/pkg/metrics"
+	"github.com/raisultan/abac/pkg/oauth"
+	"github.com/raisultan/abac/pkg/register"
+	"github.com/raisultan/abac/pkg/resource"
+	"github.com/raisultan/abac/pkg/retrieve"
+	"github.com/raisultan/abac/pkg/scim"
+	"github.com/raisultan/abac/pkg/storage/memory"
+	"github.com/raisultan/abac/pkg/token"
+	"github.com/raisultan/abac/pkg/update"
+	"github.com/raisultan/abac/pkg/webhook"
+)
+
+const password = "password1"
+
+// newServer serves the API on top of an empty memory storage, without
+// OIDC, passkeys and the decision cache.
+func newServer(t *testing.T) (*httptest.Server, *memory.Storage) {
+	s := memory.NewStorage()
+
+	reg := register.NewService(s)
+	upd := update.NewService(s)
+	del := delete.NewService(s)
+	deac := deactivate.NewService(s)
+	attr := attribute.NewService(s)
+	res := resource.NewService(s)
+
+	h := rest.Handler(
+		reg,
+		login.NewService(s),
+		jwt_refresh.NewService(s),
+		list.NewService(s),
+		retrieve.NewService(s),
+		upd,
+		del,
+		deac,
+		attr,
+		res,
+		authorize.NewService(attr, res, authorize.NewPolicies(&authorize.PolicySet{})),
+		bulk.NewService(s),
+		audit.NewService(s, []byte("key")),
+		webhook.NewService(s, nil),
+		oauth.NewService(s),
+		nil,
+		scim.NewService(s, reg, upd, del, deac),
+		nil,
+		nil,
+	)
+
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+	return srv, s
+}
+
+func do(t *testing.T, r *http.Request) *http.Response {
+	resp, err := http.DefaultClient.Do(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+func request(t *testing.T, method, url, accessToken string, body interface{}) *http.Request {
+	var b strings.Builder
+	if body != nil {
+		if err := json.NewEncoder(&b).Encode(body); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r, err := http.NewRequest(method, url, strings.NewReader(b.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body != nil {
+		r.Header.Set("Content-Type", "application/json")
+	}
+	if accessToken != "" {
+		r.Header.Set("Authorization", "Bearer "+accessToken)
+	}
+	return r
+}
+
+func decode(t *testing.T, resp *http.Response, v interface{}) {
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// signUp registers a user through the API and logs it in.
+func signUp(t *testing.T, srv *httptest.Server, email string) (int, login.UserLoginJWTResponse) {
+	resp := do(t, request(t, "POST", srv.URL+"/register", "", register.UserRegisterRequest{
+		Email:     email,
+		Password:  password,
+		FirstName: "Ann",
+		LastName:  "Lee",
+	}))
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("register: %s, want 201", resp.Status)
+	}
+	var u register.UserRegisterResponse
+	decode(t, resp, &u)
+
+	resp = do(t, request(t, "POST", srv.URL+"/login", "", login.UserLoginRequest{Email: email, Password: password}))
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("login: %s, want 200", resp.Status)
+	}
+	var tokens login.UserLoginJWTResponse
+	decode(t, resp, &tokens)
+
+	return u.ID, tokens
+}
+
+func TestRegisterLoginAndRetrieve(t *testing.T) {
+	srv, _ := newServer(t)
+	id, tokens := signUp(t, srv, "ann@example.org")
+	userURL := srv.URL + "/users/" + strconv.Itoa(id)
+
+	resp := do(t, request(t, "GET", userURL, tokens.Access, nil))
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("retrieve: %s, want 200", resp.Status)
+	}
+	var u struct {
+		Email string `json:"email"`
+	}
+	decode(t, resp, &u)
+	if u.Email != "ann@example.org" {
+		t.Errorf("retrieved %s, want ann@example.org", u.Email)
+	}
+
+	r := request(t, "GET", userURL, tokens.Access, nil)
+	r.Header.Set("If-None-Match", resp.Header.Get("ETag"))
+	if resp := do(t, r); resp.StatusCode != http.StatusNotModified {
+		t.Errorf("retrieve with its ETag: %s, want 304", resp.Status)
+	}
+
+	if resp := do(t, request(t, "GET", userURL, "", nil)); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("retrieve without a token: %s, want 401", resp.Status)
+	}
+	if resp := do(t, request(t, "GET", userURL, tokens.Refresh, nil)); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("retrieve with the refresh token: %s, want 401", resp.Status)
+	}
+}
+
+func TestRegisterDuplicateEmail(t *testing.T) {
+	srv, _ := newServer(t)
+	signUp(t, srv, "ann@example.org")
+
+	resp := do(t, request(t, "POST", srv.URL+"/register", "", register.UserRegisterRequest{
+		Email:     "ann@example.org",
+		Password:  password,
+		FirstName: "Ann",
+		LastName:  "Other",
+	}))
+	var body map[string]string
+	decode(t, resp, &body)
+	if body["error"] != register.ErrDuplicate.Error() {
+		t.Errorf("registering the email again: %q, want %q", body["error"], register.ErrDuplicate)
+	}
+}
+
+func TestLoginRejectsWrongPassword(t *testing.T) {
+	srv, _ := newServer(t)
+	signUp(t, srv, "ann@example.org")
+
+	resp := do(t, request(t, "POST", srv.URL+"/login", "", login.UserLoginRequest{Email: "ann@example.org", Password: "wrong"}))
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("login: %s, want 401", resp.Status)
+	}
+}
+
+func TestRevokedTokenIsRejected(t *testing.T) {
+	srv, s := newServer(t)
+	if _, err := s.AddClient(context.Background(), "client", "secret", "Client"); err != nil {
+		t.Fatal(err)
+	}
+	id, tokens := signUp(t, srv, "ann@example.org")
+	userURL := srv.URL + "/users/" + strconv.Itoa(id)
+
+	r, err := http.NewRequest("POST", srv.URL+"/oauth/revoke", strings.NewReader(url.Values{"token": {tokens.Access}}.Encode()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.SetBasicAuth("client", "secret")
+	if resp := do(t, r); resp.StatusCode != http.StatusOK {
+		t.Fatalf("revoke: %s, want 200", resp.Status)
+	}
+
+	if resp := do(t, request(t, "GET", userURL, tokens.Access, nil)); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("retrieve with the revoked token: %s, want 401", resp.Status)
+	}
+}
+
+func TestRefreshRejectsUnusableTokens(t *testing.T) {
+	srv, _ := newServer(t)
+	_, tokens := signUp(t, srv, "ann@example.org")
+
+	token.Configure(token.Config{AccessTTL: time.Minute, RefreshTTL: -time.Minute})
+	t.Cleanup(func() {
+		token.Configure(token.Config{AccessTTL: 5 * time.Minute, RefreshTTL: 30 * time.Minute})
+	})
+	expired, err := token.CreateRefreshToken("ann@example.org")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, refresh := range map[string]string{
+		"expired":      expired,
+		"malformed":    "not-a-token",
+		"access token": tokens.Access,
+	} {
+		resp := do(t, request(t, "POST", srv.URL+"/refresh", "", jwt_refresh.UserJWTRefreshRequest{Refresh: refresh}))
+		if resp.StatusCode != http.StatusUnauthorized {
+			t.Errorf("%s refresh token: %s, want 401", name, resp.Status)
+		}
+	}
+
+	resp := do(t, request(t, "POST", srv.URL+"/refresh", "", jwt_refresh.UserJWTRefreshRequest{Refresh: tokens.Refresh}))
+	if resp.StatusCode != http.StatusCreated {
+		t.Errorf("valid refresh token: %s, want 201", resp.Status)
+	}
+}
+
+func TestSCIMRequiresAdmin(t *testing.T) {
+	srv, s := newServer(t)
+	id, tokens := signUp(t, srv, "ann@example.org")
+	usersURL := srv.URL + "/scim/v2/Users"
+
+	if resp := do(t, request(t, "GET", usersURL, "", nil)); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("without credentials: %s, want 401", resp.Status)
+	}
+	if resp := do(t, request(t, "GET", usersURL, tokens.Access, nil)); resp.StatusCode != http.StatusForbidden {
+		t.Errorf("as a user: %s, want 403", resp.Status)
+	}
+
+	if err := s.SetUserAdmin(context.Background(), id, true); err != nil {
+		t.Fatal(err)
+	}
+	if resp := do(t, request(t, "GET", usersURL, tokens.Access, nil)); resp.StatusCode != http.StatusOK {
+		t.Errorf("as an admin: %s, want 200", resp.Status)
+	}
+}
+
+func TestMetricsCountUnmatchedRoutes(t *testing.T) {
+	srv, _ := newServer(t)
+
+	for _, tc := range []struct {
+		method, path string
+		code         int
+	}{
+		{"GET", "/nowhere", http.StatusNotFound},
+		{"DELETE", "/register", http.StatusMethodNotAllowed},
+	} {
+		requests := metrics.Requests.WithLabelValues("unknown", tc.method, strconv.Itoa(tc.code))
+		before := testutil.ToFloat64(requests)
+
+		if resp := do(t, request(t, tc.method, srv.URL+tc.path, "", nil)); resp.StatusCode != tc.code {
+			t.Errorf("%s %s: %s, want %d", tc.method, tc.path, resp.Status, tc.code)
+		}
+		if n := testutil.ToFloat64(requests) - before; n != 1 {
+			t.Errorf("%s %s counted %v times as unknown, want once", tc.method, tc.path, n)
+		}
+	}
+}
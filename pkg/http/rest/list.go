@@ -0,0 +1,113 @@
+package rest
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/raisultan/abac/pkg/list"
+)
+
+var InvalidQueryParamErr = errors.New("Invalid query parameter")
+
+func listUsers(s list.Service) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := validateAuth(r); err != nil {
+			respondWithErrorMessage(w, http.StatusUnauthorized, err.Error())
+			return
+		}
+
+		lr, err := parseUserListRequest(r)
+		if err != nil {
+			respondWithErrorMessage(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		resp, err := s.ListUsers(r.Context(), lr)
+		if err != nil {
+			respondWithErrorMessage(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		if resp.NextCursor != "" {
+			q := r.URL.Query()
+			q.Set("cursor", resp.NextCursor)
+			resp.Next = r.URL.Path + "?" + q.Encode()
+		}
+
+		respondWithJSON(w, http.StatusOK, resp)
+	}
+}
+
+func parseUserListRequest(r *http.Request) (list.UserListRequest, error) {
+	q := r.URL.Query()
+	lr := list.UserListRequest{
+		Email:  q.Get("email"),
+		Group:  q.Get("group"),
+		Search: q.Get("q"),
+	}
+
+	var err error
+	if lr.IsAdmin, err = parseBoolParam(q.Get("isAdmin")); err != nil {
+		return lr, err
+	}
+	if lr.IsApproved, err = parseBoolParam(q.Get("isApproved")); err != nil {
+		return lr, err
+	}
+	if lr.CreatedFrom, err = parseTimeParam(q.Get("createdFrom")); err != nil {
+		return lr, err
+	}
+	if lr.CreatedTo, err = parseTimeParam(q.Get("createdTo")); err != nil {
+		return lr, err
+	}
+
+	if v := q.Get("limit"); v != "" {
+		if lr.Limit, err = strconv.Atoi(v); err != nil {
+			return lr, InvalidQueryParamErr
+		}
+	}
+	if v := q.Get("includeDeleted"); v != "" {
+		if lr.IncludeDeleted, err = strconv.ParseBool(v); err != nil {
+			return lr, InvalidQueryParamErr
+		}
+	}
+	if v := q.Get("count"); v != "" {
+		if lr.WithTotal, err = strconv.ParseBool(v); err != nil {
+			return lr, InvalidQueryParamErr
+		}
+	}
+
+	if lr.Sort, err = list.ParseSort(q.Get("sort")); err != nil {
+		return lr, err
+	}
+	if v := q.Get("cursor"); v != "" {
+		if lr.After, err = list.DecodeCursor(v, lr.Sort); err != nil {
+			return lr, err
+		}
+	}
+
+	return lr, nil
+}
+
+func parseBoolParam(v string) (*bool, error) {
+	if v == "" {
+		return nil, nil
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return nil, InvalidQueryParamErr
+	}
+	return &b, nil
+}
+
+func parseTimeParam(v string) (*time.Time, error) {
+	if v == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return nil, InvalidQueryParamErr
+	}
+	return &t, nil
+}
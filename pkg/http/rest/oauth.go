@@ -0,0 +1,88 @@
+package rest
+
+import (
+	"net/http"
+
+	"github.com/raisultan/abac/pkg/oauth"
+)
+
+const (
+	InvalidClientErrMsg  = "invalid_client"
+	InvalidRequestErrMsg = "invalid_request"
+)
+
+func introspectToken(s oauth.Service, rv *reqValidator) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			respondWithErrorMessage(w, http.StatusBadRequest, InvalidRequestErrMsg)
+			return
+		}
+
+		tr := oauth.TokenIntrospectRequest{
+			Token:         r.PostFormValue("token"),
+			TokenTypeHint: r.PostFormValue("token_type_hint"),
+		}
+		tr.ClientID, tr.ClientSecret = extractClientCredentials(r)
+
+		isValid, vErr := validateRequest(tr, rv)
+		if !isValid {
+			respondWithJSON(w, http.StatusBadRequest, vErr)
+			return
+		}
+
+		resp, err := s.IntrospectToken(r.Context(), tr)
+		if err != nil {
+			respondWithOAuthError(w, err)
+			return
+		}
+
+		respondWithJSON(w, http.StatusOK, resp)
+	}
+}
+
+func revokeToken(s oauth.Service, rv *reqValidator) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			respondWithErrorMessage(w, http.StatusBadRequest, InvalidRequestErrMsg)
+			return
+		}
+
+		tr := oauth.TokenRevokeRequest{
+			Token:         r.PostFormValue("token"),
+			TokenTypeHint: r.PostFormValue("token_type_hint"),
+		}
+		tr.ClientID, tr.ClientSecret = extractClientCredentials(r)
+
+		isValid, vErr := validateRequest(tr, rv)
+		if !isValid {
+			respondWithJSON(w, http.StatusBadRequest, vErr)
+			return
+		}
+
+		if err := s.RevokeToken(r.Context(), tr); err != nil {
+			respondWithOAuthError(w, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// extractClientCredentials supports both client_secret_basic and
+// client_secret_post authentication methods.
+func extractClientCredentials(r *http.Request) (string, string) {
+	if id, secret, ok := r.BasicAuth(); ok {
+		return id, secret
+	}
+	return r.PostFormValue("client_id"), r.PostFormValue("client_secret")
+}
+
+func respondWithOAuthError(w http.ResponseWriter, err error) {
+	switch err {
+	case oauth.ErrInvalidClient:
+		w.Header().Set("WWW-Authenticate", `Basic realm="abac"`)
+		respondWithErrorMessage(w, http.StatusUnauthorized, InvalidClientErrMsg)
+	default:
+		respondWithErrorMessage(w, http.StatusInternalServerError, err.Error())
+	}
+}
@@ -0,0 +1,110 @@
+package rest
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"net/http"
+
+	"github.com/raisultan/abac/pkg/audit"
+	"github.com/raisultan/abac/pkg/oidc"
+)
+
+const (
+	oidcStateCookie = "oidc_state"
+	oidcNonceCookie = "oidc_nonce"
+
+	InvalidOIDCStateErrMsg = "Invalid OIDC state"
+)
+
+func startOIDCLogin(s oidc.Service) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		state, err := randomString()
+		if err != nil {
+			respondWithErrorMessage(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		nonce, err := randomString()
+		if err != nil {
+			respondWithErrorMessage(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		setOIDCCookie(w, r, oidcStateCookie, state, 600)
+		setOIDCCookie(w, r, oidcNonceCookie, nonce, 600)
+
+		http.Redirect(w, r, s.AuthCodeURL(state, nonce), http.StatusFound)
+	}
+}
+
+func completeOIDCLogin(s oidc.Service, rv *reqValidator, au audit.Service) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if e := r.FormValue("error"); e != "" {
+			respondWithErrorMessage(w, http.StatusUnauthorized, e)
+			return
+		}
+
+		state, err := r.Cookie(oidcStateCookie)
+		if err != nil || state.Value != r.FormValue("state") {
+			respondWithErrorMessage(w, http.StatusBadRequest, InvalidOIDCStateErrMsg)
+			return
+		}
+		nonce, err := r.Cookie(oidcNonceCookie)
+		if err != nil {
+			respondWithErrorMessage(w, http.StatusBadRequest, InvalidOIDCStateErrMsg)
+			return
+		}
+
+		// state and nonce are single use
+		setOIDCCookie(w, r, oidcStateCookie, "", -1)
+		setOIDCCookie(w, r, oidcNonceCookie, "", -1)
+
+		ur := oidc.UserOIDCLoginRequest{Code: r.FormValue("code"), Nonce: nonce.Value}
+		isValid, vErr := validateRequest(ur, rv)
+		if !isValid {
+			respondWithJSON(w, http.StatusBadRequest, vErr)
+			return
+		}
+
+		e := newAuditEvent(r, audit.LoginEvent, audit.Success)
+		e.Details = map[string]interface{}{"method": "oidc"}
+
+		u, err := s.LoginUser(r.Context(), ur)
+		if err != nil {
+			e.Result, e.Details["error"] = audit.Failure, err.Error()
+			recordLogin(r, au, e)
+
+			switch err {
+			case oidc.InvalidIDTokenErr, oidc.MissingClaimErr, oidc.UnverifiedEmailErr, oidc.DisabledUserErr:
+				respondWithErrorMessage(w, http.StatusUnauthorized, err.Error())
+			default:
+				respondWithErrorMessage(w, http.StatusInternalServerError, err.Error())
+			}
+			return
+		}
+
+		e.Subject = tokenEmail(u.Access)
+		recordLogin(r, au, e)
+
+		respondWithJSON(w, http.StatusOK, u)
+	}
+}
+
+func setOIDCCookie(w http.ResponseWriter, r *http.Request, name, value string, maxAge int) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/oidc",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+func randomString() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
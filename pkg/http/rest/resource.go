@@ -0,0 +1,203 @@
+package rest
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/raisultan/abac/pkg/oauth"
+	"github.com/raisultan/abac/pkg/resource"
+	"github.com/raisultan/abac/pkg/retrieve"
+)
+
+func listResources(s resource.Service, oa oauth.Service) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, err := authenticateClientOrUser(r, oa); err != nil {
+			respondWithErrorMessage(w, http.StatusUnauthorized, err.Error())
+			return
+		}
+
+		q := r.URL.Query()
+		lr := resource.ListRequest{Type: q.Get("type")}
+		if pt, pid := q.Get("parentType"), q.Get("parentId"); pt != "" || pid != "" {
+			lr.Parent = &resource.Ref{Type: pt, ExternalID: pid}
+		}
+
+		var err error
+		if v := q.Get("ownerId"); v != "" {
+			id, err := strconv.Atoi(v)
+			if err != nil {
+				respondWithErrorMessage(w, http.StatusBadRequest, InvalidQueryParamErr.Error())
+				return
+			}
+			lr.OwnerID = &id
+		}
+		if v := q.Get("limit"); v != "" {
+			if lr.Limit, err = strconv.Atoi(v); err != nil {
+				respondWithErrorMessage(w, http.StatusBadRequest, InvalidQueryParamErr.Error())
+				return
+			}
+		}
+		if v := q.Get("offset"); v != "" {
+			if lr.Offset, err = strconv.Atoi(v); err != nil {
+				respondWithErrorMessage(w, http.StatusBadRequest, InvalidQueryParamErr.Error())
+				return
+			}
+		}
+
+		resources, err := s.ListResources(r.Context(), lr)
+		if err != nil {
+			respondWithErrorMessage(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		respondWithJSON(w, http.StatusOK, resources)
+	}
+}
+
+func getResource(s resource.Service, oa oauth.Service) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, err := authenticateClientOrUser(r, oa); err != nil {
+			respondWithErrorMessage(w, http.StatusUnauthorized, err.Error())
+			return
+		}
+
+		res, err := s.GetResource(r.Context(), resourceRef(r))
+		if err != nil {
+			respondWithResourceError(w, err)
+			return
+		}
+
+		respondWithJSON(w, http.StatusOK, res)
+	}
+}
+
+func putResource(
+	s resource.Service,
+	oa oauth.Service,
+	retr retrieve.Service,
+	rv *reqValidator,
+) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := authenticateClientOrAdmin(r, oa, retr); err != nil {
+			respondWithAuthError(w, err)
+			return
+		}
+
+		var res resource.Resource
+		decoder := json.NewDecoder(r.Body)
+		decoder.UseNumber()
+		if err := decoder.Decode(&res); err != nil {
+			respondWithErrorMessage(w, http.StatusBadRequest, InvalidReqPayloadErrMsg)
+			return
+		}
+		defer r.Body.Close()
+
+		ref := resourceRef(r)
+		res.Type, res.ExternalID = ref.Type, ref.ExternalID
+
+		isValid, vErr := validateRequest(res, rv)
+		if !isValid {
+			respondWithJSON(w, http.StatusBadRequest, vErr)
+			return
+		}
+
+		res, created, err := s.PutResource(r.Context(), res)
+		if err != nil {
+			respondWithResourceError(w, err)
+			return
+		}
+
+		if created {
+			respondWithJSON(w, http.StatusCreated, res)
+			return
+		}
+		respondWithJSON(w, http.StatusOK, res)
+	}
+}
+
+func bulkUpsertResources(
+	s resource.Service,
+	oa oauth.Service,
+	retr retrieve.Service,
+	rv *reqValidator,
+) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := authenticateClientOrAdmin(r, oa, retr); err != nil {
+			respondWithAuthError(w, err)
+			return
+		}
+
+		var br resource.BulkUpsertRequest
+		decoder := json.NewDecoder(r.Body)
+		decoder.UseNumber()
+		if err := decoder.Decode(&br); err != nil {
+			respondWithErrorMessage(w, http.StatusBadRequest, InvalidReqPayloadErrMsg)
+			return
+		}
+		defer r.Body.Close()
+
+		isValid, vErr := validateRequest(br, rv)
+		if !isValid {
+			respondWithJSON(w, http.StatusBadRequest, vErr)
+			return
+		}
+
+		resources, err := s.BulkUpsert(r.Context(), br.Resources)
+		if err != nil {
+			var itemErr *resource.ItemErr
+			if errors.As(err, &itemErr) && itemErr.Err != nil && isResourceErr(itemErr.Err) {
+				respondWithErrorMessage(w, http.StatusUnprocessableEntity, itemErr.Error())
+				return
+			}
+			respondWithErrorMessage(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		respondWithJSON(w, http.StatusOK, map[string]interface{}{"resources": resources})
+	}
+}
+
+func deleteResource(s resource.Service, oa oauth.Service, retr retrieve.Service) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := authenticateClientOrAdmin(r, oa, retr); err != nil {
+			respondWithAuthError(w, err)
+			return
+		}
+
+		if err := s.DeleteResource(r.Context(), resourceRef(r)); err != nil {
+			respondWithResourceError(w, err)
+			return
+		}
+
+		respondWithJSON(w, http.StatusOK, map[string]string{"result": "success"})
+	}
+}
+
+func resourceRef(r *http.Request) resource.Ref {
+	vars := mux.Vars(r)
+	return resource.Ref{Type: vars["type"], ExternalID: vars["externalId"]}
+}
+
+func isResourceErr(err error) bool {
+	switch err {
+	case resource.ParentNotFoundErr, resource.OwnerNotFoundErr, resource.CycleErr:
+		return true
+	}
+	return false
+}
+
+func respondWithResourceError(w http.ResponseWriter, err error) {
+	switch {
+	case err == resource.NotFoundErr:
+		respondWithErrorMessage(w, http.StatusNotFound, err.Error())
+	case err == resource.HasChildrenErr:
+		respondWithErrorMessage(w, http.StatusConflict, err.Error())
+	case isResourceErr(err):
+		respondWithErrorMessage(w, http.StatusUnprocessableEntity, err.Error())
+	default:
+		respondWithErrorMessage(w, http.StatusInternalServerError, err.Error())
+	}
+}
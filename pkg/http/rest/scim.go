@@ -0,0 +1,409 @@
+package rest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/raisultan/abac/pkg/audit"
+	"github.com/raisultan/abac/pkg/oauth"
+	"github.com/raisultan/abac/pkg/retrieve"
+	"github.com/raisultan/abac/pkg/scim"
+)
+
+type scimError struct {
+	Schemas  []string `json:"schemas"`
+	Status   string   `json:"status"`
+	SCIMType string   `json:"scimType,omitempty"`
+	Detail   string   `json:"detail"`
+}
+
+func registerSCIMRoutes(r *mux.Router, s scim.Service, oa oauth.Service, retr retrieve.Service, rv *reqValidator, au audit.Service) {
+	sr := r.PathPrefix("/scim/v2").Subrouter()
+	sr.Use(scimAuthMiddleware(oa, retr))
+
+	sr.HandleFunc("/Users", listSCIMUsers(s)).Methods("GET")
+	sr.HandleFunc("/Users", createSCIMUser(s, au)).Methods("POST")
+	sr.HandleFunc("/Users/{id}", getSCIMUser(s)).Methods("GET")
+	sr.HandleFunc("/Users/{id}", replaceSCIMUser(s, au)).Methods("PUT")
+	sr.HandleFunc("/Users/{id}", patchSCIMUser(s, rv, au)).Methods("PATCH")
+	sr.HandleFunc("/Users/{id}", deleteSCIMUser(s, au)).Methods("DELETE")
+
+	sr.HandleFunc("/Groups", listSCIMGroups(s)).Methods("GET")
+	sr.HandleFunc("/Groups", createSCIMGroup(s, rv)).Methods("POST")
+	sr.HandleFunc("/Groups/{id}", getSCIMGroup(s)).Methods("GET")
+	sr.HandleFunc("/Groups/{id}", replaceSCIMGroup(s, rv)).Methods("PUT")
+	sr.HandleFunc("/Groups/{id}", patchSCIMGroup(s, rv)).Methods("PATCH")
+	sr.HandleFunc("/Groups/{id}", deleteSCIMGroup(s)).Methods("DELETE")
+}
+
+// scimAuthMiddleware accepts either OAuth client credentials via HTTP Basic
+// auth, which provisioning tools are usually configured with, or the access
+// token of an admin.
+func scimAuthMiddleware(oa oauth.Service, retr retrieve.Service) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if err := authenticateClientOrAdmin(r, oa, retr); err != nil {
+				status := http.StatusUnauthorized
+				if err == AdminExpectedErr {
+					status = http.StatusForbidden
+				}
+				respondWithSCIMError(w, status, "", err.Error())
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func listSCIMUsers(s scim.Service) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		lr, err := parseSCIMListRequest(r)
+		if err != nil {
+			respondWithSCIMServiceError(w, err)
+			return
+		}
+
+		resp, err := s.ListUsers(r.Context(), lr)
+		if err != nil {
+			respondWithSCIMServiceError(w, err)
+			return
+		}
+
+		respondWithSCIM(w, http.StatusOK, resp)
+	}
+}
+
+func getSCIMUser(s scim.Service) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := scimID(r)
+		if err != nil {
+			respondWithSCIMServiceError(w, err)
+			return
+		}
+
+		u, err := s.GetUser(r.Context(), id)
+		if err != nil {
+			respondWithSCIMServiceError(w, err)
+			return
+		}
+
+		respondWithSCIM(w, http.StatusOK, u)
+	}
+}
+
+func createSCIMUser(s scim.Service, au audit.Service) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var u scim.User
+		if !decodeSCIMRequest(w, r, &u) {
+			return
+		}
+
+		created, err := s.CreateUser(r.Context(), u)
+		if err != nil {
+			respondWithSCIMServiceError(w, err)
+			return
+		}
+
+		recordSCIMUserChange(r, au, audit.UserCreateEvent, created.ID, created.UserName, nil, created)
+
+		w.Header().Set("Location", created.Meta.Location)
+		respondWithSCIM(w, http.StatusCreated, created)
+	}
+}
+
+func replaceSCIMUser(s scim.Service, au audit.Service) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := scimID(r)
+		if err != nil {
+			respondWithSCIMServiceError(w, err)
+			return
+		}
+
+		var u scim.User
+		if !decodeSCIMRequest(w, r, &u) {
+			return
+		}
+
+		before, err := s.GetUser(r.Context(), id)
+		if err != nil {
+			respondWithSCIMServiceError(w, err)
+			return
+		}
+
+		updated, err := s.ReplaceUser(r.Context(), id, u)
+		if err != nil {
+			respondWithSCIMServiceError(w, err)
+			return
+		}
+
+		recordSCIMUserChange(r, au, audit.UserUpdateEvent, updated.ID, updated.UserName, before, updated)
+
+		respondWithSCIM(w, http.StatusOK, updated)
+	}
+}
+
+func patchSCIMUser(s scim.Service, rv *reqValidator, au audit.Service) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := scimID(r)
+		if err != nil {
+			respondWithSCIMServiceError(w, err)
+			return
+		}
+
+		var pr scim.PatchRequest
+		if !decodeSCIMRequest(w, r, &pr) || !validateSCIMRequest(w, pr, rv) {
+			return
+		}
+
+		before, err := s.GetUser(r.Context(), id)
+		if err != nil {
+			respondWithSCIMServiceError(w, err)
+			return
+		}
+
+		updated, err := s.PatchUser(r.Context(), id, pr)
+		if err != nil {
+			respondWithSCIMServiceError(w, err)
+			return
+		}
+
+		recordSCIMUserChange(r, au, audit.UserUpdateEvent, updated.ID, updated.UserName, before, updated)
+
+		respondWithSCIM(w, http.StatusOK, updated)
+	}
+}
+
+func deleteSCIMUser(s scim.Service, au audit.Service) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := scimID(r)
+		if err != nil {
+			respondWithSCIMServiceError(w, err)
+			return
+		}
+
+		before, err := s.GetUser(r.Context(), id)
+		if err != nil {
+			respondWithSCIMServiceError(w, err)
+			return
+		}
+
+		if err := s.DeleteUser(r.Context(), id); err != nil {
+			respondWithSCIMServiceError(w, err)
+			return
+		}
+
+		recordSCIMUserChange(r, au, audit.UserDeleteEvent, before.ID, before.UserName, before, nil)
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// recordSCIMUserChange audits a change made by a provisioning tool, SCIM
+// IDs are the string form of user IDs.
+func recordSCIMUserChange(r *http.Request, au audit.Service, typ, id, email string, before, after interface{}) {
+	e := newAuditEvent(r, typ, audit.Success)
+	e.Subject, e.Resource = email, "user/"+id
+	e.Details = audit.Diff(before, after)
+	au.Record(r.Context(), e)
+}
+
+func listSCIMGroups(s scim.Service) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		lr, err := parseSCIMListRequest(r)
+		if err != nil {
+			respondWithSCIMServiceError(w, err)
+			return
+		}
+
+		resp, err := s.ListGroups(r.Context(), lr)
+		if err != nil {
+			respondWithSCIMServiceError(w, err)
+			return
+		}
+
+		respondWithSCIM(w, http.StatusOK, resp)
+	}
+}
+
+func getSCIMGroup(s scim.Service) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := scimID(r)
+		if err != nil {
+			respondWithSCIMServiceError(w, err)
+			return
+		}
+
+		g, err := s.GetGroup(r.Context(), id)
+		if err != nil {
+			respondWithSCIMServiceError(w, err)
+			return
+		}
+
+		respondWithSCIM(w, http.StatusOK, g)
+	}
+}
+
+func createSCIMGroup(s scim.Service, rv *reqValidator) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var g scim.Group
+		if !decodeSCIMRequest(w, r, &g) || !validateSCIMRequest(w, g, rv) {
+			return
+		}
+
+		created, err := s.CreateGroup(r.Context(), g)
+		if err != nil {
+			respondWithSCIMServiceError(w, err)
+			return
+		}
+
+		w.Header().Set("Location", created.Meta.Location)
+		respondWithSCIM(w, http.StatusCreated, created)
+	}
+}
+
+func replaceSCIMGroup(s scim.Service, rv *reqValidator) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := scimID(r)
+		if err != nil {
+			respondWithSCIMServiceError(w, err)
+			return
+		}
+
+		var g scim.Group
+		if !decodeSCIMRequest(w, r, &g) || !validateSCIMRequest(w, g, rv) {
+			return
+		}
+
+		updated, err := s.ReplaceGroup(r.Context(), id, g)
+		if err != nil {
+			respondWithSCIMServiceError(w, err)
+			return
+		}
+
+		respondWithSCIM(w, http.StatusOK, updated)
+	}
+}
+
+func patchSCIMGroup(s scim.Service, rv *reqValidator) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := scimID(r)
+		if err != nil {
+			respondWithSCIMServiceError(w, err)
+			return
+		}
+
+		var pr scim.PatchRequest
+		if !decodeSCIMRequest(w, r, &pr) || !validateSCIMRequest(w, pr, rv) {
+			return
+		}
+
+		updated, err := s.PatchGroup(r.Context(), id, pr)
+		if err != nil {
+			respondWithSCIMServiceError(w, err)
+			return
+		}
+
+		respondWithSCIM(w, http.StatusOK, updated)
+	}
+}
+
+func deleteSCIMGroup(s scim.Service) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := scimID(r)
+		if err != nil {
+			respondWithSCIMServiceError(w, err)
+			return
+		}
+
+		if err := s.DeleteGroup(r.Context(), id); err != nil {
+			respondWithSCIMServiceError(w, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func parseSCIMListRequest(r *http.Request) (scim.ListRequest, error) {
+	f, err := scim.ParseFilter(r.FormValue("filter"))
+	if err != nil {
+		return scim.ListRequest{}, err
+	}
+
+	lr := scim.ListRequest{Filter: f, StartIndex: 1, Count: scim.DefaultCount}
+	if v := r.FormValue("startIndex"); v != "" {
+		lr.StartIndex, _ = strconv.Atoi(v)
+	}
+	if v := r.FormValue("count"); v != "" {
+		lr.Count, _ = strconv.Atoi(v)
+	}
+
+	return lr, nil
+}
+
+// scimID parses the resource ID, IDs that are not numeric can not exist.
+func scimID(r *http.Request) (int, error) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		return 0, scim.NotFoundErr
+	}
+	return id, nil
+}
+
+func decodeSCIMRequest(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	defer r.Body.Close()
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		respondWithSCIMError(w, http.StatusBadRequest, "invalidSyntax", InvalidReqPayloadErrMsg)
+		return false
+	}
+	return true
+}
+
+func validateSCIMRequest(w http.ResponseWriter, v interface{}, rv *reqValidator) bool {
+	isValid, vErr := validateRequest(v, rv)
+	if !isValid {
+		respondWithSCIMError(w, http.StatusBadRequest, "invalidValue", vErr.Details[0].Error)
+		return false
+	}
+	return true
+}
+
+func respondWithSCIMServiceError(w http.ResponseWriter, err error) {
+	switch err {
+	case scim.NotFoundErr:
+		respondWithSCIMError(w, http.StatusNotFound, "", err.Error())
+	case scim.UniquenessErr:
+		respondWithSCIMError(w, http.StatusConflict, "uniqueness", err.Error())
+	case scim.InvalidFilterErr:
+		respondWithSCIMError(w, http.StatusBadRequest, "invalidFilter", err.Error())
+	case scim.InvalidPathErr:
+		respondWithSCIMError(w, http.StatusBadRequest, "invalidPath", err.Error())
+	case scim.InvalidValueErr:
+		respondWithSCIMError(w, http.StatusBadRequest, "invalidValue", err.Error())
+	case scim.MutabilityErr:
+		respondWithSCIMError(w, http.StatusBadRequest, "mutability", err.Error())
+	default:
+		respondWithSCIMError(w, http.StatusInternalServerError, "", err.Error())
+	}
+}
+
+func respondWithSCIMError(w http.ResponseWriter, code int, scimType, detail string) {
+	respondWithSCIM(w, code, scimError{
+		Schemas:  []string{scim.ErrorSchema},
+		Status:   fmt.Sprint(code),
+		SCIMType: scimType,
+		Detail:   detail,
+	})
+}
+
+func respondWithSCIM(w http.ResponseWriter, code int, payload interface{}) {
+	response, _ := json.Marshal(payload)
+
+	w.Header().Set("Content-Type", "application/scim+json")
+	w.WriteHeader(code)
+	w.Write(response)
+}
@@ -0,0 +1,138 @@
+package rest
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+
+	"github.com/raisultan/abac/pkg/audit"
+	"github.com/raisultan/abac/pkg/webauthn"
+)
+
+func beginWebAuthnRegistration(s webauthn.Service) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tp, err := authenticate(r)
+		if err != nil {
+			respondWithErrorMessage(w, http.StatusUnauthorized, err.Error())
+			return
+		}
+
+		opts, err := s.BeginRegistration(r.Context(), tp.Email)
+		if err != nil {
+			respondWithWebAuthnError(w, err)
+			return
+		}
+
+		respondWithJSON(w, http.StatusOK, opts)
+	}
+}
+
+func finishWebAuthnRegistration(s webauthn.Service, rv *reqValidator) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tp, err := authenticate(r)
+		if err != nil {
+			respondWithErrorMessage(w, http.StatusUnauthorized, err.Error())
+			return
+		}
+
+		var ar webauthn.AttestationResponse
+		decoder := json.NewDecoder(r.Body)
+		if err := decoder.Decode(&ar); err != nil {
+			respondWithErrorMessage(w, http.StatusBadRequest, InvalidReqPayloadErrMsg)
+			return
+		}
+		defer r.Body.Close()
+
+		isValid, vErr := validateRequest(ar, rv)
+		if !isValid {
+			respondWithJSON(w, http.StatusBadRequest, vErr)
+			return
+		}
+
+		c, err := s.FinishRegistration(r.Context(), tp.Email, ar)
+		if err != nil {
+			respondWithWebAuthnError(w, err)
+			return
+		}
+
+		respondWithJSON(w, http.StatusCreated, c)
+	}
+}
+
+func beginWebAuthnLogin(s webauthn.Service, rv *reqValidator) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var lr webauthn.UserLoginBeginRequest
+		decoder := json.NewDecoder(r.Body)
+		if err := decoder.Decode(&lr); err != nil {
+			respondWithErrorMessage(w, http.StatusBadRequest, InvalidReqPayloadErrMsg)
+			return
+		}
+		defer r.Body.Close()
+
+		isValid, vErr := validateRequest(lr, rv)
+		if !isValid {
+			respondWithJSON(w, http.StatusBadRequest, vErr)
+			return
+		}
+
+		opts, err := s.BeginLogin(r.Context(), lr)
+		if err != nil {
+			respondWithWebAuthnError(w, err)
+			return
+		}
+
+		respondWithJSON(w, http.StatusOK, opts)
+	}
+}
+
+func finishWebAuthnLogin(s webauthn.Service, rv *reqValidator, au audit.Service) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var ar webauthn.AssertionResponse
+		decoder := json.NewDecoder(r.Body)
+		if err := decoder.Decode(&ar); err != nil {
+			respondWithErrorMessage(w, http.StatusBadRequest, InvalidReqPayloadErrMsg)
+			return
+		}
+		defer r.Body.Close()
+
+		isValid, vErr := validateRequest(ar, rv)
+		if !isValid {
+			respondWithJSON(w, http.StatusBadRequest, vErr)
+			return
+		}
+
+		e := newAuditEvent(r, audit.LoginEvent, audit.Success)
+		e.Details = map[string]interface{}{"method": "webauthn"}
+
+		u, err := s.FinishLogin(r.Context(), ar)
+		if err != nil {
+			e.Result, e.Details["error"] = audit.Failure, err.Error()
+			recordLogin(r, au, e)
+
+			respondWithWebAuthnError(w, err)
+			return
+		}
+
+		e.Subject = tokenEmail(u.Access)
+		recordLogin(r, au, e)
+
+		respondWithJSON(w, http.StatusOK, u)
+	}
+}
+
+func respondWithWebAuthnError(w http.ResponseWriter, err error) {
+	switch err {
+	case sql.ErrNoRows:
+		respondWithErrorMessage(w, http.StatusNotFound, UserNotFoundErrMsg)
+	case webauthn.DuplicateCredentialErr:
+		respondWithErrorMessage(w, http.StatusConflict, err.Error())
+	case webauthn.MalformedDataErr, webauthn.UnsupportedKeyErr, webauthn.InvalidRPErr,
+		webauthn.InvalidOriginErr, webauthn.InvalidChallengeErr:
+		respondWithErrorMessage(w, http.StatusBadRequest, err.Error())
+	case webauthn.UnknownCredentialErr, webauthn.InvalidSignatureErr, webauthn.SignCountErr,
+		webauthn.UserNotPresentErr, webauthn.UserNotVerifiedErr, webauthn.DisabledUserErr:
+		respondWithErrorMessage(w, http.StatusUnauthorized, err.Error())
+	default:
+		respondWithErrorMessage(w, http.StatusInternalServerError, err.Error())
+	}
+}
@@ -0,0 +1,207 @@
+package rest
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/raisultan/abac/pkg/retrieve"
+	"github.com/raisultan/abac/pkg/webhook"
+)
+
+const InvalidWebhookIDErrMsg = "Invalid webhook ID"
+
+func listWebhooks(s webhook.Service, retr retrieve.Service) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := authenticateAdmin(r, retr); err != nil {
+			respondWithAuthError(w, err)
+			return
+		}
+
+		subs, err := s.ListSubscriptions(r.Context())
+		if err != nil {
+			respondWithErrorMessage(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		respondWithJSON(w, http.StatusOK, subs)
+	}
+}
+
+func getWebhook(s webhook.Service, retr retrieve.Service) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := authenticateAdmin(r, retr); err != nil {
+			respondWithAuthError(w, err)
+			return
+		}
+
+		id, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			respondWithErrorMessage(w, http.StatusBadRequest, InvalidWebhookIDErrMsg)
+			return
+		}
+
+		sub, err := s.GetSubscription(r.Context(), id)
+		if err != nil {
+			respondWithWebhookError(w, err)
+			return
+		}
+
+		respondWithJSON(w, http.StatusOK, sub)
+	}
+}
+
+// saveWebhook creates a subscription on POST, the response is the only
+// time its secret is shown, and replaces one on PUT.
+func saveWebhook(s webhook.Service, retr retrieve.Service, rv *reqValidator) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := authenticateAdmin(r, retr); err != nil {
+			respondWithAuthError(w, err)
+			return
+		}
+
+		var sr webhook.SubscriptionRequest
+		if err := json.NewDecoder(r.Body).Decode(&sr); err != nil {
+			respondWithErrorMessage(w, http.StatusBadRequest, InvalidReqPayloadErrMsg)
+			return
+		}
+		defer r.Body.Close()
+
+		isValid, vErr := validateRequest(sr, rv)
+		if !isValid {
+			respondWithJSON(w, http.StatusBadRequest, vErr)
+			return
+		}
+
+		if r.Method == http.MethodPost {
+			sub, err := s.CreateSubscription(r.Context(), sr)
+			if err != nil {
+				respondWithWebhookError(w, err)
+				return
+			}
+			respondWithJSON(w, http.StatusCreated, sub)
+			return
+		}
+
+		id, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			respondWithErrorMessage(w, http.StatusBadRequest, InvalidWebhookIDErrMsg)
+			return
+		}
+
+		sub, err := s.UpdateSubscription(r.Context(), id, sr)
+		if err != nil {
+			respondWithWebhookError(w, err)
+			return
+		}
+
+		respondWithJSON(w, http.StatusOK, sub)
+	}
+}
+
+func deleteWebhook(s webhook.Service, retr retrieve.Service) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := authenticateAdmin(r, retr); err != nil {
+			respondWithAuthError(w, err)
+			return
+		}
+
+		id, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			respondWithErrorMessage(w, http.StatusBadRequest, InvalidWebhookIDErrMsg)
+			return
+		}
+
+		if err := s.DeleteSubscription(r.Context(), id); err != nil {
+			respondWithWebhookError(w, err)
+			return
+		}
+
+		respondWithJSON(w, http.StatusOK, map[string]string{"result": "success"})
+	}
+}
+
+func listWebhookDeliveries(s webhook.Service, retr retrieve.Service) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := authenticateAdmin(r, retr); err != nil {
+			respondWithAuthError(w, err)
+			return
+		}
+
+		id, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			respondWithErrorMessage(w, http.StatusBadRequest, InvalidWebhookIDErrMsg)
+			return
+		}
+
+		q := r.URL.Query()
+		lr := webhook.DeliveryListRequest{SubscriptionID: id, Status: q.Get("status")}
+		if v := q.Get("limit"); v != "" {
+			if lr.Limit, err = strconv.Atoi(v); err != nil {
+				respondWithErrorMessage(w, http.StatusBadRequest, InvalidQueryParamErr.Error())
+				return
+			}
+		}
+		if v := q.Get("before"); v != "" {
+			if lr.Before, err = strconv.ParseInt(v, 10, 64); err != nil {
+				respondWithErrorMessage(w, http.StatusBadRequest, InvalidQueryParamErr.Error())
+				return
+			}
+		}
+
+		resp, err := s.ListDeliveries(r.Context(), lr)
+		if err != nil {
+			respondWithWebhookError(w, err)
+			return
+		}
+
+		if resp.NextBefore > 0 {
+			q.Set("before", strconv.FormatInt(resp.NextBefore, 10))
+			resp.Next = r.URL.Path + "?" + q.Encode()
+		}
+
+		respondWithJSON(w, http.StatusOK, resp)
+	}
+}
+
+func redeliverWebhook(s webhook.Service, retr retrieve.Service) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := authenticateAdmin(r, retr); err != nil {
+			respondWithAuthError(w, err)
+			return
+		}
+
+		vars := mux.Vars(r)
+		id, err := strconv.Atoi(vars["id"])
+		if err != nil {
+			respondWithErrorMessage(w, http.StatusBadRequest, InvalidWebhookIDErrMsg)
+			return
+		}
+		deliveryID, err := strconv.ParseInt(vars["deliveryId"], 10, 64)
+		if err != nil {
+			respondWithErrorMessage(w, http.StatusBadRequest, webhook.DeliveryNotFoundErr.Error())
+			return
+		}
+
+		d, err := s.Redeliver(r.Context(), id, deliveryID)
+		if err != nil {
+			respondWithWebhookError(w, err)
+			return
+		}
+
+		respondWithJSON(w, http.StatusAccepted, d)
+	}
+}
+
+func respondWithWebhookError(w http.ResponseWriter, err error) {
+	switch {
+	case err == webhook.NotFoundErr, err == webhook.DeliveryNotFoundErr:
+		respondWithErrorMessage(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, webhook.UnknownEventTypeErr):
+		respondWithErrorMessage(w, http.StatusBadRequest, err.Error())
+	default:
+		respondWithErrorMessage(w, http.StatusInternalServerError, err.Error())
+	}
+}
@@ -1,21 +1,25 @@
 package jwt_refresh
 
 import (
+	"context"
 	"errors"
-	"fmt"
-	"time"
 
-	"github.com/dgrijalva/jwt-go"
+	"github.com/raisultan/abac/pkg/token"
 )
 
 var RefreshExpectedErr = errors.New("Refresh token is expected")
 var InvalidRefreshErr = errors.New("Invalid refresh token received")
+var RevokedRefreshErr = errors.New("Refresh token has been revoked")
+var DisabledUserErr = errors.New("User is disabled")
 
 type Service interface {
-	RefreshJWT(UserJWTRefreshRequest) (UserJWTRefreshResponse, error)
+	RefreshJWT(context.Context, UserJWTRefreshRequest) (UserJWTRefreshResponse, error)
 }
 
-type Repository interface{}
+type Repository interface {
+	IsTokenRevoked(context.Context, string) (bool, error)
+	IsUserDisabled(context.Context, string) (bool, error)
+}
 
 type service struct {
 	r Repository
@@ -25,55 +29,38 @@ func NewService(r Repository) Service {
 	return &service{r}
 }
 
-func (s *service) RefreshJWT(r UserJWTRefreshRequest) (UserJWTRefreshResponse, error) {
-	// TODO: make global
-	var jwtKey = []byte("23a93f6d2673b09c1d3d063cf7a97fc20d0054dfce65c3737455dbec25439938")
-
-	token, err := jwt.Parse(r.Refresh, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, errors.New(
-				fmt.Sprintf(
-					"unexpected signing method: %v",
-					token.Header["alg"],
-				),
-			)
-		}
-		return jwtKey, nil
-	})
-
+func (s *service) RefreshJWT(ctx context.Context, r UserJWTRefreshRequest) (UserJWTRefreshResponse, error) {
+	// malformed, expired and wrongly signed tokens are all just invalid
+	tp, err := token.Parse(r.Refresh)
 	if err != nil {
-		return UserJWTRefreshResponse{}, err
+		return UserJWTRefreshResponse{}, InvalidRefreshErr
+	}
+	if tp.Type != token.RefreshType {
+		return UserJWTRefreshResponse{}, RefreshExpectedErr
 	}
 
-	claims, ok := token.Claims.(jwt.MapClaims)
-	if ok && token.Valid {
-		email, ok := claims["email"].(string)
-		if !ok {
-			return UserJWTRefreshResponse{}, err
-		}
-
-		tType, ok := claims["type"].(string)
-		if !ok {
+	if tp.ID != "" {
+		revoked, err := s.r.IsTokenRevoked(ctx, tp.ID)
+		if err != nil {
 			return UserJWTRefreshResponse{}, err
 		}
-		if tType != "refresh" {
-			return UserJWTRefreshResponse{}, RefreshExpectedErr
+		if revoked {
+			return UserJWTRefreshResponse{}, RevokedRefreshErr
 		}
+	}
 
-		atClaims := jwt.MapClaims{}
-		atClaims["isAuthorized"] = true
-		atClaims["email"] = email
-		atClaims["type"] = "access"
-		atClaims["exp"] = time.Now().Add(5 * time.Minute).Unix()
-
-		at := jwt.NewWithClaims(jwt.SigningMethodHS256, atClaims)
-		atStr, err := at.SignedString(jwtKey)
-		if err != nil {
-			return UserJWTRefreshResponse{}, err
-		}
+	disabled, err := s.r.IsUserDisabled(ctx, tp.Email)
+	if err != nil {
+		return UserJWTRefreshResponse{}, err
+	}
+	if disabled {
+		return UserJWTRefreshResponse{}, DisabledUserErr
+	}
 
-		return UserJWTRefreshResponse{Access: atStr}, nil
+	atStr, err := token.CreateAccessToken(tp.Email)
+	if err != nil {
+		return UserJWTRefreshResponse{}, err
 	}
 
-	return UserJWTRefreshResponse{}, InvalidRefreshErr
+	return UserJWTRefreshResponse{Access: atStr}, nil
 }
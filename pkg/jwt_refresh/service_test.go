@@ -0,0 +1,71 @@
+package jwt_refresh_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/raisultan/abac/pkg/jwt_refresh"
+	"github.com/raisultan/abac/pkg/token"
+)
+
+// repository knows no revoked tokens and no disabled users.
+type repository struct{}
+
+func (repository) IsTokenRevoked(context.Context, string) (bool, error) { return false, nil }
+func (repository) IsUserDisabled(context.Context, string) (bool, error) { return false, nil }
+
+// configure issues tokens valid for ttl until the test ends.
+func configure(t *testing.T, ttl time.Duration) {
+	token.Configure(token.Config{AccessTTL: ttl, RefreshTTL: ttl})
+	t.Cleanup(func() {
+		token.Configure(token.Config{AccessTTL: 5 * time.Minute, RefreshTTL: 30 * time.Minute})
+	})
+}
+
+func refresh(t *testing.T, refreshToken string) error {
+	_, err := jwt_refresh.NewService(repository{}).RefreshJWT(
+		context.Background(),
+		jwt_refresh.UserJWTRefreshRequest{Refresh: refreshToken},
+	)
+	return err
+}
+
+func TestRefreshRejectsExpiredToken(t *testing.T) {
+	configure(t, -time.Minute)
+	expired, err := token.CreateRefreshToken("ada@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := refresh(t, expired); err != jwt_refresh.InvalidRefreshErr {
+		t.Errorf("expired token: got %v, want %v", err, jwt_refresh.InvalidRefreshErr)
+	}
+}
+
+func TestRefreshRejectsInvalidTokens(t *testing.T) {
+	configure(t, time.Minute)
+	access, err := token.CreateAccessToken("ada@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	valid, err := token.CreateRefreshToken("ada@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, tc := range map[string]struct {
+		token string
+		want  error
+	}{
+		"malformed":    {"not-a-token", jwt_refresh.InvalidRefreshErr},
+		"tampered":     {valid[:strings.LastIndex(valid, ".")] + access[strings.LastIndex(access, "."):], jwt_refresh.InvalidRefreshErr},
+		"access token": {access, jwt_refresh.RefreshExpectedErr},
+		"valid":        {valid, nil},
+	} {
+		if err := refresh(t, tc.token); err != tc.want {
+			t.Errorf("%s: got %v, want %v", name, err, tc.want)
+		}
+	}
+}
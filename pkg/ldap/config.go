@@ -0,0 +1,36 @@
+package ldap
+
+import "time"
+
+// Config describes how users are authenticated against and groups are
+// read from an LDAP or Active Directory server.
+type Config struct {
+	URL      string
+	StartTLS bool
+
+	// BindDNTemplate binds users directly, e.g. "uid={username},ou=people,dc=example,dc=org".
+	// {username} is replaced with the local part of the email and {email} with the
+	// whole email. When empty the user is looked up with UserFilter first.
+	BindDNTemplate string
+
+	// BindDN and BindPassword are the service account used for searches.
+	BindDN       string
+	BindPassword string
+
+	UserBaseDN    string
+	UserFilter    string
+	EmailAttr     string
+	FirstNameAttr string
+	LastNameAttr  string
+
+	GroupBaseDN     string
+	GroupFilter     string
+	GroupNameAttr   string
+	GroupMemberAttr string
+
+	SyncInterval time.Duration
+}
+
+func (c Config) Enabled() bool {
+	return c.URL != ""
+}
@@ -0,0 +1,259 @@
+package ldap
+
+import (
+	"crypto/tls"
+	"fmt"
+	"strings"
+
+	goldap "github.com/go-ldap/ldap/v3"
+	"github.com/raisultan/abac/pkg/login"
+)
+
+// conn is the subset of an LDAP connection the directory relies on,
+// it allows an in-process stand-in to replace the real server.
+type conn interface {
+	Bind(username, password string) error
+	Search(*goldap.SearchRequest) (*goldap.SearchResult, error)
+	Close()
+}
+
+// Group is a directory group with the emails of its members.
+type Group struct {
+	Name    string
+	Members []string
+}
+
+type Directory struct {
+	c    Config
+	dial func() (conn, error)
+}
+
+func NewDirectory(c Config) *Directory {
+	d := &Directory{c: c}
+	d.dial = d.dialURL
+	return d
+}
+
+func (d *Directory) dialURL() (conn, error) {
+	l, err := goldap.DialURL(d.c.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	if d.c.StartTLS {
+		host := strings.TrimPrefix(strings.TrimPrefix(d.c.URL, "ldap://"), "ldaps://")
+		host = strings.Split(host, ":")[0]
+		if err := l.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			l.Close()
+			return nil, err
+		}
+	}
+
+	return l, nil
+}
+
+// Authenticate binds as the user identified by email and returns the
+// directory entry along with the groups the user is a member of.
+func (d *Directory) Authenticate(email, password string) (login.ExternalUser, error) {
+	// an empty password would result in an unauthenticated bind, which succeeds
+	if password == "" {
+		return login.ExternalUser{}, login.InvalidCredsErr
+	}
+
+	l, err := d.dial()
+	if err != nil {
+		return login.ExternalUser{}, err
+	}
+	defer l.Close()
+
+	var dn string
+	if d.c.BindDNTemplate != "" {
+		dn = expand(d.c.BindDNTemplate, email, escapeDN)
+	} else {
+		entry, err := d.findUser(l, email)
+		if err != nil {
+			return login.ExternalUser{}, err
+		}
+		dn = entry.DN
+	}
+
+	if err := l.Bind(dn, password); err != nil {
+		if goldap.IsErrorWithCode(err, goldap.LDAPResultInvalidCredentials) {
+			return login.ExternalUser{}, login.InvalidCredsErr
+		}
+		return login.ExternalUser{}, err
+	}
+
+	entry, err := d.entry(l, dn)
+	if err != nil {
+		return login.ExternalUser{}, err
+	}
+
+	groups, err := d.userGroups(l, dn)
+	if err != nil {
+		return login.ExternalUser{}, err
+	}
+
+	u := login.ExternalUser{
+		Email:     entry.GetAttributeValue(d.c.EmailAttr),
+		FirstName: entry.GetAttributeValue(d.c.FirstNameAttr),
+		LastName:  entry.GetAttributeValue(d.c.LastNameAttr),
+		Groups:    groups,
+	}
+	if u.Email == "" {
+		u.Email = email
+	}
+
+	return u, nil
+}
+
+// Groups lists every directory group matching GroupFilter with its members.
+func (d *Directory) Groups() ([]Group, error) {
+	l, err := d.dial()
+	if err != nil {
+		return nil, err
+	}
+	defer l.Close()
+
+	if err := d.bindServiceAccount(l); err != nil {
+		return nil, err
+	}
+
+	res, err := l.Search(goldap.NewSearchRequest(
+		d.c.GroupBaseDN,
+		goldap.ScopeWholeSubtree, goldap.NeverDerefAliases, 0, 0, false,
+		d.c.GroupFilter,
+		[]string{d.c.GroupNameAttr, d.c.GroupMemberAttr},
+		nil,
+	))
+	if err != nil {
+		return nil, err
+	}
+
+	emails := map[string]string{}
+	groups := []Group{}
+	for _, e := range res.Entries {
+		g := Group{Name: e.GetAttributeValue(d.c.GroupNameAttr), Members: []string{}}
+		for _, memberDN := range e.GetAttributeValues(d.c.GroupMemberAttr) {
+			email, ok := emails[memberDN]
+			if !ok {
+				member, err := d.entry(l, memberDN)
+				if err != nil {
+					// members may reference entries that no longer exist
+					if goldap.IsErrorWithCode(err, goldap.LDAPResultNoSuchObject) {
+						continue
+					}
+					return nil, err
+				}
+				email = member.GetAttributeValue(d.c.EmailAttr)
+				emails[memberDN] = email
+			}
+			if email != "" {
+				g.Members = append(g.Members, email)
+			}
+		}
+		groups = append(groups, g)
+	}
+
+	return groups, nil
+}
+
+func (d *Directory) findUser(l conn, email string) (*goldap.Entry, error) {
+	if err := d.bindServiceAccount(l); err != nil {
+		return nil, err
+	}
+
+	res, err := l.Search(goldap.NewSearchRequest(
+		d.c.UserBaseDN,
+		goldap.ScopeWholeSubtree, goldap.NeverDerefAliases, 2, 0, false,
+		expand(d.c.UserFilter, email, goldap.EscapeFilter),
+		[]string{"dn"},
+		nil,
+	))
+	if err != nil {
+		if goldap.IsErrorWithCode(err, goldap.LDAPResultSizeLimitExceeded) {
+			return nil, login.InvalidCredsErr
+		}
+		return nil, err
+	}
+	if len(res.Entries) != 1 {
+		return nil, login.InvalidCredsErr
+	}
+
+	return res.Entries[0], nil
+}
+
+func (d *Directory) entry(l conn, dn string) (*goldap.Entry, error) {
+	res, err := l.Search(goldap.NewSearchRequest(
+		dn,
+		goldap.ScopeBaseObject, goldap.NeverDerefAliases, 1, 0, false,
+		"(objectClass=*)",
+		[]string{d.c.EmailAttr, d.c.FirstNameAttr, d.c.LastNameAttr},
+		nil,
+	))
+	if err != nil {
+		return nil, err
+	}
+	if len(res.Entries) != 1 {
+		return nil, fmt.Errorf("ldap: entry %q not found", dn)
+	}
+
+	return res.Entries[0], nil
+}
+
+func (d *Directory) userGroups(l conn, dn string) ([]string, error) {
+	if d.c.GroupBaseDN == "" {
+		return nil, nil
+	}
+
+	res, err := l.Search(goldap.NewSearchRequest(
+		d.c.GroupBaseDN,
+		goldap.ScopeWholeSubtree, goldap.NeverDerefAliases, 0, 0, false,
+		fmt.Sprintf("(&%s(%s=%s))", d.c.GroupFilter, d.c.GroupMemberAttr, goldap.EscapeFilter(dn)),
+		[]string{d.c.GroupNameAttr},
+		nil,
+	))
+	if err != nil {
+		return nil, err
+	}
+
+	groups := []string{}
+	for _, e := range res.Entries {
+		if name := e.GetAttributeValue(d.c.GroupNameAttr); name != "" {
+			groups = append(groups, name)
+		}
+	}
+	return groups, nil
+}
+
+func (d *Directory) bindServiceAccount(l conn) error {
+	if d.c.BindDN == "" {
+		return nil
+	}
+	return l.Bind(d.c.BindDN, d.c.BindPassword)
+}
+
+func expand(template, email string, escape func(string) string) string {
+	username := strings.SplitN(email, "@", 2)[0]
+	r := strings.NewReplacer("{email}", escape(email), "{username}", escape(username))
+	return r.Replace(template)
+}
+
+// escapeDN escapes an attribute value for use in a distinguished name as per RFC 4514.
+func escapeDN(v string) string {
+	var b strings.Builder
+	for i, r := range v {
+		switch {
+		case strings.ContainsRune(`,+"\<>;=`, r),
+			i == 0 && (r == ' ' || r == '#'),
+			i == len(v)-1 && r == ' ':
+			b.WriteRune('\\')
+			b.WriteRune(r)
+		case r == 0:
+			b.WriteString(`\00`)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,280 @@
+package ldap
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	goldap "github.com/go-ldap/ldap/v3"
+	"github.com/raisultan/abac/pkg/login"
+)
+
+// fakeDirectory is an in-process stand-in for an LDAP server. It knows the
+// filters the directory sends: equality, & and presence of objectClass.
+type fakeDirectory struct {
+	entries   map[string]map[string][]string
+	passwords map[string]string
+	bound     string
+}
+
+func (f *fakeDirectory) dial() (conn, error) {
+	f.bound = ""
+	return f, nil
+}
+
+func (f *fakeDirectory) Bind(username, password string) error {
+	if pw, ok := f.passwords[username]; !ok || pw != password {
+		return goldap.NewError(goldap.LDAPResultInvalidCredentials, errors.New("invalid credentials"))
+	}
+	f.bound = username
+	return nil
+}
+
+func (f *fakeDirectory) Search(req *goldap.SearchRequest) (*goldap.SearchResult, error) {
+	if f.bound == "" {
+		return nil, goldap.NewError(goldap.LDAPResultInsufficientAccessRights, errors.New("anonymous search"))
+	}
+
+	res := &goldap.SearchResult{}
+	if req.Scope == goldap.ScopeBaseObject {
+		attrs, ok := f.entries[req.BaseDN]
+		if !ok {
+			return nil, goldap.NewError(goldap.LDAPResultNoSuchObject, fmt.Errorf("no entry %s", req.BaseDN))
+		}
+		res.Entries = append(res.Entries, goldap.NewEntry(req.BaseDN, attrs))
+		return res, nil
+	}
+
+	dns := make([]string, 0, len(f.entries))
+	for dn := range f.entries {
+		dns = append(dns, dn)
+	}
+	sort.Strings(dns)
+
+	for _, dn := range dns {
+		if !strings.HasSuffix(dn, req.BaseDN) || !matchFilter(req.Filter, f.entries[dn]) {
+			continue
+		}
+		if req.SizeLimit > 0 && len(res.Entries) == req.SizeLimit {
+			return res, goldap.NewError(goldap.LDAPResultSizeLimitExceeded, errors.New("size limit exceeded"))
+		}
+		res.Entries = append(res.Entries, goldap.NewEntry(dn, f.entries[dn]))
+	}
+	return res, nil
+}
+
+func (f *fakeDirectory) Close() {}
+
+func matchFilter(filter string, attrs map[string][]string) bool {
+	filter = strings.TrimSuffix(strings.TrimPrefix(filter, "("), ")")
+	if strings.HasPrefix(filter, "&") {
+		for _, sub := range splitFilters(filter[1:]) {
+			if !matchFilter(sub, attrs) {
+				return false
+			}
+		}
+		return true
+	}
+
+	kv := strings.SplitN(filter, "=", 2)
+	if kv[1] == "*" {
+		return kv[0] == "objectClass"
+	}
+	for _, v := range attrs[kv[0]] {
+		if v == unescapeFilter(kv[1]) {
+			return true
+		}
+	}
+	return false
+}
+
+func splitFilters(s string) []string {
+	var filters []string
+	depth, start := 0, 0
+	for i, r := range s {
+		switch r {
+		case '(':
+			if depth == 0 {
+				start = i
+			}
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				filters = append(filters, s[start:i+1])
+			}
+		}
+	}
+	return filters
+}
+
+func unescapeFilter(v string) string {
+	var b strings.Builder
+	for i := 0; i < len(v); i++ {
+		if v[i] == '\\' && i+2 < len(v) {
+			if n, err := strconv.ParseUint(v[i+1:i+3], 16, 8); err == nil {
+				b.WriteByte(byte(n))
+				i += 2
+				continue
+			}
+		}
+		b.WriteByte(v[i])
+	}
+	return b.String()
+}
+
+func newFakeDirectory() *fakeDirectory {
+	return &fakeDirectory{
+		entries: map[string]map[string][]string{
+			"cn=service,dc=example,dc=org": {"objectClass": {"person"}},
+			"uid=ann,ou=people,dc=example,dc=org": {
+				"objectClass": {"inetOrgPerson"},
+				"mail":        {"ann@example.org"},
+				"givenName":   {"Ann"},
+				"sn":          {"Lee"},
+			},
+			"uid=bob,ou=people,dc=example,dc=org": {
+				"objectClass": {"inetOrgPerson"},
+				"mail":        {"bob@example.org"},
+			},
+			"cn=staff,ou=groups,dc=example,dc=org": {
+				"objectClass": {"groupOfNames"},
+				"cn":          {"staff"},
+				"member": {
+					"uid=ann,ou=people,dc=example,dc=org",
+					"uid=bob,ou=people,dc=example,dc=org",
+					"uid=gone,ou=people,dc=example,dc=org",
+				},
+			},
+			"cn=admins,ou=groups,dc=example,dc=org": {
+				"objectClass": {"groupOfNames"},
+				"cn":          {"admins"},
+				"member":      {"uid=ann,ou=people,dc=example,dc=org"},
+			},
+		},
+		passwords: map[string]string{
+			"cn=service,dc=example,dc=org":        "service",
+			"uid=ann,ou=people,dc=example,dc=org": "secret",
+			"uid=bob,ou=people,dc=example,dc=org": "hunter2",
+		},
+	}
+}
+
+func testConfig() Config {
+	return Config{
+		URL:             "ldap://directory.example.org",
+		BindDN:          "cn=service,dc=example,dc=org",
+		BindPassword:    "service",
+		UserBaseDN:      "ou=people,dc=example,dc=org",
+		UserFilter:      "(mail={email})",
+		EmailAttr:       "mail",
+		FirstNameAttr:   "givenName",
+		LastNameAttr:    "sn",
+		GroupBaseDN:     "ou=groups,dc=example,dc=org",
+		GroupFilter:     "(objectClass=groupOfNames)",
+		GroupNameAttr:   "cn",
+		GroupMemberAttr: "member",
+	}
+}
+
+func newTestDirectory(c Config, f *fakeDirectory) *Directory {
+	d := NewDirectory(c)
+	d.dial = f.dial
+	return d
+}
+
+func TestAuthenticate(t *testing.T) {
+	d := newTestDirectory(testConfig(), newFakeDirectory())
+
+	u, err := d.Authenticate("ann@example.org", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(u.Groups)
+	want := login.ExternalUser{
+		Email:     "ann@example.org",
+		FirstName: "Ann",
+		LastName:  "Lee",
+		Groups:    []string{"admins", "staff"},
+	}
+	if !reflect.DeepEqual(u, want) {
+		t.Errorf("got %+v, want %+v", u, want)
+	}
+}
+
+func TestAuthenticateWithBindDNTemplate(t *testing.T) {
+	c := testConfig()
+	c.BindDNTemplate = "uid={username},ou=people,dc=example,dc=org"
+	d := newTestDirectory(c, newFakeDirectory())
+
+	u, err := d.Authenticate("bob@example.org", "hunter2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Email != "bob@example.org" || len(u.Groups) != 1 || u.Groups[0] != "staff" {
+		t.Errorf("got %+v, want bob@example.org in [staff]", u)
+	}
+}
+
+func TestAuthenticateRejectsInvalidCredentials(t *testing.T) {
+	for name, creds := range map[string][2]string{
+		"wrong password": {"ann@example.org", "wrong"},
+		"empty password": {"ann@example.org", ""},
+		"unknown user":   {"nobody@example.org", "secret"},
+		"filter escape":  {"*", "secret"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			d := newTestDirectory(testConfig(), newFakeDirectory())
+			if _, err := d.Authenticate(creds[0], creds[1]); err != login.InvalidCredsErr {
+				t.Errorf("got %v, want %v", err, login.InvalidCredsErr)
+			}
+		})
+	}
+}
+
+func TestAuthenticateRejectsAmbiguousUser(t *testing.T) {
+	f := newFakeDirectory()
+	f.entries["uid=ann2,ou=people,dc=example,dc=org"] = map[string][]string{"mail": {"ann@example.org"}}
+	d := newTestDirectory(testConfig(), f)
+
+	if _, err := d.Authenticate("ann@example.org", "secret"); err != login.InvalidCredsErr {
+		t.Errorf("got %v, want %v", err, login.InvalidCredsErr)
+	}
+}
+
+func TestGroups(t *testing.T) {
+	d := newTestDirectory(testConfig(), newFakeDirectory())
+
+	groups, err := d.Groups()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// members whose entry is gone are skipped
+	want := []Group{
+		{Name: "admins", Members: []string{"ann@example.org"}},
+		{Name: "staff", Members: []string{"ann@example.org", "bob@example.org"}},
+	}
+	if !reflect.DeepEqual(groups, want) {
+		t.Errorf("got %+v, want %+v", groups, want)
+	}
+}
+
+func TestEscapeDN(t *testing.T) {
+	for in, want := range map[string]string{
+		"ann":       "ann",
+		"a,b=c":     `a\,b\=c`,
+		" lead":     `\ lead`,
+		"trail ":    `trail\ `,
+		"#hash":     `\#hash`,
+		`q"<x>;+\y`: `q\"\<x\>\;\+\\y`,
+	} {
+		if got := escapeDN(in); got != want {
+			t.Errorf("escapeDN(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
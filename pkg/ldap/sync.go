@@ -0,0 +1,78 @@
+package ldap
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/raisultan/abac/pkg/event"
+	"github.com/raisultan/abac/pkg/storage"
+)
+
+type Repository interface {
+	storage.Transactor
+
+	// SyncGroupMembers reports whether the membership changed.
+	SyncGroupMembers(ctx context.Context, group string, emails []string) (bool, error)
+	AppendEvent(context.Context, event.Event) error
+}
+
+// Syncer periodically mirrors directory groups into the local group tables.
+type Syncer struct {
+	d *Directory
+	r Repository
+}
+
+func NewSyncer(d *Directory, r Repository) *Syncer {
+	return &Syncer{d, r}
+}
+
+// Run syncs groups every interval until ctx is done.
+func (s *Syncer) Run(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		if err := s.Sync(ctx); err != nil {
+			log.Println("ldap group sync failed:", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// Sync replaces the membership of each directory group with its current
+// members, emitting an event for the groups that changed. Members without a
+// local user are skipped, they are provisioned on their first login.
+func (s *Syncer) Sync(ctx context.Context) error {
+	groups, err := s.d.Groups()
+	if err != nil {
+		return err
+	}
+
+	for _, g := range groups {
+		if g.Name == "" {
+			continue
+		}
+		err := s.r.WithinTx(ctx, func(ctx context.Context) error {
+			changed, err := s.r.SyncGroupMembers(ctx, g.Name, g.Members)
+			if err != nil || !changed {
+				return err
+			}
+			return s.r.AppendEvent(ctx, event.New(
+				event.GroupUpdated,
+				event.GroupSubject(g.Name),
+				map[string]interface{}{"name": g.Name},
+			))
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
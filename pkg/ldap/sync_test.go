@@ -0,0 +1,85 @@
+package ldap
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/raisultan/abac/pkg/event"
+	"github.com/raisultan/abac/pkg/register"
+	"github.com/raisultan/abac/pkg/storage/memory"
+)
+
+func TestSync(t *testing.T) {
+	ctx := context.Background()
+	s := memory.NewStorage()
+	for _, email := range []string{"ann@example.org", "bob@example.org"} {
+		if _, err := s.CreateUser(ctx, register.UserRegisterRequest{Email: email, Password: "password"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	f := newFakeDirectory()
+	syncer := NewSyncer(newTestDirectory(testConfig(), f), s)
+	if err := syncer.Sync(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	assertGroups(t, s, "ann@example.org", []string{"admins", "staff"})
+	assertGroups(t, s, "bob@example.org", []string{"staff"})
+	assertGroupEvents(t, s, []string{"group:admins", "group:staff"})
+
+	// only groups whose membership changed are announced
+	f.entries["cn=staff,ou=groups,dc=example,dc=org"]["member"] = []string{"uid=ann,ou=people,dc=example,dc=org"}
+	if err := syncer.Sync(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	assertGroups(t, s, "bob@example.org", nil)
+	assertGroupEvents(t, s, []string{"group:staff"})
+}
+
+func assertGroups(t *testing.T, s *memory.Storage, email string, want []string) {
+	t.Helper()
+
+	sub, err := s.GetSubject(context.Background(), email)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := sub.Groups
+	sort.Strings(got)
+	if len(got) == 0 && len(want) == 0 {
+		return
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("groups of %s are %v, want %v", email, got, want)
+	}
+}
+
+// assertGroupEvents checks the subjects of the group.updated events
+// appended since the last call.
+func assertGroupEvents(t *testing.T, s *memory.Storage, want []string) {
+	t.Helper()
+
+	events, err := s.ClaimEvents(context.Background(), 100, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := []string{}
+	for _, e := range events {
+		if e.Type == event.GroupUpdated {
+			got = append(got, e.Subject)
+		}
+		// later events of the subject wait for this one
+		if err := s.MarkEventPublished(context.Background(), e.ID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sort.Strings(got)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("group events for %v, want %v", got, want)
+	}
+}
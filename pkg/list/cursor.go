@@ -0,0 +1,107 @@
+package list
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var InvalidSortErr = errors.New("Invalid sort field")
+var InvalidCursorErr = errors.New("Invalid cursor")
+
+// SortableFields are the user fields results can be sorted by.
+var SortableFields = map[string]bool{
+	"id":        true,
+	"email":     true,
+	"firstName": true,
+	"lastName":  true,
+	"createdAt": true,
+}
+
+// Cursor marks the last user of a page. It stores the values of the sort
+// fields so the next page can continue right after it.
+type Cursor struct {
+	Sort   string   `json:"s"`
+	Values []string `json:"v"`
+	ID     int      `json:"i"`
+}
+
+// ParseSort parses a comma separated list of fields, a leading "-" sorts
+// in descending order.
+func ParseSort(s string) ([]SortField, error) {
+	fields := []SortField{}
+	if s == "" {
+		return fields, nil
+	}
+
+	for _, f := range strings.Split(s, ",") {
+		sf := SortField{Name: strings.TrimSpace(f)}
+		if strings.HasPrefix(sf.Name, "-") {
+			sf.Name, sf.Desc = sf.Name[1:], true
+		}
+		if !SortableFields[sf.Name] {
+			return nil, InvalidSortErr
+		}
+		fields = append(fields, sf)
+	}
+	return fields, nil
+}
+
+func FormatSort(fields []SortField) string {
+	parts := []string{}
+	for _, f := range fields {
+		if f.Desc {
+			parts = append(parts, "-"+f.Name)
+		} else {
+			parts = append(parts, f.Name)
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+// DecodeCursor decodes a cursor and checks it was issued for the same sort order.
+func DecodeCursor(s string, sort []SortField) (*Cursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, InvalidCursorErr
+	}
+
+	var c Cursor
+	if err := json.Unmarshal(b, &c); err != nil {
+		return nil, InvalidCursorErr
+	}
+	if c.Sort != FormatSort(sort) || len(c.Values) != len(sort) {
+		return nil, InvalidCursorErr
+	}
+
+	return &c, nil
+}
+
+func encodeCursor(sort []SortField, u UserRetrieveResponse) string {
+	c := Cursor{Sort: FormatSort(sort), Values: []string{}, ID: u.ID}
+	for _, f := range sort {
+		c.Values = append(c.Values, fieldValue(f.Name, u))
+	}
+
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func fieldValue(name string, u UserRetrieveResponse) string {
+	switch name {
+	case "id":
+		return strconv.Itoa(u.ID)
+	case "email":
+		return u.Email
+	case "firstName":
+		return u.FirstName
+	case "lastName":
+		return u.LastName
+	case "createdAt":
+		return u.CreatedAt.Format(time.RFC3339Nano)
+	}
+	return ""
+}
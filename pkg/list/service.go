@@ -1,11 +1,19 @@
 package list
 
+import "context"
+
+const (
+	DefaultLimit = 20
+	MaxLimit     = 100
+)
+
 type Service interface {
-	ListUsers(start, count int) ([]UserRetrieveResponse, error)
+	ListUsers(context.Context, UserListRequest) (UserListResponse, error)
 }
 
 type Repository interface {
-	GetAllUsers(start, count int) ([]UserRetrieveResponse, error)
+	GetAllUsers(context.Context, UserListRequest) ([]UserRetrieveResponse, error)
+	CountUsers(context.Context, UserListRequest) (int, error)
 }
 
 type service struct {
@@ -16,6 +24,35 @@ func NewService(r Repository) Service {
 	return &service{r}
 }
 
-func (s *service) ListUsers(start, count int) ([]UserRetrieveResponse, error) {
-	return s.r.GetAllUsers(start, count)
+func (s *service) ListUsers(ctx context.Context, lr UserListRequest) (UserListResponse, error) {
+	if lr.Limit < 1 {
+		lr.Limit = DefaultLimit
+	}
+	if lr.Limit > MaxLimit {
+		lr.Limit = MaxLimit
+	}
+
+	// one extra user is fetched to find out whether there is a next page
+	page := lr
+	page.Limit++
+	users, err := s.r.GetAllUsers(ctx, page)
+	if err != nil {
+		return UserListResponse{}, err
+	}
+
+	resp := UserListResponse{Data: users}
+	if len(users) > lr.Limit {
+		resp.Data = users[:lr.Limit]
+		resp.NextCursor = encodeCursor(lr.Sort, resp.Data[lr.Limit-1])
+	}
+
+	if lr.WithTotal {
+		total, err := s.r.CountUsers(ctx, lr)
+		if err != nil {
+			return UserListResponse{}, err
+		}
+		resp.Total = &total
+	}
+
+	return resp, nil
 }
@@ -1,11 +1,49 @@
 package list
 
+import "time"
+
 type UserRetrieveResponse struct {
 	ID int `json:"id"`
 
-	Email      string `json:"email"`
-	FirstName  string `json:"firstName"`
-	LastName   string `json:"lastName"`
-	IsAdmin    bool   `json:"isAdmin"`
-	IsApproved bool   `json:"isApproved"`
+	Email      string     `json:"email"`
+	FirstName  string     `json:"firstName"`
+	LastName   string     `json:"lastName"`
+	IsAdmin    bool       `json:"isAdmin"`
+	IsApproved bool       `json:"isApproved"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	DisabledAt *time.Time `json:"disabledAt,omitempty"`
+	DeletedAt  *time.Time `json:"deletedAt,omitempty"`
+}
+
+type UserListRequest struct {
+	Email       string
+	IsAdmin     *bool
+	IsApproved  *bool
+	Group       string
+	CreatedFrom *time.Time
+	CreatedTo   *time.Time
+
+	// IncludeDeleted also lists soft deleted users
+	IncludeDeleted bool
+
+	// Search matches email, first and last name case-insensitively
+	Search string
+
+	Sort      []SortField
+	After     *Cursor
+	Limit     int
+	WithTotal bool
+}
+
+type SortField struct {
+	Name string
+	Desc bool
+}
+
+type UserListResponse struct {
+	Data  []UserRetrieveResponse `json:"data"`
+	Next  string                 `json:"next,omitempty"`
+	Total *int                   `json:"total,omitempty"`
+
+	NextCursor string `json:"-"`
 }
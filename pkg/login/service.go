@@ -1,44 +1,71 @@
 package login
 
 import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/raisultan/abac/pkg/event"
+	"github.com/raisultan/abac/pkg/storage"
+	"github.com/raisultan/abac/pkg/token"
 	"golang.org/x/crypto/bcrypt"
 )
 
+var InvalidCredsErr = errors.New("Invalid user credentials")
+var DisabledUserErr = errors.New("User is disabled")
+
 type Service interface {
-	LoginUser(UserLoginRequest) (UserLoginJWTResponse, error)
+	LoginUser(context.Context, UserLoginRequest) (UserLoginJWTResponse, error)
 }
 
 type Repository interface {
-	GetUserByEmail(UserLoginRequest) (UserLoginRequest, error)
+	storage.Transactor
+
+	GetUserByEmail(context.Context, UserLoginRequest) (UserLoginRequest, error)
+	GetUserIDByEmail(context.Context, string) (int, error)
+	CreatePasswordlessUser(ctx context.Context, email, firstName, lastName string) (int, error)
+	AddUserToGroups(ctx context.Context, userID int, groups []string) ([]string, error)
+	IsUserDisabled(context.Context, string) (bool, error)
+	AppendEvent(context.Context, event.Event) error
+}
+
+// Authenticator verifies credentials against an external directory,
+// it returns InvalidCredsErr when the credentials are rejected.
+type Authenticator interface {
+	Authenticate(email, password string) (ExternalUser, error)
 }
 
 type service struct {
-	r Repository
+	r     Repository
+	auths []Authenticator
 }
 
-func NewService(r Repository) Service {
-	return &service{r}
+// NewService creates a login service checking bcrypt hashed passwords first
+// and falling back to the given authenticators in order.
+func NewService(r Repository, auths ...Authenticator) Service {
+	return &service{r, auths}
 }
 
-func (s *service) LoginUser(ulr UserLoginRequest) (UserLoginJWTResponse, error) {
-	var err error
-	u := UserLoginRequest{Email: ulr.Email}
-	u, err = s.r.GetUserByEmail(ulr)
+func (s *service) LoginUser(ctx context.Context, ulr UserLoginRequest) (UserLoginJWTResponse, error) {
+	email, err := s.authenticate(ctx, ulr)
 	if err != nil {
 		return UserLoginJWTResponse{}, err
 	}
 
-	err = bcrypt.CompareHashAndPassword([]byte(u.Password), []byte(ulr.Password))
+	disabled, err := s.r.IsUserDisabled(ctx, email)
 	if err != nil {
 		return UserLoginJWTResponse{}, err
 	}
+	if disabled {
+		return UserLoginJWTResponse{}, DisabledUserErr
+	}
 
-	at, err := createAccessToken(ulr.Email)
+	at, err := token.CreateAccessToken(email)
 	if err != nil {
 		return UserLoginJWTResponse{}, err
 	}
 
-	rt, err := createRefreshToken(ulr.Email)
+	rt, err := token.CreateRefreshToken(email)
 	if err != nil {
 		return UserLoginJWTResponse{}, err
 	}
@@ -46,3 +73,73 @@ func (s *service) LoginUser(ulr UserLoginRequest) (UserLoginJWTResponse, error)
 	uJWT := UserLoginJWTResponse{Access: at, Refresh: rt}
 	return uJWT, nil
 }
+
+func (s *service) authenticate(ctx context.Context, ulr UserLoginRequest) (string, error) {
+	u, localErr := s.r.GetUserByEmail(ctx, ulr)
+	if localErr != nil && localErr != sql.ErrNoRows {
+		return "", localErr
+	}
+	if localErr == nil {
+		// users provisioned by an external directory have no password hash,
+		// so any comparison failure is treated as a mismatch
+		if err := bcrypt.CompareHashAndPassword([]byte(u.Password), []byte(ulr.Password)); err == nil {
+			return ulr.Email, nil
+		}
+		localErr = InvalidCredsErr
+	}
+
+	for _, a := range s.auths {
+		eu, err := a.Authenticate(ulr.Email, ulr.Password)
+		if err == InvalidCredsErr {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+
+		if err := s.provision(ctx, eu); err != nil {
+			return "", err
+		}
+		return eu.Email, nil
+	}
+
+	return "", localErr
+}
+
+// provision creates the local user for an externally authenticated one on
+// first login and adds it to its directory groups, emitting an event for
+// every group it joined.
+func (s *service) provision(ctx context.Context, eu ExternalUser) error {
+	return s.r.WithinTx(ctx, func(ctx context.Context) error {
+		id, err := s.r.GetUserIDByEmail(ctx, eu.Email)
+		if err == sql.ErrNoRows {
+			if id, err = s.r.CreatePasswordlessUser(ctx, eu.Email, eu.FirstName, eu.LastName); err != nil {
+				return err
+			}
+			err = s.r.AppendEvent(ctx, event.New(event.UserCreated, event.UserSubject(id), map[string]interface{}{
+				"id":        id,
+				"email":     eu.Email,
+				"firstName": eu.FirstName,
+				"lastName":  eu.LastName,
+			}))
+		}
+		if err != nil {
+			return err
+		}
+
+		if len(eu.Groups) == 0 {
+			return nil
+		}
+		added, err := s.r.AddUserToGroups(ctx, id, eu.Groups)
+		if err != nil {
+			return err
+		}
+		for _, g := range added {
+			err := s.r.AppendEvent(ctx, event.New(event.GroupUpdated, event.GroupSubject(g), map[string]interface{}{"name": g}))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,67 @@
+package login_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/raisultan/abac/pkg/event"
+	"github.com/raisultan/abac/pkg/login"
+	"github.com/raisultan/abac/pkg/storage/memory"
+)
+
+// directory accepts a single password for every user it knows.
+type directory map[string]login.ExternalUser
+
+func (d directory) Authenticate(email, password string) (login.ExternalUser, error) {
+	u, ok := d[email]
+	if !ok || password != "secret" {
+		return login.ExternalUser{}, login.InvalidCredsErr
+	}
+	return u, nil
+}
+
+func TestLoginProvisionsExternalUser(t *testing.T) {
+	ctx := context.Background()
+	s := memory.NewStorage()
+	svc := login.NewService(s, directory{
+		"ann@example.org": {Email: "ann@example.org", FirstName: "Ann", Groups: []string{"staff"}},
+	})
+
+	if _, err := svc.LoginUser(ctx, login.UserLoginRequest{Email: "ann@example.org", Password: "wrong"}); err == nil {
+		t.Fatal("signed in with a wrong password")
+	}
+	if _, err := svc.LoginUser(ctx, login.UserLoginRequest{Email: "ann@example.org", Password: "secret"}); err != nil {
+		t.Fatal(err)
+	}
+
+	sub, err := s.GetSubject(ctx, "ann@example.org")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sub.Groups) != 1 || sub.Groups[0] != "staff" {
+		t.Errorf("groups %v, want [staff]", sub.Groups)
+	}
+	if e, err := s.LatestEvent(ctx, event.UserCreated); err != nil || e.Subject != event.UserSubject(sub.ID) {
+		t.Errorf("user.created event for %q (%v), want %q", e.Subject, err, event.UserSubject(sub.ID))
+	}
+	if e, err := s.LatestEvent(ctx, event.GroupUpdated); err != nil || e.Subject != event.GroupSubject("staff") {
+		t.Errorf("group.updated event for %q (%v), want %q", e.Subject, err, event.GroupSubject("staff"))
+	}
+
+	// signing in again neither creates the user nor joins the group again
+	if _, err := svc.LoginUser(ctx, login.UserLoginRequest{Email: "ann@example.org", Password: "secret"}); err != nil {
+		t.Fatal(err)
+	}
+	events, err := s.ClaimEvents(ctx, 10, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	count := map[string]int{}
+	for _, e := range events {
+		count[e.Type]++
+	}
+	if len(events) != 2 || count[event.UserCreated] != 1 || count[event.GroupUpdated] != 1 {
+		t.Errorf("events %v, want one user.created and one group.updated", count)
+	}
+}
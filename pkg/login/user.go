@@ -9,3 +9,11 @@ type UserLoginJWTResponse struct {
 	Access  string `json:"access"`
 	Refresh string `json:"refresh"`
 }
+
+// ExternalUser is a user authenticated by an external directory.
+type ExternalUser struct {
+	Email     string
+	FirstName string
+	LastName  string
+	Groups    []string
+}
@@ -0,0 +1,33 @@
+package oauth
+
+type Client struct {
+	ID       int
+	ClientID string
+	Secret   string
+	Name     string
+}
+
+type TokenIntrospectRequest struct {
+	ClientID      string `json:"-"`
+	ClientSecret  string `json:"-"`
+	Token         string `json:"token" validate:"required"`
+	TokenTypeHint string `json:"token_type_hint"`
+}
+
+type TokenIntrospectResponse struct {
+	Active bool `json:"active"`
+
+	ID         string `json:"jti,omitempty"`
+	Subject    string `json:"sub,omitempty"`
+	Scope      string `json:"scope,omitempty"`
+	TokenType  string `json:"token_type,omitempty"`
+	Expiration uint64 `json:"exp,omitempty"`
+	IssuedAt   uint64 `json:"iat,omitempty"`
+}
+
+type TokenRevokeRequest struct {
+	ClientID      string `json:"-"`
+	ClientSecret  string `json:"-"`
+	Token         string `json:"token" validate:"required"`
+	TokenTypeHint string `json:"token_type_hint"`
+}
@@ -0,0 +1,33 @@
+package oidc
+
+// Config describes the upstream OpenID Connect provider users may sign in with.
+type Config struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+
+	Claims ClaimMapping
+
+	// GroupMapping translates upstream group names to local ones. When it is
+	// empty upstream group names are used as is, otherwise unmapped groups
+	// are ignored.
+	GroupMapping map[string]string
+
+	// ProvisionUnverified creates users for providers that leave out the
+	// email_verified claim. Existing users are never linked without it.
+	ProvisionUnverified bool
+}
+
+// ClaimMapping names the ID token claims user attributes are read from.
+type ClaimMapping struct {
+	Email     string
+	FirstName string
+	LastName  string
+	Groups    string
+}
+
+func (c Config) Enabled() bool {
+	return c.Issuer != ""
+}
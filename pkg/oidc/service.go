@@ -0,0 +1,215 @@
+package oidc
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/raisultan/abac/pkg/event"
+	"github.com/raisultan/abac/pkg/storage"
+	"github.com/raisultan/abac/pkg/token"
+)
+
+var MissingClaimErr = errors.New("Required claim is missing from ID token")
+var UnverifiedEmailErr = errors.New("Upstream email address is not verified")
+var DisabledUserErr = errors.New("User is disabled")
+
+type Service interface {
+	AuthCodeURL(state, nonce string) string
+	LoginUser(context.Context, UserOIDCLoginRequest) (UserLoginJWTResponse, error)
+}
+
+type Repository interface {
+	storage.Transactor
+
+	GetUserByIdentity(ctx context.Context, issuer, subject string) (User, error)
+	GetUserIDByEmail(context.Context, string) (int, error)
+	CreatePasswordlessUser(ctx context.Context, email, firstName, lastName string) (int, error)
+	LinkIdentity(ctx context.Context, userID int, issuer, subject string) error
+	AddUserToGroups(ctx context.Context, userID int, groups []string) ([]string, error)
+	IsUserDisabled(context.Context, string) (bool, error)
+	AppendEvent(context.Context, event.Event) error
+}
+
+type service struct {
+	r Repository
+	p *Provider
+	c Config
+}
+
+func NewService(r Repository, p *Provider) Service {
+	return &service{r, p, p.c}
+}
+
+func (s *service) AuthCodeURL(state, nonce string) string {
+	return s.p.AuthCodeURL(state, nonce)
+}
+
+func (s *service) LoginUser(ctx context.Context, r UserOIDCLoginRequest) (UserLoginJWTResponse, error) {
+	rawIDToken, err := s.p.Exchange(ctx, r.Code)
+	if err != nil {
+		return UserLoginJWTResponse{}, err
+	}
+
+	claims, err := s.p.Verify(rawIDToken, r.Nonce)
+	if err != nil {
+		return UserLoginJWTResponse{}, err
+	}
+
+	u, err := s.resolveUser(ctx, claims)
+	if err != nil {
+		return UserLoginJWTResponse{}, err
+	}
+
+	disabled, err := s.r.IsUserDisabled(ctx, u.Email)
+	if err != nil {
+		return UserLoginJWTResponse{}, err
+	}
+	if disabled {
+		return UserLoginJWTResponse{}, DisabledUserErr
+	}
+
+	groups := s.mapGroups(claimStrings(claims, s.c.Claims.Groups))
+	if len(groups) > 0 {
+		if err := s.addToGroups(ctx, u.ID, groups); err != nil {
+			return UserLoginJWTResponse{}, err
+		}
+	}
+
+	at, err := token.CreateAccessToken(u.Email)
+	if err != nil {
+		return UserLoginJWTResponse{}, err
+	}
+
+	rt, err := token.CreateRefreshToken(u.Email)
+	if err != nil {
+		return UserLoginJWTResponse{}, err
+	}
+
+	return UserLoginJWTResponse{Access: at, Refresh: rt}, nil
+}
+
+// addToGroups adds the user to its upstream groups, emitting an event for
+// every group it joined.
+func (s *service) addToGroups(ctx context.Context, userID int, groups []string) error {
+	return s.r.WithinTx(ctx, func(ctx context.Context) error {
+		added, err := s.r.AddUserToGroups(ctx, userID, groups)
+		if err != nil {
+			return err
+		}
+		for _, g := range added {
+			err := s.r.AppendEvent(ctx, event.New(event.GroupUpdated, event.GroupSubject(g), map[string]interface{}{"name": g}))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// resolveUser finds the local user linked to the upstream identity. On first
+// login the identity is linked to an existing user with the same email only
+// when the provider verified it, as anyone could otherwise take over the
+// account. A new user is provisioned for an email the provider did not
+// state as verified only when the config allows it.
+func (s *service) resolveUser(ctx context.Context, claims map[string]interface{}) (User, error) {
+	issuer := s.p.Issuer()
+	subject := claimString(claims, "sub")
+	if subject == "" {
+		return User{}, MissingClaimErr
+	}
+
+	u, err := s.r.GetUserByIdentity(ctx, issuer, subject)
+	if err == nil {
+		return u, nil
+	}
+	if err != sql.ErrNoRows {
+		return User{}, err
+	}
+
+	email := claimString(claims, s.c.Claims.Email)
+	if email == "" {
+		return User{}, MissingClaimErr
+	}
+	verified, stated := claims["email_verified"].(bool)
+	if stated && !verified {
+		return User{}, UnverifiedEmailErr
+	}
+
+	var id int
+	err = s.r.WithinTx(ctx, func(ctx context.Context) error {
+		var err error
+		id, err = s.r.GetUserIDByEmail(ctx, email)
+		switch {
+		case err == nil:
+			if !verified {
+				return UnverifiedEmailErr
+			}
+		case err != sql.ErrNoRows:
+			return err
+		default:
+			if !verified && !s.c.ProvisionUnverified {
+				return UnverifiedEmailErr
+			}
+
+			firstName := claimString(claims, s.c.Claims.FirstName)
+			lastName := claimString(claims, s.c.Claims.LastName)
+			if id, err = s.r.CreatePasswordlessUser(ctx, email, firstName, lastName); err != nil {
+				return err
+			}
+			err = s.r.AppendEvent(ctx, event.New(event.UserCreated, event.UserSubject(id), map[string]interface{}{
+				"id":        id,
+				"email":     email,
+				"firstName": firstName,
+				"lastName":  lastName,
+			}))
+			if err != nil {
+				return err
+			}
+		}
+
+		return s.r.LinkIdentity(ctx, id, issuer, subject)
+	})
+	if err != nil {
+		return User{}, err
+	}
+
+	return User{ID: id, Email: email}, nil
+}
+
+func (s *service) mapGroups(upstream []string) []string {
+	if len(s.c.GroupMapping) == 0 {
+		return upstream
+	}
+
+	groups := []string{}
+	for _, g := range upstream {
+		if local, ok := s.c.GroupMapping[g]; ok {
+			groups = append(groups, local)
+		}
+	}
+	return groups
+}
+
+func claimString(claims map[string]interface{}, name string) string {
+	v, _ := claims[name].(string)
+	return v
+}
+
+// claimStrings accepts both a single string and a list of strings,
+// as providers differ in how they encode multi-valued claims.
+func claimStrings(claims map[string]interface{}, name string) []string {
+	switch v := claims[name].(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		values := []string{}
+		for _, e := range v {
+			if s, ok := e.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+	return nil
+}
@@ -0,0 +1,298 @@
+package oidc_test
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/raisultan/abac/pkg/event"
+	"github.com/raisultan/abac/pkg/oidc"
+	"github.com/raisultan/abac/pkg/register"
+	"github.com/raisultan/abac/pkg/storage/memory"
+	"github.com/raisultan/abac/pkg/token"
+)
+
+const clientID = "abac"
+
+// idp is a fake OpenID Connect provider serving discovery, its keys and a
+// token endpoint that answers every code with an ID token of claims.
+type idp struct {
+	*httptest.Server
+	key    *rsa.PrivateKey
+	claims jwt.MapClaims
+}
+
+func newIdP(t *testing.T) *idp {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := &idp{key: key}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 p.URL,
+			"authorization_endpoint": p.URL + "/authorize",
+			"token_endpoint":         p.URL + "/token",
+			"jwks_uri":               p.URL + "/keys",
+		})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+			"kid": "k1",
+			"kty": "RSA",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if id, secret, ok := r.BasicAuth(); !ok || id != clientID || secret != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_client"})
+			return
+		}
+
+		claims := jwt.MapClaims{
+			"iss":   p.URL,
+			"aud":   clientID,
+			"exp":   time.Now().Add(time.Minute).Unix(),
+			"nonce": "nonce",
+		}
+		for k, v := range p.claims {
+			claims[k] = v
+		}
+		t := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+		t.Header["kid"] = "k1"
+		signed, err := t.SignedString(key)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"id_token": signed})
+	})
+
+	p.Server = httptest.NewServer(mux)
+	t.Cleanup(p.Close)
+	return p
+}
+
+func newService(t *testing.T, p *idp, s *memory.Storage, configure func(*oidc.Config)) oidc.Service {
+	c := oidc.Config{
+		Issuer:       p.URL,
+		ClientID:     clientID,
+		ClientSecret: "secret",
+		RedirectURL:  "http://localhost/oidc/callback",
+		Claims: oidc.ClaimMapping{
+			Email:     "email",
+			FirstName: "given_name",
+			LastName:  "family_name",
+			Groups:    "groups",
+		},
+	}
+	if configure != nil {
+		configure(&c)
+	}
+
+	provider, err := oidc.NewProvider(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return oidc.NewService(s, provider)
+}
+
+func login(svc oidc.Service) (oidc.UserLoginJWTResponse, error) {
+	return svc.LoginUser(context.Background(), oidc.UserOIDCLoginRequest{Code: "code", Nonce: "nonce"})
+}
+
+func groupsOf(t *testing.T, s *memory.Storage, email string) []string {
+	sub, err := s.GetSubject(context.Background(), email)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(sub.Groups)
+	return sub.Groups
+}
+
+func TestLoginProvisionsUser(t *testing.T) {
+	p := newIdP(t)
+	s := memory.NewStorage()
+	svc := newService(t, p, s, nil)
+
+	p.claims = jwt.MapClaims{
+		"sub":            "u1",
+		"email":          "ann@example.com",
+		"email_verified": true,
+		"given_name":     "Ann",
+		"groups":         []string{"staff", "eng"},
+	}
+	resp, err := login(svc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tp, err := token.Parse(resp.Access)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tp.Email != "ann@example.com" || tp.Type != token.AccessType {
+		t.Errorf("access token of %s (%s), want ann@example.com (access)", tp.Email, tp.Type)
+	}
+
+	sub, err := s.GetSubject(context.Background(), "ann@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sub.FirstName != "Ann" {
+		t.Errorf("first name %q, want Ann", sub.FirstName)
+	}
+	if got := groupsOf(t, s, "ann@example.com"); len(got) != 2 || got[0] != "eng" || got[1] != "staff" {
+		t.Errorf("groups %v, want [eng staff]", got)
+	}
+	if e, err := s.LatestEvent(context.Background(), event.UserCreated); err != nil || e.Subject != event.UserSubject(sub.ID) {
+		t.Errorf("user.created event for %q (%v), want %q", e.Subject, err, event.UserSubject(sub.ID))
+	}
+
+	// the identity is linked, a changed email does not create another user
+	p.claims["email"] = "ann@corp.example.com"
+	resp, err = login(svc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tp, _ := token.Parse(resp.Access); tp.Email != "ann@example.com" {
+		t.Errorf("second login as %s, want ann@example.com", tp.Email)
+	}
+}
+
+func TestLoginLinksVerifiedEmail(t *testing.T) {
+	p := newIdP(t)
+	s := memory.NewStorage()
+	svc := newService(t, p, s, nil)
+
+	existing, err := s.CreateUser(context.Background(), register.UserRegisterRequest{
+		Email:    "bob@example.com",
+		Password: "password",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p.claims = jwt.MapClaims{"sub": "u2", "email": "bob@example.com", "email_verified": true}
+	if _, err := login(svc); err != nil {
+		t.Fatal(err)
+	}
+
+	u, err := s.GetUserByIdentity(context.Background(), p.URL, "u2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.ID != existing.ID {
+		t.Errorf("identity linked to user %d, want %d", u.ID, existing.ID)
+	}
+}
+
+func TestLoginRejectsUnverifiedLink(t *testing.T) {
+	for name, claims := range map[string]jwt.MapClaims{
+		"missing": {"sub": "u3", "email": "admin@example.com"},
+		"false":   {"sub": "u3", "email": "admin@example.com", "email_verified": false},
+	} {
+		t.Run(name, func(t *testing.T) {
+			p := newIdP(t)
+			s := memory.NewStorage()
+			// provisioning unverified users must not allow linking either
+			svc := newService(t, p, s, func(c *oidc.Config) { c.ProvisionUnverified = true })
+
+			if _, err := s.CreateUser(context.Background(), register.UserRegisterRequest{
+				Email:    "admin@example.com",
+				Password: "password",
+			}); err != nil {
+				t.Fatal(err)
+			}
+
+			p.claims = claims
+			if _, err := login(svc); err != oidc.UnverifiedEmailErr {
+				t.Errorf("got %v, want %v", err, oidc.UnverifiedEmailErr)
+			}
+			if _, err := s.GetUserByIdentity(context.Background(), p.URL, "u3"); err == nil {
+				t.Error("identity was linked")
+			}
+		})
+	}
+}
+
+func TestLoginProvisionsUnverifiedOnlyWhenAllowed(t *testing.T) {
+	p := newIdP(t)
+	p.claims = jwt.MapClaims{"sub": "u4", "email": "carl@example.com"}
+
+	if _, err := login(newService(t, p, memory.NewStorage(), nil)); err != oidc.UnverifiedEmailErr {
+		t.Errorf("got %v, want %v", err, oidc.UnverifiedEmailErr)
+	}
+
+	s := memory.NewStorage()
+	svc := newService(t, p, s, func(c *oidc.Config) { c.ProvisionUnverified = true })
+	if _, err := login(svc); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.GetUserIDByEmail(context.Background(), "carl@example.com"); err != nil {
+		t.Errorf("user was not provisioned: %v", err)
+	}
+}
+
+func TestLoginMapsGroups(t *testing.T) {
+	p := newIdP(t)
+	s := memory.NewStorage()
+	svc := newService(t, p, s, func(c *oidc.Config) {
+		c.GroupMapping = map[string]string{"idp-admins": "admins"}
+	})
+
+	p.claims = jwt.MapClaims{
+		"sub":            "u5",
+		"email":          "dana@example.com",
+		"email_verified": true,
+		"groups":         []string{"idp-admins", "idp-other"},
+	}
+	if _, err := login(svc); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := groupsOf(t, s, "dana@example.com"); len(got) != 1 || got[0] != "admins" {
+		t.Errorf("groups %v, want [admins]", got)
+	}
+
+	// only joining a group is an event, signing in again is not
+	if _, err := login(svc); err != nil {
+		t.Fatal(err)
+	}
+	events, err := s.ClaimEvents(context.Background(), 10, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var joined []string
+	for _, e := range events {
+		if e.Type == event.GroupUpdated {
+			joined = append(joined, e.Subject)
+		}
+	}
+	if len(joined) != 1 || joined[0] != event.GroupSubject("admins") {
+		t.Errorf("group.updated events for %v, want %s", joined, event.GroupSubject("admins"))
+	}
+}
+
+func TestLoginRejectsWrongNonce(t *testing.T) {
+	p := newIdP(t)
+	svc := newService(t, p, memory.NewStorage(), nil)
+
+	p.claims = jwt.MapClaims{"sub": "u6", "email": "eve@example.com", "email_verified": true, "nonce": "other"}
+	if _, err := login(svc); err != oidc.InvalidIDTokenErr {
+		t.Errorf("got %v, want %v", err, oidc.InvalidIDTokenErr)
+	}
+}
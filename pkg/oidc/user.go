@@ -0,0 +1,16 @@
+package oidc
+
+type User struct {
+	ID    int
+	Email string
+}
+
+type UserOIDCLoginRequest struct {
+	Code  string `validate:"required"`
+	Nonce string `validate:"required"`
+}
+
+type UserLoginJWTResponse struct {
+	Access  string `json:"access"`
+	Refresh string `json:"refresh"`
+}
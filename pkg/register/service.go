@@ -1,16 +1,26 @@
 package register
 
-import "errors"
+import (
+	"context"
+	"errors"
+
+	"github.com/raisultan/abac/pkg/event"
+	"github.com/raisultan/abac/pkg/storage"
+)
 
 var ErrDuplicate = errors.New("User already exists")
 
 type Service interface {
-	RegisterUser(UserRegisterRequest) (UserRegisterResponse, error)
+	RegisterUser(context.Context, UserRegisterRequest) (UserRegisterResponse, error)
 }
 
 type Repository interface {
-	CreateUser(UserRegisterRequest) (UserRegisterResponse, error)
-	CheckUserExists(UserRegisterRequest) (bool, error)
+	storage.Transactor
+
+	// CreateUser returns ErrDuplicate when the email is taken.
+	CreateUser(context.Context, UserRegisterRequest) (UserRegisterResponse, error)
+	CheckUserExists(context.Context, UserRegisterRequest) (bool, error)
+	AppendEvent(context.Context, event.Event) error
 }
 
 type service struct {
@@ -21,16 +31,23 @@ func NewService(r Repository) Service {
 	return &service{r}
 }
 
-func (s *service) RegisterUser(ur UserRegisterRequest) (UserRegisterResponse, error) {
-	exists, err := s.r.CheckUserExists(ur)
-	if err != nil {
-		return UserRegisterResponse{}, err
-	}
-	if exists {
-		return UserRegisterResponse{}, ErrDuplicate
-	}
-
-	u, err := s.r.CreateUser(ur)
+func (s *service) RegisterUser(ctx context.Context, ur UserRegisterRequest) (UserRegisterResponse, error) {
+	var u UserRegisterResponse
+	err := s.r.WithinTx(ctx, func(ctx context.Context) error {
+		exists, err := s.r.CheckUserExists(ctx, ur)
+		if err != nil {
+			return err
+		}
+		if exists {
+			return ErrDuplicate
+		}
+
+		if u, err = s.r.CreateUser(ctx, ur); err != nil {
+			return err
+		}
+
+		return s.r.AppendEvent(ctx, event.New(event.UserCreated, event.UserSubject(u.ID), u))
+	})
 	if err != nil {
 		return UserRegisterResponse{}, err
 	}
@@ -0,0 +1,39 @@
+package resource
+
+import "time"
+
+// Ref identifies a resource by the type and ID it has in the service that
+// owns it.
+type Ref struct {
+	Type       string `json:"type" validate:"required,max=64"`
+	ExternalID string `json:"externalId" validate:"required,max=256"`
+}
+
+type Resource struct {
+	ID int `json:"id"`
+
+	Type       string                 `json:"type" validate:"required,max=64"`
+	ExternalID string                 `json:"externalId" validate:"required,max=256"`
+	OwnerID    *int                   `json:"ownerId,omitempty"`
+	Parent     *Ref                   `json:"parent,omitempty"`
+	Attributes map[string]interface{} `json:"attributes"`
+
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+func (r Resource) Ref() Ref {
+	return Ref{Type: r.Type, ExternalID: r.ExternalID}
+}
+
+type ListRequest struct {
+	Type    string
+	Parent  *Ref
+	OwnerID *int
+	Offset  int
+	Limit   int
+}
+
+type BulkUpsertRequest struct {
+	Resources []Resource `json:"resources" validate:"required,min=1,max=1000,dive"`
+}
@@ -0,0 +1,110 @@
+package resource
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+const (
+	DefaultLimit = 100
+	MaxLimit     = 1000
+
+	// MaxDepth bounds how far up the hierarchy ancestors are looked up.
+	MaxDepth = 32
+)
+
+var NotFoundErr = errors.New("Resource not found")
+var ParentNotFoundErr = errors.New("Parent resource not found")
+var OwnerNotFoundErr = errors.New("Owner not found")
+var CycleErr = errors.New("Resource can not be its own ancestor")
+var HasChildrenErr = errors.New("Resource has child resources")
+
+// ItemErr tells which resource of a bulk request failed.
+type ItemErr struct {
+	Index int
+	Err   error
+}
+
+func (e *ItemErr) Error() string {
+	return fmt.Sprintf("resources[%d]: %s", e.Index, e.Err)
+}
+
+func (e *ItemErr) Unwrap() error {
+	return e.Err
+}
+
+type Service interface {
+	PutResource(context.Context, Resource) (res Resource, created bool, err error)
+	BulkUpsert(context.Context, []Resource) ([]Resource, error)
+	GetResource(context.Context, Ref) (Resource, error)
+	ListResources(context.Context, ListRequest) ([]Resource, error)
+	DeleteResource(context.Context, Ref) error
+
+	// ResourceChain returns the resource followed by its ancestors, closest first.
+	ResourceChain(context.Context, Ref) ([]Resource, error)
+}
+
+// Repository reports NotFoundErr, ParentNotFoundErr, OwnerNotFoundErr,
+// CycleErr and HasChildrenErr for the respective failures.
+type Repository interface {
+	UpsertResource(context.Context, Resource) (Resource, bool, error)
+
+	// UpsertResources stores all resources or none, parents can refer to
+	// resources earlier in the same batch. Failures are wrapped in ItemErr.
+	UpsertResources(context.Context, []Resource) ([]Resource, error)
+
+	GetResource(context.Context, Ref) (Resource, error)
+	ListResources(context.Context, ListRequest) ([]Resource, error)
+	DeleteResource(context.Context, Ref) error
+	GetResourceChain(ctx context.Context, ref Ref, maxDepth int) ([]Resource, error)
+}
+
+type service struct {
+	r Repository
+}
+
+func NewService(r Repository) Service {
+	return &service{r}
+}
+
+func (s *service) PutResource(ctx context.Context, res Resource) (Resource, bool, error) {
+	if res.Attributes == nil {
+		res.Attributes = map[string]interface{}{}
+	}
+	return s.r.UpsertResource(ctx, res)
+}
+
+func (s *service) BulkUpsert(ctx context.Context, resources []Resource) ([]Resource, error) {
+	for i := range resources {
+		if resources[i].Attributes == nil {
+			resources[i].Attributes = map[string]interface{}{}
+		}
+	}
+	return s.r.UpsertResources(ctx, resources)
+}
+
+func (s *service) GetResource(ctx context.Context, ref Ref) (Resource, error) {
+	return s.r.GetResource(ctx, ref)
+}
+
+func (s *service) ListResources(ctx context.Context, lr ListRequest) ([]Resource, error) {
+	if lr.Limit < 1 {
+		lr.Limit = DefaultLimit
+	}
+	if lr.Limit > MaxLimit {
+		lr.Limit = MaxLimit
+	}
+	if lr.Offset < 0 {
+		lr.Offset = 0
+	}
+	return s.r.ListResources(ctx, lr)
+}
+
+func (s *service) DeleteResource(ctx context.Context, ref Ref) error {
+	return s.r.DeleteResource(ctx, ref)
+}
+
+func (s *service) ResourceChain(ctx context.Context, ref Ref) ([]Resource, error) {
+	return s.r.GetResourceChain(ctx, ref, MaxDepth)
+}
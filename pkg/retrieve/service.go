@@ -1,11 +1,15 @@
 package retrieve
 
+import "context"
+
 type Service interface {
-	RetrieveUser(int) (UserRetrieveResponse, error)
+	RetrieveUser(context.Context, int) (UserRetrieveResponse, error)
+	RetrieveUserByEmail(context.Context, string) (UserRetrieveResponse, error)
 }
 
 type Repository interface {
-	GetUserByID(int) (UserRetrieveResponse, error)
+	GetUserByID(context.Context, int) (UserRetrieveResponse, error)
+	FindUserByEmail(context.Context, string) (UserRetrieveResponse, error)
 }
 
 type service struct {
@@ -16,6 +20,10 @@ func NewService(r Repository) Service {
 	return &service{r}
 }
 
-func (s *service) RetrieveUser(id int) (UserRetrieveResponse, error) {
-	return s.r.GetUserByID(id)
+func (s *service) RetrieveUser(ctx context.Context, id int) (UserRetrieveResponse, error) {
+	return s.r.GetUserByID(ctx, id)
+}
+
+func (s *service) RetrieveUserByEmail(ctx context.Context, email string) (UserRetrieveResponse, error) {
+	return s.r.FindUserByEmail(ctx, email)
 }
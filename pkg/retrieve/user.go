@@ -1,11 +1,15 @@
 package retrieve
 
+import "time"
+
 type UserRetrieveResponse struct {
 	ID int `json:"id"`
 
-	Email      string `json:"email"`
-	FirstName  string `json:"firstName"`
-	LastName   string `json:"lastName"`
-	IsAdmin    bool   `json:"isAdmin"`
-	IsApproved bool   `json:"isApproved"`
+	Email      string    `json:"email"`
+	FirstName  string    `json:"firstName"`
+	LastName   string    `json:"lastName"`
+	IsAdmin    bool      `json:"isAdmin"`
+	IsApproved bool      `json:"isApproved"`
+	UpdatedAt  time.Time `json:"updatedAt"`
+	Version    int       `json:"-"`
 }
@@ -0,0 +1,210 @@
+package scim
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"unicode"
+)
+
+var InvalidFilterErr = errors.New("Invalid filter")
+
+// Filter is a node of a parsed SCIM filter expression (RFC 7644 section 3.4.2.2).
+// Logical nodes ("and", "or", "not") use Left and Right, comparison nodes use
+// Attr and Value.
+type Filter struct {
+	Op    string
+	Attr  string
+	Value interface{}
+
+	Left  *Filter
+	Right *Filter
+}
+
+var comparisonOps = map[string]bool{
+	"eq": true, "ne": true, "co": true, "sw": true, "ew": true,
+	"gt": true, "ge": true, "lt": true, "le": true, "pr": true,
+}
+
+// ParseFilter parses a filter expression, an empty expression yields a nil filter.
+func ParseFilter(s string) (*Filter, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, nil
+	}
+
+	tokens, err := tokenize(s)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &filterParser{tokens: tokens}
+	f, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos != len(p.tokens) {
+		return nil, InvalidFilterErr
+	}
+
+	return f, nil
+}
+
+type filterParser struct {
+	tokens []string
+	pos    int
+}
+
+func (p *filterParser) next() string {
+	if p.pos >= len(p.tokens) {
+		return ""
+	}
+	t := p.tokens[p.pos]
+	p.pos++
+	return t
+}
+
+func (p *filterParser) peek() string {
+	if p.pos >= len(p.tokens) {
+		return ""
+	}
+	return p.tokens[p.pos]
+}
+
+func (p *filterParser) parseOr() (*Filter, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for strings.EqualFold(p.peek(), "or") {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &Filter{Op: "or", Left: left, Right: right}
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseAnd() (*Filter, error) {
+	left, err := p.parseFactor()
+	if err != nil {
+		return nil, err
+	}
+	for strings.EqualFold(p.peek(), "and") {
+		p.next()
+		right, err := p.parseFactor()
+		if err != nil {
+			return nil, err
+		}
+		left = &Filter{Op: "and", Left: left, Right: right}
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseFactor() (*Filter, error) {
+	t := p.next()
+	switch {
+	case t == "":
+		return nil, InvalidFilterErr
+	case strings.EqualFold(t, "not"):
+		if p.next() != "(" {
+			return nil, InvalidFilterErr
+		}
+		f, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.next() != ")" {
+			return nil, InvalidFilterErr
+		}
+		return &Filter{Op: "not", Left: f}, nil
+	case t == "(":
+		f, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.next() != ")" {
+			return nil, InvalidFilterErr
+		}
+		return f, nil
+	}
+
+	if !isAttrPath(t) {
+		return nil, InvalidFilterErr
+	}
+
+	op := strings.ToLower(p.next())
+	if !comparisonOps[op] {
+		return nil, InvalidFilterErr
+	}
+	if op == "pr" {
+		return &Filter{Op: op, Attr: strings.ToLower(t)}, nil
+	}
+
+	v, err := parseValue(p.next())
+	if err != nil {
+		return nil, err
+	}
+
+	return &Filter{Op: op, Attr: strings.ToLower(t), Value: v}, nil
+}
+
+func parseValue(t string) (interface{}, error) {
+	if t == "" {
+		return nil, InvalidFilterErr
+	}
+
+	var v interface{}
+	if err := json.Unmarshal([]byte(t), &v); err != nil {
+		return nil, InvalidFilterErr
+	}
+	switch v.(type) {
+	case string, bool, float64, nil:
+		return v, nil
+	}
+	return nil, InvalidFilterErr
+}
+
+func isAttrPath(t string) bool {
+	for _, r := range t {
+		if !(unicode.IsLetter(r) || unicode.IsDigit(r) || r == '.' || r == '_' || r == '-' || r == ':' || r == '$') {
+			return false
+		}
+	}
+	return true
+}
+
+func tokenize(s string) ([]string, error) {
+	tokens := []string{}
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t':
+			i++
+		case c == '(' || c == ')':
+			tokens = append(tokens, string(c))
+			i++
+		case c == '"':
+			j := i + 1
+			for ; j < len(s) && s[j] != '"'; j++ {
+				if s[j] == '\\' {
+					j++
+				}
+			}
+			if j >= len(s) {
+				return nil, InvalidFilterErr
+			}
+			tokens = append(tokens, s[i:j+1])
+			i = j + 1
+		default:
+			j := i
+			for j < len(s) && s[j] != ' ' && s[j] != '\t' && s[j] != '(' && s[j] != ')' && s[j] != '"' {
+				j++
+			}
+			tokens = append(tokens, s[i:j])
+			i = j
+		}
+	}
+	return tokens, nil
+}
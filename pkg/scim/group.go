@@ -0,0 +1,21 @@
+package scim
+
+type Group struct {
+	Schemas     []string   `json:"schemas"`
+	ID          string     `json:"id,omitempty"`
+	DisplayName string     `json:"displayName" validate:"required"`
+	Members     []Relation `json:"members,omitempty"`
+	Meta        *Meta      `json:"meta,omitempty"`
+}
+
+// GroupRecord is a group as read from storage.
+type GroupRecord struct {
+	ID      int
+	Name    string
+	Members []MemberRef
+}
+
+type MemberRef struct {
+	ID    int
+	Email string
+}
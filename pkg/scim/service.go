@@ -0,0 +1,703 @@
+package scim
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/raisultan/abac/pkg/deactivate"
+	"github.com/raisultan/abac/pkg/delete"
+	"github.com/raisultan/abac/pkg/event"
+	"github.com/raisultan/abac/pkg/register"
+	"github.com/raisultan/abac/pkg/storage"
+	"github.com/raisultan/abac/pkg/update"
+)
+
+const (
+	basePath        = "/scim/v2"
+	DefaultCount    = 100
+	maxCount        = 500
+	randomPassBytes = 32
+)
+
+var NotFoundErr = errors.New("Resource not found")
+var UniquenessErr = errors.New("Resource already exists")
+var InvalidValueErr = errors.New("Invalid attribute value")
+var InvalidPathErr = errors.New("Invalid patch path")
+var MutabilityErr = errors.New("Attribute can not be modified")
+
+var membersPathRe = regexp.MustCompile(`^(?i)members\[(.+)\]$`)
+
+type Service interface {
+	ListUsers(context.Context, ListRequest) (ListResponse, error)
+	GetUser(context.Context, int) (User, error)
+	CreateUser(context.Context, User) (User, error)
+	ReplaceUser(context.Context, int, User) (User, error)
+	PatchUser(context.Context, int, PatchRequest) (User, error)
+	DeleteUser(context.Context, int) error
+
+	ListGroups(context.Context, ListRequest) (ListResponse, error)
+	GetGroup(context.Context, int) (Group, error)
+	CreateGroup(context.Context, Group) (Group, error)
+	ReplaceGroup(context.Context, int, Group) (Group, error)
+	PatchGroup(context.Context, int, PatchRequest) (Group, error)
+	DeleteGroup(context.Context, int) error
+}
+
+type Repository interface {
+	storage.Transactor
+
+	FilterUsers(ctx context.Context, f *Filter, offset, limit int) ([]UserRecord, int, error)
+	GetUserWithGroups(context.Context, int) (UserRecord, error)
+
+	FilterGroups(ctx context.Context, f *Filter, offset, limit int) ([]GroupRecord, int, error)
+	GetGroupWithMembers(context.Context, int) (GroupRecord, error)
+	GroupExists(context.Context, string) (bool, error)
+	CreateGroup(context.Context, string) (int, error)
+	RenameGroup(ctx context.Context, id int, name string) error
+	ReplaceGroupMembers(ctx context.Context, id int, userIDs []int) error
+	AddGroupMembers(ctx context.Context, id int, userIDs []int) error
+	RemoveGroupMembers(ctx context.Context, id int, userIDs []int) error
+	DeleteGroup(context.Context, int) error
+
+	AppendEvent(context.Context, event.Event) error
+}
+
+type service struct {
+	r    Repository
+	reg  register.Service
+	upd  update.Service
+	del  delete.Service
+	deac deactivate.Service
+}
+
+// NewService creates a SCIM service, user writes go through the regular
+// register, update, delete and deactivate services.
+func NewService(
+	r Repository,
+	reg register.Service,
+	upd update.Service,
+	del delete.Service,
+	deac deactivate.Service,
+) Service {
+	return &service{r, reg, upd, del, deac}
+}
+
+func (s *service) ListUsers(ctx context.Context, lr ListRequest) (ListResponse, error) {
+	offset, limit := page(lr)
+	recs, total, err := s.r.FilterUsers(ctx, lr.Filter, offset, limit)
+	if err != nil {
+		return ListResponse{}, err
+	}
+
+	users := []User{}
+	for _, rec := range recs {
+		users = append(users, toUser(rec))
+	}
+
+	return newListResponse(offset, total, len(users), users), nil
+}
+
+func (s *service) GetUser(ctx context.Context, id int) (User, error) {
+	rec, err := s.r.GetUserWithGroups(ctx, id)
+	if err != nil {
+		return User{}, notFound(err)
+	}
+	return toUser(rec), nil
+}
+
+func (s *service) CreateUser(ctx context.Context, u User) (User, error) {
+	if u.UserName == "" {
+		return User{}, InvalidValueErr
+	}
+
+	password := u.Password
+	if password == "" {
+		// provisioned users sign in through the IdP, the password only
+		// has to be impossible to guess
+		var err error
+		if password, err = randomPassword(); err != nil {
+			return User{}, err
+		}
+	}
+
+	created, err := s.reg.RegisterUser(ctx, register.UserRegisterRequest{
+		Email:     u.UserName,
+		Password:  password,
+		FirstName: u.Name.GivenName,
+		LastName:  u.Name.FamilyName,
+	})
+	if err != nil {
+		if err == register.ErrDuplicate {
+			return User{}, UniquenessErr
+		}
+		return User{}, err
+	}
+
+	if u.Active != nil && !*u.Active {
+		if err := s.deac.DeactivateUser(ctx, created.ID); err != nil {
+			return User{}, err
+		}
+	}
+
+	return s.GetUser(ctx, created.ID)
+}
+
+func (s *service) ReplaceUser(ctx context.Context, id int, u User) (User, error) {
+	rec, err := s.r.GetUserWithGroups(ctx, id)
+	if err != nil {
+		return User{}, notFound(err)
+	}
+	if !strings.EqualFold(u.UserName, rec.Email) {
+		return User{}, MutabilityErr
+	}
+
+	active := true
+	if u.Active != nil {
+		active = *u.Active
+	}
+
+	return s.apply(ctx, rec, u.Name.GivenName, u.Name.FamilyName, active)
+}
+
+func (s *service) PatchUser(ctx context.Context, id int, pr PatchRequest) (User, error) {
+	rec, err := s.r.GetUserWithGroups(ctx, id)
+	if err != nil {
+		return User{}, notFound(err)
+	}
+
+	firstName, lastName, active := rec.FirstName, rec.LastName, rec.Active
+	for _, op := range pr.Operations {
+		attrs := map[string]interface{}{}
+		switch strings.ToLower(op.Op) {
+		case "add", "replace":
+			if op.Path == "" {
+				m, ok := op.Value.(map[string]interface{})
+				if !ok {
+					return User{}, InvalidValueErr
+				}
+				attrs = flatten(m)
+			} else {
+				attrs[strings.ToLower(op.Path)] = op.Value
+			}
+		case "remove":
+			// only names can be cleared, "active" and "userName" are required
+			path := strings.ToLower(op.Path)
+			if path != "name.givenname" && path != "name.familyname" {
+				return User{}, InvalidPathErr
+			}
+			attrs[path] = ""
+		default:
+			return User{}, InvalidValueErr
+		}
+
+		for path, v := range attrs {
+			switch path {
+			case "active":
+				b, err := parseBool(v)
+				if err != nil {
+					return User{}, err
+				}
+				active = b
+			case "name.givenname":
+				if firstName, err = parseString(v); err != nil {
+					return User{}, err
+				}
+			case "name.familyname":
+				if lastName, err = parseString(v); err != nil {
+					return User{}, err
+				}
+			case "username":
+				if name, _ := v.(string); !strings.EqualFold(name, rec.Email) {
+					return User{}, MutabilityErr
+				}
+			}
+			// attributes the server does not store are ignored
+		}
+	}
+
+	return s.apply(ctx, rec, firstName, lastName, active)
+}
+
+func (s *service) apply(ctx context.Context, rec UserRecord, firstName, lastName string, active bool) (User, error) {
+	if firstName != rec.FirstName || lastName != rec.LastName {
+		_, err := s.upd.UpdateUser(ctx, update.UserUpdateRequest{
+			ID:        rec.ID,
+			FirstName: firstName,
+			LastName:  lastName,
+		})
+		if err != nil {
+			return User{}, err
+		}
+	}
+
+	if active != rec.Active {
+		setActive := s.deac.DeactivateUser
+		if active {
+			setActive = s.deac.ActivateUser
+		}
+		if err := setActive(ctx, rec.ID); err != nil {
+			return User{}, err
+		}
+	}
+
+	return s.GetUser(ctx, rec.ID)
+}
+
+func (s *service) DeleteUser(ctx context.Context, id int) error {
+	if _, err := s.r.GetUserWithGroups(ctx, id); err != nil {
+		return notFound(err)
+	}
+	return s.del.DeleteUser(ctx, id)
+}
+
+func (s *service) ListGroups(ctx context.Context, lr ListRequest) (ListResponse, error) {
+	offset, limit := page(lr)
+	recs, total, err := s.r.FilterGroups(ctx, lr.Filter, offset, limit)
+	if err != nil {
+		return ListResponse{}, err
+	}
+
+	groups := []Group{}
+	for _, rec := range recs {
+		groups = append(groups, toGroup(rec))
+	}
+
+	return newListResponse(offset, total, len(groups), groups), nil
+}
+
+func (s *service) GetGroup(ctx context.Context, id int) (Group, error) {
+	rec, err := s.r.GetGroupWithMembers(ctx, id)
+	if err != nil {
+		return Group{}, notFound(err)
+	}
+	return toGroup(rec), nil
+}
+
+func (s *service) CreateGroup(ctx context.Context, g Group) (Group, error) {
+	exists, err := s.r.GroupExists(ctx, g.DisplayName)
+	if err != nil {
+		return Group{}, err
+	}
+	if exists {
+		return Group{}, UniquenessErr
+	}
+
+	ids, err := memberIDs(g.Members)
+	if err != nil {
+		return Group{}, err
+	}
+
+	var id int
+	err = s.r.WithinTx(ctx, func(ctx context.Context) error {
+		var err error
+		if id, err = s.r.CreateGroup(ctx, g.DisplayName); err != nil {
+			return err
+		}
+		if err := s.r.ReplaceGroupMembers(ctx, id, ids); err != nil {
+			return err
+		}
+		return s.appendGroupEvent(ctx, event.GroupUpdated, g.DisplayName)
+	})
+	if err != nil {
+		return Group{}, err
+	}
+
+	return s.GetGroup(ctx, id)
+}
+
+func (s *service) ReplaceGroup(ctx context.Context, id int, g Group) (Group, error) {
+	rec, err := s.r.GetGroupWithMembers(ctx, id)
+	if err != nil {
+		return Group{}, notFound(err)
+	}
+
+	ids, err := memberIDs(g.Members)
+	if err != nil {
+		return Group{}, err
+	}
+
+	err = s.r.WithinTx(ctx, func(ctx context.Context) error {
+		if err := s.rename(ctx, rec, g.DisplayName); err != nil {
+			return err
+		}
+		if err := s.r.ReplaceGroupMembers(ctx, id, ids); err != nil {
+			return err
+		}
+		return s.appendGroupEvent(ctx, event.GroupUpdated, g.DisplayName)
+	})
+	if err != nil {
+		return Group{}, err
+	}
+
+	return s.GetGroup(ctx, id)
+}
+
+func (s *service) PatchGroup(ctx context.Context, id int, pr PatchRequest) (Group, error) {
+	rec, err := s.r.GetGroupWithMembers(ctx, id)
+	if err != nil {
+		return Group{}, notFound(err)
+	}
+
+	err = s.r.WithinTx(ctx, func(ctx context.Context) error {
+		if err := s.patchGroup(ctx, rec, pr); err != nil {
+			return err
+		}
+
+		patched, err := s.r.GetGroupWithMembers(ctx, id)
+		if err != nil {
+			return err
+		}
+		return s.appendGroupEvent(ctx, event.GroupUpdated, patched.Name)
+	})
+	if err != nil {
+		return Group{}, err
+	}
+
+	return s.GetGroup(ctx, id)
+}
+
+func (s *service) patchGroup(ctx context.Context, rec GroupRecord, pr PatchRequest) error {
+	id := rec.ID
+
+	for _, op := range pr.Operations {
+		path := strings.ToLower(op.Path)
+		switch strings.ToLower(op.Op) {
+		case "add", "replace":
+			if path == "" {
+				m, ok := op.Value.(map[string]interface{})
+				if !ok {
+					return InvalidValueErr
+				}
+				if name, ok := m["displayName"]; ok {
+					if err := s.renameTo(ctx, rec, name); err != nil {
+						return err
+					}
+				}
+				if members, ok := m["members"]; ok {
+					if err := s.setMembers(ctx, id, op.Op, members); err != nil {
+						return err
+					}
+				}
+				continue
+			}
+
+			switch path {
+			case "displayname":
+				if err := s.renameTo(ctx, rec, op.Value); err != nil {
+					return err
+				}
+			case "members":
+				if err := s.setMembers(ctx, id, op.Op, op.Value); err != nil {
+					return err
+				}
+			default:
+				return InvalidPathErr
+			}
+		case "remove":
+			ids, err := s.removalTargets(ctx, op)
+			if err != nil {
+				return err
+			}
+			if ids == nil {
+				err = s.r.ReplaceGroupMembers(ctx, id, []int{})
+			} else {
+				err = s.r.RemoveGroupMembers(ctx, id, ids)
+			}
+			if err != nil {
+				return err
+			}
+		default:
+			return InvalidValueErr
+		}
+	}
+
+	return nil
+}
+
+func (s *service) DeleteGroup(ctx context.Context, id int) error {
+	rec, err := s.r.GetGroupWithMembers(ctx, id)
+	if err != nil {
+		return notFound(err)
+	}
+
+	return s.r.WithinTx(ctx, func(ctx context.Context) error {
+		if err := s.r.DeleteGroup(ctx, id); err != nil {
+			return err
+		}
+		return s.appendGroupEvent(ctx, event.GroupDeleted, rec.Name)
+	})
+}
+
+func (s *service) appendGroupEvent(ctx context.Context, typ, name string) error {
+	return s.r.AppendEvent(ctx, event.New(typ, event.GroupSubject(name), map[string]interface{}{"name": name}))
+}
+
+func (s *service) renameTo(ctx context.Context, rec GroupRecord, v interface{}) error {
+	name, ok := v.(string)
+	if !ok {
+		return InvalidValueErr
+	}
+	return s.rename(ctx, rec, name)
+}
+
+func (s *service) rename(ctx context.Context, rec GroupRecord, name string) error {
+	if name == "" {
+		return InvalidValueErr
+	}
+	if name == rec.Name {
+		return nil
+	}
+
+	exists, err := s.r.GroupExists(ctx, name)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return UniquenessErr
+	}
+
+	return s.r.RenameGroup(ctx, rec.ID, name)
+}
+
+func (s *service) setMembers(ctx context.Context, id int, op string, v interface{}) error {
+	ids, err := memberValues(v)
+	if err != nil {
+		return err
+	}
+	if strings.EqualFold(op, "add") {
+		return s.r.AddGroupMembers(ctx, id, ids)
+	}
+	return s.r.ReplaceGroupMembers(ctx, id, ids)
+}
+
+// removalTargets returns the members a remove operation applies to,
+// nil means every member.
+func (s *service) removalTargets(ctx context.Context, op PatchOperation) ([]int, error) {
+	if strings.EqualFold(op.Path, "members") {
+		if op.Value == nil {
+			return nil, nil
+		}
+		return memberValues(op.Value)
+	}
+
+	m := membersPathRe.FindStringSubmatch(op.Path)
+	if m == nil {
+		return nil, InvalidPathErr
+	}
+
+	f, err := ParseFilter(m[1])
+	if err != nil {
+		return nil, err
+	}
+
+	ids := []int{}
+	if err := collectMemberIDs(f, &ids); err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+// collectMemberIDs supports the `value eq "id"` filters, optionally joined
+// with "or", that IdPs send to remove specific members.
+func collectMemberIDs(f *Filter, ids *[]int) error {
+	switch f.Op {
+	case "or":
+		if err := collectMemberIDs(f.Left, ids); err != nil {
+			return err
+		}
+		return collectMemberIDs(f.Right, ids)
+	case "eq":
+		if f.Attr != "value" {
+			return InvalidPathErr
+		}
+		id, err := parseID(f.Value)
+		if err != nil {
+			return err
+		}
+		*ids = append(*ids, id)
+		return nil
+	}
+	return InvalidPathErr
+}
+
+func memberIDs(members []Relation) ([]int, error) {
+	ids := []int{}
+	for _, m := range members {
+		id, err := strconv.Atoi(m.Value)
+		if err != nil {
+			return nil, InvalidValueErr
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+func memberValues(v interface{}) ([]int, error) {
+	list, ok := v.([]interface{})
+	if !ok {
+		return nil, InvalidValueErr
+	}
+
+	ids := []int{}
+	for _, e := range list {
+		m, ok := e.(map[string]interface{})
+		if !ok {
+			return nil, InvalidValueErr
+		}
+		id, err := parseID(m["value"])
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+func toUser(rec UserRecord) User {
+	active := rec.Active
+	u := User{
+		Schemas:  []string{UserSchema},
+		ID:       strconv.Itoa(rec.ID),
+		UserName: rec.Email,
+		Name:     Name{GivenName: rec.FirstName, FamilyName: rec.LastName},
+		Emails:   []Email{{Value: rec.Email, Type: "work", Primary: true}},
+		Active:   &active,
+		Meta: &Meta{
+			ResourceType: "User",
+			Location:     fmt.Sprintf("%s/Users/%d", basePath, rec.ID),
+		},
+	}
+
+	for _, g := range rec.Groups {
+		u.Groups = append(u.Groups, Relation{
+			Value:   strconv.Itoa(g.ID),
+			Display: g.Name,
+			Ref:     fmt.Sprintf("%s/Groups/%d", basePath, g.ID),
+		})
+	}
+
+	return u
+}
+
+func toGroup(rec GroupRecord) Group {
+	g := Group{
+		Schemas:     []string{GroupSchema},
+		ID:          strconv.Itoa(rec.ID),
+		DisplayName: rec.Name,
+		Members:     []Relation{},
+		Meta: &Meta{
+			ResourceType: "Group",
+			Location:     fmt.Sprintf("%s/Groups/%d", basePath, rec.ID),
+		},
+	}
+
+	for _, m := range rec.Members {
+		g.Members = append(g.Members, Relation{
+			Value:   strconv.Itoa(m.ID),
+			Display: m.Email,
+			Ref:     fmt.Sprintf("%s/Users/%d", basePath, m.ID),
+		})
+	}
+
+	return g
+}
+
+// page converts the 1-based SCIM startIndex and count into an offset and limit.
+func page(lr ListRequest) (int, int) {
+	offset := lr.StartIndex - 1
+	if offset < 0 {
+		offset = 0
+	}
+
+	limit := lr.Count
+	if limit < 0 {
+		limit = 0
+	}
+	if limit > maxCount {
+		limit = maxCount
+	}
+
+	return offset, limit
+}
+
+func newListResponse(offset, total, n int, resources interface{}) ListResponse {
+	return ListResponse{
+		Schemas:      []string{ListResponseSchema},
+		TotalResults: total,
+		StartIndex:   offset + 1,
+		ItemsPerPage: n,
+		Resources:    resources,
+	}
+}
+
+// flatten turns {"name": {"givenName": "x"}} into {"name.givenname": "x"}.
+func flatten(m map[string]interface{}) map[string]interface{} {
+	flat := map[string]interface{}{}
+	for k, v := range m {
+		if nested, ok := v.(map[string]interface{}); ok {
+			for nk, nv := range flatten(nested) {
+				flat[strings.ToLower(k)+"."+nk] = nv
+			}
+			continue
+		}
+		flat[strings.ToLower(k)] = v
+	}
+	return flat
+}
+
+// parseBool accepts both JSON booleans and the "True"/"False" strings some IdPs send.
+func parseBool(v interface{}) (bool, error) {
+	switch b := v.(type) {
+	case bool:
+		return b, nil
+	case string:
+		parsed, err := strconv.ParseBool(b)
+		if err != nil {
+			return false, InvalidValueErr
+		}
+		return parsed, nil
+	}
+	return false, InvalidValueErr
+}
+
+func parseString(v interface{}) (string, error) {
+	s, ok := v.(string)
+	if !ok {
+		return "", InvalidValueErr
+	}
+	return s, nil
+}
+
+func parseID(v interface{}) (int, error) {
+	s, ok := v.(string)
+	if !ok {
+		return 0, InvalidValueErr
+	}
+	id, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, InvalidValueErr
+	}
+	return id, nil
+}
+
+func notFound(err error) error {
+	if err == sql.ErrNoRows {
+		return NotFoundErr
+	}
+	return err
+}
+
+func randomPassword() (string, error) {
+	b := make([]byte, randomPassBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,84 @@
+package scim
+
+const (
+	UserSchema         = "urn:ietf:params:scim:schemas:core:2.0:User"
+	GroupSchema        = "urn:ietf:params:scim:schemas:core:2.0:Group"
+	ListResponseSchema = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	PatchOpSchema      = "urn:ietf:params:scim:api:messages:2.0:PatchOp"
+	ErrorSchema        = "urn:ietf:params:scim:api:messages:2.0:Error"
+)
+
+type User struct {
+	Schemas  []string   `json:"schemas"`
+	ID       string     `json:"id,omitempty"`
+	UserName string     `json:"userName"`
+	Name     Name       `json:"name"`
+	Emails   []Email    `json:"emails,omitempty"`
+	Active   *bool      `json:"active,omitempty"`
+	Password string     `json:"password,omitempty"`
+	Groups   []Relation `json:"groups,omitempty"`
+	Meta     *Meta      `json:"meta,omitempty"`
+}
+
+type Name struct {
+	GivenName  string `json:"givenName"`
+	FamilyName string `json:"familyName"`
+}
+
+type Email struct {
+	Value   string `json:"value"`
+	Type    string `json:"type,omitempty"`
+	Primary bool   `json:"primary,omitempty"`
+}
+
+// Relation references a group from a user or a user from a group.
+type Relation struct {
+	Value   string `json:"value"`
+	Display string `json:"display,omitempty"`
+	Ref     string `json:"$ref,omitempty"`
+}
+
+type Meta struct {
+	ResourceType string `json:"resourceType"`
+	Location     string `json:"location"`
+}
+
+type ListRequest struct {
+	Filter     *Filter
+	StartIndex int
+	Count      int
+}
+
+type ListResponse struct {
+	Schemas      []string    `json:"schemas"`
+	TotalResults int         `json:"totalResults"`
+	StartIndex   int         `json:"startIndex"`
+	ItemsPerPage int         `json:"itemsPerPage"`
+	Resources    interface{} `json:"Resources"`
+}
+
+type PatchRequest struct {
+	Schemas    []string         `json:"schemas"`
+	Operations []PatchOperation `json:"Operations" validate:"required,min=1"`
+}
+
+type PatchOperation struct {
+	Op    string      `json:"op" validate:"required"`
+	Path  string      `json:"path"`
+	Value interface{} `json:"value"`
+}
+
+// UserRecord is a user as read from storage.
+type UserRecord struct {
+	ID        int
+	Email     string
+	FirstName string
+	LastName  string
+	Active    bool
+	Groups    []GroupRef
+}
+
+type GroupRef struct {
+	ID   int
+	Name string
+}
@@ -0,0 +1,15 @@
+package storage
+
+import "errors"
+
+// Drivers are the storage backends the server can run on, the driver is
+// picked with the storage.driver setting of pkg/config.
+const (
+	Postgres = "postgres"
+	// Memory keeps everything in memory, for tests and local development
+	Memory = "memory"
+	// SQLite keeps everything in a single file, for single node deployments
+	SQLite = "sqlite"
+)
+
+var UnknownDriverErr = errors.New("Unknown storage driver")
@@ -0,0 +1,188 @@
+package memory
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"sort"
+
+	"github.com/raisultan/abac/pkg/attribute"
+)
+
+// definition keeps the default value encoded, like the JSONB column does.
+type definition struct {
+	Name        string
+	Type        string
+	Required    bool
+	Default     []byte
+	Values      []string
+	Description string
+}
+
+func (s *Storage) ListAttributeDefinitions(ctx context.Context) ([]attribute.Definition, error) {
+	unlock, err := s.lock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	defs := []attribute.Definition{}
+	for _, stored := range s.d.definitions {
+		d := attribute.Definition{
+			Name:        stored.Name,
+			Type:        stored.Type,
+			Required:    stored.Required,
+			Values:      append([]string{}, stored.Values...),
+			Description: stored.Description,
+		}
+		if stored.Default != nil {
+			if err := decodeJSON(stored.Default, &d.Default); err != nil {
+				return nil, err
+			}
+		}
+		defs = append(defs, d)
+	}
+	sort.Slice(defs, func(i, j int) bool { return defs[i].Name < defs[j].Name })
+
+	return defs, nil
+}
+
+func (s *Storage) SaveAttributeDefinition(ctx context.Context, d attribute.Definition) error {
+	var def []byte
+	if d.Default != nil {
+		var err error
+		if def, err = json.Marshal(d.Default); err != nil {
+			return err
+		}
+	}
+
+	unlock, err := s.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	s.d.definitions[d.Name] = definition{
+		Name:        d.Name,
+		Type:        d.Type,
+		Required:    d.Required,
+		Default:     def,
+		Values:      append([]string{}, d.Values...),
+		Description: d.Description,
+	}
+	return nil
+}
+
+// DeleteAttributeDefinition removes the definition together with the values
+// users have for it.
+func (s *Storage) DeleteAttributeDefinition(ctx context.Context, name string) error {
+	unlock, err := s.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if _, ok := s.d.definitions[name]; !ok {
+		return sql.ErrNoRows
+	}
+
+	for id, u := range s.d.users {
+		attrs := map[string]interface{}{}
+		if err := decodeJSON(u.Attributes, &attrs); err != nil {
+			return err
+		}
+		if _, ok := attrs[name]; !ok {
+			continue
+		}
+
+		delete(attrs, name)
+		raw, err := json.Marshal(attrs)
+		if err != nil {
+			return err
+		}
+		u.Attributes = raw
+		s.d.users[id] = u
+	}
+
+	delete(s.d.definitions, name)
+	return nil
+}
+
+func (s *Storage) GetUserAttributes(ctx context.Context, userID int) (map[string]interface{}, error) {
+	unlock, err := s.lock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	u, ok := s.d.users[userID]
+	if !ok || u.deleted() {
+		return nil, sql.ErrNoRows
+	}
+
+	attrs := map[string]interface{}{}
+	if err := decodeJSON(u.Attributes, &attrs); err != nil {
+		return nil, err
+	}
+	return attrs, nil
+}
+
+// GetUserAttributesForUpdate is GetUserAttributes, a transaction holds the
+// whole store.
+func (s *Storage) GetUserAttributesForUpdate(ctx context.Context, userID int) (map[string]interface{}, error) {
+	return s.GetUserAttributes(ctx, userID)
+}
+
+func (s *Storage) SetUserAttributes(ctx context.Context, userID int, attrs map[string]interface{}) error {
+	raw, err := json.Marshal(attrs)
+	if err != nil {
+		return err
+	}
+
+	unlock, err := s.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	u, ok := s.d.users[userID]
+	if !ok || u.deleted() {
+		return sql.ErrNoRows
+	}
+
+	u.Attributes = raw
+	s.touch(&u)
+	return nil
+}
+
+func (s *Storage) GetSubject(ctx context.Context, email string) (attribute.Subject, error) {
+	unlock, err := s.lock(ctx)
+	if err != nil {
+		return attribute.Subject{}, err
+	}
+	defer unlock()
+
+	u, ok := s.userByEmail(email)
+	if !ok || u.deleted() {
+		return attribute.Subject{}, sql.ErrNoRows
+	}
+
+	sub := attribute.Subject{
+		ID:         u.ID,
+		Email:      u.Email,
+		FirstName:  u.FirstName,
+		LastName:   u.LastName,
+		IsAdmin:    u.IsAdmin,
+		IsApproved: u.IsApproved,
+		Groups:     []string{},
+		Attributes: map[string]interface{}{},
+	}
+	if err := decodeJSON(u.Attributes, &sub.Attributes); err != nil {
+		return attribute.Subject{}, err
+	}
+	for _, id := range s.groupsOf(u.ID) {
+		sub.Groups = append(sub.Groups, s.d.groups[id])
+	}
+
+	return sub, nil
+}
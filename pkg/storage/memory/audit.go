@@ -0,0 +1,166 @@
+package memory
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/raisultan/abac/pkg/audit"
+)
+
+// auditEvent keeps the details encoded, like the JSONB column does, so the
+// hash is verified against what was stored.
+type auditEvent struct {
+	audit.Event
+	RawDetails []byte
+}
+
+type checkpoint audit.Checkpoint
+
+// AppendAuditEvent assigns the event its ID and chains it to the last
+// event, the store lock keeps the chain linear.
+func (s *Storage) AppendAuditEvent(ctx context.Context, e audit.Event) error {
+	if e.Details == nil {
+		e.Details = map[string]interface{}{}
+	}
+	details, err := json.Marshal(e.Details)
+	if err != nil {
+		return err
+	}
+
+	unlock, err := s.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	var prev audit.Hash
+	if n := len(s.d.auditEvents); n > 0 {
+		prev = s.d.auditEvents[n-1].Hash
+	}
+
+	e.ID = s.next("audit_events")
+	e.Time = e.Time.UTC().Truncate(time.Microsecond)
+	e.PrevHash = prev
+	e.Hash = audit.HashEvent(prev, e)
+	e.Details = nil
+
+	s.d.auditEvents = append(s.d.auditEvents, auditEvent{Event: e, RawDetails: details})
+	return nil
+}
+
+// ListAuditEvents returns matching events, newest first.
+func (s *Storage) ListAuditEvents(ctx context.Context, lr audit.ListRequest) ([]audit.Event, error) {
+	unlock, err := s.lock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	events := []audit.Event{}
+	for i := len(s.d.auditEvents) - 1; i >= 0 && len(events) < lr.Limit; i-- {
+		e := s.d.auditEvents[i]
+		switch {
+		case lr.Type != "" && e.Type != lr.Type,
+			lr.Actor != "" && e.Actor != lr.Actor,
+			lr.Subject != "" && e.Subject != lr.Subject,
+			lr.Resource != "" && e.Resource != lr.Resource,
+			lr.Result != "" && e.Result != lr.Result,
+			lr.From != nil && e.Time.Before(*lr.From),
+			lr.To != nil && !e.Time.Before(*lr.To),
+			lr.Before > 0 && e.ID >= lr.Before:
+			continue
+		}
+
+		event, err := e.decode()
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+
+	return events, nil
+}
+
+// ListAuditEventsAfter returns events in chain order starting after afterID.
+func (s *Storage) ListAuditEventsAfter(ctx context.Context, afterID int64, limit int) ([]audit.Event, error) {
+	unlock, err := s.lock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	events := []audit.Event{}
+	for _, e := range s.d.auditEvents {
+		if len(events) == limit {
+			break
+		}
+		if e.ID <= afterID {
+			continue
+		}
+
+		event, err := e.decode()
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+
+	return events, nil
+}
+
+func (s *Storage) LastAuditEvent(ctx context.Context) (audit.Event, error) {
+	unlock, err := s.lock(ctx)
+	if err != nil {
+		return audit.Event{}, err
+	}
+	defer unlock()
+
+	if len(s.d.auditEvents) == 0 {
+		return audit.Event{}, sql.ErrNoRows
+	}
+	return s.d.auditEvents[len(s.d.auditEvents)-1].decode()
+}
+
+// AuditChainStart is the first ID, every event is chained.
+func (s *Storage) AuditChainStart(ctx context.Context) (int64, error) {
+	return 1, nil
+}
+
+func (s *Storage) CreateAuditCheckpoint(ctx context.Context, c audit.Checkpoint) error {
+	unlock, err := s.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	c.ID = s.next("audit_checkpoints")
+	c.CreatedAt = now()
+	s.d.checkpoints = append(s.d.checkpoints, checkpoint(c))
+	return nil
+}
+
+func (s *Storage) ListAuditCheckpoints(ctx context.Context) ([]audit.Checkpoint, error) {
+	unlock, err := s.lock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	checkpoints := []audit.Checkpoint{}
+	for _, c := range s.d.checkpoints {
+		checkpoints = append(checkpoints, audit.Checkpoint(c))
+	}
+	return checkpoints, nil
+}
+
+// decode returns a copy of the event with its stored details.
+func (e auditEvent) decode() (audit.Event, error) {
+	event := e.Event
+	event.Details = nil
+	if err := decodeJSON(e.RawDetails, &event.Details); err != nil {
+		return audit.Event{}, err
+	}
+	return event, nil
+}
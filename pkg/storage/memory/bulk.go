@@ -0,0 +1,104 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"sort"
+
+	"github.com/raisultan/abac/pkg/bulk"
+)
+
+var errDryRun = errors.New("dry run")
+
+// UpsertUsers imports rows in a single transaction which is rolled back on
+// a dry run, so it reports exactly what a real import would do. Rows of
+// deleted users fail with DeletedUserErr. Passwords
+// are only changed for existing users when the row has one.
+func (s *Storage) UpsertUsers(ctx context.Context, rows []bulk.ImportRow, dryRun bool) ([]bulk.ImportedUser, error) {
+	var users []bulk.ImportedUser
+	err := s.WithinTx(ctx, func(ctx context.Context) error {
+		return s.upsertUsers(rows, dryRun, &users)
+	})
+	if err == errDryRun {
+		err = nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
+
+func (s *Storage) upsertUsers(rows []bulk.ImportRow, dryRun bool, users *[]bulk.ImportedUser) error {
+	for _, row := range rows {
+		var err error
+		hash := ""
+		if row.Password != "" && !dryRun {
+			if hash, err = hashPassword(row.Password); err != nil {
+				return err
+			}
+		}
+
+		imported := bulk.ImportedUser{Email: row.Email, FirstName: row.FirstName, LastName: row.LastName}
+		u, ok := s.userByEmail(row.Email)
+		if !ok {
+			if u, err = s.insertUser(row.Email, hash, row.FirstName, row.LastName); err != nil {
+				return err
+			}
+			imported.ID, imported.Created = u.ID, true
+			*users = append(*users, imported)
+			continue
+		}
+		if u.deleted() {
+			return &bulk.RowErr{Line: row.Line, Err: bulk.DeletedUserErr}
+		}
+
+		u.FirstName = row.FirstName
+		u.LastName = row.LastName
+		if hash != "" {
+			u.Password = hash
+		}
+		s.touch(&u)
+		imported.ID = u.ID
+		*users = append(*users, imported)
+	}
+
+	// a dry run rolls the transaction back
+	if dryRun {
+		return errDryRun
+	}
+	return nil
+}
+
+func (s *Storage) ExportUsers(ctx context.Context, fn func(bulk.ExportRow) error) error {
+	unlock, err := s.lock(ctx)
+	if err != nil {
+		return err
+	}
+
+	users := []bulk.ExportRow{}
+	for _, u := range s.d.users {
+		if u.deleted() {
+			continue
+		}
+		users = append(users, bulk.ExportRow{
+			ID:         u.ID,
+			Email:      u.Email,
+			FirstName:  u.FirstName,
+			LastName:   u.LastName,
+			IsAdmin:    u.IsAdmin,
+			IsApproved: u.IsApproved,
+			CreatedAt:  u.CreatedAt,
+		})
+	}
+	unlock()
+	sort.Slice(users, func(i, j int) bool { return users[i].ID < users[j].ID })
+
+	// fn runs without the lock, it writes to the client at its own pace
+	for _, u := range users {
+		if err := fn(u); err != nil {
+			return err
+		}
+	}
+	return nil
+}
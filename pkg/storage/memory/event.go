@@ -0,0 +1,186 @@
+package memory
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/raisultan/abac/pkg/event"
+)
+
+type outboxEvent struct {
+	ID            int64
+	Type          string
+	Subject       string
+	Time          time.Time
+	Data          []byte
+	Attempts      int
+	NextAttemptAt time.Time
+	PublishedAt   *time.Time
+	PublishedTo   []string
+	LastError     string
+}
+
+// AppendEvent stores e in the outbox, within the transaction of the change
+// it describes when ctx carries one.
+func (s *Storage) AppendEvent(ctx context.Context, e event.Event) error {
+	data, err := json.Marshal(e.Data)
+	if err != nil {
+		return err
+	}
+
+	unlock, err := s.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	id := s.next("outbox_events")
+	s.d.outbox[id] = outboxEvent{
+		ID:            id,
+		Type:          e.Type,
+		Subject:       e.Subject,
+		Time:          e.Time,
+		Data:          data,
+		NextAttemptAt: now(),
+	}
+	return nil
+}
+
+func (s *Storage) LatestEvent(ctx context.Context, typ string) (event.Event, error) {
+	unlock, err := s.lock(ctx)
+	if err != nil {
+		return event.Event{}, err
+	}
+	defer unlock()
+
+	var latest *outboxEvent
+	for _, e := range s.d.outbox {
+		if e.Type == typ && (latest == nil || e.ID > latest.ID) {
+			e := e
+			latest = &e
+		}
+	}
+	if latest == nil {
+		return event.Event{}, sql.ErrNoRows
+	}
+	return latest.decode()
+}
+
+// ClaimEvents pushes the due time of the claimed events past the lease. An
+// event waits for the earlier events of its subject.
+func (s *Storage) ClaimEvents(ctx context.Context, limit int, lease time.Duration) ([]event.Event, error) {
+	unlock, err := s.lock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	pending := []outboxEvent{}
+	for _, e := range s.d.outbox {
+		if e.PublishedAt == nil {
+			pending = append(pending, e)
+		}
+	}
+	sort.Slice(pending, func(i, j int) bool { return pending[i].ID < pending[j].ID })
+
+	t := now()
+	due := []outboxEvent{}
+	waiting := map[string]bool{}
+	for _, e := range pending {
+		if !waiting[e.Subject] && !e.NextAttemptAt.After(t) {
+			due = append(due, e)
+		}
+		waiting[e.Subject] = true
+	}
+	if len(due) > limit {
+		due = due[:limit]
+	}
+
+	events := []event.Event{}
+	for _, e := range due {
+		e.NextAttemptAt = t.Add(lease)
+		s.d.outbox[e.ID] = e
+
+		decoded, err := e.decode()
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, decoded)
+	}
+
+	return events, nil
+}
+
+func (s *Storage) MarkEventPublished(ctx context.Context, id int64) error {
+	unlock, err := s.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	e, ok := s.d.outbox[id]
+	if !ok {
+		return sql.ErrNoRows
+	}
+
+	t := now()
+	e.PublishedAt = &t
+	e.LastError = ""
+	s.d.outbox[id] = e
+	return nil
+}
+
+func (s *Storage) RetryEvent(ctx context.Context, id int64, at time.Time, reason string, publishedTo []string) error {
+	unlock, err := s.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	e, ok := s.d.outbox[id]
+	if !ok {
+		return sql.ErrNoRows
+	}
+
+	e.Attempts++
+	e.NextAttemptAt = at
+	e.LastError = reason
+	e.PublishedTo = append([]string{}, publishedTo...)
+	s.d.outbox[id] = e
+	return nil
+}
+
+func (s *Storage) PurgePublishedEvents(ctx context.Context, before time.Time) (int64, error) {
+	unlock, err := s.lock(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+
+	var n int64
+	for id, e := range s.d.outbox {
+		if e.PublishedAt != nil && e.PublishedAt.Before(before) {
+			delete(s.d.outbox, id)
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (e outboxEvent) decode() (event.Event, error) {
+	decoded := event.Event{
+		ID:          e.ID,
+		Type:        e.Type,
+		Subject:     e.Subject,
+		Time:        e.Time,
+		Attempts:    e.Attempts,
+		PublishedTo: append([]string{}, e.PublishedTo...),
+	}
+	if err := decodeJSON(e.Data, &decoded.Data); err != nil {
+		return event.Event{}, err
+	}
+	return decoded, nil
+}
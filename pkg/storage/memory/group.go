@@ -0,0 +1,230 @@
+package memory
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sort"
+)
+
+// errDuplicateGroup is what the unique constraint on group names reports.
+var errDuplicateGroup = errors.New("Group name already exists")
+
+type membership struct {
+	UserID  int
+	GroupID int
+}
+
+// AddUserToGroups adds the user to each of the named groups, creating the
+// groups that do not exist yet, and returns the groups the user was added to.
+func (s *Storage) AddUserToGroups(ctx context.Context, userID int, groups []string) ([]string, error) {
+	unlock, err := s.lock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	if _, ok := s.d.users[userID]; !ok {
+		return nil, sql.ErrNoRows
+	}
+
+	added := []string{}
+	for _, name := range groups {
+		m := membership{userID, s.ensureGroup(name)}
+		if !s.d.memberships[m] {
+			s.d.memberships[m] = true
+			added = append(added, name)
+		}
+	}
+	sort.Strings(added)
+	return added, nil
+}
+
+// SyncGroupMembers makes the existing users with the given emails the only
+// members of the named group, creating the group if it does not exist yet,
+// and reports whether the membership changed.
+func (s *Storage) SyncGroupMembers(ctx context.Context, group string, emails []string) (bool, error) {
+	unlock, err := s.lock(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer unlock()
+
+	groupID := s.ensureGroup(group)
+
+	members := map[int]bool{}
+	for _, email := range emails {
+		if u, ok := s.userByEmail(email); ok {
+			members[u.ID] = true
+		}
+	}
+
+	changed := false
+	for m := range s.d.memberships {
+		if m.GroupID == groupID && !members[m.UserID] {
+			delete(s.d.memberships, m)
+			changed = true
+		}
+	}
+	for userID := range members {
+		m := membership{userID, groupID}
+		if !s.d.memberships[m] {
+			s.d.memberships[m] = true
+			changed = true
+		}
+	}
+	return changed, nil
+}
+
+func (s *Storage) GroupExists(ctx context.Context, name string) (bool, error) {
+	unlock, err := s.lock(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer unlock()
+
+	_, ok := s.groupByName(name)
+	return ok, nil
+}
+
+func (s *Storage) CreateGroup(ctx context.Context, name string) (int, error) {
+	unlock, err := s.lock(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+
+	if _, ok := s.groupByName(name); ok {
+		return 0, errDuplicateGroup
+	}
+	return s.ensureGroup(name), nil
+}
+
+func (s *Storage) RenameGroup(ctx context.Context, id int, name string) error {
+	unlock, err := s.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if other, ok := s.groupByName(name); ok && other != id {
+		return errDuplicateGroup
+	}
+	if _, ok := s.d.groups[id]; ok {
+		s.d.groups[id] = name
+	}
+	return nil
+}
+
+func (s *Storage) ReplaceGroupMembers(ctx context.Context, id int, userIDs []int) error {
+	return s.WithinTx(ctx, func(ctx context.Context) error {
+		keep := map[int]bool{}
+		for _, userID := range userIDs {
+			keep[userID] = true
+		}
+		for m := range s.d.memberships {
+			if m.GroupID == id && !keep[m.UserID] {
+				delete(s.d.memberships, m)
+			}
+		}
+
+		return s.AddGroupMembers(ctx, id, userIDs)
+	})
+}
+
+func (s *Storage) AddGroupMembers(ctx context.Context, id int, userIDs []int) error {
+	unlock, err := s.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if _, ok := s.d.groups[id]; !ok {
+		return sql.ErrNoRows
+	}
+	for _, userID := range userIDs {
+		if _, ok := s.d.users[userID]; ok {
+			s.d.memberships[membership{userID, id}] = true
+		}
+	}
+	return nil
+}
+
+func (s *Storage) RemoveGroupMembers(ctx context.Context, id int, userIDs []int) error {
+	unlock, err := s.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	for _, userID := range userIDs {
+		delete(s.d.memberships, membership{userID, id})
+	}
+	return nil
+}
+
+func (s *Storage) DeleteGroup(ctx context.Context, id int) error {
+	unlock, err := s.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	delete(s.d.groups, id)
+	for m := range s.d.memberships {
+		if m.GroupID == id {
+			delete(s.d.memberships, m)
+		}
+	}
+	return nil
+}
+
+// ensureGroup returns the ID of the named group, creating it if needed.
+func (s *Storage) ensureGroup(name string) int {
+	if id, ok := s.groupByName(name); ok {
+		return id
+	}
+
+	id := int(s.next("groups"))
+	s.d.groups[id] = name
+	return id
+}
+
+func (s *Storage) groupByName(name string) (int, bool) {
+	for id, n := range s.d.groups {
+		if n == name {
+			return id, true
+		}
+	}
+	return 0, false
+}
+
+func (s *Storage) inGroup(userID int, name string) bool {
+	id, ok := s.groupByName(name)
+	return ok && s.d.memberships[membership{userID, id}]
+}
+
+// groupsOf returns the groups of a user ordered by ID.
+func (s *Storage) groupsOf(userID int) []int {
+	ids := []int{}
+	for m := range s.d.memberships {
+		if m.UserID == userID {
+			ids = append(ids, m.GroupID)
+		}
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+// membersOf returns the members of a group that are not deleted, ordered
+// by ID.
+func (s *Storage) membersOf(groupID int) []int {
+	ids := []int{}
+	for m := range s.d.memberships {
+		if m.GroupID == groupID && !s.d.users[m.UserID].deleted() {
+			ids = append(ids, m.UserID)
+		}
+	}
+	sort.Ints(ids)
+	return ids
+}
@@ -0,0 +1,48 @@
+package memory
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/raisultan/abac/pkg/oidc"
+)
+
+var errDuplicateIdentity = errors.New("Identity already linked")
+
+type identity struct {
+	Issuer  string
+	Subject string
+}
+
+func (s *Storage) GetUserByIdentity(ctx context.Context, issuer, subject string) (oidc.User, error) {
+	unlock, err := s.lock(ctx)
+	if err != nil {
+		return oidc.User{}, err
+	}
+	defer unlock()
+
+	id, ok := s.d.identities[identity{issuer, subject}]
+	if !ok {
+		return oidc.User{}, sql.ErrNoRows
+	}
+	return oidc.User{ID: id, Email: s.d.users[id].Email}, nil
+}
+
+func (s *Storage) LinkIdentity(ctx context.Context, userID int, issuer, subject string) error {
+	unlock, err := s.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if _, ok := s.d.users[userID]; !ok {
+		return sql.ErrNoRows
+	}
+	if _, ok := s.d.identities[identity{issuer, subject}]; ok {
+		return errDuplicateIdentity
+	}
+
+	s.d.identities[identity{issuer, subject}] = userID
+	return nil
+}
@@ -0,0 +1,160 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/raisultan/abac/pkg/list"
+)
+
+func (s *Storage) GetAllUsers(ctx context.Context, lr list.UserListRequest) ([]list.UserRetrieveResponse, error) {
+	unlock, err := s.lock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	// id is always the last sort key so the order is total and cursors are stable
+	fields := append(append([]list.SortField{}, lr.Sort...), list.SortField{Name: "id", Desc: idDesc(lr.Sort)})
+
+	var after []string
+	if lr.After != nil {
+		after = append(append([]string{}, lr.After.Values...), strconv.Itoa(lr.After.ID))
+	}
+
+	users := []list.UserRetrieveResponse{}
+	for _, u := range s.matchingUsers(lr) {
+		if after != nil && compareUser(u, after, fields) <= 0 {
+			continue
+		}
+		users = append(users, u)
+	}
+
+	sort.Slice(users, func(i, j int) bool {
+		return compareUser(users[i], userValues(users[j], fields), fields) < 0
+	})
+
+	if len(users) > lr.Limit {
+		users = users[:lr.Limit]
+	}
+	return users, nil
+}
+
+func (s *Storage) CountUsers(ctx context.Context, lr list.UserListRequest) (int, error) {
+	unlock, err := s.lock(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+
+	return len(s.matchingUsers(lr)), nil
+}
+
+func (s *Storage) matchingUsers(lr list.UserListRequest) []list.UserRetrieveResponse {
+	search := strings.ToLower(lr.Search)
+
+	users := []list.UserRetrieveResponse{}
+	for _, u := range s.d.users {
+		switch {
+		case !lr.IncludeDeleted && u.deleted():
+			continue
+		case lr.Email != "" && !strings.EqualFold(u.Email, lr.Email):
+			continue
+		case lr.IsAdmin != nil && u.IsAdmin != *lr.IsAdmin:
+			continue
+		case lr.IsApproved != nil && u.IsApproved != *lr.IsApproved:
+			continue
+		case lr.Group != "" && !s.inGroup(u.ID, lr.Group):
+			continue
+		case lr.CreatedFrom != nil && u.CreatedAt.Before(*lr.CreatedFrom):
+			continue
+		case lr.CreatedTo != nil && !u.CreatedAt.Before(*lr.CreatedTo):
+			continue
+		case search != "" &&
+			!strings.Contains(strings.ToLower(u.Email), search) &&
+			!strings.Contains(strings.ToLower(u.FirstName), search) &&
+			!strings.Contains(strings.ToLower(u.LastName), search):
+			continue
+		}
+
+		users = append(users, list.UserRetrieveResponse{
+			ID:         u.ID,
+			Email:      u.Email,
+			FirstName:  u.FirstName,
+			LastName:   u.LastName,
+			IsAdmin:    u.IsAdmin,
+			IsApproved: u.IsApproved,
+			CreatedAt:  u.CreatedAt,
+			DisabledAt: u.DisabledAt,
+			DeletedAt:  u.DeletedAt,
+		})
+	}
+	return users
+}
+
+// compareUser compares u with the sort field values of another user, the
+// way the keyset condition of the postgres query does.
+func compareUser(u list.UserRetrieveResponse, values []string, fields []list.SortField) int {
+	mine := userValues(u, fields)
+	for i, f := range fields {
+		c := compareField(f.Name, mine[i], values[i])
+		if f.Desc {
+			c = -c
+		}
+		if c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+func compareField(name, a, b string) int {
+	switch name {
+	case "id":
+		x, _ := strconv.Atoi(a)
+		y, _ := strconv.Atoi(b)
+		return x - y
+	case "createdAt":
+		x, _ := time.Parse(time.RFC3339Nano, a)
+		y, _ := time.Parse(time.RFC3339Nano, b)
+		switch {
+		case x.Before(y):
+			return -1
+		case x.After(y):
+			return 1
+		}
+		return 0
+	}
+	return strings.Compare(a, b)
+}
+
+func userValues(u list.UserRetrieveResponse, fields []list.SortField) []string {
+	values := []string{}
+	for _, f := range fields {
+		switch f.Name {
+		case "id":
+			values = append(values, strconv.Itoa(u.ID))
+		case "email":
+			values = append(values, u.Email)
+		case "firstName":
+			values = append(values, u.FirstName)
+		case "lastName":
+			values = append(values, u.LastName)
+		case "createdAt":
+			values = append(values, u.CreatedAt.Format(time.RFC3339Nano))
+		}
+	}
+	return values
+}
+
+// idDesc sorts the id tie breaker in the direction of the last requested
+// field, like the postgres storage does.
+func idDesc(sort []list.SortField) bool {
+	if len(sort) == 0 {
+		return false
+	}
+	return sort[len(sort)-1].Desc
+}
@@ -0,0 +1,158 @@
+// Package memory keeps everything postgres.Storage stores in memory, for
+// tests and local development. It implements the same repositories with
+// the same semantics and errors, data is lost when the process exits.
+package memory
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// Storage is safe for concurrent use. Transactions hold the lock of the
+// whole store, so they are serializable.
+type Storage struct {
+	mu sync.Mutex
+	d  data
+}
+
+// data holds the tables. Rows are stored by value and replaced rather than
+// changed in place, so copying the maps is enough to snapshot the store.
+type data struct {
+	users       map[int]user
+	groups      map[int]string
+	memberships map[membership]bool
+	identities  map[identity]int
+	clients     map[string]client
+	revoked     map[string]time.Time
+	credentials map[int]credential
+	challenges  map[string]challenge
+	definitions map[string]definition
+	resources   map[int]resourceRow
+
+	auditEvents []auditEvent
+	checkpoints []checkpoint
+
+	outbox        map[int64]outboxEvent
+	subscriptions map[int]subscription
+	deliveries    map[int64]delivery
+
+	seq map[string]int64
+}
+
+type txKey struct{}
+
+func NewStorage() *Storage {
+	return &Storage{d: data{
+		users:         map[int]user{},
+		groups:        map[int]string{},
+		memberships:   map[membership]bool{},
+		identities:    map[identity]int{},
+		clients:       map[string]client{},
+		revoked:       map[string]time.Time{},
+		credentials:   map[int]credential{},
+		challenges:    map[string]challenge{},
+		definitions:   map[string]definition{},
+		resources:     map[int]resourceRow{},
+		outbox:        map[int64]outboxEvent{},
+		subscriptions: map[int]subscription{},
+		deliveries:    map[int64]delivery{},
+		seq:           map[string]int64{},
+	}}
+}
+
+// WithinTx runs fn holding the store, or in the transaction ctx already
+// carries. Changes made by fn are undone when it fails.
+func (s *Storage) WithinTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	if s.inTx(ctx) {
+		return fn(ctx)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	snapshot := s.d.clone()
+	if err := fn(context.WithValue(ctx, txKey{}, s)); err != nil {
+		s.d = snapshot
+		return err
+	}
+	return nil
+}
+
+// lock locks the store unless ctx carries a transaction that already holds
+// it, the returned function undoes it.
+func (s *Storage) lock(ctx context.Context) (func(), error) {
+	if s.inTx(ctx) {
+		return func() {}, ctx.Err()
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	return s.mu.Unlock, nil
+}
+
+func (s *Storage) inTx(ctx context.Context) bool {
+	tx, ok := ctx.Value(txKey{}).(*Storage)
+	return ok && tx == s
+}
+
+// next returns the next value of the named sequence, sequences start at 1
+// and are not rolled back, like their postgres counterparts.
+func (s *Storage) next(name string) int64 {
+	s.d.seq[name]++
+	return s.d.seq[name]
+}
+
+func (d data) clone() data {
+	c := d
+	c.users = copyMap(d.users).(map[int]user)
+	c.groups = copyMap(d.groups).(map[int]string)
+	c.memberships = copyMap(d.memberships).(map[membership]bool)
+	c.identities = copyMap(d.identities).(map[identity]int)
+	c.clients = copyMap(d.clients).(map[string]client)
+	c.revoked = copyMap(d.revoked).(map[string]time.Time)
+	c.credentials = copyMap(d.credentials).(map[int]credential)
+	c.challenges = copyMap(d.challenges).(map[string]challenge)
+	c.definitions = copyMap(d.definitions).(map[string]definition)
+	c.resources = copyMap(d.resources).(map[int]resourceRow)
+	c.auditEvents = append([]auditEvent{}, d.auditEvents...)
+	c.checkpoints = append([]checkpoint{}, d.checkpoints...)
+	c.outbox = copyMap(d.outbox).(map[int64]outboxEvent)
+	c.subscriptions = copyMap(d.subscriptions).(map[int]subscription)
+	c.deliveries = copyMap(d.deliveries).(map[int64]delivery)
+
+	// sequences keep counting on rollback
+	c.seq = d.seq
+	return c
+}
+
+// now is the time of a change, truncated to what postgres stores.
+func now() time.Time {
+	return time.Now().Truncate(time.Microsecond)
+}
+
+func copyMap(m interface{}) interface{} {
+	v := reflect.ValueOf(m)
+	c := reflect.MakeMapWithSize(v.Type(), v.Len())
+	for it := v.MapRange(); it.Next(); {
+		c.SetMapIndex(it.Key(), it.Value())
+	}
+	return c.Interface()
+}
+
+// decodeJSON keeps numbers as json.Number, JSON values are stored encoded
+// like postgres does so they come back the same way and are never shared
+// with callers.
+func decodeJSON(raw []byte, v interface{}) error {
+	d := json.NewDecoder(bytes.NewReader(raw))
+	d.UseNumber()
+	return d.Decode(v)
+}
@@ -0,0 +1,248 @@
+package memory
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/raisultan/abac/pkg/resource"
+)
+
+type resourceRow struct {
+	ID         int
+	Type       string
+	ExternalID string
+	OwnerID    *int
+	ParentID   *int
+	Attributes []byte
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+func (s *Storage) UpsertResource(ctx context.Context, res resource.Resource) (resource.Resource, bool, error) {
+	var created bool
+	err := s.WithinTx(ctx, func(ctx context.Context) error {
+		var err error
+		res, created, err = s.upsertResource(res)
+		return err
+	})
+	if err != nil {
+		return resource.Resource{}, false, err
+	}
+
+	return res, created, nil
+}
+
+func (s *Storage) UpsertResources(ctx context.Context, resources []resource.Resource) ([]resource.Resource, error) {
+	saved := make([]resource.Resource, 0, len(resources))
+	err := s.WithinTx(ctx, func(ctx context.Context) error {
+		for i, res := range resources {
+			res, _, err := s.upsertResource(res)
+			if err != nil {
+				return &resource.ItemErr{Index: i, Err: err}
+			}
+			saved = append(saved, res)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return saved, nil
+}
+
+func (s *Storage) upsertResource(res resource.Resource) (resource.Resource, bool, error) {
+	var parentID *int
+	if res.Parent != nil {
+		parent, ok := s.resourceByRef(*res.Parent)
+		if !ok {
+			return res, false, resource.ParentNotFoundErr
+		}
+
+		// the new parent must not be the resource itself or one of its descendants
+		for _, r := range s.resourceChain(parent, resource.MaxDepth) {
+			if r.Type == res.Type && r.ExternalID == res.ExternalID {
+				return res, false, resource.CycleErr
+			}
+		}
+		parentID = &parent.ID
+	}
+
+	if res.OwnerID != nil {
+		if _, ok := s.d.users[*res.OwnerID]; !ok {
+			return res, false, resource.OwnerNotFoundErr
+		}
+	}
+
+	attrs, err := json.Marshal(res.Attributes)
+	if err != nil {
+		return res, false, err
+	}
+
+	t := now()
+	row, ok := s.resourceByRef(res.Ref())
+	if !ok {
+		row = resourceRow{
+			ID:         int(s.next("resources")),
+			Type:       res.Type,
+			ExternalID: res.ExternalID,
+			CreatedAt:  t,
+		}
+	}
+	row.OwnerID = copyInt(res.OwnerID)
+	row.ParentID = parentID
+	row.Attributes = attrs
+	row.UpdatedAt = t
+	s.d.resources[row.ID] = row
+
+	res.ID, res.CreatedAt, res.UpdatedAt = row.ID, row.CreatedAt, row.UpdatedAt
+	return res, !ok, nil
+}
+
+func (s *Storage) GetResource(ctx context.Context, ref resource.Ref) (resource.Resource, error) {
+	unlock, err := s.lock(ctx)
+	if err != nil {
+		return resource.Resource{}, err
+	}
+	defer unlock()
+
+	row, ok := s.resourceByRef(ref)
+	if !ok {
+		return resource.Resource{}, resource.NotFoundErr
+	}
+	return s.resource(row)
+}
+
+func (s *Storage) ListResources(ctx context.Context, lr resource.ListRequest) ([]resource.Resource, error) {
+	unlock, err := s.lock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	rows := []resourceRow{}
+	for _, row := range s.d.resources {
+		if lr.Type != "" && row.Type != lr.Type {
+			continue
+		}
+		if lr.Parent != nil {
+			if row.ParentID == nil {
+				continue
+			}
+			parent := s.d.resources[*row.ParentID]
+			if parent.Type != lr.Parent.Type || parent.ExternalID != lr.Parent.ExternalID {
+				continue
+			}
+		}
+		if lr.OwnerID != nil && (row.OwnerID == nil || *row.OwnerID != *lr.OwnerID) {
+			continue
+		}
+		rows = append(rows, row)
+	}
+	sort.Slice(rows, func(i, j int) bool { return rows[i].ID < rows[j].ID })
+
+	resources := []resource.Resource{}
+	for i := lr.Offset; i < len(rows) && len(resources) < lr.Limit; i++ {
+		res, err := s.resource(rows[i])
+		if err != nil {
+			return nil, err
+		}
+		resources = append(resources, res)
+	}
+
+	return resources, nil
+}
+
+func (s *Storage) DeleteResource(ctx context.Context, ref resource.Ref) error {
+	unlock, err := s.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	row, ok := s.resourceByRef(ref)
+	if !ok {
+		return resource.NotFoundErr
+	}
+	for _, child := range s.d.resources {
+		if child.ParentID != nil && *child.ParentID == row.ID {
+			return resource.HasChildrenErr
+		}
+	}
+
+	delete(s.d.resources, row.ID)
+	return nil
+}
+
+func (s *Storage) GetResourceChain(ctx context.Context, ref resource.Ref, maxDepth int) ([]resource.Resource, error) {
+	unlock, err := s.lock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	row, ok := s.resourceByRef(ref)
+	if !ok {
+		return nil, resource.NotFoundErr
+	}
+
+	chain := []resource.Resource{}
+	for _, r := range s.resourceChain(row, maxDepth) {
+		res, err := s.resource(r)
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, res)
+	}
+	return chain, nil
+}
+
+// resourceChain returns row followed by at most maxDepth of its ancestors.
+func (s *Storage) resourceChain(row resourceRow, maxDepth int) []resourceRow {
+	chain := []resourceRow{row}
+	for depth := 0; depth < maxDepth && row.ParentID != nil; depth++ {
+		row = s.d.resources[*row.ParentID]
+		chain = append(chain, row)
+	}
+	return chain
+}
+
+func (s *Storage) resourceByRef(ref resource.Ref) (resourceRow, bool) {
+	for _, row := range s.d.resources {
+		if row.Type == ref.Type && row.ExternalID == ref.ExternalID {
+			return row, true
+		}
+	}
+	return resourceRow{}, false
+}
+
+func (s *Storage) resource(row resourceRow) (resource.Resource, error) {
+	res := resource.Resource{
+		ID:         row.ID,
+		Type:       row.Type,
+		ExternalID: row.ExternalID,
+		OwnerID:    copyInt(row.OwnerID),
+		Attributes: map[string]interface{}{},
+		CreatedAt:  row.CreatedAt,
+		UpdatedAt:  row.UpdatedAt,
+	}
+	if row.ParentID != nil {
+		parent := s.d.resources[*row.ParentID]
+		res.Parent = &resource.Ref{Type: parent.Type, ExternalID: parent.ExternalID}
+	}
+
+	if err := decodeJSON(row.Attributes, &res.Attributes); err != nil {
+		return resource.Resource{}, err
+	}
+	return res, nil
+}
+
+func copyInt(p *int) *int {
+	if p == nil {
+		return nil
+	}
+	v := *p
+	return &v
+}
@@ -0,0 +1,242 @@
+package memory
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/raisultan/abac/pkg/scim"
+)
+
+// scimValues maps the filterable attributes of a user or group to their
+// values, like the column mappings of the postgres storage.
+type scimValues map[string]interface{}
+
+var scimUserAttrs = []string{"id", "username", "emails", "emails.value", "name.givenname", "name.familyname", "active"}
+
+var scimGroupAttrs = []string{"id", "displayname"}
+
+func (s *Storage) FilterUsers(ctx context.Context, f *scim.Filter, offset, limit int) ([]scim.UserRecord, int, error) {
+	match, err := scimPredicate(f, scimUserAttrs)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	unlock, err := s.lock(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer unlock()
+
+	users := []scim.UserRecord{}
+	for _, u := range s.d.users {
+		if u.deleted() {
+			continue
+		}
+		r := s.userRecord(u)
+		if match(scimValues{
+			"id":              strconv.Itoa(r.ID),
+			"username":        r.Email,
+			"emails":          r.Email,
+			"emails.value":    r.Email,
+			"name.givenname":  r.FirstName,
+			"name.familyname": r.LastName,
+			"active":          r.Active,
+		}) {
+			users = append(users, r)
+		}
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].ID < users[j].ID })
+
+	from, to := page(len(users), offset, limit)
+	return users[from:to], len(users), nil
+}
+
+func (s *Storage) GetUserWithGroups(ctx context.Context, id int) (scim.UserRecord, error) {
+	unlock, err := s.lock(ctx)
+	if err != nil {
+		return scim.UserRecord{}, err
+	}
+	defer unlock()
+
+	u, ok := s.d.users[id]
+	if !ok || u.deleted() {
+		return scim.UserRecord{}, sql.ErrNoRows
+	}
+	return s.userRecord(u), nil
+}
+
+func (s *Storage) SetUserDisabled(ctx context.Context, id int, disabled bool) error {
+	unlock, err := s.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	u, ok := s.d.users[id]
+	if !ok || u.deleted() {
+		return sql.ErrNoRows
+	}
+
+	switch {
+	case !disabled:
+		u.DisabledAt = nil
+	case u.DisabledAt == nil:
+		t := now()
+		u.DisabledAt = &t
+	}
+	s.d.users[id] = u
+	return nil
+}
+
+func (s *Storage) FilterGroups(ctx context.Context, f *scim.Filter, offset, limit int) ([]scim.GroupRecord, int, error) {
+	match, err := scimPredicate(f, scimGroupAttrs)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	unlock, err := s.lock(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer unlock()
+
+	groups := []scim.GroupRecord{}
+	for id, name := range s.d.groups {
+		if match(scimValues{"id": strconv.Itoa(id), "displayname": name}) {
+			groups = append(groups, s.groupRecord(id))
+		}
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].ID < groups[j].ID })
+
+	from, to := page(len(groups), offset, limit)
+	return groups[from:to], len(groups), nil
+}
+
+func (s *Storage) GetGroupWithMembers(ctx context.Context, id int) (scim.GroupRecord, error) {
+	unlock, err := s.lock(ctx)
+	if err != nil {
+		return scim.GroupRecord{}, err
+	}
+	defer unlock()
+
+	if _, ok := s.d.groups[id]; !ok {
+		return scim.GroupRecord{}, sql.ErrNoRows
+	}
+	return s.groupRecord(id), nil
+}
+
+func (s *Storage) userRecord(u user) scim.UserRecord {
+	r := scim.UserRecord{
+		ID:        u.ID,
+		Email:     u.Email,
+		FirstName: u.FirstName,
+		LastName:  u.LastName,
+		Active:    u.DisabledAt == nil,
+	}
+	for _, id := range s.groupsOf(u.ID) {
+		r.Groups = append(r.Groups, scim.GroupRef{ID: id, Name: s.d.groups[id]})
+	}
+	return r
+}
+
+func (s *Storage) groupRecord(id int) scim.GroupRecord {
+	g := scim.GroupRecord{ID: id, Name: s.d.groups[id]}
+	for _, userID := range s.membersOf(id) {
+		g.Members = append(g.Members, scim.MemberRef{ID: userID, Email: s.d.users[userID].Email})
+	}
+	return g
+}
+
+// page returns the bounds of the records after offset, at most limit of
+// them.
+func page(n, offset, limit int) (int, int) {
+	if offset > n {
+		offset = n
+	}
+	if offset+limit < n {
+		return offset, offset + limit
+	}
+	return offset, n
+}
+
+// scimPredicate compiles a SCIM filter over the given attributes, it fails
+// with InvalidFilterErr up front like building the SQL condition does.
+// String comparisons are case-insensitive.
+func scimPredicate(f *scim.Filter, attrs []string) (func(scimValues) bool, error) {
+	if f == nil {
+		return func(scimValues) bool { return true }, nil
+	}
+
+	switch f.Op {
+	case "and", "or":
+		left, err := scimPredicate(f.Left, attrs)
+		if err != nil {
+			return nil, err
+		}
+		right, err := scimPredicate(f.Right, attrs)
+		if err != nil {
+			return nil, err
+		}
+		if f.Op == "and" {
+			return func(v scimValues) bool { return left(v) && right(v) }, nil
+		}
+		return func(v scimValues) bool { return left(v) || right(v) }, nil
+	case "not":
+		inner, err := scimPredicate(f.Left, attrs)
+		if err != nil {
+			return nil, err
+		}
+		return func(v scimValues) bool { return !inner(v) }, nil
+	}
+
+	known := false
+	for _, a := range attrs {
+		known = known || a == f.Attr
+	}
+	if !known {
+		return nil, scim.InvalidFilterErr
+	}
+	attr := f.Attr
+
+	if f.Op == "pr" {
+		return func(v scimValues) bool { return fmt.Sprint(v[attr]) != "" }, nil
+	}
+
+	if b, ok := f.Value.(bool); ok {
+		if f.Op != "eq" && f.Op != "ne" {
+			return nil, scim.InvalidFilterErr
+		}
+		return func(v scimValues) bool { return (v[attr] == b) == (f.Op == "eq") }, nil
+	}
+
+	want := strings.ToLower(fmt.Sprint(f.Value))
+	var cmp func(have string) bool
+	switch f.Op {
+	case "eq":
+		cmp = func(have string) bool { return have == want }
+	case "ne":
+		cmp = func(have string) bool { return have != want }
+	case "gt":
+		cmp = func(have string) bool { return have > want }
+	case "ge":
+		cmp = func(have string) bool { return have >= want }
+	case "lt":
+		cmp = func(have string) bool { return have < want }
+	case "le":
+		cmp = func(have string) bool { return have <= want }
+	case "co":
+		cmp = func(have string) bool { return strings.Contains(have, want) }
+	case "sw":
+		cmp = func(have string) bool { return strings.HasPrefix(have, want) }
+	case "ew":
+		cmp = func(have string) bool { return strings.HasSuffix(have, want) }
+	default:
+		return nil, scim.InvalidFilterErr
+	}
+
+	return func(v scimValues) bool { return cmp(strings.ToLower(fmt.Sprint(v[attr]))) }, nil
+}
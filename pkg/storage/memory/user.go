@@ -0,0 +1,372 @@
+package memory
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/raisultan/abac/pkg/login"
+	"github.com/raisultan/abac/pkg/register"
+	"github.com/raisultan/abac/pkg/retrieve"
+	"github.com/raisultan/abac/pkg/update"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type user struct {
+	ID         int
+	Email      string
+	Password   string
+	FirstName  string
+	LastName   string
+	IsAdmin    bool
+	IsApproved bool
+	Attributes []byte
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+	DisabledAt *time.Time
+	DeletedAt  *time.Time
+	Version    int
+}
+
+func (u user) deleted() bool {
+	return u.DeletedAt != nil
+}
+
+func (s *Storage) CreateUser(ctx context.Context, ru register.UserRegisterRequest) (register.UserRegisterResponse, error) {
+	hashedPasswordStr, err := hashPassword(ru.Password)
+	if err != nil {
+		return register.UserRegisterResponse{}, err
+	}
+
+	unlock, err := s.lock(ctx)
+	if err != nil {
+		return register.UserRegisterResponse{}, err
+	}
+	defer unlock()
+
+	u, err := s.insertUser(ru.Email, hashedPasswordStr, ru.FirstName, ru.LastName)
+	if err != nil {
+		return register.UserRegisterResponse{}, err
+	}
+
+	resp := register.UserRegisterResponse{
+		ID:        u.ID,
+		Email:     u.Email,
+		FirstName: u.FirstName,
+		LastName:  u.LastName,
+	}
+	return resp, nil
+}
+
+func (s *Storage) CheckUserExists(ctx context.Context, ru register.UserRegisterRequest) (bool, error) {
+	unlock, err := s.lock(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer unlock()
+
+	_, ok := s.userByEmail(ru.Email)
+	return ok, nil
+}
+
+// CreatePasswordlessUser creates a user that can only sign in through an
+// external identity provider, an empty hash never matches a bcrypt comparison.
+func (s *Storage) CreatePasswordlessUser(ctx context.Context, email, firstName, lastName string) (int, error) {
+	unlock, err := s.lock(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+
+	u, err := s.insertUser(email, "", firstName, lastName)
+	if err != nil {
+		return 0, err
+	}
+	return u.ID, nil
+}
+
+func (s *Storage) GetUserIDByEmail(ctx context.Context, email string) (int, error) {
+	unlock, err := s.lock(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+
+	u, ok := s.userByEmail(email)
+	if !ok {
+		return 0, sql.ErrNoRows
+	}
+	return u.ID, nil
+}
+
+// IsUserDisabled reports whether the user with the given email has been
+// disabled or deleted, unknown users are not considered disabled.
+func (s *Storage) IsUserDisabled(ctx context.Context, email string) (bool, error) {
+	unlock, err := s.lock(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer unlock()
+
+	u, ok := s.userByEmail(email)
+	return ok && (u.DisabledAt != nil || u.deleted()), nil
+}
+
+func (s *Storage) GetUserByID(ctx context.Context, uID int) (retrieve.UserRetrieveResponse, error) {
+	unlock, err := s.lock(ctx)
+	if err != nil {
+		return retrieve.UserRetrieveResponse{}, err
+	}
+	defer unlock()
+
+	u, ok := s.d.users[uID]
+	if !ok || u.deleted() {
+		return retrieve.UserRetrieveResponse{}, sql.ErrNoRows
+	}
+	return retrieve.UserRetrieveResponse(u.retrieveResponse()), nil
+}
+
+func (s *Storage) FindUserByEmail(ctx context.Context, email string) (retrieve.UserRetrieveResponse, error) {
+	unlock, err := s.lock(ctx)
+	if err != nil {
+		return retrieve.UserRetrieveResponse{}, err
+	}
+	defer unlock()
+
+	u, ok := s.userByEmail(email)
+	if !ok || u.deleted() {
+		return retrieve.UserRetrieveResponse{}, sql.ErrNoRows
+	}
+	return retrieve.UserRetrieveResponse(u.retrieveResponse()), nil
+}
+
+func (s *Storage) GetUserByEmail(ctx context.Context, r login.UserLoginRequest) (login.UserLoginRequest, error) {
+	unlock, err := s.lock(ctx)
+	if err != nil {
+		return login.UserLoginRequest{}, err
+	}
+	defer unlock()
+
+	u, ok := s.userByEmail(r.Email)
+	if !ok || u.deleted() {
+		return login.UserLoginRequest{}, sql.ErrNoRows
+	}
+	return login.UserLoginRequest{Email: u.Email, Password: u.Password}, nil
+}
+
+// UpdateUser changes the fields of r that are set and bumps the version,
+// VersionMismatchErr is only reported for a user that exists.
+func (s *Storage) UpdateUser(ctx context.Context, r update.UserPatchRequest) (update.UserRetrieveResponse, error) {
+	unlock, err := s.lock(ctx)
+	if err != nil {
+		return update.UserRetrieveResponse{}, err
+	}
+	defer unlock()
+
+	u, ok := s.d.users[r.ID]
+	if !ok || u.deleted() {
+		return update.UserRetrieveResponse{}, sql.ErrNoRows
+	}
+	if r.Version != 0 && u.Version != r.Version {
+		return update.UserRetrieveResponse{}, update.VersionMismatchErr
+	}
+
+	if r.FirstName != nil {
+		u.FirstName = *r.FirstName
+	}
+	if r.LastName != nil {
+		u.LastName = *r.LastName
+	}
+	s.touch(&u)
+
+	return u.retrieveResponse(), nil
+}
+
+// ApproveUser approves a user, approving an approved user changes nothing.
+func (s *Storage) ApproveUser(ctx context.Context, id int) (update.UserRetrieveResponse, bool, error) {
+	unlock, err := s.lock(ctx)
+	if err != nil {
+		return update.UserRetrieveResponse{}, false, err
+	}
+	defer unlock()
+
+	u, ok := s.d.users[id]
+	if !ok || u.deleted() {
+		return update.UserRetrieveResponse{}, false, sql.ErrNoRows
+	}
+	if u.IsApproved {
+		return u.retrieveResponse(), false, nil
+	}
+
+	u.IsApproved = true
+	s.touch(&u)
+
+	return u.retrieveResponse(), true, nil
+}
+
+// DeleteUser soft deletes a user, the row is kept until it is purged.
+func (s *Storage) DeleteUser(ctx context.Context, uID int) error {
+	unlock, err := s.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	u, ok := s.d.users[uID]
+	if !ok || u.deleted() {
+		return sql.ErrNoRows
+	}
+
+	t := now()
+	u.DeletedAt = &t
+	s.d.users[uID] = u
+	return nil
+}
+
+func (s *Storage) RestoreUser(ctx context.Context, uID int) error {
+	unlock, err := s.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	u, ok := s.d.users[uID]
+	if !ok || !u.deleted() {
+		return sql.ErrNoRows
+	}
+
+	u.DeletedAt = nil
+	s.d.users[uID] = u
+	return nil
+}
+
+func (s *Storage) PurgeDeletedUsers(ctx context.Context, before time.Time) (int64, error) {
+	unlock, err := s.lock(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+
+	var n int64
+	for id, u := range s.d.users {
+		if u.deleted() && u.DeletedAt.Before(before) {
+			s.removeUser(id)
+			n++
+		}
+	}
+	return n, nil
+}
+
+// SetUserAdmin grants or takes away admin rights. There is no route for it,
+// tests and local setups use it to create their first admin.
+func (s *Storage) SetUserAdmin(ctx context.Context, id int, admin bool) error {
+	unlock, err := s.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	u, ok := s.d.users[id]
+	if !ok || u.deleted() {
+		return sql.ErrNoRows
+	}
+
+	u.IsAdmin = admin
+	s.touch(&u)
+	return nil
+}
+
+// insertUser enforces the unique email like the users table does, deleted
+// users keep their email reserved.
+func (s *Storage) insertUser(email, password, firstName, lastName string) (user, error) {
+	if _, ok := s.userByEmail(email); ok {
+		return user{}, register.ErrDuplicate
+	}
+
+	t := now()
+	u := user{
+		ID:         int(s.next("users")),
+		Email:      email,
+		Password:   password,
+		FirstName:  firstName,
+		LastName:   lastName,
+		Attributes: []byte("{}"),
+		CreatedAt:  t,
+		UpdatedAt:  t,
+		Version:    1,
+	}
+	s.d.users[u.ID] = u
+	return u, nil
+}
+
+// removeUser deletes a user with the rows referring to it, as the foreign
+// keys of the users table do.
+func (s *Storage) removeUser(id int) {
+	delete(s.d.users, id)
+
+	for m := range s.d.memberships {
+		if m.UserID == id {
+			delete(s.d.memberships, m)
+		}
+	}
+	for i, userID := range s.d.identities {
+		if userID == id {
+			delete(s.d.identities, i)
+		}
+	}
+	for credID, c := range s.d.credentials {
+		if c.UserID == id {
+			delete(s.d.credentials, credID)
+		}
+	}
+	for key, c := range s.d.challenges {
+		if c.UserID == id {
+			delete(s.d.challenges, key)
+		}
+	}
+	for resID, r := range s.d.resources {
+		if r.OwnerID != nil && *r.OwnerID == id {
+			r.OwnerID = nil
+			s.d.resources[resID] = r
+		}
+	}
+}
+
+// touch bumps the version of a changed user and stores it.
+func (s *Storage) touch(u *user) {
+	u.Version++
+	u.UpdatedAt = now()
+	s.d.users[u.ID] = *u
+}
+
+func (s *Storage) userByEmail(email string) (user, bool) {
+	for _, u := range s.d.users {
+		if u.Email == email {
+			return u, true
+		}
+	}
+	return user{}, false
+}
+
+func (u user) retrieveResponse() update.UserRetrieveResponse {
+	return update.UserRetrieveResponse{
+		ID:         u.ID,
+		Email:      u.Email,
+		FirstName:  u.FirstName,
+		LastName:   u.LastName,
+		IsAdmin:    u.IsAdmin,
+		IsApproved: u.IsApproved,
+		UpdatedAt:  u.UpdatedAt,
+		Version:    u.Version,
+	}
+}
+
+// hashPassword uses the lowest cost, the store only lives as long as a test
+// or a local run.
+func hashPassword(password string) (string, error) {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hashedPassword), nil
+}
@@ -0,0 +1,143 @@
+package memory
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"sort"
+
+	"github.com/raisultan/abac/pkg/webauthn"
+)
+
+var errDuplicateCredential = errors.New("Credential already registered")
+
+type credential struct {
+	ID           int
+	UserID       int
+	CredentialID []byte
+	PublicKey    []byte
+	SignCount    uint32
+}
+
+type challenge webauthn.Challenge
+
+func (s *Storage) SaveChallenge(ctx context.Context, c webauthn.Challenge) error {
+	unlock, err := s.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	// expired challenges are cleaned up whenever a new one is issued
+	t := now()
+	for key, old := range s.d.challenges {
+		if old.ExpiresAt.Before(t) {
+			delete(s.d.challenges, key)
+		}
+	}
+
+	s.d.challenges[c.Challenge] = challenge(c)
+	return nil
+}
+
+func (s *Storage) ConsumeChallenge(ctx context.Context, key string) (webauthn.Challenge, error) {
+	unlock, err := s.lock(ctx)
+	if err != nil {
+		return webauthn.Challenge{}, err
+	}
+	defer unlock()
+
+	c, ok := s.d.challenges[key]
+	if !ok {
+		return webauthn.Challenge{}, sql.ErrNoRows
+	}
+	delete(s.d.challenges, key)
+
+	return webauthn.Challenge(c), nil
+}
+
+func (s *Storage) CreateCredential(ctx context.Context, c webauthn.Credential) (int, error) {
+	unlock, err := s.lock(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+
+	if _, ok := s.d.users[c.UserID]; !ok {
+		return 0, sql.ErrNoRows
+	}
+	for _, other := range s.d.credentials {
+		if bytes.Equal(other.CredentialID, c.CredentialID) {
+			return 0, errDuplicateCredential
+		}
+	}
+
+	cred := credential{
+		ID:           int(s.next("webauthn_credentials")),
+		UserID:       c.UserID,
+		CredentialID: append([]byte{}, c.CredentialID...),
+		PublicKey:    append([]byte{}, c.PublicKey...),
+		SignCount:    c.SignCount,
+	}
+	s.d.credentials[cred.ID] = cred
+	return cred.ID, nil
+}
+
+func (s *Storage) GetCredentialsByUserID(ctx context.Context, userID int) ([]webauthn.Credential, error) {
+	unlock, err := s.lock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	creds := []webauthn.Credential{}
+	for _, c := range s.d.credentials {
+		if c.UserID == userID {
+			creds = append(creds, s.credential(c))
+		}
+	}
+	sort.Slice(creds, func(i, j int) bool { return creds[i].ID < creds[j].ID })
+
+	return creds, nil
+}
+
+func (s *Storage) GetCredentialByCredentialID(ctx context.Context, credentialID []byte) (webauthn.Credential, error) {
+	unlock, err := s.lock(ctx)
+	if err != nil {
+		return webauthn.Credential{}, err
+	}
+	defer unlock()
+
+	for _, c := range s.d.credentials {
+		if bytes.Equal(c.CredentialID, credentialID) {
+			return s.credential(c), nil
+		}
+	}
+	return webauthn.Credential{}, sql.ErrNoRows
+}
+
+func (s *Storage) UpdateCredentialSignCount(ctx context.Context, id int, signCount uint32) error {
+	unlock, err := s.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if c, ok := s.d.credentials[id]; ok {
+		c.SignCount = signCount
+		s.d.credentials[id] = c
+	}
+	return nil
+}
+
+func (s *Storage) credential(c credential) webauthn.Credential {
+	return webauthn.Credential{
+		ID:           c.ID,
+		UserID:       c.UserID,
+		Email:        s.d.users[c.UserID].Email,
+		CredentialID: append([]byte{}, c.CredentialID...),
+		PublicKey:    append([]byte{}, c.PublicKey...),
+		SignCount:    c.SignCount,
+	}
+}
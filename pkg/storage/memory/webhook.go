@@ -0,0 +1,302 @@
+package memory
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"time"
+
+	"github.com/raisultan/abac/pkg/event"
+	"github.com/raisultan/abac/pkg/webhook"
+)
+
+type subscription struct {
+	webhook.Subscription
+}
+
+type delivery struct {
+	webhook.Delivery
+}
+
+func (s *Storage) ListSubscriptions(ctx context.Context) ([]webhook.Subscription, error) {
+	unlock, err := s.lock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	subs := []webhook.Subscription{}
+	for _, sub := range s.d.subscriptions {
+		subs = append(subs, sub.public())
+	}
+	sort.Slice(subs, func(i, j int) bool { return subs[i].ID < subs[j].ID })
+
+	return subs, nil
+}
+
+func (s *Storage) GetSubscription(ctx context.Context, id int) (webhook.Subscription, error) {
+	unlock, err := s.lock(ctx)
+	if err != nil {
+		return webhook.Subscription{}, err
+	}
+	defer unlock()
+
+	sub, ok := s.d.subscriptions[id]
+	if !ok {
+		return webhook.Subscription{}, webhook.NotFoundErr
+	}
+	return sub.public(), nil
+}
+
+func (s *Storage) CreateSubscription(ctx context.Context, sub webhook.Subscription) (webhook.Subscription, error) {
+	unlock, err := s.lock(ctx)
+	if err != nil {
+		return webhook.Subscription{}, err
+	}
+	defer unlock()
+
+	sub.ID = int(s.next("webhook_subscriptions"))
+	sub.EventTypes = append([]string{}, sub.EventTypes...)
+	sub.CreatedAt = now()
+	s.d.subscriptions[sub.ID] = subscription{sub}
+
+	return s.d.subscriptions[sub.ID].public(), nil
+}
+
+func (s *Storage) UpdateSubscription(ctx context.Context, sub webhook.Subscription) (webhook.Subscription, error) {
+	unlock, err := s.lock(ctx)
+	if err != nil {
+		return webhook.Subscription{}, err
+	}
+	defer unlock()
+
+	stored, ok := s.d.subscriptions[sub.ID]
+	if !ok {
+		return webhook.Subscription{}, webhook.NotFoundErr
+	}
+
+	stored.URL = sub.URL
+	stored.EventTypes = append([]string{}, sub.EventTypes...)
+	stored.Active = sub.Active
+	s.d.subscriptions[sub.ID] = stored
+
+	return stored.public(), nil
+}
+
+func (s *Storage) DeleteSubscription(ctx context.Context, id int) error {
+	unlock, err := s.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if _, ok := s.d.subscriptions[id]; !ok {
+		return webhook.NotFoundErr
+	}
+
+	delete(s.d.subscriptions, id)
+	for deliveryID, d := range s.d.deliveries {
+		if d.SubscriptionID == id {
+			delete(s.d.deliveries, deliveryID)
+		}
+	}
+	return nil
+}
+
+func (s *Storage) EnqueueDeliveries(ctx context.Context, e event.Event, payload []byte) error {
+	unlock, err := s.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	queued := map[int]bool{}
+	for _, d := range s.d.deliveries {
+		if d.EventID == e.ID {
+			queued[d.SubscriptionID] = true
+		}
+	}
+
+	for _, sub := range s.d.subscriptions {
+		if !sub.Active || !sub.subscribed(e.Type) || queued[sub.ID] {
+			continue
+		}
+
+		t := now()
+		d := webhook.Delivery{
+			ID:             s.next("webhook_deliveries"),
+			SubscriptionID: sub.ID,
+			EventID:        e.ID,
+			EventType:      e.Type,
+			Payload:        append([]byte{}, payload...),
+			Status:         webhook.Pending,
+			NextAttemptAt:  &t,
+			CreatedAt:      t,
+		}
+		s.d.deliveries[d.ID] = delivery{d}
+	}
+	return nil
+}
+
+// ClaimDeliveries pushes the due time of the claimed deliveries past the
+// lease, deliveries to inactive subscriptions wait until they are active.
+func (s *Storage) ClaimDeliveries(ctx context.Context, limit int, lease time.Duration) ([]webhook.Delivery, error) {
+	unlock, err := s.lock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	t := now()
+	due := []delivery{}
+	for _, d := range s.d.deliveries {
+		if d.Status == webhook.Pending && d.NextAttemptAt != nil && !d.NextAttemptAt.After(t) &&
+			s.d.subscriptions[d.SubscriptionID].Active {
+			due = append(due, d)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool { return due[i].ID < due[j].ID })
+	if len(due) > limit {
+		due = due[:limit]
+	}
+
+	deliveries := []webhook.Delivery{}
+	for _, d := range due {
+		next := t.Add(lease)
+		d.NextAttemptAt = &next
+		s.d.deliveries[d.ID] = d
+
+		claimed := d.public()
+		sub := s.d.subscriptions[d.SubscriptionID]
+		claimed.URL, claimed.Secret = sub.URL, sub.Secret
+		deliveries = append(deliveries, claimed)
+	}
+
+	return deliveries, nil
+}
+
+func (s *Storage) RecordAttempt(ctx context.Context, a webhook.Attempt) error {
+	unlock, err := s.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	d, ok := s.d.deliveries[a.DeliveryID]
+	if !ok {
+		return sql.ErrNoRows
+	}
+
+	d.Status = a.Status
+	d.Attempts++
+	d.NextAttemptAt = nil
+	if a.Status == webhook.Pending {
+		next := a.NextAttemptAt
+		d.NextAttemptAt = &next
+	}
+	d.LastStatusCode = nil
+	if a.StatusCode != 0 {
+		code := a.StatusCode
+		d.LastStatusCode = &code
+	}
+	d.LastError = nil
+	if a.Error != "" {
+		reason := a.Error
+		d.LastError = &reason
+	}
+	if a.Status == webhook.Succeeded {
+		t := now()
+		d.DeliveredAt = &t
+	}
+	s.d.deliveries[d.ID] = d
+	return nil
+}
+
+// ListDeliveries returns the deliveries of a subscription, newest first.
+func (s *Storage) ListDeliveries(ctx context.Context, lr webhook.DeliveryListRequest) ([]webhook.Delivery, error) {
+	unlock, err := s.lock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	deliveries := []webhook.Delivery{}
+	for _, d := range s.d.deliveries {
+		if d.SubscriptionID != lr.SubscriptionID ||
+			lr.Status != "" && d.Status != lr.Status ||
+			lr.Before > 0 && d.ID >= lr.Before {
+			continue
+		}
+		deliveries = append(deliveries, d.public())
+	}
+	sort.Slice(deliveries, func(i, j int) bool { return deliveries[i].ID > deliveries[j].ID })
+	if len(deliveries) > lr.Limit {
+		deliveries = deliveries[:lr.Limit]
+	}
+
+	return deliveries, nil
+}
+
+// RedeliverDelivery makes a delivery due now with a fresh set of attempts.
+func (s *Storage) RedeliverDelivery(ctx context.Context, subscriptionID int, id int64) (webhook.Delivery, error) {
+	unlock, err := s.lock(ctx)
+	if err != nil {
+		return webhook.Delivery{}, err
+	}
+	defer unlock()
+
+	d, ok := s.d.deliveries[id]
+	if !ok || d.SubscriptionID != subscriptionID {
+		return webhook.Delivery{}, webhook.DeliveryNotFoundErr
+	}
+
+	t := now()
+	d.Status = webhook.Pending
+	d.Attempts = 0
+	d.NextAttemptAt = &t
+	s.d.deliveries[id] = d
+
+	return d.public(), nil
+}
+
+func (s *Storage) PurgeDeliveries(ctx context.Context, before time.Time) (int64, error) {
+	unlock, err := s.lock(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+
+	var n int64
+	for id, d := range s.d.deliveries {
+		if d.Status == webhook.Succeeded && d.DeliveredAt != nil && d.DeliveredAt.Before(before) {
+			delete(s.d.deliveries, id)
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (sub subscription) subscribed(typ string) bool {
+	for _, t := range sub.EventTypes {
+		if t == typ {
+			return true
+		}
+	}
+	return false
+}
+
+// public returns a copy of the subscription without its secret.
+func (sub subscription) public() webhook.Subscription {
+	c := sub.Subscription
+	c.EventTypes = append([]string{}, sub.EventTypes...)
+	c.Secret = ""
+	return c
+}
+
+// public returns a copy of the delivery without the target of a claim.
+func (d delivery) public() webhook.Delivery {
+	c := d.Delivery
+	c.Payload = append([]byte{}, d.Payload...)
+	c.URL, c.Secret = "", ""
+	return c
+}
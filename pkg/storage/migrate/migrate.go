@@ -0,0 +1,268 @@
+// Package migrate applies the SQL migrations a storage backend embeds. The
+// version is kept in a schema_migrations table laid out like the one of
+// the migrate CLI, so databases it migrated carry on where it stopped.
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+)
+
+var (
+	DirtyErr          = errors.New("Database is dirty, a migration failed halfway and has to be fixed by hand")
+	UnknownVersionErr = errors.New("Unknown migration version")
+)
+
+var fileName = regexp.MustCompile(`^(\d+)_(.+)\.(up|down)\.sql$`)
+
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Status is the version of the database and whether each migration is
+// applied.
+type Status struct {
+	Version    int               `json:"version"`
+	Dirty      bool              `json:"dirty"`
+	Migrations []MigrationStatus `json:"migrations"`
+}
+
+type MigrationStatus struct {
+	Version int    `json:"version"`
+	Name    string `json:"name"`
+	Applied bool   `json:"applied"`
+}
+
+// Locker keeps other processes from migrating the same database, it holds
+// a lock for as long as the connection it is given.
+type Locker interface {
+	Lock(ctx context.Context, conn *sql.Conn) error
+	Unlock(ctx context.Context, conn *sql.Conn) error
+}
+
+type Migrator struct {
+	db         *sql.DB
+	migrations []Migration
+	locker     Locker
+}
+
+// Load reads the migrations in dir of fsys, named like
+// 1_add_users_table.up.sql and 1_add_users_table.down.sql.
+func Load(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int]*Migration{}
+	for _, e := range entries {
+		m := fileName.FindStringSubmatch(e.Name())
+		if m == nil {
+			continue
+		}
+
+		v, err := strconv.Atoi(m[1])
+		if err != nil {
+			return nil, fmt.Errorf("migration %s: %w", e.Name(), err)
+		}
+		script, err := fs.ReadFile(fsys, path.Join(dir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		mig, ok := byVersion[v]
+		if !ok {
+			mig = &Migration{Version: v, Name: m[2]}
+			byVersion[v] = mig
+		}
+		if m[3] == "up" {
+			mig.Up = string(script)
+		} else {
+			mig.Down = string(script)
+		}
+	}
+
+	migrations := []Migration{}
+	for _, m := range byVersion {
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+
+	return migrations, nil
+}
+
+// New returns a migrator of db, locker may be nil when the database can
+// not be shared.
+func New(db *sql.DB, migrations []Migration, locker Locker) *Migrator {
+	return &Migrator{db, migrations, locker}
+}
+
+// Up applies every migration that is not applied yet.
+func (m *Migrator) Up(ctx context.Context) error {
+	if len(m.migrations) == 0 {
+		return nil
+	}
+	return m.run(ctx, true, func(ctx context.Context, conn *sql.Conn, version int, dirty bool) error {
+		return m.migrate(ctx, conn, version, m.migrations[len(m.migrations)-1].Version)
+	})
+}
+
+// Down reverts the last applied migration.
+func (m *Migrator) Down(ctx context.Context) error {
+	return m.run(ctx, true, func(ctx context.Context, conn *sql.Conn, version int, dirty bool) error {
+		if version == 0 {
+			return nil
+		}
+		i := m.index(version)
+		if i < 0 {
+			return fmt.Errorf("%w: %d", UnknownVersionErr, version)
+		}
+		return m.migrate(ctx, conn, version, m.previous(i))
+	})
+}
+
+// Goto migrates up or down to version, 0 reverts every migration.
+func (m *Migrator) Goto(ctx context.Context, version int) error {
+	if version != 0 && m.index(version) < 0 {
+		return fmt.Errorf("%w: %d", UnknownVersionErr, version)
+	}
+	return m.run(ctx, true, func(ctx context.Context, conn *sql.Conn, current int, dirty bool) error {
+		return m.migrate(ctx, conn, current, version)
+	})
+}
+
+func (m *Migrator) Status(ctx context.Context) (Status, error) {
+	s := Status{Migrations: []MigrationStatus{}}
+	err := m.run(ctx, false, func(ctx context.Context, conn *sql.Conn, version int, dirty bool) error {
+		s.Version, s.Dirty = version, dirty
+		return nil
+	})
+	if err != nil {
+		return Status{}, err
+	}
+
+	for _, mig := range m.migrations {
+		s.Migrations = append(s.Migrations, MigrationStatus{
+			Version: mig.Version,
+			Name:    mig.Name,
+			Applied: mig.Version <= s.Version,
+		})
+	}
+	return s, nil
+}
+
+// run calls fn with the current version, holding the lock on a connection
+// of its own. Changes are refused while the database is dirty.
+func (m *Migrator) run(ctx context.Context, write bool, fn func(ctx context.Context, conn *sql.Conn, version int, dirty bool) error) error {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if m.locker != nil {
+		if err := m.locker.Lock(ctx, conn); err != nil {
+			return err
+		}
+		defer m.locker.Unlock(context.Background(), conn)
+	}
+
+	_, err = conn.ExecContext(
+		ctx,
+		"CREATE TABLE IF NOT EXISTS schema_migrations (version BIGINT NOT NULL PRIMARY KEY, dirty BOOLEAN NOT NULL)",
+	)
+	if err != nil {
+		return err
+	}
+
+	var version int
+	var dirty bool
+	err = conn.QueryRowContext(ctx, "SELECT version, dirty FROM schema_migrations LIMIT 1").Scan(&version, &dirty)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+	if dirty && write {
+		return fmt.Errorf("%w: version %d", DirtyErr, version)
+	}
+
+	return fn(ctx, conn, version, dirty)
+}
+
+// migrate applies the up or down scripts between the from and to versions,
+// each in a transaction of its own together with the version it leaves.
+func (m *Migrator) migrate(ctx context.Context, conn *sql.Conn, from, to int) error {
+	if to > from {
+		for _, mig := range m.migrations {
+			if mig.Version <= from || mig.Version > to {
+				continue
+			}
+			if err := m.apply(ctx, conn, mig.Up, mig.Version); err != nil {
+				return fmt.Errorf("migration %d_%s up: %w", mig.Version, mig.Name, err)
+			}
+			log.Printf("applied migration %d_%s", mig.Version, mig.Name)
+		}
+		return nil
+	}
+
+	for i := len(m.migrations) - 1; i >= 0; i-- {
+		mig := m.migrations[i]
+		if mig.Version > from || mig.Version <= to {
+			continue
+		}
+		if err := m.apply(ctx, conn, mig.Down, m.previous(i)); err != nil {
+			return fmt.Errorf("migration %d_%s down: %w", mig.Version, mig.Name, err)
+		}
+		log.Printf("reverted migration %d_%s", mig.Version, mig.Name)
+	}
+	return nil
+}
+
+func (m *Migrator) apply(ctx context.Context, conn *sql.Conn, script string, version int) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, script); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM schema_migrations"); err != nil {
+		return err
+	}
+	if version > 0 {
+		if _, err := tx.ExecContext(ctx, "INSERT INTO schema_migrations(version, dirty) VALUES($1, FALSE)", version); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// index returns the position of version in the migrations, or -1.
+func (m *Migrator) index(version int) int {
+	for i, mig := range m.migrations {
+		if mig.Version == version {
+			return i
+		}
+	}
+	return -1
+}
+
+// previous is the version left by reverting the migration at i.
+func (m *Migrator) previous(i int) int {
+	if i == 0 {
+		return 0
+	}
+	return m.migrations[i-1].Version
+}
@@ -0,0 +1,162 @@
+package postgres
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+
+	"github.com/lib/pq"
+	"github.com/raisultan/abac/pkg/attribute"
+)
+
+func (s *Storage) ListAttributeDefinitions(ctx context.Context) ([]attribute.Definition, error) {
+	rows, err := s.conn(ctx).QueryContext(
+		ctx,
+		"SELECT name, type, required, defaultValue, allowedValues, description FROM attribute_definitions ORDER BY name",
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	defs := []attribute.Definition{}
+	for rows.Next() {
+		var d attribute.Definition
+		var def []byte
+		if err := rows.Scan(&d.Name, &d.Type, &d.Required, &def, pq.Array(&d.Values), &d.Description); err != nil {
+			return nil, err
+		}
+		if def != nil {
+			if err := decodeJSON(def, &d.Default); err != nil {
+				return nil, err
+			}
+		}
+		defs = append(defs, d)
+	}
+
+	return defs, rows.Err()
+}
+
+func (s *Storage) SaveAttributeDefinition(ctx context.Context, d attribute.Definition) error {
+	// JSON is passed as a string, lib/pq would encode a []byte as bytea
+	var def *string
+	if d.Default != nil {
+		b, err := json.Marshal(d.Default)
+		if err != nil {
+			return err
+		}
+		str := string(b)
+		def = &str
+	}
+
+	_, err := s.conn(ctx).ExecContext(
+		ctx,
+		`INSERT INTO attribute_definitions(name, type, required, defaultValue, allowedValues, description)
+		VALUES($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (name) DO UPDATE SET
+			type=EXCLUDED.type,
+			required=EXCLUDED.required,
+			defaultValue=EXCLUDED.defaultValue,
+			allowedValues=EXCLUDED.allowedValues,
+			description=EXCLUDED.description`,
+		d.Name,
+		d.Type,
+		d.Required,
+		def,
+		pq.Array(d.Values),
+		d.Description,
+	)
+	return err
+}
+
+// DeleteAttributeDefinition removes the definition together with the values
+// users have for it.
+func (s *Storage) DeleteAttributeDefinition(ctx context.Context, name string) error {
+	return s.WithinTx(ctx, func(ctx context.Context) error {
+		if err := s.execOne(ctx, "DELETE FROM attribute_definitions WHERE name=$1", name); err != nil {
+			return err
+		}
+
+		_, err := s.conn(ctx).ExecContext(
+			ctx,
+			"UPDATE users SET attributes = attributes - $1 WHERE attributes ? $1",
+			name,
+		)
+		return err
+	})
+}
+
+func (s *Storage) GetUserAttributes(ctx context.Context, userID int) (map[string]interface{}, error) {
+	return s.getUserAttributes(ctx, "SELECT attributes FROM users WHERE id=$1 AND deletedAt IS NULL", userID)
+}
+
+// GetUserAttributesForUpdate locks the user row until the transaction ends.
+func (s *Storage) GetUserAttributesForUpdate(ctx context.Context, userID int) (map[string]interface{}, error) {
+	return s.getUserAttributes(ctx, "SELECT attributes FROM users WHERE id=$1 AND deletedAt IS NULL FOR UPDATE", userID)
+}
+
+func (s *Storage) getUserAttributes(ctx context.Context, query string, userID int) (map[string]interface{}, error) {
+	var raw []byte
+	err := s.conn(ctx).QueryRowContext(ctx, query, userID).Scan(&raw)
+	if err != nil {
+		return nil, err
+	}
+
+	attrs := map[string]interface{}{}
+	if err := decodeJSON(raw, &attrs); err != nil {
+		return nil, err
+	}
+	return attrs, nil
+}
+
+func (s *Storage) SetUserAttributes(ctx context.Context, userID int, attrs map[string]interface{}) error {
+	raw, err := json.Marshal(attrs)
+	if err != nil {
+		return err
+	}
+
+	return s.execOne(
+		ctx,
+		`UPDATE users SET attributes=$1, version=version+1, updatedAt=NOW()
+		WHERE id=$2 AND deletedAt IS NULL`,
+		string(raw),
+		userID,
+	)
+}
+
+func (s *Storage) GetSubject(ctx context.Context, email string) (attribute.Subject, error) {
+	sub := attribute.Subject{}
+	var raw []byte
+	err := s.conn(ctx).QueryRowContext(
+		ctx,
+		`SELECT id, email, firstName, lastName, isAdmin, isApproved, attributes
+		FROM users WHERE email=$1 AND deletedAt IS NULL`,
+		email,
+	).Scan(&sub.ID, &sub.Email, &sub.FirstName, &sub.LastName, &sub.IsAdmin, &sub.IsApproved, &raw)
+	if err != nil {
+		return attribute.Subject{}, err
+	}
+
+	sub.Attributes = map[string]interface{}{}
+	if err := decodeJSON(raw, &sub.Attributes); err != nil {
+		return attribute.Subject{}, err
+	}
+
+	groups, err := s.userGroups(ctx, []int{sub.ID})
+	if err != nil {
+		return attribute.Subject{}, err
+	}
+	sub.Groups = []string{}
+	for _, g := range groups[sub.ID] {
+		sub.Groups = append(sub.Groups, g.Name)
+	}
+
+	return sub, nil
+}
+
+// decodeJSON keeps numbers as json.Number so integers survive the round trip.
+func decodeJSON(raw []byte, v interface{}) error {
+	d := json.NewDecoder(bytes.NewReader(raw))
+	d.UseNumber()
+	return d.Decode(v)
+}
@@ -0,0 +1,224 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/raisultan/abac/pkg/audit"
+)
+
+// auditChainLock is the advisory lock serializing appends to the audit chain.
+const auditChainLock = 7283901
+
+const auditEventColumns = `id, occurredAt, type, actor, subject, action, resource, result,
+	remoteAddr, details, prevHash, hash`
+
+func (s *Storage) AppendAuditEvent(ctx context.Context, e audit.Event) error {
+	if e.Details == nil {
+		e.Details = map[string]interface{}{}
+	}
+	details, err := json.Marshal(e.Details)
+	if err != nil {
+		return err
+	}
+
+	return s.WithinTx(ctx, func(ctx context.Context) error {
+		return s.appendAuditEvent(ctx, e, details)
+	})
+}
+
+func (s *Storage) appendAuditEvent(ctx context.Context, e audit.Event, details []byte) error {
+	q := s.conn(ctx)
+	if _, err := q.ExecContext(ctx, "SELECT pg_advisory_xact_lock($1)", auditChainLock); err != nil {
+		return err
+	}
+
+	var prev []byte
+	err := q.QueryRowContext(ctx, "SELECT hash FROM audit_events ORDER BY id DESC LIMIT 1").Scan(&prev)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+
+	err = q.QueryRowContext(ctx, "SELECT nextval(pg_get_serial_sequence('audit_events', 'id'))").Scan(&e.ID)
+	if err != nil {
+		return err
+	}
+	e.Time = e.Time.UTC().Truncate(time.Microsecond)
+	e.PrevHash = prev
+	e.Hash = audit.HashEvent(prev, e)
+
+	_, err = q.ExecContext(
+		ctx,
+		`INSERT INTO audit_events(`+auditEventColumns+`)
+		VALUES($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)`,
+		e.ID,
+		e.Time,
+		e.Type,
+		e.Actor,
+		e.Subject,
+		e.Action,
+		e.Resource,
+		e.Result,
+		e.RemoteAddr,
+		string(details),
+		[]byte(e.PrevHash),
+		[]byte(e.Hash),
+	)
+	return err
+}
+
+// ListAuditEvents returns matching events, newest first.
+func (s *Storage) ListAuditEvents(ctx context.Context, lr audit.ListRequest) ([]audit.Event, error) {
+	conds := []string{"TRUE"}
+	args := []interface{}{}
+
+	add := func(cond string, arg interface{}) {
+		args = append(args, arg)
+		conds = append(conds, fmt.Sprintf(cond, len(args)))
+	}
+
+	if lr.Type != "" {
+		add("type = $%d", lr.Type)
+	}
+	if lr.Actor != "" {
+		add("actor = $%d", lr.Actor)
+	}
+	if lr.Subject != "" {
+		add("subject = $%d", lr.Subject)
+	}
+	if lr.Resource != "" {
+		add("resource = $%d", lr.Resource)
+	}
+	if lr.Result != "" {
+		add("result = $%d", lr.Result)
+	}
+	if lr.From != nil {
+		add("occurredAt >= $%d", *lr.From)
+	}
+	if lr.To != nil {
+		add("occurredAt < $%d", *lr.To)
+	}
+	if lr.Before > 0 {
+		add("id < $%d", lr.Before)
+	}
+
+	args = append(args, lr.Limit)
+	return s.queryAuditEvents(
+		ctx,
+		fmt.Sprintf(
+			"SELECT "+auditEventColumns+" FROM audit_events WHERE %s ORDER BY id DESC LIMIT $%d",
+			strings.Join(conds, " AND "), len(args),
+		),
+		args...,
+	)
+}
+
+// ListAuditEventsAfter returns events in chain order starting after afterID.
+func (s *Storage) ListAuditEventsAfter(ctx context.Context, afterID int64, limit int) ([]audit.Event, error) {
+	return s.queryAuditEvents(
+		ctx,
+		"SELECT "+auditEventColumns+" FROM audit_events WHERE id > $1 ORDER BY id LIMIT $2",
+		afterID,
+		limit,
+	)
+}
+
+func (s *Storage) LastAuditEvent(ctx context.Context) (audit.Event, error) {
+	return scanAuditEvent(s.conn(ctx).QueryRowContext(
+		ctx,
+		"SELECT "+auditEventColumns+" FROM audit_events ORDER BY id DESC LIMIT 1",
+	))
+}
+
+// AuditChainStart returns the first ID the chaining migration left to be
+// hashed. Without the row every event has to be chained.
+func (s *Storage) AuditChainStart(ctx context.Context) (int64, error) {
+	var start int64
+	err := s.conn(ctx).QueryRowContext(ctx, "SELECT startEventId FROM audit_chain").Scan(&start)
+	if err == sql.ErrNoRows {
+		return 1, nil
+	}
+	return start, err
+}
+
+func (s *Storage) CreateAuditCheckpoint(ctx context.Context, c audit.Checkpoint) error {
+	_, err := s.conn(ctx).ExecContext(
+		ctx,
+		"INSERT INTO audit_checkpoints(lastEventId, hash, signature) VALUES($1, $2, $3)",
+		c.LastEventID,
+		[]byte(c.Hash),
+		[]byte(c.Signature),
+	)
+	return err
+}
+
+func (s *Storage) ListAuditCheckpoints(ctx context.Context) ([]audit.Checkpoint, error) {
+	rows, err := s.conn(ctx).QueryContext(ctx, "SELECT id, lastEventId, hash, signature, createdAt FROM audit_checkpoints ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	checkpoints := []audit.Checkpoint{}
+	for rows.Next() {
+		var c audit.Checkpoint
+		if err := rows.Scan(&c.ID, &c.LastEventID, &c.Hash, &c.Signature, &c.CreatedAt); err != nil {
+			return nil, err
+		}
+		checkpoints = append(checkpoints, c)
+	}
+
+	return checkpoints, rows.Err()
+}
+
+func (s *Storage) queryAuditEvents(ctx context.Context, query string, args ...interface{}) ([]audit.Event, error) {
+	rows, err := s.conn(ctx).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []audit.Event{}
+	for rows.Next() {
+		e, err := scanAuditEvent(rows)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+
+	return events, rows.Err()
+}
+
+func scanAuditEvent(row scanner) (audit.Event, error) {
+	var e audit.Event
+	var details, prevHash, hash []byte
+	err := row.Scan(
+		&e.ID,
+		&e.Time,
+		&e.Type,
+		&e.Actor,
+		&e.Subject,
+		&e.Action,
+		&e.Resource,
+		&e.Result,
+		&e.RemoteAddr,
+		&details,
+		&prevHash,
+		&hash,
+	)
+	if err != nil {
+		return audit.Event{}, err
+	}
+
+	if err := decodeJSON(details, &e.Details); err != nil {
+		return audit.Event{}, err
+	}
+	e.PrevHash, e.Hash = prevHash, hash
+
+	return e, nil
+}
@@ -0,0 +1,99 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/raisultan/abac/pkg/bulk"
+)
+
+var errDryRun = errors.New("dry run")
+
+// UpsertUsers imports rows in a single transaction which is rolled back on
+// a dry run, so it reports exactly what a real import would do. Rows of
+// deleted users fail with DeletedUserErr. Passwords
+// are only changed for existing users when the row has one.
+func (s *Storage) UpsertUsers(ctx context.Context, rows []bulk.ImportRow, dryRun bool) ([]bulk.ImportedUser, error) {
+	var users []bulk.ImportedUser
+	err := s.WithinTx(ctx, func(ctx context.Context) error {
+		return s.upsertUsers(ctx, rows, dryRun, &users)
+	})
+	if err == errDryRun {
+		err = nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
+
+func (s *Storage) upsertUsers(ctx context.Context, rows []bulk.ImportRow, dryRun bool, users *[]bulk.ImportedUser) error {
+	for _, row := range rows {
+		var err error
+		hash := ""
+		if row.Password != "" && !dryRun {
+			if hash, err = s.hashPassword(row.Password); err != nil {
+				return err
+			}
+		}
+
+		u := bulk.ImportedUser{Email: row.Email, FirstName: row.FirstName, LastName: row.LastName}
+		err = s.conn(ctx).QueryRowContext(
+			ctx,
+			`INSERT INTO users(email, password, firstName, lastName) VALUES($1, $2, $3, $4)
+			ON CONFLICT (email) DO UPDATE SET
+				firstName=EXCLUDED.firstName,
+				lastName=EXCLUDED.lastName,
+				password=CASE WHEN $2 <> '' THEN EXCLUDED.password ELSE users.password END,
+				version=users.version+1,
+				updatedAt=NOW()
+			WHERE users.deletedAt IS NULL
+			RETURNING id, xmax = 0`,
+			row.Email,
+			hash,
+			row.FirstName,
+			row.LastName,
+		).Scan(&u.ID, &u.Created)
+
+		if err == sql.ErrNoRows {
+			return &bulk.RowErr{Line: row.Line, Err: bulk.DeletedUserErr}
+		}
+		if err != nil {
+			return err
+		}
+
+		*users = append(*users, u)
+	}
+
+	// a dry run rolls the transaction back
+	if dryRun {
+		return errDryRun
+	}
+	return nil
+}
+
+func (s *Storage) ExportUsers(ctx context.Context, fn func(bulk.ExportRow) error) error {
+	rows, err := s.conn(ctx).QueryContext(
+		ctx,
+		`SELECT id, email, firstName, lastName, isAdmin, isApproved, createdAt
+		FROM users WHERE deletedAt IS NULL ORDER BY id`,
+	)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var u bulk.ExportRow
+		if err := rows.Scan(&u.ID, &u.Email, &u.FirstName, &u.LastName, &u.IsAdmin, &u.IsApproved, &u.CreatedAt); err != nil {
+			return err
+		}
+		if err := fn(u); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
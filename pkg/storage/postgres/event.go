@@ -0,0 +1,179 @@
+package postgres
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/raisultan/abac/pkg/event"
+)
+
+const outboxColumns = "id, type, subject, occurredAt, data, attempts, publishedTo"
+
+// eventsChannel is notified of every event appended to the outbox once its
+// transaction commits.
+const eventsChannel = "abac_events"
+
+// notification is the payload sent on eventsChannel, the data of an event
+// may not fit into one.
+type notification struct {
+	Type    string `json:"type"`
+	Subject string `json:"subject"`
+}
+
+// AppendEvent stores e in the outbox, within the transaction of the change
+// it describes when ctx carries one.
+func (s *Storage) AppendEvent(ctx context.Context, e event.Event) error {
+	data, err := json.Marshal(e.Data)
+	if err != nil {
+		return err
+	}
+	payload, err := json.Marshal(notification{e.Type, e.Subject})
+	if err != nil {
+		return err
+	}
+
+	_, err = s.conn(ctx).ExecContext(
+		ctx,
+		"INSERT INTO outbox_events(type, subject, occurredAt, data) VALUES($1, $2, $3, $4)",
+		e.Type,
+		e.Subject,
+		e.Time,
+		string(data),
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.conn(ctx).ExecContext(ctx, "SELECT pg_notify($1, $2)", eventsChannel, string(payload))
+	return err
+}
+
+// ListenEvents hands the type and subject of every event appended by any
+// server sharing the database to sink as soon as its transaction commits,
+// until ctx is done. Notifications sent while the connection was lost are
+// gone, reconnected is called after the connection is back.
+func (s *Storage) ListenEvents(ctx context.Context, sink event.Sink, reconnected func()) error {
+	l := pq.NewListener(s.url, time.Second, time.Minute, func(ev pq.ListenerEventType, err error) {
+		if err != nil {
+			log.Println("event listener:", err)
+		}
+	})
+	defer l.Close()
+
+	if err := l.Listen(eventsChannel); err != nil {
+		return err
+	}
+
+	ping := time.NewTicker(time.Minute)
+	defer ping.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ping.C:
+			// a connection that died silently is only noticed when used
+			go l.Ping()
+		case n := <-l.Notify:
+			if n == nil {
+				reconnected()
+				continue
+			}
+
+			var msg notification
+			if err := json.Unmarshal([]byte(n.Extra), &msg); err != nil {
+				log.Println("event listener:", err)
+				continue
+			}
+			if err := sink.Publish(ctx, event.New(msg.Type, msg.Subject, nil)); err != nil {
+				log.Println("event listener:", err)
+			}
+		}
+	}
+}
+
+func (s *Storage) LatestEvent(ctx context.Context, typ string) (event.Event, error) {
+	return scanOutboxEvent(s.conn(ctx).QueryRowContext(
+		ctx,
+		"SELECT "+outboxColumns+" FROM outbox_events WHERE type=$1 ORDER BY id DESC LIMIT 1",
+		typ,
+	))
+}
+
+// ClaimEvents pushes the due time of the claimed events past the lease,
+// rows claimed by a concurrent dispatcher are skipped. An event waits for
+// the earlier events of its subject even while they are leased.
+func (s *Storage) ClaimEvents(ctx context.Context, limit int, lease time.Duration) ([]event.Event, error) {
+	rows, err := s.conn(ctx).QueryContext(
+		ctx,
+		`UPDATE outbox_events SET nextAttemptAt = NOW() + make_interval(secs => $2)
+		WHERE id IN (
+			SELECT e.id FROM outbox_events e
+			WHERE e.publishedAt IS NULL AND e.nextAttemptAt <= NOW()
+			AND NOT EXISTS (
+				SELECT 1 FROM outbox_events p
+				WHERE p.subject = e.subject AND p.id < e.id AND p.publishedAt IS NULL
+			)
+			ORDER BY e.id LIMIT $1
+			FOR UPDATE OF e SKIP LOCKED
+		)
+		RETURNING `+outboxColumns,
+		limit,
+		lease.Seconds(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []event.Event{}
+	for rows.Next() {
+		e, err := scanOutboxEvent(rows)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+
+	return events, rows.Err()
+}
+
+func (s *Storage) MarkEventPublished(ctx context.Context, id int64) error {
+	return s.execOne(ctx, "UPDATE outbox_events SET publishedAt=NOW(), lastError=NULL WHERE id=$1", id)
+}
+
+func (s *Storage) RetryEvent(ctx context.Context, id int64, at time.Time, reason string, publishedTo []string) error {
+	return s.execOne(
+		ctx,
+		"UPDATE outbox_events SET attempts=attempts+1, nextAttemptAt=$2, lastError=$3, publishedTo=$4 WHERE id=$1",
+		id,
+		at,
+		reason,
+		pq.Array(publishedTo),
+	)
+}
+
+func (s *Storage) PurgePublishedEvents(ctx context.Context, before time.Time) (int64, error) {
+	res, err := s.conn(ctx).ExecContext(ctx, "DELETE FROM outbox_events WHERE publishedAt < $1", before)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+func scanOutboxEvent(row scanner) (event.Event, error) {
+	var e event.Event
+	var data []byte
+	if err := row.Scan(&e.ID, &e.Type, &e.Subject, &e.Time, &data, &e.Attempts, pq.Array(&e.PublishedTo)); err != nil {
+		return event.Event{}, err
+	}
+
+	if err := decodeJSON(data, &e.Data); err != nil {
+		return event.Event{}, err
+	}
+
+	return e, nil
+}
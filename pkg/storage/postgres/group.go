@@ -0,0 +1,163 @@
+package postgres
+
+import (
+	"context"
+
+	"github.com/lib/pq"
+)
+
+// AddUserToGroups adds the user to each of the named groups, creating the
+// groups that do not exist yet, and returns the groups the user was added to.
+func (s *Storage) AddUserToGroups(ctx context.Context, userID int, groups []string) ([]string, error) {
+	_, err := s.conn(ctx).ExecContext(
+		ctx,
+		"INSERT INTO groups(name) SELECT unnest($1::text[]) ON CONFLICT (name) DO NOTHING",
+		pq.Array(groups),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.conn(ctx).QueryContext(
+		ctx,
+		`WITH added AS (
+			INSERT INTO user_groups(userId, groupId)
+			SELECT $1, id FROM groups WHERE name = ANY($2)
+			ON CONFLICT DO NOTHING
+			RETURNING groupId
+		)
+		SELECT g.name FROM groups g JOIN added a ON a.groupId = g.id ORDER BY g.name`,
+		userID,
+		pq.Array(groups),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	added := []string{}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		added = append(added, name)
+	}
+	return added, rows.Err()
+}
+
+// SyncGroupMembers makes the existing users with the given emails the only
+// members of the named group, creating the group if it does not exist yet,
+// and reports whether the membership changed.
+func (s *Storage) SyncGroupMembers(ctx context.Context, group string, emails []string) (bool, error) {
+	var changed int64
+	err := s.WithinTx(ctx, func(ctx context.Context) error {
+		var groupID int
+		err := s.conn(ctx).QueryRowContext(
+			ctx,
+			`INSERT INTO groups(name) VALUES($1)
+			ON CONFLICT (name) DO UPDATE SET name=EXCLUDED.name
+			RETURNING id`,
+			group,
+		).Scan(&groupID)
+		if err != nil {
+			return err
+		}
+
+		res, err := s.conn(ctx).ExecContext(
+			ctx,
+			`DELETE FROM user_groups WHERE groupId=$1
+			AND userId NOT IN (SELECT id FROM users WHERE email = ANY($2))`,
+			groupID,
+			pq.Array(emails),
+		)
+		if err != nil {
+			return err
+		}
+		if changed, err = res.RowsAffected(); err != nil {
+			return err
+		}
+
+		res, err = s.conn(ctx).ExecContext(
+			ctx,
+			`INSERT INTO user_groups(userId, groupId)
+			SELECT id, $1 FROM users WHERE email = ANY($2)
+			ON CONFLICT DO NOTHING`,
+			groupID,
+			pq.Array(emails),
+		)
+		if err != nil {
+			return err
+		}
+		added, err := res.RowsAffected()
+		changed += added
+		return err
+	})
+	return changed > 0, err
+}
+
+func (s *Storage) GroupExists(ctx context.Context, name string) (bool, error) {
+	var exists bool
+	err := s.conn(ctx).QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM groups WHERE name=$1)", name).Scan(&exists)
+	if err != nil {
+		return false, err
+	}
+	return exists, nil
+}
+
+func (s *Storage) CreateGroup(ctx context.Context, name string) (int, error) {
+	var id int
+	err := s.conn(ctx).QueryRowContext(ctx, "INSERT INTO groups(name) VALUES($1) RETURNING id", name).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+func (s *Storage) RenameGroup(ctx context.Context, id int, name string) error {
+	_, err := s.conn(ctx).ExecContext(ctx, "UPDATE groups SET name=$1 WHERE id=$2", name, id)
+	return err
+}
+
+func (s *Storage) ReplaceGroupMembers(ctx context.Context, id int, userIDs []int) error {
+	return s.WithinTx(ctx, func(ctx context.Context) error {
+		_, err := s.conn(ctx).ExecContext(
+			ctx,
+			"DELETE FROM user_groups WHERE groupId=$1 AND NOT (userId = ANY($2))",
+			id,
+			pq.Array(userIDs),
+		)
+		if err != nil {
+			return err
+		}
+
+		return s.AddGroupMembers(ctx, id, userIDs)
+	})
+}
+
+func (s *Storage) AddGroupMembers(ctx context.Context, id int, userIDs []int) error {
+	_, err := s.conn(ctx).ExecContext(
+		ctx,
+		`INSERT INTO user_groups(userId, groupId)
+		SELECT id, $1 FROM users WHERE id = ANY($2)
+		ON CONFLICT DO NOTHING`,
+		id,
+		pq.Array(userIDs),
+	)
+	return err
+}
+
+func (s *Storage) RemoveGroupMembers(ctx context.Context, id int, userIDs []int) error {
+	_, err := s.conn(ctx).ExecContext(
+		ctx,
+		"DELETE FROM user_groups WHERE groupId=$1 AND userId = ANY($2)",
+		id,
+		pq.Array(userIDs),
+	)
+	return err
+}
+
+func (s *Storage) DeleteGroup(ctx context.Context, id int) error {
+	_, err := s.conn(ctx).ExecContext(ctx, "DELETE FROM groups WHERE id=$1", id)
+	return err
+}
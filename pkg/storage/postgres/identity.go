@@ -0,0 +1,37 @@
+package postgres
+
+import (
+	"context"
+
+	"github.com/raisultan/abac/pkg/oidc"
+)
+
+func (s *Storage) GetUserByIdentity(ctx context.Context, issuer, subject string) (oidc.User, error) {
+	u := oidc.User{}
+
+	err := s.conn(ctx).QueryRowContext(
+		ctx,
+		`SELECT u.id, u.email FROM users u
+		JOIN user_identities i ON i.userId = u.id
+		WHERE i.issuer=$1 AND i.subject=$2`,
+		issuer,
+		subject,
+	).Scan(&u.ID, &u.Email)
+
+	if err != nil {
+		return oidc.User{}, err
+	}
+
+	return u, nil
+}
+
+func (s *Storage) LinkIdentity(ctx context.Context, userID int, issuer, subject string) error {
+	_, err := s.conn(ctx).ExecContext(
+		ctx,
+		"INSERT INTO user_identities(userId, issuer, subject) VALUES($1, $2, $3)",
+		userID,
+		issuer,
+		subject,
+	)
+	return err
+}
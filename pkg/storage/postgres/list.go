@@ -0,0 +1,151 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/raisultan/abac/pkg/list"
+)
+
+var listSortColumns = map[string]string{
+	"id":        "id",
+	"email":     "email",
+	"firstName": "firstName",
+	"lastName":  "lastName",
+	"createdAt": "createdAt",
+}
+
+func (s *Storage) GetAllUsers(ctx context.Context, lr list.UserListRequest) ([]list.UserRetrieveResponse, error) {
+	conds, args := listConditions(lr)
+
+	// id is always the last sort key so the order is total and cursors are stable
+	sort := append(append([]list.SortField{}, lr.Sort...), list.SortField{Name: "id", Desc: idDesc(lr.Sort)})
+
+	if lr.After != nil {
+		values := append(append([]string{}, lr.After.Values...), fmt.Sprint(lr.After.ID))
+		var keyset []string
+		for i := range sort {
+			var eq []string
+			for j := 0; j < i; j++ {
+				args = append(args, values[j])
+				eq = append(eq, fmt.Sprintf("%s = %s", listSortColumns[sort[j].Name], listParam(sort[j].Name, len(args))))
+			}
+
+			op := ">"
+			if sort[i].Desc {
+				op = "<"
+			}
+			args = append(args, values[i])
+			eq = append(eq, fmt.Sprintf("%s %s %s", listSortColumns[sort[i].Name], op, listParam(sort[i].Name, len(args))))
+			keyset = append(keyset, "("+strings.Join(eq, " AND ")+")")
+		}
+		conds = append(conds, "("+strings.Join(keyset, " OR ")+")")
+	}
+
+	var order []string
+	for _, f := range sort {
+		if f.Desc {
+			order = append(order, listSortColumns[f.Name]+" DESC")
+		} else {
+			order = append(order, listSortColumns[f.Name])
+		}
+	}
+
+	args = append(args, lr.Limit)
+	rows, err := s.conn(ctx).QueryContext(
+		ctx,
+		fmt.Sprintf(
+			`SELECT id, email, firstName, lastName, isAdmin, isApproved, createdAt, disabledAt, deletedAt FROM users
+			WHERE %s ORDER BY %s LIMIT $%d`,
+			strings.Join(conds, " AND "), strings.Join(order, ", "), len(args),
+		),
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []list.UserRetrieveResponse{}
+	for rows.Next() {
+		var u list.UserRetrieveResponse
+		if err := rows.Scan(&u.ID, &u.Email, &u.FirstName, &u.LastName, &u.IsAdmin, &u.IsApproved, &u.CreatedAt, &u.DisabledAt, &u.DeletedAt); err != nil {
+			return nil, err
+		}
+		users = append(users, u)
+	}
+
+	return users, rows.Err()
+}
+
+func (s *Storage) CountUsers(ctx context.Context, lr list.UserListRequest) (int, error) {
+	conds, args := listConditions(lr)
+
+	var total int
+	err := s.conn(ctx).QueryRowContext(ctx, "SELECT COUNT(*) FROM users WHERE "+strings.Join(conds, " AND "), args...).Scan(&total)
+	return total, err
+}
+
+func listConditions(lr list.UserListRequest) ([]string, []interface{}) {
+	conds := []string{"TRUE"}
+	args := []interface{}{}
+
+	add := func(cond string, arg interface{}) {
+		args = append(args, arg)
+		conds = append(conds, fmt.Sprintf(cond, len(args)))
+	}
+
+	if !lr.IncludeDeleted {
+		conds = append(conds, "deletedAt IS NULL")
+	}
+	if lr.Email != "" {
+		add("LOWER(email) = LOWER($%d)", lr.Email)
+	}
+	if lr.IsAdmin != nil {
+		add("isAdmin = $%d", *lr.IsAdmin)
+	}
+	if lr.IsApproved != nil {
+		add("isApproved = $%d", *lr.IsApproved)
+	}
+	if lr.Group != "" {
+		add(
+			`EXISTS (SELECT 1 FROM user_groups ug JOIN groups g ON g.id = ug.groupId
+			WHERE ug.userId = users.id AND g.name = $%d)`,
+			lr.Group,
+		)
+	}
+	if lr.CreatedFrom != nil {
+		add("createdAt >= $%d", *lr.CreatedFrom)
+	}
+	if lr.CreatedTo != nil {
+		add("createdAt < $%d", *lr.CreatedTo)
+	}
+	if lr.Search != "" {
+		add(
+			"(email ILIKE $%[1]d OR firstName ILIKE $%[1]d OR lastName ILIKE $%[1]d)",
+			"%"+escapeLike(lr.Search)+"%",
+		)
+	}
+
+	return conds, args
+}
+
+// idDesc sorts the id tie breaker in the direction of the last requested
+// field, which lets the keyset condition use a single index scan.
+func idDesc(sort []list.SortField) bool {
+	if len(sort) == 0 {
+		return false
+	}
+	return sort[len(sort)-1].Desc
+}
+
+func listParam(field string, n int) string {
+	switch field {
+	case "id":
+		return fmt.Sprintf("CAST($%d AS INTEGER)", n)
+	case "createdAt":
+		return fmt.Sprintf("CAST($%d AS TIMESTAMP WITH TIME ZONE)", n)
+	}
+	return fmt.Sprintf("$%d", n)
+}
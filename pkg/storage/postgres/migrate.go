@@ -0,0 +1,37 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+
+	"github.com/raisultan/abac/pkg/storage/migrate"
+)
+
+// migrationLock is the advisory lock held while migrating, so replicas that
+// start together apply the migrations once.
+const migrationLock = 7283902
+
+//go:embed migrations/*.sql
+var migrations embed.FS
+
+// Migrator returns the migrator of the migrations built into the binary.
+func (s *Storage) Migrator() (*migrate.Migrator, error) {
+	ms, err := migrate.Load(migrations, "migrations")
+	if err != nil {
+		return nil, err
+	}
+	return migrate.New(s.db, ms, advisoryLock{}), nil
+}
+
+type advisoryLock struct{}
+
+func (advisoryLock) Lock(ctx context.Context, conn *sql.Conn) error {
+	_, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", migrationLock)
+	return err
+}
+
+func (advisoryLock) Unlock(ctx context.Context, conn *sql.Conn) error {
+	_, err := conn.ExecContext(ctx, "SELECT pg_advisory_unlock($1)", migrationLock)
+	return err
+}
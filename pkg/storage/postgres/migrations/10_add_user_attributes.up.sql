@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS attribute_definitions
+(
+    name VARCHAR(64) NOT NULL,
+    type VARCHAR(16) NOT NULL,
+    required BOOLEAN NOT NULL DEFAULT FALSE,
+    defaultValue JSONB DEFAULT NULL,
+    allowedValues TEXT[] NOT NULL DEFAULT '{}',
+    description TEXT NOT NULL DEFAULT '',
+
+    CONSTRAINT attribute_definitions_pkey PRIMARY KEY (name)
+);
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS attributes JSONB NOT NULL DEFAULT '{}';
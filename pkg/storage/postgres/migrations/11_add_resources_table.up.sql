@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS resources
+(
+    id SERIAL,
+    type VARCHAR(64) NOT NULL,
+    externalId VARCHAR(256) NOT NULL,
+    ownerId INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    parentId INTEGER REFERENCES resources(id),
+    attributes JSONB NOT NULL DEFAULT '{}',
+    createdAt TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updatedAt TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+
+    CONSTRAINT resources_pkey PRIMARY KEY (id),
+    CONSTRAINT resources_type_external_id_key UNIQUE (type, externalId)
+);
+
+CREATE INDEX IF NOT EXISTS resources_parent_id_idx ON resources (parentId);
+CREATE INDEX IF NOT EXISTS resources_owner_id_idx ON resources (ownerId);
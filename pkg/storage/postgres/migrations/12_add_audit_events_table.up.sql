@@ -0,0 +1,34 @@
+CREATE TABLE IF NOT EXISTS audit_events
+(
+    id BIGSERIAL,
+    occurredAt TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    type VARCHAR(64) NOT NULL,
+    actor TEXT NOT NULL DEFAULT '',
+    subject TEXT NOT NULL DEFAULT '',
+    action TEXT NOT NULL DEFAULT '',
+    resource TEXT NOT NULL DEFAULT '',
+    result VARCHAR(16) NOT NULL,
+    remoteAddr TEXT NOT NULL DEFAULT '',
+    details JSONB NOT NULL DEFAULT '{}',
+
+    CONSTRAINT audit_events_pkey PRIMARY KEY (id)
+);
+
+CREATE INDEX IF NOT EXISTS audit_events_occurred_at_idx ON audit_events (occurredAt);
+CREATE INDEX IF NOT EXISTS audit_events_actor_idx ON audit_events (actor, id);
+CREATE INDEX IF NOT EXISTS audit_events_subject_idx ON audit_events (subject, id);
+
+-- audit events can only be appended
+CREATE OR REPLACE FUNCTION audit_events_append_only() RETURNS TRIGGER AS $$
+BEGIN
+    RAISE EXCEPTION 'audit_events is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER audit_events_no_update_delete
+    BEFORE UPDATE OR DELETE ON audit_events
+    FOR EACH ROW EXECUTE PROCEDURE audit_events_append_only();
+
+CREATE TRIGGER audit_events_no_truncate
+    BEFORE TRUNCATE ON audit_events
+    FOR EACH STATEMENT EXECUTE PROCEDURE audit_events_append_only();
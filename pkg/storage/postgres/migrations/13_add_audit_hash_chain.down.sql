@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS audit_checkpoints;
+
+ALTER TABLE audit_events
+    DROP COLUMN IF EXISTS prevHash,
+    DROP COLUMN IF EXISTS hash;
@@ -0,0 +1,18 @@
+CREATE TABLE IF NOT EXISTS outbox_events
+(
+    id BIGSERIAL,
+    type VARCHAR(64) NOT NULL,
+    subject TEXT NOT NULL DEFAULT '',
+    occurredAt TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    data JSONB NOT NULL DEFAULT '{}',
+    attempts INTEGER NOT NULL DEFAULT 0,
+    nextAttemptAt TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    lastError TEXT,
+    publishedAt TIMESTAMP WITH TIME ZONE,
+
+    CONSTRAINT outbox_events_pkey PRIMARY KEY (id)
+);
+
+CREATE INDEX IF NOT EXISTS outbox_events_pending_idx ON outbox_events (nextAttemptAt, id) WHERE publishedAt IS NULL;
+CREATE INDEX IF NOT EXISTS outbox_events_published_at_idx ON outbox_events (publishedAt) WHERE publishedAt IS NOT NULL;
+CREATE INDEX IF NOT EXISTS outbox_events_type_idx ON outbox_events (type, id);
@@ -0,0 +1,35 @@
+CREATE TABLE IF NOT EXISTS webhook_subscriptions
+(
+    id SERIAL,
+    url TEXT NOT NULL,
+    eventTypes TEXT[] NOT NULL,
+    active BOOLEAN NOT NULL DEFAULT TRUE,
+    secret TEXT NOT NULL,
+    createdAt TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+
+    CONSTRAINT webhook_subscriptions_pkey PRIMARY KEY (id)
+);
+
+CREATE TABLE IF NOT EXISTS webhook_deliveries
+(
+    id BIGSERIAL,
+    subscriptionId INTEGER NOT NULL,
+    eventId BIGINT NOT NULL,
+    eventType VARCHAR(64) NOT NULL,
+    payload TEXT NOT NULL,
+    status VARCHAR(16) NOT NULL DEFAULT 'pending',
+    attempts INTEGER NOT NULL DEFAULT 0,
+    nextAttemptAt TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    lastStatusCode INTEGER,
+    lastError TEXT,
+    createdAt TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    deliveredAt TIMESTAMP WITH TIME ZONE,
+
+    CONSTRAINT webhook_deliveries_pkey PRIMARY KEY (id),
+    CONSTRAINT webhook_deliveries_event_key UNIQUE (subscriptionId, eventId),
+    CONSTRAINT webhook_deliveries_subscription_fkey FOREIGN KEY (subscriptionId)
+        REFERENCES webhook_subscriptions (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS webhook_deliveries_pending_idx ON webhook_deliveries (nextAttemptAt, id) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS webhook_deliveries_subscription_idx ON webhook_deliveries (subscriptionId, id);
@@ -0,0 +1,22 @@
+-- events recorded before the hash chain was introduced have no hash, the
+-- chain starts at the first hashed event or, without one, the next event
+CREATE TABLE IF NOT EXISTS audit_chain
+(
+    single BOOLEAN NOT NULL DEFAULT TRUE,
+    startEventId BIGINT NOT NULL,
+
+    CONSTRAINT audit_chain_pkey PRIMARY KEY (single),
+    CONSTRAINT audit_chain_single CHECK (single)
+);
+
+INSERT INTO audit_chain(startEventId)
+SELECT COALESCE(MIN(id) FILTER (WHERE hash IS NOT NULL), MAX(id) + 1, 1) FROM audit_events
+ON CONFLICT DO NOTHING;
+
+CREATE TRIGGER audit_chain_no_update_delete
+    BEFORE UPDATE OR DELETE ON audit_chain
+    FOR EACH ROW EXECUTE PROCEDURE audit_events_append_only();
+
+CREATE TRIGGER audit_chain_no_truncate
+    BEFORE TRUNCATE ON audit_chain
+    FOR EACH STATEMENT EXECUTE PROCEDURE audit_events_append_only();
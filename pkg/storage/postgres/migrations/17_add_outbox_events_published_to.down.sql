@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS outbox_events_subject_pending_idx;
+
+ALTER TABLE outbox_events DROP COLUMN IF EXISTS publishedTo;
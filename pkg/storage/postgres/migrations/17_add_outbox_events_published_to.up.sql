@@ -0,0 +1,4 @@
+-- the sinks an event was published to, so a failed sink is retried alone
+ALTER TABLE outbox_events ADD COLUMN IF NOT EXISTS publishedTo TEXT[] NOT NULL DEFAULT '{}';
+
+CREATE INDEX IF NOT EXISTS outbox_events_subject_pending_idx ON outbox_events (subject, id) WHERE publishedAt IS NULL;
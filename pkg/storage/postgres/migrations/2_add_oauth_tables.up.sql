@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS oauth_clients
+(
+    id SERIAL,
+    clientId VARCHAR(256) NOT NULL UNIQUE,
+    secret VARCHAR(256) NOT NULL,
+    name TEXT NOT NULL,
+
+    CONSTRAINT oauth_clients_pkey PRIMARY KEY (id)
+);
+
+CREATE TABLE IF NOT EXISTS revoked_tokens
+(
+    jti VARCHAR(64) NOT NULL,
+    expiresAt TIMESTAMP WITH TIME ZONE NOT NULL,
+
+    CONSTRAINT revoked_tokens_pkey PRIMARY KEY (jti)
+);
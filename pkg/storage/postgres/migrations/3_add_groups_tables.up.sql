@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS groups
+(
+    id SERIAL,
+    name VARCHAR(256) NOT NULL UNIQUE,
+
+    CONSTRAINT groups_pkey PRIMARY KEY (id)
+);
+
+CREATE TABLE IF NOT EXISTS user_groups
+(
+    userId INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    groupId INTEGER NOT NULL REFERENCES groups(id) ON DELETE CASCADE,
+
+    CONSTRAINT user_groups_pkey PRIMARY KEY (userId, groupId)
+);
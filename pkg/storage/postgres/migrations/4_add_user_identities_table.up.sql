@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS user_identities
+(
+    id SERIAL,
+    userId INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    issuer TEXT NOT NULL,
+    subject TEXT NOT NULL,
+
+    CONSTRAINT user_identities_pkey PRIMARY KEY (id),
+    CONSTRAINT user_identities_issuer_subject_key UNIQUE (issuer, subject)
+);
@@ -0,0 +1,21 @@
+CREATE TABLE IF NOT EXISTS webauthn_credentials
+(
+    id SERIAL,
+    userId INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    credentialId BYTEA NOT NULL UNIQUE,
+    publicKey BYTEA NOT NULL,
+    signCount BIGINT NOT NULL DEFAULT 0,
+    createdAt TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+
+    CONSTRAINT webauthn_credentials_pkey PRIMARY KEY (id)
+);
+
+CREATE TABLE IF NOT EXISTS webauthn_challenges
+(
+    challenge VARCHAR(128) NOT NULL,
+    userId INTEGER REFERENCES users(id) ON DELETE CASCADE,
+    ceremony VARCHAR(32) NOT NULL,
+    expiresAt TIMESTAMP WITH TIME ZONE NOT NULL,
+
+    CONSTRAINT webauthn_challenges_pkey PRIMARY KEY (challenge)
+);
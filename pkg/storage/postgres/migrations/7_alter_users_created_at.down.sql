@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS users_last_name_idx;
+DROP INDEX IF EXISTS users_created_at_idx;
+
+ALTER TABLE users ALTER COLUMN createdAt DROP NOT NULL;
+ALTER TABLE users ALTER COLUMN createdAt DROP DEFAULT;
+ALTER TABLE users ALTER COLUMN createdAt TYPE TEXT USING CAST(createdAt AS TEXT);
+ALTER TABLE users ALTER COLUMN createdAt SET DEFAULT NULL;
@@ -0,0 +1,9 @@
+ALTER TABLE users ALTER COLUMN createdAt DROP DEFAULT;
+ALTER TABLE users ALTER COLUMN createdAt TYPE TIMESTAMP WITH TIME ZONE
+    USING CAST(NULLIF(createdAt, '') AS TIMESTAMP WITH TIME ZONE);
+UPDATE users SET createdAt = NOW() WHERE createdAt IS NULL;
+ALTER TABLE users ALTER COLUMN createdAt SET DEFAULT NOW();
+ALTER TABLE users ALTER COLUMN createdAt SET NOT NULL;
+
+CREATE INDEX IF NOT EXISTS users_created_at_idx ON users (createdAt, id);
+CREATE INDEX IF NOT EXISTS users_last_name_idx ON users (lastName, id);
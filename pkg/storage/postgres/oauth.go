@@ -0,0 +1,49 @@
+package postgres
+
+import (
+	"context"
+	"time"
+
+	"github.com/raisultan/abac/pkg/oauth"
+)
+
+func (s *Storage) GetClientByClientID(ctx context.Context, clientID string) (oauth.Client, error) {
+	c := oauth.Client{}
+
+	err := s.conn(ctx).QueryRowContext(
+		ctx,
+		"SELECT id, clientId, secret, name FROM oauth_clients WHERE clientId=$1",
+		clientID,
+	).Scan(&c.ID, &c.ClientID, &c.Secret, &c.Name)
+
+	if err != nil {
+		return oauth.Client{}, err
+	}
+
+	return c, nil
+}
+
+func (s *Storage) RevokeToken(ctx context.Context, jti string, expiresAt time.Time) error {
+	_, err := s.conn(ctx).ExecContext(
+		ctx,
+		"INSERT INTO revoked_tokens(jti, expiresAt) VALUES($1, $2) ON CONFLICT (jti) DO NOTHING",
+		jti,
+		expiresAt,
+	)
+	return err
+}
+
+func (s *Storage) IsTokenRevoked(ctx context.Context, jti string) (bool, error) {
+	var revoked bool
+	err := s.conn(ctx).QueryRowContext(
+		ctx,
+		"SELECT EXISTS(SELECT 1 FROM revoked_tokens WHERE jti=$1)",
+		jti,
+	).Scan(&revoked)
+
+	if err != nil {
+		return false, err
+	}
+
+	return revoked, nil
+}
@@ -1,72 +1,89 @@
 package postgres
 
 import (
+	"context"
 	"database/sql"
-	"os"
+	"time"
 
-	_ "github.com/lib/pq"
-
-	"github.com/raisultan/abac/pkg/list"
+	"github.com/lib/pq"
 	"github.com/raisultan/abac/pkg/login"
 	"github.com/raisultan/abac/pkg/register"
 	"github.com/raisultan/abac/pkg/retrieve"
+	"github.com/raisultan/abac/pkg/tracing"
 	"github.com/raisultan/abac/pkg/update"
 	"golang.org/x/crypto/bcrypt"
 )
 
-var dbUrl = os.Getenv("POSTGRES_URL")
+const updateUserColumns = "id, email, firstName, lastName, isAdmin, isApproved, updatedAt, version"
 
 type Storage struct {
-	db *sql.DB
+	db   *sql.DB
+	cost int
+
+	// url is kept for the connection ListenEvents opens
+	url string
 }
 
-func NewStorage() (*Storage, error) {
-	var err error
-	s := Storage{}
+// Config is the connection and pool of the database, zero values keep the
+// defaults of database/sql.
+type Config struct {
+	URL             string
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
 
-	s.db, err = sql.Open("postgres", dbUrl)
-	if err != nil {
-		return nil, err
-	}
+	// BcryptCost is the cost passwords are hashed with, 8 when zero
+	BcryptCost int
+}
 
-	return &s, nil
+// querier is implemented by both *sql.DB and *sql.Tx.
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
 }
 
-func (s *Storage) GetAllUsers(limit, offset int) ([]list.UserRetrieveResponse, error) {
-	rows, err := s.db.Query(
-		"SELECT id, email, firstName, lastName FROM users LIMIT $1 OFFSET $2",
-		limit,
-		offset,
-	)
+type txKey struct{}
+
+const (
+	foreignKeyViolation = "23503"
+	uniqueViolation     = "23505"
+)
 
+func NewStorage(c Config) (*Storage, error) {
+	var err error
+	s := Storage{cost: c.BcryptCost, url: c.URL}
+	if s.cost == 0 {
+		s.cost = 8
+	}
+
+	s.db, err = sql.Open("postgres", c.URL)
 	if err != nil {
 		return nil, err
 	}
 
-	defer rows.Close()
-
-	users := []list.UserRetrieveResponse{}
-
-	for rows.Next() {
-		var u list.UserRetrieveResponse
-		if err := rows.Scan(&u.ID, &u.Email, &u.FirstName, &u.LastName); err != nil {
-			return nil, err
-		}
-		users = append(users, u)
+	s.db.SetMaxOpenConns(c.MaxOpenConns)
+	if c.MaxIdleConns > 0 {
+		s.db.SetMaxIdleConns(c.MaxIdleConns)
 	}
+	s.db.SetConnMaxLifetime(c.ConnMaxLifetime)
 
-	return users, nil
+	return &s, nil
 }
 
-func (s *Storage) CreateUser(ru register.UserRegisterRequest) (register.UserRegisterResponse, error) {
-	hashingCost := 8
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(ru.Password), hashingCost)
+// DB is the connection pool of the storage, for its stats.
+func (s *Storage) DB() *sql.DB {
+	return s.db
+}
+
+func (s *Storage) CreateUser(ctx context.Context, ru register.UserRegisterRequest) (register.UserRegisterResponse, error) {
+	hashedPasswordStr, err := s.hashPassword(ru.Password)
 	if err != nil {
 		return register.UserRegisterResponse{}, err
 	}
 
-	hashedPasswordStr := string(hashedPassword)
-	err = s.db.QueryRow(
+	err = s.conn(ctx).QueryRowContext(
+		ctx,
 		"INSERT INTO users(email, password, firstName, lastName) VALUES($1, $2, $3, $4) RETURNING id",
 		ru.Email,
 		hashedPasswordStr,
@@ -75,6 +92,9 @@ func (s *Storage) CreateUser(ru register.UserRegisterRequest) (register.UserRegi
 	).Scan(&ru.ID)
 
 	if err != nil {
+		if isUniqueViolation(err) {
+			return register.UserRegisterResponse{}, register.ErrDuplicate
+		}
 		return register.UserRegisterResponse{}, err
 	}
 
@@ -87,8 +107,9 @@ func (s *Storage) CreateUser(ru register.UserRegisterRequest) (register.UserRegi
 	return resp, nil
 }
 
-func (s *Storage) CheckUserExists(ru register.UserRegisterRequest) (bool, error) {
-	err := s.db.QueryRow(
+func (s *Storage) CheckUserExists(ctx context.Context, ru register.UserRegisterRequest) (bool, error) {
+	err := s.conn(ctx).QueryRowContext(
+		ctx,
 		"SELECT email FROM users WHERE email=$1",
 		ru.Email,
 	).Scan(&ru.Email)
@@ -103,13 +124,65 @@ func (s *Storage) CheckUserExists(ru register.UserRegisterRequest) (bool, error)
 	return true, nil
 }
 
-func (s *Storage) GetUserByID(uID int) (retrieve.UserRetrieveResponse, error) {
+// CreatePasswordlessUser creates a user that can only sign in through an
+// external identity provider, an empty hash never matches a bcrypt comparison.
+func (s *Storage) CreatePasswordlessUser(ctx context.Context, email, firstName, lastName string) (int, error) {
+	var id int
+	err := s.conn(ctx).QueryRowContext(
+		ctx,
+		"INSERT INTO users(email, password, firstName, lastName) VALUES($1, '', $2, $3) RETURNING id",
+		email,
+		firstName,
+		lastName,
+	).Scan(&id)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+func (s *Storage) GetUserIDByEmail(ctx context.Context, email string) (int, error) {
+	var id int
+	err := s.conn(ctx).QueryRowContext(ctx, "SELECT id FROM users WHERE email=$1", email).Scan(&id)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+// IsUserDisabled reports whether the user with the given email has been
+// disabled or deleted, unknown users are not considered disabled.
+func (s *Storage) IsUserDisabled(ctx context.Context, email string) (bool, error) {
+	var disabled bool
+	err := s.conn(ctx).QueryRowContext(
+		ctx,
+		"SELECT disabledAt IS NOT NULL OR deletedAt IS NOT NULL FROM users WHERE email=$1",
+		email,
+	).Scan(&disabled)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return disabled, nil
+}
+
+func (s *Storage) GetUserByID(ctx context.Context, uID int) (retrieve.UserRetrieveResponse, error) {
 	u := retrieve.UserRetrieveResponse{}
 
-	err := s.db.QueryRow(
-		"SELECT id, email, firstName, lastName, isAdmin, isApproved FROM users WHERE id=$1",
+	err := s.conn(ctx).QueryRowContext(
+		ctx,
+		`SELECT id, email, firstName, lastName, isAdmin, isApproved, updatedAt, version
+		FROM users WHERE id=$1 AND deletedAt IS NULL`,
 		uID,
-	).Scan(&u.ID, &u.Email, &u.FirstName, &u.LastName, &u.IsAdmin, &u.IsApproved)
+	).Scan(&u.ID, &u.Email, &u.FirstName, &u.LastName, &u.IsAdmin, &u.IsApproved, &u.UpdatedAt, &u.Version)
 
 	if err != nil {
 		return retrieve.UserRetrieveResponse{}, err
@@ -118,10 +191,28 @@ func (s *Storage) GetUserByID(uID int) (retrieve.UserRetrieveResponse, error) {
 	return u, nil
 }
 
-func (s *Storage) GetUserByEmail(r login.UserLoginRequest) (login.UserLoginRequest, error) {
+func (s *Storage) FindUserByEmail(ctx context.Context, email string) (retrieve.UserRetrieveResponse, error) {
+	u := retrieve.UserRetrieveResponse{}
+
+	err := s.conn(ctx).QueryRowContext(
+		ctx,
+		`SELECT id, email, firstName, lastName, isAdmin, isApproved, updatedAt, version
+		FROM users WHERE email=$1 AND deletedAt IS NULL`,
+		email,
+	).Scan(&u.ID, &u.Email, &u.FirstName, &u.LastName, &u.IsAdmin, &u.IsApproved, &u.UpdatedAt, &u.Version)
+
+	if err != nil {
+		return retrieve.UserRetrieveResponse{}, err
+	}
+
+	return u, nil
+}
+
+func (s *Storage) GetUserByEmail(ctx context.Context, r login.UserLoginRequest) (login.UserLoginRequest, error) {
 	u := login.UserLoginRequest{}
-	err := s.db.QueryRow(
-		"SELECT email, password FROM users WHERE email=$1",
+	err := s.conn(ctx).QueryRowContext(
+		ctx,
+		"SELECT email, password FROM users WHERE email=$1 AND deletedAt IS NULL",
 		r.Email,
 	).Scan(&u.Email, &u.Password)
 
@@ -132,32 +223,144 @@ func (s *Storage) GetUserByEmail(r login.UserLoginRequest) (login.UserLoginReque
 	return u, nil
 }
 
-func (s *Storage) UpdateUser(r update.UserUpdateRequest) (update.UserRetrieveResponse, error) {
-	_, err := s.db.Exec(
-		"UPDATE users SET firstName=$1, lastName=$2 WHERE id=$3",
+// UpdateUser changes the fields of r that are set and bumps the version in
+// a single statement, a version check failure is told apart from a missing
+// user only when nothing was updated.
+func (s *Storage) UpdateUser(ctx context.Context, r update.UserPatchRequest) (update.UserRetrieveResponse, error) {
+	u := update.UserRetrieveResponse{}
+	err := s.conn(ctx).QueryRowContext(
+		ctx,
+		`UPDATE users SET
+			firstName=COALESCE($1, firstName),
+			lastName=COALESCE($2, lastName),
+			version=version+1,
+			updatedAt=NOW()
+		WHERE id=$3 AND deletedAt IS NULL AND ($4 = 0 OR version=$4)
+		RETURNING `+updateUserColumns,
 		r.FirstName,
 		r.LastName,
 		r.ID,
-	)
+		r.Version,
+	).Scan(&u.ID, &u.Email, &u.FirstName, &u.LastName, &u.IsAdmin, &u.IsApproved, &u.UpdatedAt, &u.Version)
+
+	if err == sql.ErrNoRows && r.Version != 0 {
+		var exists bool
+		if err := s.conn(ctx).QueryRowContext(
+			ctx,
+			"SELECT EXISTS (SELECT 1 FROM users WHERE id=$1 AND deletedAt IS NULL)",
+			r.ID,
+		).Scan(&exists); err != nil {
+			return update.UserRetrieveResponse{}, err
+		}
+		if exists {
+			return update.UserRetrieveResponse{}, update.VersionMismatchErr
+		}
+	}
 
 	if err != nil {
 		return update.UserRetrieveResponse{}, err
 	}
 
+	return u, nil
+}
+
+// ApproveUser approves a user, approving an approved user changes nothing.
+func (s *Storage) ApproveUser(ctx context.Context, id int) (update.UserRetrieveResponse, bool, error) {
 	u := update.UserRetrieveResponse{}
-	err = s.db.QueryRow(
-		"SELECT email, firstName, lastName, isAdmin, isApproved FROM users WHERE id=$1",
-		r.ID,
-	).Scan(&u.Email, &u.FirstName, &u.LastName, &u.IsAdmin, &u.IsApproved)
+	err := s.conn(ctx).QueryRowContext(
+		ctx,
+		`UPDATE users SET isApproved=TRUE, version=version+1, updatedAt=NOW()
+		WHERE id=$1 AND deletedAt IS NULL AND NOT isApproved
+		RETURNING `+updateUserColumns,
+		id,
+	).Scan(&u.ID, &u.Email, &u.FirstName, &u.LastName, &u.IsAdmin, &u.IsApproved, &u.UpdatedAt, &u.Version)
+
+	if err == sql.ErrNoRows {
+		err = s.conn(ctx).QueryRowContext(
+			ctx,
+			"SELECT "+updateUserColumns+" FROM users WHERE id=$1 AND deletedAt IS NULL",
+			id,
+		).Scan(&u.ID, &u.Email, &u.FirstName, &u.LastName, &u.IsAdmin, &u.IsApproved, &u.UpdatedAt, &u.Version)
+		return u, false, err
+	}
+	if err != nil {
+		return update.UserRetrieveResponse{}, false, err
+	}
+
+	return u, true, nil
+}
+
+// DeleteUser soft deletes a user, the row is kept until it is purged.
+func (s *Storage) DeleteUser(ctx context.Context, uID int) error {
+	return s.execOne(ctx, "UPDATE users SET deletedAt=NOW() WHERE id=$1 AND deletedAt IS NULL", uID)
+}
 
+func (s *Storage) RestoreUser(ctx context.Context, uID int) error {
+	return s.execOne(ctx, "UPDATE users SET deletedAt=NULL WHERE id=$1 AND deletedAt IS NOT NULL", uID)
+}
+
+func (s *Storage) PurgeDeletedUsers(ctx context.Context, before time.Time) (int64, error) {
+	res, err := s.conn(ctx).ExecContext(ctx, "DELETE FROM users WHERE deletedAt < $1", before)
 	if err != nil {
-		return update.UserRetrieveResponse{}, err
+		return 0, err
 	}
+	return res.RowsAffected()
+}
 
-	return u, nil
+// WithinTx runs fn in a transaction, or in the one ctx already carries.
+func (s *Storage) WithinTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	if _, ok := ctx.Value(txKey{}).(*sql.Tx); ok {
+		return fn(ctx)
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := fn(context.WithValue(ctx, txKey{}, tx)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// conn returns the transaction ctx carries, or the pool outside of one.
+func (s *Storage) conn(ctx context.Context) querier {
+	if tx, ok := ctx.Value(txKey{}).(*sql.Tx); ok {
+		return tracing.SQL(tx, "postgresql")
+	}
+	return tracing.SQL(s.db, "postgresql")
+}
+
+func isUniqueViolation(err error) bool {
+	pqErr, ok := err.(*pq.Error)
+	return ok && pqErr.Code == uniqueViolation
 }
 
-func (s *Storage) DeleteUser(uID int) error {
-	_, err := s.db.Exec("DELETE FROM users WHERE id=$1", uID)
-	return err
+func (s *Storage) hashPassword(password string) (string, error) {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), s.cost)
+	if err != nil {
+		return "", err
+	}
+	return string(hashedPassword), nil
+}
+
+// execOne runs a statement that is expected to change exactly one row and
+// reports sql.ErrNoRows when nothing matched.
+func (s *Storage) execOne(ctx context.Context, query string, args ...interface{}) error {
+	res, err := s.conn(ctx).ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
 }
@@ -0,0 +1,77 @@
+package postgres_test
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/raisultan/abac/pkg/storage/postgres"
+	"github.com/raisultan/abac/pkg/storage/storagetest"
+)
+
+// TestConformance runs against the database of POSTGRES_URL, which is
+// migrated and emptied before every check. Emptying the audit tables takes
+// a superuser.
+func TestConformance(t *testing.T) {
+	url := os.Getenv("POSTGRES_URL")
+	if url == "" {
+		t.Skip("POSTGRES_URL is not set")
+	}
+
+	storagetest.Run(t, func(t *testing.T) storagetest.Storage {
+		s, err := postgres.NewStorage(postgres.Config{URL: url})
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { s.DB().Close() })
+
+		m, err := s.Migrator()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := m.Up(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		truncate(t, s)
+		return s
+	})
+}
+
+func truncate(t *testing.T, s *postgres.Storage) {
+	rows, err := s.DB().Query(
+		"SELECT tablename FROM pg_tables WHERE schemaname = current_schema() AND tablename <> 'schema_migrations'",
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	tables := []string{}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			t.Fatal(err)
+		}
+		tables = append(tables, `"`+name+`"`)
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the audit tables refuse to be truncated unless triggers are off
+	tx, err := s.DB().Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec("SET LOCAL session_replication_role = replica"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tx.Exec("TRUNCATE " + strings.Join(tables, ", ") + " RESTART IDENTITY CASCADE"); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+}
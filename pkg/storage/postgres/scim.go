@@ -0,0 +1,304 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/lib/pq"
+	"github.com/raisultan/abac/pkg/scim"
+)
+
+var scimUserColumns = map[string]string{
+	"id":              "CAST(id AS TEXT)",
+	"username":        "email",
+	"emails":          "email",
+	"emails.value":    "email",
+	"name.givenname":  "firstName",
+	"name.familyname": "lastName",
+	"active":          "(disabledAt IS NULL)",
+}
+
+var scimGroupColumns = map[string]string{
+	"id":          "CAST(id AS TEXT)",
+	"displayname": "name",
+}
+
+func (s *Storage) FilterUsers(ctx context.Context, f *scim.Filter, offset, limit int) ([]scim.UserRecord, int, error) {
+	where, args, err := scimWhere(f, scimUserColumns)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	where = "deletedAt IS NULL AND (" + where + ")"
+
+	var total int
+	if err := s.conn(ctx).QueryRowContext(ctx, "SELECT COUNT(*) FROM users WHERE "+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := s.conn(ctx).QueryContext(
+		ctx,
+		fmt.Sprintf(
+			`SELECT id, email, firstName, lastName, disabledAt IS NULL FROM users
+			WHERE %s ORDER BY id LIMIT $%d OFFSET $%d`,
+			where, len(args)+1, len(args)+2,
+		),
+		append(args, limit, offset)...,
+	)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	users := []scim.UserRecord{}
+	ids := []int{}
+	for rows.Next() {
+		var u scim.UserRecord
+		if err := rows.Scan(&u.ID, &u.Email, &u.FirstName, &u.LastName, &u.Active); err != nil {
+			return nil, 0, err
+		}
+		users = append(users, u)
+		ids = append(ids, u.ID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	groups, err := s.userGroups(ctx, ids)
+	if err != nil {
+		return nil, 0, err
+	}
+	for i := range users {
+		users[i].Groups = groups[users[i].ID]
+	}
+
+	return users, total, nil
+}
+
+func (s *Storage) GetUserWithGroups(ctx context.Context, id int) (scim.UserRecord, error) {
+	u := scim.UserRecord{}
+	err := s.conn(ctx).QueryRowContext(
+		ctx,
+		"SELECT id, email, firstName, lastName, disabledAt IS NULL FROM users WHERE id=$1 AND deletedAt IS NULL",
+		id,
+	).Scan(&u.ID, &u.Email, &u.FirstName, &u.LastName, &u.Active)
+	if err != nil {
+		return scim.UserRecord{}, err
+	}
+
+	groups, err := s.userGroups(ctx, []int{id})
+	if err != nil {
+		return scim.UserRecord{}, err
+	}
+	u.Groups = groups[id]
+
+	return u, nil
+}
+
+func (s *Storage) SetUserDisabled(ctx context.Context, id int, disabled bool) error {
+	return s.execOne(
+		ctx,
+		`UPDATE users SET disabledAt = CASE WHEN $1 THEN COALESCE(disabledAt, NOW()) ELSE NULL END
+		WHERE id=$2 AND deletedAt IS NULL`,
+		disabled,
+		id,
+	)
+}
+
+func (s *Storage) FilterGroups(ctx context.Context, f *scim.Filter, offset, limit int) ([]scim.GroupRecord, int, error) {
+	where, args, err := scimWhere(f, scimGroupColumns)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var total int
+	if err := s.conn(ctx).QueryRowContext(ctx, "SELECT COUNT(*) FROM groups WHERE "+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := s.conn(ctx).QueryContext(
+		ctx,
+		fmt.Sprintf(
+			"SELECT id, name FROM groups WHERE %s ORDER BY id LIMIT $%d OFFSET $%d",
+			where, len(args)+1, len(args)+2,
+		),
+		append(args, limit, offset)...,
+	)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	groups := []scim.GroupRecord{}
+	ids := []int{}
+	for rows.Next() {
+		var g scim.GroupRecord
+		if err := rows.Scan(&g.ID, &g.Name); err != nil {
+			return nil, 0, err
+		}
+		groups = append(groups, g)
+		ids = append(ids, g.ID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	members, err := s.groupMembers(ctx, ids)
+	if err != nil {
+		return nil, 0, err
+	}
+	for i := range groups {
+		groups[i].Members = members[groups[i].ID]
+	}
+
+	return groups, total, nil
+}
+
+func (s *Storage) GetGroupWithMembers(ctx context.Context, id int) (scim.GroupRecord, error) {
+	g := scim.GroupRecord{}
+	err := s.conn(ctx).QueryRowContext(ctx, "SELECT id, name FROM groups WHERE id=$1", id).Scan(&g.ID, &g.Name)
+	if err != nil {
+		return scim.GroupRecord{}, err
+	}
+
+	members, err := s.groupMembers(ctx, []int{id})
+	if err != nil {
+		return scim.GroupRecord{}, err
+	}
+	g.Members = members[id]
+
+	return g, nil
+}
+
+func (s *Storage) userGroups(ctx context.Context, userIDs []int) (map[int][]scim.GroupRef, error) {
+	rows, err := s.conn(ctx).QueryContext(
+		ctx,
+		`SELECT ug.userId, g.id, g.name FROM user_groups ug
+		JOIN groups g ON g.id = ug.groupId
+		WHERE ug.userId = ANY($1) ORDER BY g.id`,
+		pq.Array(userIDs),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	groups := map[int][]scim.GroupRef{}
+	for rows.Next() {
+		var userID int
+		var g scim.GroupRef
+		if err := rows.Scan(&userID, &g.ID, &g.Name); err != nil {
+			return nil, err
+		}
+		groups[userID] = append(groups[userID], g)
+	}
+
+	return groups, rows.Err()
+}
+
+func (s *Storage) groupMembers(ctx context.Context, groupIDs []int) (map[int][]scim.MemberRef, error) {
+	rows, err := s.conn(ctx).QueryContext(
+		ctx,
+		`SELECT ug.groupId, u.id, u.email FROM user_groups ug
+		JOIN users u ON u.id = ug.userId
+		WHERE ug.groupId = ANY($1) AND u.deletedAt IS NULL ORDER BY u.id`,
+		pq.Array(groupIDs),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := map[int][]scim.MemberRef{}
+	for rows.Next() {
+		var groupID int
+		var m scim.MemberRef
+		if err := rows.Scan(&groupID, &m.ID, &m.Email); err != nil {
+			return nil, err
+		}
+		members[groupID] = append(members[groupID], m)
+	}
+
+	return members, rows.Err()
+}
+
+// scimWhere translates a SCIM filter into a SQL condition over the given
+// attribute to column mapping. String comparisons are case-insensitive.
+func scimWhere(f *scim.Filter, columns map[string]string) (string, []interface{}, error) {
+	if f == nil {
+		return "TRUE", nil, nil
+	}
+
+	args := []interface{}{}
+	cond, err := scimCondition(f, columns, &args)
+	if err != nil {
+		return "", nil, err
+	}
+	return cond, args, nil
+}
+
+func scimCondition(f *scim.Filter, columns map[string]string, args *[]interface{}) (string, error) {
+	switch f.Op {
+	case "and", "or":
+		left, err := scimCondition(f.Left, columns, args)
+		if err != nil {
+			return "", err
+		}
+		right, err := scimCondition(f.Right, columns, args)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("(%s %s %s)", left, strings.ToUpper(f.Op), right), nil
+	case "not":
+		inner, err := scimCondition(f.Left, columns, args)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("NOT (%s)", inner), nil
+	}
+
+	col, ok := columns[f.Attr]
+	if !ok {
+		return "", scim.InvalidFilterErr
+	}
+
+	if f.Op == "pr" {
+		return fmt.Sprintf("(%s IS NOT NULL AND CAST(%s AS TEXT) <> '')", col, col), nil
+	}
+
+	if b, ok := f.Value.(bool); ok {
+		if f.Op != "eq" && f.Op != "ne" {
+			return "", scim.InvalidFilterErr
+		}
+		*args = append(*args, b)
+		op := "="
+		if f.Op == "ne" {
+			op = "<>"
+		}
+		return fmt.Sprintf("%s %s $%d", col, op, len(*args)), nil
+	}
+
+	v := strings.ToLower(fmt.Sprint(f.Value))
+	lhs := fmt.Sprintf("LOWER(CAST(%s AS TEXT))", col)
+
+	switch f.Op {
+	case "eq", "ne", "gt", "ge", "lt", "le":
+		ops := map[string]string{"eq": "=", "ne": "<>", "gt": ">", "ge": ">=", "lt": "<", "le": "<="}
+		*args = append(*args, v)
+		return fmt.Sprintf("%s %s $%d", lhs, ops[f.Op], len(*args)), nil
+	case "co":
+		*args = append(*args, "%"+escapeLike(v)+"%")
+	case "sw":
+		*args = append(*args, escapeLike(v)+"%")
+	case "ew":
+		*args = append(*args, "%"+escapeLike(v))
+	default:
+		return "", scim.InvalidFilterErr
+	}
+	return fmt.Sprintf("%s LIKE $%d", lhs, len(*args)), nil
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
@@ -0,0 +1,129 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/raisultan/abac/pkg/webauthn"
+)
+
+func (s *Storage) SaveChallenge(ctx context.Context, c webauthn.Challenge) error {
+	// expired challenges are cleaned up whenever a new one is issued
+	if _, err := s.conn(ctx).ExecContext(ctx, "DELETE FROM webauthn_challenges WHERE expiresAt < NOW()"); err != nil {
+		return err
+	}
+
+	var userID sql.NullInt64
+	if c.UserID != 0 {
+		userID = sql.NullInt64{Int64: int64(c.UserID), Valid: true}
+	}
+
+	_, err := s.conn(ctx).ExecContext(
+		ctx,
+		"INSERT INTO webauthn_challenges(challenge, userId, ceremony, expiresAt) VALUES($1, $2, $3, $4)",
+		c.Challenge,
+		userID,
+		c.Ceremony,
+		c.ExpiresAt,
+	)
+	return err
+}
+
+func (s *Storage) ConsumeChallenge(ctx context.Context, challenge string) (webauthn.Challenge, error) {
+	c := webauthn.Challenge{}
+	var userID sql.NullInt64
+
+	err := s.conn(ctx).QueryRowContext(
+		ctx,
+		"DELETE FROM webauthn_challenges WHERE challenge=$1 RETURNING challenge, userId, ceremony, expiresAt",
+		challenge,
+	).Scan(&c.Challenge, &userID, &c.Ceremony, &c.ExpiresAt)
+
+	if err != nil {
+		return webauthn.Challenge{}, err
+	}
+	c.UserID = int(userID.Int64)
+
+	return c, nil
+}
+
+func (s *Storage) CreateCredential(ctx context.Context, c webauthn.Credential) (int, error) {
+	var id int
+	err := s.conn(ctx).QueryRowContext(
+		ctx,
+		"INSERT INTO webauthn_credentials(userId, credentialId, publicKey, signCount) VALUES($1, $2, $3, $4) RETURNING id",
+		c.UserID,
+		c.CredentialID,
+		c.PublicKey,
+		int64(c.SignCount),
+	).Scan(&id)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+func (s *Storage) GetCredentialsByUserID(ctx context.Context, userID int) ([]webauthn.Credential, error) {
+	rows, err := s.conn(ctx).QueryContext(
+		ctx,
+		`SELECT c.id, c.userId, u.email, c.credentialId, c.publicKey, c.signCount
+		FROM webauthn_credentials c JOIN users u ON u.id = c.userId
+		WHERE c.userId=$1 ORDER BY c.id`,
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	creds := []webauthn.Credential{}
+	for rows.Next() {
+		c, err := scanCredential(rows)
+		if err != nil {
+			return nil, err
+		}
+		creds = append(creds, c)
+	}
+
+	return creds, rows.Err()
+}
+
+func (s *Storage) GetCredentialByCredentialID(ctx context.Context, credentialID []byte) (webauthn.Credential, error) {
+	row := s.conn(ctx).QueryRowContext(
+		ctx,
+		`SELECT c.id, c.userId, u.email, c.credentialId, c.publicKey, c.signCount
+		FROM webauthn_credentials c JOIN users u ON u.id = c.userId
+		WHERE c.credentialId=$1`,
+		credentialID,
+	)
+	return scanCredential(row)
+}
+
+func (s *Storage) UpdateCredentialSignCount(ctx context.Context, id int, signCount uint32) error {
+	_, err := s.conn(ctx).ExecContext(
+		ctx,
+		"UPDATE webauthn_credentials SET signCount=$1 WHERE id=$2",
+		int64(signCount),
+		id,
+	)
+	return err
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanCredential(row scanner) (webauthn.Credential, error) {
+	c := webauthn.Credential{}
+	var signCount int64
+
+	err := row.Scan(&c.ID, &c.UserID, &c.Email, &c.CredentialID, &c.PublicKey, &signCount)
+	if err != nil {
+		return webauthn.Credential{}, err
+	}
+	c.SignCount = uint32(signCount)
+
+	return c, nil
+}
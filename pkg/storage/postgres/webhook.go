@@ -0,0 +1,261 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/raisultan/abac/pkg/event"
+	"github.com/raisultan/abac/pkg/webhook"
+)
+
+const subscriptionColumns = "id, url, eventTypes, active, createdAt"
+
+const deliveryColumns = `d.id, d.subscriptionId, d.eventId, d.eventType, d.payload, d.status, d.attempts,
+	d.nextAttemptAt, d.lastStatusCode, d.lastError, d.createdAt, d.deliveredAt`
+
+func (s *Storage) ListSubscriptions(ctx context.Context) ([]webhook.Subscription, error) {
+	rows, err := s.conn(ctx).QueryContext(ctx, "SELECT "+subscriptionColumns+" FROM webhook_subscriptions ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	subs := []webhook.Subscription{}
+	for rows.Next() {
+		sub, err := scanSubscription(rows)
+		if err != nil {
+			return nil, err
+		}
+		subs = append(subs, sub)
+	}
+
+	return subs, rows.Err()
+}
+
+func (s *Storage) GetSubscription(ctx context.Context, id int) (webhook.Subscription, error) {
+	sub, err := scanSubscription(s.conn(ctx).QueryRowContext(
+		ctx,
+		"SELECT "+subscriptionColumns+" FROM webhook_subscriptions WHERE id=$1",
+		id,
+	))
+	if err == sql.ErrNoRows {
+		return webhook.Subscription{}, webhook.NotFoundErr
+	}
+	return sub, err
+}
+
+func (s *Storage) CreateSubscription(ctx context.Context, sub webhook.Subscription) (webhook.Subscription, error) {
+	return scanSubscription(s.conn(ctx).QueryRowContext(
+		ctx,
+		`INSERT INTO webhook_subscriptions(url, eventTypes, active, secret) VALUES($1, $2, $3, $4)
+		RETURNING `+subscriptionColumns,
+		sub.URL,
+		pq.Array(sub.EventTypes),
+		sub.Active,
+		sub.Secret,
+	))
+}
+
+func (s *Storage) UpdateSubscription(ctx context.Context, sub webhook.Subscription) (webhook.Subscription, error) {
+	sub, err := scanSubscription(s.conn(ctx).QueryRowContext(
+		ctx,
+		`UPDATE webhook_subscriptions SET url=$2, eventTypes=$3, active=$4 WHERE id=$1
+		RETURNING `+subscriptionColumns,
+		sub.ID,
+		sub.URL,
+		pq.Array(sub.EventTypes),
+		sub.Active,
+	))
+	if err == sql.ErrNoRows {
+		return webhook.Subscription{}, webhook.NotFoundErr
+	}
+	return sub, err
+}
+
+func (s *Storage) DeleteSubscription(ctx context.Context, id int) error {
+	err := s.execOne(ctx, "DELETE FROM webhook_subscriptions WHERE id=$1", id)
+	if err == sql.ErrNoRows {
+		return webhook.NotFoundErr
+	}
+	return err
+}
+
+func (s *Storage) EnqueueDeliveries(ctx context.Context, e event.Event, payload []byte) error {
+	_, err := s.conn(ctx).ExecContext(
+		ctx,
+		`INSERT INTO webhook_deliveries(subscriptionId, eventId, eventType, payload)
+		SELECT id, $1, $2, $3 FROM webhook_subscriptions WHERE active AND $4 = ANY(eventTypes)
+		ON CONFLICT (subscriptionId, eventId) DO NOTHING`,
+		e.ID,
+		e.Type,
+		string(payload),
+		e.Type,
+	)
+	return err
+}
+
+// ClaimDeliveries pushes the due time of the claimed deliveries past the
+// lease, deliveries to inactive subscriptions wait until they are active.
+func (s *Storage) ClaimDeliveries(ctx context.Context, limit int, lease time.Duration) ([]webhook.Delivery, error) {
+	rows, err := s.conn(ctx).QueryContext(
+		ctx,
+		`UPDATE webhook_deliveries d SET nextAttemptAt = NOW() + make_interval(secs => $2)
+		FROM webhook_subscriptions s
+		WHERE s.id = d.subscriptionId AND d.id IN (
+			SELECT pd.id FROM webhook_deliveries pd
+			JOIN webhook_subscriptions ps ON ps.id = pd.subscriptionId
+			WHERE pd.status = 'pending' AND pd.nextAttemptAt <= NOW() AND ps.active
+			ORDER BY pd.id LIMIT $1
+			FOR UPDATE OF pd SKIP LOCKED
+		)
+		RETURNING `+deliveryColumns+`, s.url, s.secret`,
+		limit,
+		lease.Seconds(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []webhook.Delivery{}
+	for rows.Next() {
+		var d webhook.Delivery
+		if err := scanDelivery(rows, &d, &d.URL, &d.Secret); err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, d)
+	}
+
+	return deliveries, rows.Err()
+}
+
+func (s *Storage) RecordAttempt(ctx context.Context, a webhook.Attempt) error {
+	var next *time.Time
+	if a.Status == webhook.Pending {
+		next = &a.NextAttemptAt
+	}
+
+	return s.execOne(
+		ctx,
+		`UPDATE webhook_deliveries SET
+			status=$2,
+			attempts=attempts+1,
+			nextAttemptAt=$3,
+			lastStatusCode=NULLIF($4, 0),
+			lastError=NULLIF($5, ''),
+			deliveredAt=CASE WHEN $2 = 'succeeded' THEN NOW() ELSE deliveredAt END
+		WHERE id=$1`,
+		a.DeliveryID,
+		a.Status,
+		next,
+		a.StatusCode,
+		a.Error,
+	)
+}
+
+// ListDeliveries returns the deliveries of a subscription, newest first.
+func (s *Storage) ListDeliveries(ctx context.Context, lr webhook.DeliveryListRequest) ([]webhook.Delivery, error) {
+	conds := []string{"d.subscriptionId = $1"}
+	args := []interface{}{lr.SubscriptionID}
+
+	if lr.Status != "" {
+		args = append(args, lr.Status)
+		conds = append(conds, fmt.Sprintf("d.status = $%d", len(args)))
+	}
+	if lr.Before > 0 {
+		args = append(args, lr.Before)
+		conds = append(conds, fmt.Sprintf("d.id < $%d", len(args)))
+	}
+
+	args = append(args, lr.Limit)
+	rows, err := s.conn(ctx).QueryContext(
+		ctx,
+		fmt.Sprintf(
+			"SELECT "+deliveryColumns+" FROM webhook_deliveries d WHERE %s ORDER BY d.id DESC LIMIT $%d",
+			strings.Join(conds, " AND "), len(args),
+		),
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []webhook.Delivery{}
+	for rows.Next() {
+		var d webhook.Delivery
+		if err := scanDelivery(rows, &d); err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, d)
+	}
+
+	return deliveries, rows.Err()
+}
+
+// RedeliverDelivery makes a delivery due now with a fresh set of attempts.
+func (s *Storage) RedeliverDelivery(ctx context.Context, subscriptionID int, id int64) (webhook.Delivery, error) {
+	var d webhook.Delivery
+	err := scanDelivery(
+		s.conn(ctx).QueryRowContext(
+			ctx,
+			`UPDATE webhook_deliveries d SET status='pending', attempts=0, nextAttemptAt=NOW()
+			WHERE d.id=$1 AND d.subscriptionId=$2
+			RETURNING `+deliveryColumns,
+			id,
+			subscriptionID,
+		),
+		&d,
+	)
+	if err == sql.ErrNoRows {
+		return webhook.Delivery{}, webhook.DeliveryNotFoundErr
+	}
+	return d, err
+}
+
+func (s *Storage) PurgeDeliveries(ctx context.Context, before time.Time) (int64, error) {
+	res, err := s.conn(ctx).ExecContext(
+		ctx,
+		"DELETE FROM webhook_deliveries WHERE status='succeeded' AND deliveredAt < $1",
+		before,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+func scanSubscription(row scanner) (webhook.Subscription, error) {
+	var sub webhook.Subscription
+	err := row.Scan(&sub.ID, &sub.URL, pq.Array(&sub.EventTypes), &sub.Active, &sub.CreatedAt)
+	return sub, err
+}
+
+func scanDelivery(row scanner, d *webhook.Delivery, extra ...interface{}) error {
+	var payload string
+	dest := append([]interface{}{
+		&d.ID,
+		&d.SubscriptionID,
+		&d.EventID,
+		&d.EventType,
+		&payload,
+		&d.Status,
+		&d.Attempts,
+		&d.NextAttemptAt,
+		&d.LastStatusCode,
+		&d.LastError,
+		&d.CreatedAt,
+		&d.DeliveredAt,
+	}, extra...)
+
+	if err := row.Scan(dest...); err != nil {
+		return err
+	}
+	d.Payload = []byte(payload)
+
+	return nil
+}
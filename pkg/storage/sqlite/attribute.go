@@ -0,0 +1,205 @@
+package sqlite
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+
+	"github.com/raisultan/abac/pkg/attribute"
+)
+
+func (s *Storage) ListAttributeDefinitions(ctx context.Context) ([]attribute.Definition, error) {
+	rows, err := s.conn(ctx).QueryContext(
+		ctx,
+		"SELECT name, type, required, defaultValue, allowedValues, description FROM attribute_definitions ORDER BY name",
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	defs := []attribute.Definition{}
+	for rows.Next() {
+		var d attribute.Definition
+		var def *string
+		var values string
+		if err := rows.Scan(&d.Name, &d.Type, &d.Required, &def, &values, &d.Description); err != nil {
+			return nil, err
+		}
+		if def != nil {
+			if err := decodeJSON([]byte(*def), &d.Default); err != nil {
+				return nil, err
+			}
+		}
+		if err := json.Unmarshal([]byte(values), &d.Values); err != nil {
+			return nil, err
+		}
+		defs = append(defs, d)
+	}
+
+	return defs, rows.Err()
+}
+
+func (s *Storage) SaveAttributeDefinition(ctx context.Context, d attribute.Definition) error {
+	var def *string
+	if d.Default != nil {
+		b, err := json.Marshal(d.Default)
+		if err != nil {
+			return err
+		}
+		str := string(b)
+		def = &str
+	}
+
+	values, err := json.Marshal(d.Values)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.conn(ctx).ExecContext(
+		ctx,
+		`INSERT INTO attribute_definitions(name, type, required, defaultValue, allowedValues, description)
+		VALUES(?1, ?2, ?3, ?4, ?5, ?6)
+		ON CONFLICT (name) DO UPDATE SET
+			type=excluded.type,
+			required=excluded.required,
+			defaultValue=excluded.defaultValue,
+			allowedValues=excluded.allowedValues,
+			description=excluded.description`,
+		d.Name,
+		d.Type,
+		d.Required,
+		def,
+		string(values),
+		d.Description,
+	)
+	return err
+}
+
+// DeleteAttributeDefinition removes the definition together with the values
+// users have for it. The values are removed in Go, the JSON functions are
+// not part of every SQLite build.
+func (s *Storage) DeleteAttributeDefinition(ctx context.Context, name string) error {
+	return s.WithinTx(ctx, func(ctx context.Context) error {
+		if err := s.execOne(ctx, "DELETE FROM attribute_definitions WHERE name=?1", name); err != nil {
+			return err
+		}
+
+		rows, err := s.conn(ctx).QueryContext(ctx, "SELECT id, attributes FROM users")
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		changed := map[int]string{}
+		for rows.Next() {
+			var id int
+			var raw string
+			if err := rows.Scan(&id, &raw); err != nil {
+				return err
+			}
+
+			attrs := map[string]interface{}{}
+			if err := decodeJSON([]byte(raw), &attrs); err != nil {
+				return err
+			}
+			if _, ok := attrs[name]; !ok {
+				continue
+			}
+			delete(attrs, name)
+
+			b, err := json.Marshal(attrs)
+			if err != nil {
+				return err
+			}
+			changed[id] = string(b)
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		for id, attrs := range changed {
+			if _, err := s.conn(ctx).ExecContext(ctx, "UPDATE users SET attributes=?1 WHERE id=?2", attrs, id); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *Storage) GetUserAttributes(ctx context.Context, userID int) (map[string]interface{}, error) {
+	var raw string
+	err := s.conn(ctx).QueryRowContext(
+		ctx,
+		"SELECT attributes FROM users WHERE id=?1 AND deletedAt IS NULL",
+		userID,
+	).Scan(&raw)
+	if err != nil {
+		return nil, err
+	}
+
+	attrs := map[string]interface{}{}
+	if err := decodeJSON([]byte(raw), &attrs); err != nil {
+		return nil, err
+	}
+	return attrs, nil
+}
+
+// GetUserAttributesForUpdate is GetUserAttributes, transactions take the
+// write lock of the database when they begin.
+func (s *Storage) GetUserAttributesForUpdate(ctx context.Context, userID int) (map[string]interface{}, error) {
+	return s.GetUserAttributes(ctx, userID)
+}
+
+func (s *Storage) SetUserAttributes(ctx context.Context, userID int, attrs map[string]interface{}) error {
+	raw, err := json.Marshal(attrs)
+	if err != nil {
+		return err
+	}
+
+	return s.execOne(
+		ctx,
+		`UPDATE users SET attributes=?1, version=version+1, updatedAt=?3
+		WHERE id=?2 AND deletedAt IS NULL`,
+		string(raw),
+		userID,
+		now(),
+	)
+}
+
+func (s *Storage) GetSubject(ctx context.Context, email string) (attribute.Subject, error) {
+	sub := attribute.Subject{}
+	var raw string
+	err := s.conn(ctx).QueryRowContext(
+		ctx,
+		`SELECT id, email, firstName, lastName, isAdmin, isApproved, attributes
+		FROM users WHERE email=?1 AND deletedAt IS NULL`,
+		email,
+	).Scan(&sub.ID, &sub.Email, &sub.FirstName, &sub.LastName, &sub.IsAdmin, &sub.IsApproved, &raw)
+	if err != nil {
+		return attribute.Subject{}, err
+	}
+
+	sub.Attributes = map[string]interface{}{}
+	if err := decodeJSON([]byte(raw), &sub.Attributes); err != nil {
+		return attribute.Subject{}, err
+	}
+
+	groups, err := s.userGroups(ctx, []int{sub.ID})
+	if err != nil {
+		return attribute.Subject{}, err
+	}
+	sub.Groups = []string{}
+	for _, g := range groups[sub.ID] {
+		sub.Groups = append(sub.Groups, g.Name)
+	}
+
+	return sub, nil
+}
+
+// decodeJSON keeps numbers as json.Number so integers survive the round trip.
+func decodeJSON(raw []byte, v interface{}) error {
+	d := json.NewDecoder(bytes.NewReader(raw))
+	d.UseNumber()
+	return d.Decode(v)
+}
@@ -0,0 +1,132 @@
+package sqlite
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/raisultan/abac/pkg/event"
+)
+
+const outboxColumns = "id, type, subject, occurredAt, data, attempts, publishedTo"
+
+// AppendEvent stores e in the outbox, within the transaction of the change
+// it describes when ctx carries one.
+func (s *Storage) AppendEvent(ctx context.Context, e event.Event) error {
+	data, err := json.Marshal(e.Data)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.conn(ctx).ExecContext(
+		ctx,
+		"INSERT INTO outbox_events(type, subject, occurredAt, data, nextAttemptAt) VALUES(?1, ?2, ?3, ?4, ?5)",
+		e.Type,
+		e.Subject,
+		utc(e.Time),
+		string(data),
+		now(),
+	)
+	return err
+}
+
+func (s *Storage) LatestEvent(ctx context.Context, typ string) (event.Event, error) {
+	return scanOutboxEvent(s.conn(ctx).QueryRowContext(
+		ctx,
+		"SELECT "+outboxColumns+" FROM outbox_events WHERE type=?1 ORDER BY id DESC LIMIT 1",
+		typ,
+	))
+}
+
+// ClaimEvents pushes the due time of the claimed events past the lease.
+// There is a single writer, so no other dispatcher can claim them meanwhile.
+// An event waits for the earlier events of its subject.
+func (s *Storage) ClaimEvents(ctx context.Context, limit int, lease time.Duration) ([]event.Event, error) {
+	t := now()
+	rows, err := s.conn(ctx).QueryContext(
+		ctx,
+		`UPDATE outbox_events SET nextAttemptAt = ?2
+		WHERE id IN (
+			SELECT e.id FROM outbox_events e
+			WHERE e.publishedAt IS NULL AND e.nextAttemptAt <= ?3
+			AND NOT EXISTS (
+				SELECT 1 FROM outbox_events p
+				WHERE p.subject = e.subject AND p.id < e.id AND p.publishedAt IS NULL
+			)
+			ORDER BY e.id LIMIT ?1
+		)
+		RETURNING `+outboxColumns,
+		limit,
+		t.Add(lease),
+		t,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []event.Event{}
+	for rows.Next() {
+		e, err := scanOutboxEvent(rows)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// RETURNING does not keep the order of the subquery
+	sort.Slice(events, func(i, j int) bool { return events[i].ID < events[j].ID })
+	return events, nil
+}
+
+func (s *Storage) MarkEventPublished(ctx context.Context, id int64) error {
+	return s.execOne(ctx, "UPDATE outbox_events SET publishedAt=?2, lastError=NULL WHERE id=?1", id, now())
+}
+
+func (s *Storage) RetryEvent(ctx context.Context, id int64, at time.Time, reason string, publishedTo []string) error {
+	if publishedTo == nil {
+		publishedTo = []string{}
+	}
+	sinks, err := json.Marshal(publishedTo)
+	if err != nil {
+		return err
+	}
+
+	return s.execOne(
+		ctx,
+		"UPDATE outbox_events SET attempts=attempts+1, nextAttemptAt=?2, lastError=?3, publishedTo=?4 WHERE id=?1",
+		id,
+		utc(at),
+		reason,
+		string(sinks),
+	)
+}
+
+func (s *Storage) PurgePublishedEvents(ctx context.Context, before time.Time) (int64, error) {
+	res, err := s.conn(ctx).ExecContext(ctx, "DELETE FROM outbox_events WHERE publishedAt < ?1", utc(before))
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+func scanOutboxEvent(row scanner) (event.Event, error) {
+	var e event.Event
+	var data, publishedTo []byte
+	if err := row.Scan(&e.ID, &e.Type, &e.Subject, timestamp{&e.Time}, &data, &e.Attempts, &publishedTo); err != nil {
+		return event.Event{}, err
+	}
+
+	if err := decodeJSON(data, &e.Data); err != nil {
+		return event.Event{}, err
+	}
+	if err := json.Unmarshal(publishedTo, &e.PublishedTo); err != nil {
+		return event.Event{}, err
+	}
+
+	return e, nil
+}
@@ -0,0 +1,186 @@
+package sqlite
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// AddUserToGroups adds the user to each of the named groups, creating the
+// groups that do not exist yet, and returns the groups the user was added to.
+func (s *Storage) AddUserToGroups(ctx context.Context, userID int, groups []string) ([]string, error) {
+	added := []string{}
+	err := s.WithinTx(ctx, func(ctx context.Context) error {
+		for _, name := range groups {
+			_, err := s.conn(ctx).ExecContext(
+				ctx,
+				"INSERT INTO groups(name) VALUES(?1) ON CONFLICT (name) DO NOTHING",
+				name,
+			)
+			if err != nil {
+				return err
+			}
+
+			res, err := s.conn(ctx).ExecContext(
+				ctx,
+				`INSERT INTO user_groups(userId, groupId)
+				SELECT ?1, id FROM groups WHERE name=?2
+				ON CONFLICT DO NOTHING`,
+				userID,
+				name,
+			)
+			if err != nil {
+				return err
+			}
+			if n, err := res.RowsAffected(); err != nil {
+				return err
+			} else if n > 0 {
+				added = append(added, name)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(added)
+	return added, nil
+}
+
+// SyncGroupMembers makes the existing users with the given emails the only
+// members of the named group, creating the group if it does not exist yet,
+// and reports whether the membership changed.
+func (s *Storage) SyncGroupMembers(ctx context.Context, group string, emails []string) (bool, error) {
+	var changed int64
+	err := s.WithinTx(ctx, func(ctx context.Context) error {
+		var groupID int
+		err := s.conn(ctx).QueryRowContext(
+			ctx,
+			`INSERT INTO groups(name) VALUES(?1)
+			ON CONFLICT (name) DO UPDATE SET name=excluded.name
+			RETURNING id`,
+			group,
+		).Scan(&groupID)
+		if err != nil {
+			return err
+		}
+
+		in, args := inList(2, emails)
+		res, err := s.conn(ctx).ExecContext(
+			ctx,
+			`DELETE FROM user_groups WHERE groupId=?1
+			AND userId NOT IN (SELECT id FROM users WHERE email IN (`+in+`))`,
+			append([]interface{}{groupID}, args...)...,
+		)
+		if err != nil {
+			return err
+		}
+		if changed, err = res.RowsAffected(); err != nil {
+			return err
+		}
+
+		res, err = s.conn(ctx).ExecContext(
+			ctx,
+			`INSERT INTO user_groups(userId, groupId)
+			SELECT id, ?1 FROM users WHERE email IN (`+in+`)
+			ON CONFLICT DO NOTHING`,
+			append([]interface{}{groupID}, args...)...,
+		)
+		if err != nil {
+			return err
+		}
+		added, err := res.RowsAffected()
+		changed += added
+		return err
+	})
+	return changed > 0, err
+}
+
+func (s *Storage) GroupExists(ctx context.Context, name string) (bool, error) {
+	var exists bool
+	err := s.conn(ctx).QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM groups WHERE name=?1)", name).Scan(&exists)
+	if err != nil {
+		return false, err
+	}
+	return exists, nil
+}
+
+func (s *Storage) CreateGroup(ctx context.Context, name string) (int, error) {
+	var id int
+	err := s.conn(ctx).QueryRowContext(ctx, "INSERT INTO groups(name) VALUES(?1) RETURNING id", name).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+func (s *Storage) RenameGroup(ctx context.Context, id int, name string) error {
+	_, err := s.conn(ctx).ExecContext(ctx, "UPDATE groups SET name=?1 WHERE id=?2", name, id)
+	return err
+}
+
+func (s *Storage) ReplaceGroupMembers(ctx context.Context, id int, userIDs []int) error {
+	return s.WithinTx(ctx, func(ctx context.Context) error {
+		in, args := inList(2, userIDs)
+		_, err := s.conn(ctx).ExecContext(
+			ctx,
+			"DELETE FROM user_groups WHERE groupId=?1 AND userId NOT IN ("+in+")",
+			append([]interface{}{id}, args...)...,
+		)
+		if err != nil {
+			return err
+		}
+
+		return s.AddGroupMembers(ctx, id, userIDs)
+	})
+}
+
+func (s *Storage) AddGroupMembers(ctx context.Context, id int, userIDs []int) error {
+	in, args := inList(2, userIDs)
+	_, err := s.conn(ctx).ExecContext(
+		ctx,
+		`INSERT INTO user_groups(userId, groupId)
+		SELECT id, ?1 FROM users WHERE id IN (`+in+`)
+		ON CONFLICT DO NOTHING`,
+		append([]interface{}{id}, args...)...,
+	)
+	return err
+}
+
+func (s *Storage) RemoveGroupMembers(ctx context.Context, id int, userIDs []int) error {
+	in, args := inList(2, userIDs)
+	_, err := s.conn(ctx).ExecContext(
+		ctx,
+		"DELETE FROM user_groups WHERE groupId=?1 AND userId IN ("+in+")",
+		append([]interface{}{id}, args...)...,
+	)
+	return err
+}
+
+func (s *Storage) DeleteGroup(ctx context.Context, id int) error {
+	_, err := s.conn(ctx).ExecContext(ctx, "DELETE FROM groups WHERE id=?1", id)
+	return err
+}
+
+// inList returns the parameters of an IN list over values, numbered from
+// first, and the arguments to go with them. SQLite has no arrays to pass.
+func inList(first int, values interface{}) (string, []interface{}) {
+	args := []interface{}{}
+	switch v := values.(type) {
+	case []int:
+		for _, x := range v {
+			args = append(args, x)
+		}
+	case []string:
+		for _, x := range v {
+			args = append(args, x)
+		}
+	}
+
+	params := make([]string, len(args))
+	for i := range args {
+		params[i] = fmt.Sprintf("?%d", first+i)
+	}
+	return strings.Join(params, ", "), args
+}
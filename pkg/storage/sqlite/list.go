@@ -0,0 +1,158 @@
+package sqlite
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/raisultan/abac/pkg/list"
+)
+
+var listSortColumns = map[string]string{
+	"id":        "id",
+	"email":     "email",
+	"firstName": "firstName",
+	"lastName":  "lastName",
+	"createdAt": "createdAt",
+}
+
+func (s *Storage) GetAllUsers(ctx context.Context, lr list.UserListRequest) ([]list.UserRetrieveResponse, error) {
+	conds, args := listConditions(lr)
+
+	// id is always the last sort key so the order is total and cursors are stable
+	sort := append(append([]list.SortField{}, lr.Sort...), list.SortField{Name: "id", Desc: idDesc(lr.Sort)})
+
+	if lr.After != nil {
+		values := append(append([]string{}, lr.After.Values...), fmt.Sprint(lr.After.ID))
+		var keyset []string
+		for i := range sort {
+			var eq []string
+			for j := 0; j < i; j++ {
+				args = append(args, listValue(sort[j].Name, values[j]))
+				eq = append(eq, fmt.Sprintf("%s = ?%d", listSortColumns[sort[j].Name], len(args)))
+			}
+
+			op := ">"
+			if sort[i].Desc {
+				op = "<"
+			}
+			args = append(args, listValue(sort[i].Name, values[i]))
+			eq = append(eq, fmt.Sprintf("%s %s ?%d", listSortColumns[sort[i].Name], op, len(args)))
+			keyset = append(keyset, "("+strings.Join(eq, " AND ")+")")
+		}
+		conds = append(conds, "("+strings.Join(keyset, " OR ")+")")
+	}
+
+	var order []string
+	for _, f := range sort {
+		if f.Desc {
+			order = append(order, listSortColumns[f.Name]+" DESC")
+		} else {
+			order = append(order, listSortColumns[f.Name])
+		}
+	}
+
+	args = append(args, lr.Limit)
+	rows, err := s.conn(ctx).QueryContext(
+		ctx,
+		fmt.Sprintf(
+			`SELECT id, email, firstName, lastName, isAdmin, isApproved, createdAt, disabledAt, deletedAt FROM users
+			WHERE %s ORDER BY %s LIMIT ?%d`,
+			strings.Join(conds, " AND "), strings.Join(order, ", "), len(args),
+		),
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []list.UserRetrieveResponse{}
+	for rows.Next() {
+		var u list.UserRetrieveResponse
+		if err := rows.Scan(&u.ID, &u.Email, &u.FirstName, &u.LastName, &u.IsAdmin, &u.IsApproved, &u.CreatedAt, &u.DisabledAt, &u.DeletedAt); err != nil {
+			return nil, err
+		}
+		users = append(users, u)
+	}
+
+	return users, rows.Err()
+}
+
+func (s *Storage) CountUsers(ctx context.Context, lr list.UserListRequest) (int, error) {
+	conds, args := listConditions(lr)
+
+	var total int
+	err := s.conn(ctx).QueryRowContext(ctx, "SELECT COUNT(*) FROM users WHERE "+strings.Join(conds, " AND "), args...).Scan(&total)
+	return total, err
+}
+
+func listConditions(lr list.UserListRequest) ([]string, []interface{}) {
+	conds := []string{"TRUE"}
+	args := []interface{}{}
+
+	add := func(cond string, arg interface{}) {
+		args = append(args, arg)
+		conds = append(conds, fmt.Sprintf(cond, len(args)))
+	}
+
+	if !lr.IncludeDeleted {
+		conds = append(conds, "deletedAt IS NULL")
+	}
+	if lr.Email != "" {
+		add("LOWER(email) = LOWER(?%d)", lr.Email)
+	}
+	if lr.IsAdmin != nil {
+		add("isAdmin = ?%d", *lr.IsAdmin)
+	}
+	if lr.IsApproved != nil {
+		add("isApproved = ?%d", *lr.IsApproved)
+	}
+	if lr.Group != "" {
+		add(
+			`EXISTS (SELECT 1 FROM user_groups ug JOIN groups g ON g.id = ug.groupId
+			WHERE ug.userId = users.id AND g.name = ?%d)`,
+			lr.Group,
+		)
+	}
+	if lr.CreatedFrom != nil {
+		add("createdAt >= ?%d", utc(*lr.CreatedFrom))
+	}
+	if lr.CreatedTo != nil {
+		add("createdAt < ?%d", utc(*lr.CreatedTo))
+	}
+	if lr.Search != "" {
+		// LIKE ignores the case of ASCII letters, as ILIKE does
+		add(
+			`(email LIKE ?%[1]d ESCAPE '\' OR firstName LIKE ?%[1]d ESCAPE '\' OR lastName LIKE ?%[1]d ESCAPE '\')`,
+			"%"+escapeLike(lr.Search)+"%",
+		)
+	}
+
+	return conds, args
+}
+
+// idDesc sorts the id tie breaker in the direction of the last requested
+// field, which lets the keyset condition use a single index scan.
+func idDesc(sort []list.SortField) bool {
+	if len(sort) == 0 {
+		return false
+	}
+	return sort[len(sort)-1].Desc
+}
+
+// listValue converts a cursor value to what the column stores, times are
+// compared as text so they have to be formatted the same way.
+func listValue(field, value string) interface{} {
+	switch field {
+	case "id":
+		id, _ := strconv.Atoi(value)
+		return id
+	case "createdAt":
+		t, _ := time.Parse(time.RFC3339Nano, value)
+		return utc(t)
+	}
+	return value
+}
@@ -0,0 +1,20 @@
+package sqlite
+
+import (
+	"embed"
+
+	"github.com/raisultan/abac/pkg/storage/migrate"
+)
+
+//go:embed migrations/*.sql
+var migrations embed.FS
+
+// Migrator returns the migrator of the migrations built into the binary.
+// There is no lock, a database file is only used by one server.
+func (s *Storage) Migrator() (*migrate.Migrator, error) {
+	ms, err := migrate.Load(migrations, "migrations")
+	if err != nil {
+		return nil, err
+	}
+	return migrate.New(s.db, ms, nil), nil
+}
@@ -0,0 +1,202 @@
+-- timestamps are written by the storage in UTC so they compare as text,
+-- JSON is kept as text and arrays as JSON arrays
+CREATE TABLE IF NOT EXISTS users
+(
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    email VARCHAR(256) NOT NULL UNIQUE,
+    password VARCHAR(256) NOT NULL,
+    firstName TEXT NOT NULL,
+    lastName TEXT NOT NULL,
+    isAdmin BOOLEAN NOT NULL DEFAULT FALSE,
+    isApproved BOOLEAN NOT NULL DEFAULT FALSE,
+    attributes TEXT NOT NULL DEFAULT '{}',
+    version INTEGER NOT NULL DEFAULT 1,
+    createdAt TIMESTAMP NOT NULL,
+    updatedAt TIMESTAMP NOT NULL,
+    disabledAt TIMESTAMP DEFAULT NULL,
+    deletedAt TIMESTAMP DEFAULT NULL
+);
+
+CREATE INDEX IF NOT EXISTS users_created_at_idx ON users (createdAt, id);
+CREATE INDEX IF NOT EXISTS users_last_name_idx ON users (lastName, id);
+CREATE INDEX IF NOT EXISTS users_deleted_at_idx ON users (deletedAt) WHERE deletedAt IS NOT NULL;
+
+CREATE TABLE IF NOT EXISTS oauth_clients
+(
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    clientId VARCHAR(256) NOT NULL UNIQUE,
+    secret VARCHAR(256) NOT NULL,
+    name TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS revoked_tokens
+(
+    jti VARCHAR(64) PRIMARY KEY,
+    expiresAt TIMESTAMP NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS groups
+(
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name VARCHAR(256) NOT NULL UNIQUE
+);
+
+CREATE TABLE IF NOT EXISTS user_groups
+(
+    userId INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    groupId INTEGER NOT NULL REFERENCES groups(id) ON DELETE CASCADE,
+
+    PRIMARY KEY (userId, groupId)
+);
+
+CREATE TABLE IF NOT EXISTS user_identities
+(
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    userId INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    issuer TEXT NOT NULL,
+    subject TEXT NOT NULL,
+
+    UNIQUE (issuer, subject)
+);
+
+CREATE TABLE IF NOT EXISTS webauthn_credentials
+(
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    userId INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    credentialId BLOB NOT NULL UNIQUE,
+    publicKey BLOB NOT NULL,
+    signCount BIGINT NOT NULL DEFAULT 0
+);
+
+CREATE TABLE IF NOT EXISTS webauthn_challenges
+(
+    challenge VARCHAR(128) PRIMARY KEY,
+    userId INTEGER REFERENCES users(id) ON DELETE CASCADE,
+    ceremony VARCHAR(32) NOT NULL,
+    expiresAt TIMESTAMP NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS attribute_definitions
+(
+    name VARCHAR(64) PRIMARY KEY,
+    type VARCHAR(16) NOT NULL,
+    required BOOLEAN NOT NULL DEFAULT FALSE,
+    defaultValue TEXT DEFAULT NULL,
+    allowedValues TEXT NOT NULL DEFAULT '[]',
+    description TEXT NOT NULL DEFAULT ''
+);
+
+CREATE TABLE IF NOT EXISTS resources
+(
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    type VARCHAR(64) NOT NULL,
+    externalId VARCHAR(256) NOT NULL,
+    ownerId INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    parentId INTEGER REFERENCES resources(id),
+    attributes TEXT NOT NULL DEFAULT '{}',
+    createdAt TIMESTAMP NOT NULL,
+    updatedAt TIMESTAMP NOT NULL,
+
+    UNIQUE (type, externalId)
+);
+
+CREATE INDEX IF NOT EXISTS resources_parent_id_idx ON resources (parentId);
+CREATE INDEX IF NOT EXISTS resources_owner_id_idx ON resources (ownerId);
+
+CREATE TABLE IF NOT EXISTS audit_events
+(
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    occurredAt TIMESTAMP NOT NULL,
+    type VARCHAR(64) NOT NULL,
+    actor TEXT NOT NULL DEFAULT '',
+    subject TEXT NOT NULL DEFAULT '',
+    action TEXT NOT NULL DEFAULT '',
+    resource TEXT NOT NULL DEFAULT '',
+    result VARCHAR(16) NOT NULL,
+    remoteAddr TEXT NOT NULL DEFAULT '',
+    details TEXT NOT NULL DEFAULT '{}',
+    prevHash BLOB,
+    hash BLOB
+);
+
+CREATE INDEX IF NOT EXISTS audit_events_occurred_at_idx ON audit_events (occurredAt);
+CREATE INDEX IF NOT EXISTS audit_events_actor_idx ON audit_events (actor, id);
+CREATE INDEX IF NOT EXISTS audit_events_subject_idx ON audit_events (subject, id);
+
+CREATE TABLE IF NOT EXISTS audit_checkpoints
+(
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    lastEventId BIGINT NOT NULL,
+    hash BLOB NOT NULL,
+    signature BLOB NOT NULL,
+    createdAt TIMESTAMP NOT NULL
+);
+
+-- audit events and checkpoints can only be appended
+CREATE TRIGGER IF NOT EXISTS audit_events_no_update BEFORE UPDATE ON audit_events
+BEGIN
+    SELECT RAISE(ABORT, 'audit_events is append-only');
+END;
+
+CREATE TRIGGER IF NOT EXISTS audit_events_no_delete BEFORE DELETE ON audit_events
+BEGIN
+    SELECT RAISE(ABORT, 'audit_events is append-only');
+END;
+
+CREATE TRIGGER IF NOT EXISTS audit_checkpoints_no_update BEFORE UPDATE ON audit_checkpoints
+BEGIN
+    SELECT RAISE(ABORT, 'audit_checkpoints is append-only');
+END;
+
+CREATE TRIGGER IF NOT EXISTS audit_checkpoints_no_delete BEFORE DELETE ON audit_checkpoints
+BEGIN
+    SELECT RAISE(ABORT, 'audit_checkpoints is append-only');
+END;
+
+CREATE TABLE IF NOT EXISTS outbox_events
+(
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    type VARCHAR(64) NOT NULL,
+    subject TEXT NOT NULL DEFAULT '',
+    occurredAt TIMESTAMP NOT NULL,
+    data TEXT NOT NULL DEFAULT '{}',
+    attempts INTEGER NOT NULL DEFAULT 0,
+    nextAttemptAt TIMESTAMP NOT NULL,
+    lastError TEXT,
+    publishedAt TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS outbox_events_pending_idx ON outbox_events (nextAttemptAt, id) WHERE publishedAt IS NULL;
+CREATE INDEX IF NOT EXISTS outbox_events_published_at_idx ON outbox_events (publishedAt) WHERE publishedAt IS NOT NULL;
+CREATE INDEX IF NOT EXISTS outbox_events_type_idx ON outbox_events (type, id);
+
+CREATE TABLE IF NOT EXISTS webhook_subscriptions
+(
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    url TEXT NOT NULL,
+    eventTypes TEXT NOT NULL,
+    active BOOLEAN NOT NULL DEFAULT TRUE,
+    secret TEXT NOT NULL,
+    createdAt TIMESTAMP NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS webhook_deliveries
+(
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    subscriptionId INTEGER NOT NULL REFERENCES webhook_subscriptions(id) ON DELETE CASCADE,
+    eventId BIGINT NOT NULL,
+    eventType VARCHAR(64) NOT NULL,
+    payload TEXT NOT NULL,
+    status VARCHAR(16) NOT NULL DEFAULT 'pending',
+    attempts INTEGER NOT NULL DEFAULT 0,
+    nextAttemptAt TIMESTAMP,
+    lastStatusCode INTEGER,
+    lastError TEXT,
+    createdAt TIMESTAMP NOT NULL,
+    deliveredAt TIMESTAMP,
+
+    UNIQUE (subscriptionId, eventId)
+);
+
+CREATE INDEX IF NOT EXISTS webhook_deliveries_pending_idx ON webhook_deliveries (nextAttemptAt, id) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS webhook_deliveries_subscription_idx ON webhook_deliveries (subscriptionId, id);
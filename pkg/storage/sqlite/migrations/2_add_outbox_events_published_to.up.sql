@@ -0,0 +1,5 @@
+-- the sinks an event was published to as a JSON array, so a failed sink is
+-- retried alone
+ALTER TABLE outbox_events ADD COLUMN publishedTo TEXT NOT NULL DEFAULT '[]';
+
+CREATE INDEX IF NOT EXISTS outbox_events_subject_pending_idx ON outbox_events (subject, id) WHERE publishedAt IS NULL;
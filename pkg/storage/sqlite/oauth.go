@@ -0,0 +1,71 @@
+package sqlite
+
+import (
+	"context"
+	"time"
+
+	"github.com/raisultan/abac/pkg/oauth"
+)
+
+func (s *Storage) GetClientByClientID(ctx context.Context, clientID string) (oauth.Client, error) {
+	c := oauth.Client{}
+
+	err := s.conn(ctx).QueryRowContext(
+		ctx,
+		"SELECT id, clientId, secret, name FROM oauth_clients WHERE clientId=?1",
+		clientID,
+	).Scan(&c.ID, &c.ClientID, &c.Secret, &c.Name)
+
+	if err != nil {
+		return oauth.Client{}, err
+	}
+
+	return c, nil
+}
+
+// AddClient registers an OAuth client with the given secret, there is no
+// route for it.
+func (s *Storage) AddClient(ctx context.Context, clientID, secret, name string) (int, error) {
+	hash, err := s.hashPassword(secret)
+	if err != nil {
+		return 0, err
+	}
+
+	var id int
+	err = s.conn(ctx).QueryRowContext(
+		ctx,
+		"INSERT INTO oauth_clients(clientId, secret, name) VALUES(?1, ?2, ?3) RETURNING id",
+		clientID,
+		hash,
+		name,
+	).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+func (s *Storage) RevokeToken(ctx context.Context, jti string, expiresAt time.Time) error {
+	_, err := s.conn(ctx).ExecContext(
+		ctx,
+		"INSERT INTO revoked_tokens(jti, expiresAt) VALUES(?1, ?2) ON CONFLICT (jti) DO NOTHING",
+		jti,
+		utc(expiresAt),
+	)
+	return err
+}
+
+func (s *Storage) IsTokenRevoked(ctx context.Context, jti string) (bool, error) {
+	var revoked bool
+	err := s.conn(ctx).QueryRowContext(
+		ctx,
+		"SELECT EXISTS(SELECT 1 FROM revoked_tokens WHERE jti=?1)",
+		jti,
+	).Scan(&revoked)
+
+	if err != nil {
+		return false, err
+	}
+
+	return revoked, nil
+}
@@ -0,0 +1,439 @@
+// Package sqlite stores everything in a single SQLite file, for single node
+// deployments and CI. It implements the same repositories as the postgres
+// storage with the same semantics and errors.
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+	"github.com/raisultan/abac/pkg/login"
+	"github.com/raisultan/abac/pkg/register"
+	"github.com/raisultan/abac/pkg/retrieve"
+	"github.com/raisultan/abac/pkg/tracing"
+	"github.com/raisultan/abac/pkg/update"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const updateUserColumns = "id, email, firstName, lastName, isAdmin, isApproved, updatedAt, version"
+
+type Storage struct {
+	db   *sql.DB
+	cost int
+}
+
+// Config is the database file of the storage, ":memory:" keeps it in
+// memory.
+type Config struct {
+	Path string
+
+	// BcryptCost is the cost passwords are hashed with, 8 when zero
+	BcryptCost int
+
+	// SkipMigrations opens the database as it is, for running the
+	// migrations by hand
+	SkipMigrations bool
+}
+
+// querier is implemented by both *sql.DB and *sql.Tx.
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+type txKey struct{}
+
+// NewStorage opens the database and applies the migrations it is missing,
+// unless SkipMigrations is set.
+func NewStorage(c Config) (*Storage, error) {
+	// transactions take the write lock right away, so a read followed by a
+	// write in one transaction can not fail halfway with SQLITE_BUSY
+	db, err := sql.Open("sqlite3", "file:"+c.Path+"?_foreign_keys=1&_txlock=immediate&_busy_timeout=5000")
+	if err != nil {
+		return nil, err
+	}
+
+	// SQLite has a single writer, and an in-memory database lives in a
+	// single connection
+	db.SetMaxOpenConns(1)
+
+	s := &Storage{db, c.BcryptCost}
+	if s.cost == 0 {
+		s.cost = 8
+	}
+	if c.SkipMigrations {
+		return s, nil
+	}
+
+	m, err := s.Migrator()
+	if err == nil {
+		err = m.Up(context.Background())
+	}
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// DB is the connection pool of the storage, for its stats.
+func (s *Storage) DB() *sql.DB {
+	return s.db
+}
+
+func (s *Storage) CreateUser(ctx context.Context, ru register.UserRegisterRequest) (register.UserRegisterResponse, error) {
+	hashedPasswordStr, err := s.hashPassword(ru.Password)
+	if err != nil {
+		return register.UserRegisterResponse{}, err
+	}
+
+	t := now()
+	err = s.conn(ctx).QueryRowContext(
+		ctx,
+		`INSERT INTO users(email, password, firstName, lastName, createdAt, updatedAt)
+		VALUES(?1, ?2, ?3, ?4, ?5, ?5) RETURNING id`,
+		ru.Email,
+		hashedPasswordStr,
+		ru.FirstName,
+		ru.LastName,
+		t,
+	).Scan(&ru.ID)
+
+	if err != nil {
+		if isConstraintErr(err, sqlite3.ErrConstraintUnique) {
+			return register.UserRegisterResponse{}, register.ErrDuplicate
+		}
+		return register.UserRegisterResponse{}, err
+	}
+
+	resp := register.UserRegisterResponse{
+		ID:        ru.ID,
+		Email:     ru.Email,
+		FirstName: ru.FirstName,
+		LastName:  ru.LastName,
+	}
+	return resp, nil
+}
+
+func (s *Storage) CheckUserExists(ctx context.Context, ru register.UserRegisterRequest) (bool, error) {
+	err := s.conn(ctx).QueryRowContext(
+		ctx,
+		"SELECT email FROM users WHERE email=?1",
+		ru.Email,
+	).Scan(&ru.Email)
+
+	if err != nil {
+		if err != sql.ErrNoRows {
+			return false, err
+		}
+		return false, nil
+	}
+
+	return true, nil
+}
+
+// CreatePasswordlessUser creates a user that can only sign in through an
+// external identity provider, an empty hash never matches a bcrypt comparison.
+func (s *Storage) CreatePasswordlessUser(ctx context.Context, email, firstName, lastName string) (int, error) {
+	var id int
+	t := now()
+	err := s.conn(ctx).QueryRowContext(
+		ctx,
+		`INSERT INTO users(email, password, firstName, lastName, createdAt, updatedAt)
+		VALUES(?1, '', ?2, ?3, ?4, ?4) RETURNING id`,
+		email,
+		firstName,
+		lastName,
+		t,
+	).Scan(&id)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+func (s *Storage) GetUserIDByEmail(ctx context.Context, email string) (int, error) {
+	var id int
+	err := s.conn(ctx).QueryRowContext(ctx, "SELECT id FROM users WHERE email=?1", email).Scan(&id)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+// IsUserDisabled reports whether the user with the given email has been
+// disabled or deleted, unknown users are not considered disabled.
+func (s *Storage) IsUserDisabled(ctx context.Context, email string) (bool, error) {
+	var disabled bool
+	err := s.conn(ctx).QueryRowContext(
+		ctx,
+		"SELECT disabledAt IS NOT NULL OR deletedAt IS NOT NULL FROM users WHERE email=?1",
+		email,
+	).Scan(&disabled)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return disabled, nil
+}
+
+func (s *Storage) GetUserByID(ctx context.Context, uID int) (retrieve.UserRetrieveResponse, error) {
+	u := retrieve.UserRetrieveResponse{}
+
+	err := s.conn(ctx).QueryRowContext(
+		ctx,
+		`SELECT id, email, firstName, lastName, isAdmin, isApproved, updatedAt, version
+		FROM users WHERE id=?1 AND deletedAt IS NULL`,
+		uID,
+	).Scan(&u.ID, &u.Email, &u.FirstName, &u.LastName, &u.IsAdmin, &u.IsApproved, &u.UpdatedAt, &u.Version)
+
+	if err != nil {
+		return retrieve.UserRetrieveResponse{}, err
+	}
+
+	return u, nil
+}
+
+func (s *Storage) FindUserByEmail(ctx context.Context, email string) (retrieve.UserRetrieveResponse, error) {
+	u := retrieve.UserRetrieveResponse{}
+
+	err := s.conn(ctx).QueryRowContext(
+		ctx,
+		`SELECT id, email, firstName, lastName, isAdmin, isApproved, updatedAt, version
+		FROM users WHERE email=?1 AND deletedAt IS NULL`,
+		email,
+	).Scan(&u.ID, &u.Email, &u.FirstName, &u.LastName, &u.IsAdmin, &u.IsApproved, &u.UpdatedAt, &u.Version)
+
+	if err != nil {
+		return retrieve.UserRetrieveResponse{}, err
+	}
+
+	return u, nil
+}
+
+func (s *Storage) GetUserByEmail(ctx context.Context, r login.UserLoginRequest) (login.UserLoginRequest, error) {
+	u := login.UserLoginRequest{}
+	err := s.conn(ctx).QueryRowContext(
+		ctx,
+		"SELECT email, password FROM users WHERE email=?1 AND deletedAt IS NULL",
+		r.Email,
+	).Scan(&u.Email, &u.Password)
+
+	if err != nil {
+		return login.UserLoginRequest{}, err
+	}
+
+	return u, nil
+}
+
+// UpdateUser changes the fields of r that are set and bumps the version in
+// a single statement, a version check failure is told apart from a missing
+// user only when nothing was updated.
+func (s *Storage) UpdateUser(ctx context.Context, r update.UserPatchRequest) (update.UserRetrieveResponse, error) {
+	u := update.UserRetrieveResponse{}
+	err := s.conn(ctx).QueryRowContext(
+		ctx,
+		`UPDATE users SET
+			firstName=COALESCE(?1, firstName),
+			lastName=COALESCE(?2, lastName),
+			version=version+1,
+			updatedAt=?5
+		WHERE id=?3 AND deletedAt IS NULL AND (?4 = 0 OR version=?4)
+		RETURNING `+updateUserColumns,
+		r.FirstName,
+		r.LastName,
+		r.ID,
+		r.Version,
+		now(),
+	).Scan(&u.ID, &u.Email, &u.FirstName, &u.LastName, &u.IsAdmin, &u.IsApproved, timestamp{&u.UpdatedAt}, &u.Version)
+
+	if err == sql.ErrNoRows && r.Version != 0 {
+		var exists bool
+		if err := s.conn(ctx).QueryRowContext(
+			ctx,
+			"SELECT EXISTS (SELECT 1 FROM users WHERE id=?1 AND deletedAt IS NULL)",
+			r.ID,
+		).Scan(&exists); err != nil {
+			return update.UserRetrieveResponse{}, err
+		}
+		if exists {
+			return update.UserRetrieveResponse{}, update.VersionMismatchErr
+		}
+	}
+
+	if err != nil {
+		return update.UserRetrieveResponse{}, err
+	}
+
+	return u, nil
+}
+
+// ApproveUser approves a user, approving an approved user changes nothing.
+func (s *Storage) ApproveUser(ctx context.Context, id int) (update.UserRetrieveResponse, bool, error) {
+	u := update.UserRetrieveResponse{}
+	err := s.conn(ctx).QueryRowContext(
+		ctx,
+		`UPDATE users SET isApproved=TRUE, version=version+1, updatedAt=?2
+		WHERE id=?1 AND deletedAt IS NULL AND NOT isApproved
+		RETURNING `+updateUserColumns,
+		id,
+		now(),
+	).Scan(&u.ID, &u.Email, &u.FirstName, &u.LastName, &u.IsAdmin, &u.IsApproved, timestamp{&u.UpdatedAt}, &u.Version)
+
+	if err == sql.ErrNoRows {
+		err = s.conn(ctx).QueryRowContext(
+			ctx,
+			"SELECT "+updateUserColumns+" FROM users WHERE id=?1 AND deletedAt IS NULL",
+			id,
+		).Scan(&u.ID, &u.Email, &u.FirstName, &u.LastName, &u.IsAdmin, &u.IsApproved, &u.UpdatedAt, &u.Version)
+		return u, false, err
+	}
+	if err != nil {
+		return update.UserRetrieveResponse{}, false, err
+	}
+
+	return u, true, nil
+}
+
+// DeleteUser soft deletes a user, the row is kept until it is purged.
+func (s *Storage) DeleteUser(ctx context.Context, uID int) error {
+	return s.execOne(ctx, "UPDATE users SET deletedAt=?2 WHERE id=?1 AND deletedAt IS NULL", uID, now())
+}
+
+func (s *Storage) RestoreUser(ctx context.Context, uID int) error {
+	return s.execOne(ctx, "UPDATE users SET deletedAt=NULL WHERE id=?1 AND deletedAt IS NOT NULL", uID)
+}
+
+func (s *Storage) PurgeDeletedUsers(ctx context.Context, before time.Time) (int64, error) {
+	res, err := s.conn(ctx).ExecContext(ctx, "DELETE FROM users WHERE deletedAt < ?1", utc(before))
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// SetUserAdmin grants or takes away admin rights. There is no route for it,
+// local setups use it to create their first admin.
+func (s *Storage) SetUserAdmin(ctx context.Context, id int, admin bool) error {
+	return s.execOne(
+		ctx,
+		"UPDATE users SET isAdmin=?2, version=version+1, updatedAt=?3 WHERE id=?1 AND deletedAt IS NULL",
+		id,
+		admin,
+		now(),
+	)
+}
+
+// WithinTx runs fn in a transaction, or in the one ctx already carries.
+func (s *Storage) WithinTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	if _, ok := ctx.Value(txKey{}).(*sql.Tx); ok {
+		return fn(ctx)
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := fn(context.WithValue(ctx, txKey{}, tx)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// conn returns the transaction ctx carries, or the pool outside of one.
+func (s *Storage) conn(ctx context.Context) querier {
+	if tx, ok := ctx.Value(txKey{}).(*sql.Tx); ok {
+		return tracing.SQL(tx, "sqlite")
+	}
+	return tracing.SQL(s.db, "sqlite")
+}
+
+func isConstraintErr(err error, code sqlite3.ErrNoExtended) bool {
+	sqliteErr, ok := err.(sqlite3.Error)
+	return ok && sqliteErr.ExtendedCode == code
+}
+
+func (s *Storage) hashPassword(password string) (string, error) {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), s.cost)
+	if err != nil {
+		return "", err
+	}
+	return string(hashedPassword), nil
+}
+
+// execOne runs a statement that is expected to change exactly one row and
+// reports sql.ErrNoRows when nothing matched.
+func (s *Storage) execOne(ctx context.Context, query string, args ...interface{}) error {
+	res, err := s.conn(ctx).ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// utc is how times are stored: in UTC, so they compare as text, and with
+// the precision postgres keeps.
+func utc(t time.Time) time.Time {
+	return t.UTC().Truncate(time.Microsecond)
+}
+
+func now() time.Time {
+	return utc(time.Now())
+}
+
+// timestamp scans a time SQLite returns as text. Only plain columns come
+// back as times, the values of RETURNING clauses and expressions do not.
+type timestamp struct {
+	t *time.Time
+}
+
+func (ts timestamp) Scan(v interface{}) error {
+	switch v := v.(type) {
+	case time.Time:
+		*ts.t = v
+		return nil
+	case []byte:
+		return ts.parse(string(v))
+	case string:
+		return ts.parse(v)
+	}
+	return fmt.Errorf("sqlite: can not scan %T into a time", v)
+}
+
+func (ts timestamp) parse(s string) error {
+	for _, layout := range sqlite3.SQLiteTimestampFormats {
+		if t, err := time.Parse(layout, s); err == nil {
+			*ts.t = t.UTC()
+			return nil
+		}
+	}
+	return fmt.Errorf("sqlite: invalid time %q", s)
+}
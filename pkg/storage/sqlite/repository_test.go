@@ -0,0 +1,20 @@
+package sqlite_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/raisultan/abac/pkg/storage/sqlite"
+	"github.com/raisultan/abac/pkg/storage/storagetest"
+)
+
+func TestConformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storagetest.Storage {
+		s, err := sqlite.NewStorage(sqlite.Config{Path: filepath.Join(t.TempDir(), "abac.db")})
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { s.DB().Close() })
+		return s
+	})
+}
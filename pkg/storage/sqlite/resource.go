@@ -0,0 +1,282 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/mattn/go-sqlite3"
+	"github.com/raisultan/abac/pkg/resource"
+)
+
+const resourceColumns = `r.id, r.type, r.externalId, r.ownerId, p.type, p.externalId,
+	r.attributes, r.createdAt, r.updatedAt`
+
+func (s *Storage) UpsertResource(ctx context.Context, res resource.Resource) (resource.Resource, bool, error) {
+	var created bool
+	err := s.WithinTx(ctx, func(ctx context.Context) error {
+		var err error
+		res, created, err = s.upsertResource(ctx, res)
+		return err
+	})
+	if err != nil {
+		return resource.Resource{}, false, err
+	}
+
+	return res, created, nil
+}
+
+func (s *Storage) UpsertResources(ctx context.Context, resources []resource.Resource) ([]resource.Resource, error) {
+	saved := make([]resource.Resource, 0, len(resources))
+	err := s.WithinTx(ctx, func(ctx context.Context) error {
+		for i, res := range resources {
+			res, _, err := s.upsertResource(ctx, res)
+			if err != nil {
+				return &resource.ItemErr{Index: i, Err: err}
+			}
+			saved = append(saved, res)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return saved, nil
+}
+
+func (s *Storage) upsertResource(ctx context.Context, res resource.Resource) (resource.Resource, bool, error) {
+	q := s.conn(ctx)
+	var parentID *int
+	if res.Parent != nil {
+		var id int
+		err := q.QueryRowContext(
+			ctx,
+			"SELECT id FROM resources WHERE type=?1 AND externalId=?2",
+			res.Parent.Type,
+			res.Parent.ExternalID,
+		).Scan(&id)
+		if err == sql.ErrNoRows {
+			return res, false, resource.ParentNotFoundErr
+		}
+		if err != nil {
+			return res, false, err
+		}
+
+		// the new parent must not be the resource itself or one of its descendants
+		var cycle bool
+		err = q.QueryRowContext(
+			ctx,
+			`WITH RECURSIVE chain AS (
+				SELECT id, parentId, 0 AS depth FROM resources WHERE id=?1
+				UNION ALL
+				SELECT r.id, r.parentId, c.depth + 1 FROM resources r
+				JOIN chain c ON r.id = c.parentId WHERE c.depth < ?4
+			)
+			SELECT EXISTS (
+				SELECT 1 FROM chain JOIN resources self ON self.id = chain.id
+				WHERE self.type=?2 AND self.externalId=?3
+			)`,
+			id,
+			res.Type,
+			res.ExternalID,
+			resource.MaxDepth,
+		).Scan(&cycle)
+		if err != nil {
+			return res, false, err
+		}
+		if cycle {
+			return res, false, resource.CycleErr
+		}
+		parentID = &id
+	}
+
+	attrs, err := json.Marshal(res.Attributes)
+	if err != nil {
+		return res, false, err
+	}
+
+	// SQLite can not tell an insert from an update in RETURNING, writes are
+	// serialized so looking first is as good
+	var exists bool
+	err = q.QueryRowContext(
+		ctx,
+		"SELECT EXISTS (SELECT 1 FROM resources WHERE type=?1 AND externalId=?2)",
+		res.Type,
+		res.ExternalID,
+	).Scan(&exists)
+	if err != nil {
+		return res, false, err
+	}
+
+	err = q.QueryRowContext(
+		ctx,
+		`INSERT INTO resources(type, externalId, ownerId, parentId, attributes, createdAt, updatedAt)
+		VALUES(?1, ?2, ?3, ?4, ?5, ?6, ?6)
+		ON CONFLICT (type, externalId) DO UPDATE SET
+			ownerId=excluded.ownerId,
+			parentId=excluded.parentId,
+			attributes=excluded.attributes,
+			updatedAt=excluded.updatedAt
+		RETURNING id, createdAt, updatedAt`,
+		res.Type,
+		res.ExternalID,
+		res.OwnerID,
+		parentID,
+		string(attrs),
+		now(),
+	).Scan(&res.ID, timestamp{&res.CreatedAt}, timestamp{&res.UpdatedAt})
+	if err != nil {
+		if isConstraintErr(err, sqlite3.ErrConstraintForeignKey) {
+			return res, false, resource.OwnerNotFoundErr
+		}
+		return res, false, err
+	}
+
+	return res, !exists, nil
+}
+
+func (s *Storage) GetResource(ctx context.Context, ref resource.Ref) (resource.Resource, error) {
+	res, err := scanResource(s.conn(ctx).QueryRowContext(
+		ctx,
+		`SELECT `+resourceColumns+` FROM resources r
+		LEFT JOIN resources p ON p.id = r.parentId
+		WHERE r.type=?1 AND r.externalId=?2`,
+		ref.Type,
+		ref.ExternalID,
+	))
+	if err == sql.ErrNoRows {
+		return resource.Resource{}, resource.NotFoundErr
+	}
+	return res, err
+}
+
+func (s *Storage) ListResources(ctx context.Context, lr resource.ListRequest) ([]resource.Resource, error) {
+	conds := []string{"TRUE"}
+	args := []interface{}{}
+
+	if lr.Type != "" {
+		args = append(args, lr.Type)
+		conds = append(conds, fmt.Sprintf("r.type = ?%d", len(args)))
+	}
+	if lr.Parent != nil {
+		args = append(args, lr.Parent.Type, lr.Parent.ExternalID)
+		conds = append(conds, fmt.Sprintf("p.type = ?%d AND p.externalId = ?%d", len(args)-1, len(args)))
+	}
+	if lr.OwnerID != nil {
+		args = append(args, *lr.OwnerID)
+		conds = append(conds, fmt.Sprintf("r.ownerId = ?%d", len(args)))
+	}
+
+	args = append(args, lr.Limit, lr.Offset)
+	rows, err := s.conn(ctx).QueryContext(
+		ctx,
+		fmt.Sprintf(
+			`SELECT `+resourceColumns+` FROM resources r
+			LEFT JOIN resources p ON p.id = r.parentId
+			WHERE %s ORDER BY r.id LIMIT ?%d OFFSET ?%d`,
+			strings.Join(conds, " AND "), len(args)-1, len(args),
+		),
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	resources := []resource.Resource{}
+	for rows.Next() {
+		res, err := scanResource(rows)
+		if err != nil {
+			return nil, err
+		}
+		resources = append(resources, res)
+	}
+
+	return resources, rows.Err()
+}
+
+func (s *Storage) DeleteResource(ctx context.Context, ref resource.Ref) error {
+	err := s.execOne(ctx, "DELETE FROM resources WHERE type=?1 AND externalId=?2", ref.Type, ref.ExternalID)
+	if err == sql.ErrNoRows {
+		return resource.NotFoundErr
+	}
+	if isConstraintErr(err, sqlite3.ErrConstraintForeignKey) {
+		return resource.HasChildrenErr
+	}
+	return err
+}
+
+func (s *Storage) GetResourceChain(ctx context.Context, ref resource.Ref, maxDepth int) ([]resource.Resource, error) {
+	rows, err := s.conn(ctx).QueryContext(
+		ctx,
+		`WITH RECURSIVE chain AS (
+			SELECT id, parentId, 0 AS depth FROM resources WHERE type=?1 AND externalId=?2
+			UNION ALL
+			SELECT r.id, r.parentId, c.depth + 1 FROM resources r
+			JOIN chain c ON r.id = c.parentId WHERE c.depth < ?3
+		)
+		SELECT `+resourceColumns+` FROM chain c
+		JOIN resources r ON r.id = c.id
+		LEFT JOIN resources p ON p.id = r.parentId
+		ORDER BY c.depth`,
+		ref.Type,
+		ref.ExternalID,
+		maxDepth,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	chain := []resource.Resource{}
+	for rows.Next() {
+		res, err := scanResource(rows)
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, res)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(chain) == 0 {
+		return nil, resource.NotFoundErr
+	}
+	return chain, nil
+}
+
+func scanResource(row scanner) (resource.Resource, error) {
+	res := resource.Resource{}
+	var parentType, parentExternalID sql.NullString
+	var raw []byte
+
+	err := row.Scan(
+		&res.ID,
+		&res.Type,
+		&res.ExternalID,
+		&res.OwnerID,
+		&parentType,
+		&parentExternalID,
+		&raw,
+		&res.CreatedAt,
+		&res.UpdatedAt,
+	)
+	if err != nil {
+		return resource.Resource{}, err
+	}
+
+	if parentType.Valid {
+		res.Parent = &resource.Ref{Type: parentType.String, ExternalID: parentExternalID.String}
+	}
+
+	res.Attributes = map[string]interface{}{}
+	if err := decodeJSON(raw, &res.Attributes); err != nil {
+		return resource.Resource{}, err
+	}
+
+	return res, nil
+}
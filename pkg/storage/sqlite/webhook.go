@@ -0,0 +1,333 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/raisultan/abac/pkg/event"
+	"github.com/raisultan/abac/pkg/webhook"
+)
+
+const subscriptionColumns = "id, url, eventTypes, active, createdAt"
+
+const deliveryColumns = `d.id, d.subscriptionId, d.eventId, d.eventType, d.payload, d.status, d.attempts,
+	d.nextAttemptAt, d.lastStatusCode, d.lastError, d.createdAt, d.deliveredAt`
+
+func (s *Storage) ListSubscriptions(ctx context.Context) ([]webhook.Subscription, error) {
+	rows, err := s.conn(ctx).QueryContext(ctx, "SELECT "+subscriptionColumns+" FROM webhook_subscriptions ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	subs := []webhook.Subscription{}
+	for rows.Next() {
+		sub, err := scanSubscription(rows)
+		if err != nil {
+			return nil, err
+		}
+		subs = append(subs, sub)
+	}
+
+	return subs, rows.Err()
+}
+
+func (s *Storage) GetSubscription(ctx context.Context, id int) (webhook.Subscription, error) {
+	sub, err := scanSubscription(s.conn(ctx).QueryRowContext(
+		ctx,
+		"SELECT "+subscriptionColumns+" FROM webhook_subscriptions WHERE id=?1",
+		id,
+	))
+	if err == sql.ErrNoRows {
+		return webhook.Subscription{}, webhook.NotFoundErr
+	}
+	return sub, err
+}
+
+func (s *Storage) CreateSubscription(ctx context.Context, sub webhook.Subscription) (webhook.Subscription, error) {
+	eventTypes, err := json.Marshal(sub.EventTypes)
+	if err != nil {
+		return webhook.Subscription{}, err
+	}
+
+	return scanSubscription(s.conn(ctx).QueryRowContext(
+		ctx,
+		`INSERT INTO webhook_subscriptions(url, eventTypes, active, secret, createdAt) VALUES(?1, ?2, ?3, ?4, ?5)
+		RETURNING `+subscriptionColumns,
+		sub.URL,
+		string(eventTypes),
+		sub.Active,
+		sub.Secret,
+		now(),
+	))
+}
+
+func (s *Storage) UpdateSubscription(ctx context.Context, sub webhook.Subscription) (webhook.Subscription, error) {
+	eventTypes, err := json.Marshal(sub.EventTypes)
+	if err != nil {
+		return webhook.Subscription{}, err
+	}
+
+	sub, err = scanSubscription(s.conn(ctx).QueryRowContext(
+		ctx,
+		`UPDATE webhook_subscriptions SET url=?2, eventTypes=?3, active=?4 WHERE id=?1
+		RETURNING `+subscriptionColumns,
+		sub.ID,
+		sub.URL,
+		string(eventTypes),
+		sub.Active,
+	))
+	if err == sql.ErrNoRows {
+		return webhook.Subscription{}, webhook.NotFoundErr
+	}
+	return sub, err
+}
+
+func (s *Storage) DeleteSubscription(ctx context.Context, id int) error {
+	err := s.execOne(ctx, "DELETE FROM webhook_subscriptions WHERE id=?1", id)
+	if err == sql.ErrNoRows {
+		return webhook.NotFoundErr
+	}
+	return err
+}
+
+// EnqueueDeliveries matches the event types of the subscriptions in Go,
+// they are stored as a JSON array.
+func (s *Storage) EnqueueDeliveries(ctx context.Context, e event.Event, payload []byte) error {
+	return s.WithinTx(ctx, func(ctx context.Context) error {
+		subs, err := s.ListSubscriptions(ctx)
+		if err != nil {
+			return err
+		}
+
+		t := now()
+		for _, sub := range subs {
+			if !sub.Active || !contains(sub.EventTypes, e.Type) {
+				continue
+			}
+
+			_, err := s.conn(ctx).ExecContext(
+				ctx,
+				`INSERT INTO webhook_deliveries(subscriptionId, eventId, eventType, payload, nextAttemptAt, createdAt)
+				VALUES(?1, ?2, ?3, ?4, ?5, ?5)
+				ON CONFLICT (subscriptionId, eventId) DO NOTHING`,
+				sub.ID,
+				e.ID,
+				e.Type,
+				string(payload),
+				t,
+			)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// ClaimDeliveries pushes the due time of the claimed deliveries past the
+// lease, deliveries to inactive subscriptions wait until they are active.
+func (s *Storage) ClaimDeliveries(ctx context.Context, limit int, lease time.Duration) ([]webhook.Delivery, error) {
+	deliveries := []webhook.Delivery{}
+	err := s.WithinTx(ctx, func(ctx context.Context) error {
+		t := now()
+		rows, err := s.conn(ctx).QueryContext(
+			ctx,
+			`SELECT `+deliveryColumns+`, s.url, s.secret FROM webhook_deliveries d
+			JOIN webhook_subscriptions s ON s.id = d.subscriptionId
+			WHERE d.status = 'pending' AND d.nextAttemptAt <= ?2 AND s.active
+			ORDER BY d.id LIMIT ?1`,
+			limit,
+			t,
+		)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var d webhook.Delivery
+			if err := scanDelivery(rows, &d, &d.URL, &d.Secret); err != nil {
+				return err
+			}
+			deliveries = append(deliveries, d)
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		next := t.Add(lease)
+		for i := range deliveries {
+			_, err := s.conn(ctx).ExecContext(
+				ctx,
+				"UPDATE webhook_deliveries SET nextAttemptAt=?2 WHERE id=?1",
+				deliveries[i].ID,
+				next,
+			)
+			if err != nil {
+				return err
+			}
+			deliveries[i].NextAttemptAt = &next
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return deliveries, nil
+}
+
+func (s *Storage) RecordAttempt(ctx context.Context, a webhook.Attempt) error {
+	var next *time.Time
+	if a.Status == webhook.Pending {
+		t := utc(a.NextAttemptAt)
+		next = &t
+	}
+
+	return s.execOne(
+		ctx,
+		`UPDATE webhook_deliveries SET
+			status=?2,
+			attempts=attempts+1,
+			nextAttemptAt=?3,
+			lastStatusCode=NULLIF(?4, 0),
+			lastError=NULLIF(?5, ''),
+			deliveredAt=CASE WHEN ?2 = 'succeeded' THEN ?6 ELSE deliveredAt END
+		WHERE id=?1`,
+		a.DeliveryID,
+		a.Status,
+		next,
+		a.StatusCode,
+		a.Error,
+		now(),
+	)
+}
+
+// ListDeliveries returns the deliveries of a subscription, newest first.
+func (s *Storage) ListDeliveries(ctx context.Context, lr webhook.DeliveryListRequest) ([]webhook.Delivery, error) {
+	conds := []string{"d.subscriptionId = ?1"}
+	args := []interface{}{lr.SubscriptionID}
+
+	if lr.Status != "" {
+		args = append(args, lr.Status)
+		conds = append(conds, fmt.Sprintf("d.status = ?%d", len(args)))
+	}
+	if lr.Before > 0 {
+		args = append(args, lr.Before)
+		conds = append(conds, fmt.Sprintf("d.id < ?%d", len(args)))
+	}
+
+	args = append(args, lr.Limit)
+	rows, err := s.conn(ctx).QueryContext(
+		ctx,
+		fmt.Sprintf(
+			"SELECT "+deliveryColumns+" FROM webhook_deliveries d WHERE %s ORDER BY d.id DESC LIMIT ?%d",
+			strings.Join(conds, " AND "), len(args),
+		),
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []webhook.Delivery{}
+	for rows.Next() {
+		var d webhook.Delivery
+		if err := scanDelivery(rows, &d); err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, d)
+	}
+
+	return deliveries, rows.Err()
+}
+
+// RedeliverDelivery makes a delivery due now with a fresh set of attempts.
+func (s *Storage) RedeliverDelivery(ctx context.Context, subscriptionID int, id int64) (webhook.Delivery, error) {
+	var d webhook.Delivery
+	err := s.WithinTx(ctx, func(ctx context.Context) error {
+		err := s.execOne(
+			ctx,
+			`UPDATE webhook_deliveries SET status='pending', attempts=0, nextAttemptAt=?3
+			WHERE id=?1 AND subscriptionId=?2`,
+			id,
+			subscriptionID,
+			now(),
+		)
+		if err != nil {
+			return err
+		}
+
+		return scanDelivery(
+			s.conn(ctx).QueryRowContext(ctx, "SELECT "+deliveryColumns+" FROM webhook_deliveries d WHERE d.id=?1", id),
+			&d,
+		)
+	})
+	if err == sql.ErrNoRows {
+		return webhook.Delivery{}, webhook.DeliveryNotFoundErr
+	}
+	return d, err
+}
+
+func (s *Storage) PurgeDeliveries(ctx context.Context, before time.Time) (int64, error) {
+	res, err := s.conn(ctx).ExecContext(
+		ctx,
+		"DELETE FROM webhook_deliveries WHERE status='succeeded' AND deliveredAt < ?1",
+		utc(before),
+	)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+func scanSubscription(row scanner) (webhook.Subscription, error) {
+	var sub webhook.Subscription
+	var eventTypes string
+	if err := row.Scan(&sub.ID, &sub.URL, &eventTypes, &sub.Active, timestamp{&sub.CreatedAt}); err != nil {
+		return webhook.Subscription{}, err
+	}
+
+	err := json.Unmarshal([]byte(eventTypes), &sub.EventTypes)
+	return sub, err
+}
+
+func scanDelivery(row scanner, d *webhook.Delivery, extra ...interface{}) error {
+	var payload string
+	dest := append([]interface{}{
+		&d.ID,
+		&d.SubscriptionID,
+		&d.EventID,
+		&d.EventType,
+		&payload,
+		&d.Status,
+		&d.Attempts,
+		&d.NextAttemptAt,
+		&d.LastStatusCode,
+		&d.LastError,
+		&d.CreatedAt,
+		&d.DeliveredAt,
+	}, extra...)
+
+	if err := row.Scan(dest...); err != nil {
+		return err
+	}
+	d.Payload = []byte(payload)
+
+	return nil
+}
+
+func contains(values []string, v string) bool {
+	for _, x := range values {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,13 @@
+// Package storage holds what the repositories of every storage backend
+// have in common.
+package storage
+
+import "context"
+
+// Transactor runs fn as a unit of work. The context passed to fn carries
+// the transaction, repository calls made with it take part in it, and fn
+// returning an error rolls everything back. Calls within fn join the
+// transaction already running.
+type Transactor interface {
+	WithinTx(ctx context.Context, fn func(ctx context.Context) error) error
+}
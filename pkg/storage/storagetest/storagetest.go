@@ -0,0 +1,712 @@
+// Package storagetest is the conformance suite of the storage backends. It
+// checks that every backend behaves the same way through the repository
+// interfaces, a backend's tests call Run with a fresh, empty store:
+//
+//	func TestConformance(t *testing.T) {
+//		storagetest.Run(t, func(t *testing.T) storagetest.Storage {
+//			return memory.NewStorage()
+//		})
+//	}
+package storagetest
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/raisultan/abac/pkg/attribute"
+	"github.com/raisultan/abac/pkg/audit"
+	"github.com/raisultan/abac/pkg/bulk"
+	"github.com/raisultan/abac/pkg/deactivate"
+	"github.com/raisultan/abac/pkg/delete"
+	"github.com/raisultan/abac/pkg/event"
+	"github.com/raisultan/abac/pkg/jwt_refresh"
+	"github.com/raisultan/abac/pkg/ldap"
+	"github.com/raisultan/abac/pkg/list"
+	"github.com/raisultan/abac/pkg/login"
+	"github.com/raisultan/abac/pkg/oauth"
+	"github.com/raisultan/abac/pkg/oidc"
+	"github.com/raisultan/abac/pkg/register"
+	"github.com/raisultan/abac/pkg/resource"
+	"github.com/raisultan/abac/pkg/retrieve"
+	"github.com/raisultan/abac/pkg/scim"
+	"github.com/raisultan/abac/pkg/storage"
+	"github.com/raisultan/abac/pkg/update"
+	"github.com/raisultan/abac/pkg/webauthn"
+	"github.com/raisultan/abac/pkg/webhook"
+)
+
+// Storage is what a backend has to implement to be checked.
+type Storage interface {
+	storage.Transactor
+
+	attribute.Repository
+	audit.Repository
+	bulk.Repository
+	deactivate.Repository
+	delete.Repository
+	event.Repository
+	jwt_refresh.Repository
+	ldap.Repository
+	list.Repository
+	login.Repository
+	oauth.Repository
+	oidc.Repository
+	register.Repository
+	resource.Repository
+	retrieve.Repository
+	scim.Repository
+	update.Repository
+	webauthn.Repository
+	webhook.Repository
+}
+
+// Run runs every check against stores returned by open, each check gets a
+// store of its own.
+func Run(t *testing.T, open func(t *testing.T) Storage) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, s Storage)
+	}{
+		{"Users", testUsers},
+		{"UpdateUser", testUpdateUser},
+		{"DeleteUser", testDeleteUser},
+		{"ListUsers", testListUsers},
+		{"Attributes", testAttributes},
+		{"Groups", testGroups},
+		{"Resources", testResources},
+		{"Audit", testAudit},
+		{"Outbox", testOutbox},
+		{"Webhooks", testWebhooks},
+		{"Transactions", testTransactions},
+		{"BulkImport", testBulkImport},
+		{"SCIM", testSCIM},
+		{"WebAuthn", testWebAuthn},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			tt.fn(t, open(t))
+		})
+	}
+}
+
+func testUsers(t *testing.T, s Storage) {
+	ctx := context.Background()
+	u := createUser(t, s, "ada@example.com", "Ada", "Lovelace")
+
+	if _, err := s.CreateUser(ctx, userRequest("ada@example.com", "Ada", "Lovelace")); err != register.ErrDuplicate {
+		t.Fatalf("creating a duplicate user: got %v, want %v", err, register.ErrDuplicate)
+	}
+
+	exists, err := s.CheckUserExists(ctx, register.UserRegisterRequest{Email: "ada@example.com"})
+	check(t, err)
+	if !exists {
+		t.Fatal("the created user does not exist")
+	}
+
+	got, err := s.GetUserByID(ctx, u.ID)
+	check(t, err)
+	if got.Email != u.Email || got.FirstName != "Ada" || got.IsApproved || got.Version != 1 {
+		t.Fatalf("got %+v", got)
+	}
+
+	if _, err := s.GetUserByID(ctx, u.ID+1000); err != sql.ErrNoRows {
+		t.Fatalf("getting a missing user: got %v, want %v", err, sql.ErrNoRows)
+	}
+
+	approved, changed, err := s.ApproveUser(ctx, u.ID)
+	check(t, err)
+	if !changed || !approved.IsApproved || approved.Version != 2 {
+		t.Fatalf("approving: got %+v, changed %v", approved, changed)
+	}
+
+	again, changed, err := s.ApproveUser(ctx, u.ID)
+	check(t, err)
+	if changed || again.Version != 2 {
+		t.Fatalf("approving twice: got %+v, changed %v", again, changed)
+	}
+}
+
+func testUpdateUser(t *testing.T, s Storage) {
+	ctx := context.Background()
+	u := createUser(t, s, "ada@example.com", "Ada", "Lovelace")
+
+	name := "Augusta"
+	got, err := s.UpdateUser(ctx, update.UserPatchRequest{ID: u.ID, FirstName: &name, Version: 1})
+	check(t, err)
+	if got.FirstName != name || got.LastName != "Lovelace" || got.Version != 2 {
+		t.Fatalf("got %+v", got)
+	}
+
+	if _, err := s.UpdateUser(ctx, update.UserPatchRequest{ID: u.ID, FirstName: &name, Version: 1}); err != update.VersionMismatchErr {
+		t.Fatalf("updating a stale version: got %v, want %v", err, update.VersionMismatchErr)
+	}
+
+	if _, err := s.UpdateUser(ctx, update.UserPatchRequest{ID: u.ID + 1000, FirstName: &name, Version: 1}); err != sql.ErrNoRows {
+		t.Fatalf("updating a missing user: got %v, want %v", err, sql.ErrNoRows)
+	}
+
+	// no version skips the check
+	got, err = s.UpdateUser(ctx, update.UserPatchRequest{ID: u.ID, LastName: &name})
+	check(t, err)
+	if got.LastName != name || got.Version != 3 {
+		t.Fatalf("got %+v", got)
+	}
+}
+
+func testDeleteUser(t *testing.T, s Storage) {
+	ctx := context.Background()
+	u := createUser(t, s, "ada@example.com", "Ada", "Lovelace")
+
+	check(t, s.DeleteUser(ctx, u.ID))
+	if err := s.DeleteUser(ctx, u.ID); err != sql.ErrNoRows {
+		t.Fatalf("deleting twice: got %v, want %v", err, sql.ErrNoRows)
+	}
+	if _, err := s.GetUserByID(ctx, u.ID); err != sql.ErrNoRows {
+		t.Fatalf("getting a deleted user: got %v, want %v", err, sql.ErrNoRows)
+	}
+
+	disabled, err := s.IsUserDisabled(ctx, u.Email)
+	check(t, err)
+	if !disabled {
+		t.Fatal("a deleted user is not disabled")
+	}
+
+	check(t, s.RestoreUser(ctx, u.ID))
+	if _, err := s.GetUserByID(ctx, u.ID); err != nil {
+		t.Fatalf("getting a restored user: %v", err)
+	}
+
+	check(t, s.DeleteUser(ctx, u.ID))
+	n, err := s.PurgeDeletedUsers(ctx, time.Now().Add(-time.Hour))
+	check(t, err)
+	if n != 0 {
+		t.Fatalf("purged %d users deleted after the cutoff", n)
+	}
+
+	n, err = s.PurgeDeletedUsers(ctx, time.Now().Add(time.Hour))
+	check(t, err)
+	if n != 1 {
+		t.Fatalf("purged %d users, want 1", n)
+	}
+	if err := s.RestoreUser(ctx, u.ID); err != sql.ErrNoRows {
+		t.Fatalf("restoring a purged user: got %v, want %v", err, sql.ErrNoRows)
+	}
+}
+
+func testListUsers(t *testing.T, s Storage) {
+	ctx := context.Background()
+	for i, last := range []string{"Hopper", "Lovelace", "Hopper", "Turing", "Lamarr"} {
+		createUser(t, s, fmt.Sprintf("user%d@example.com", i), "User", last)
+	}
+
+	sort := []list.SortField{{Name: "lastName"}}
+	page, err := s.GetAllUsers(ctx, list.UserListRequest{Sort: sort, Limit: 2})
+	check(t, err)
+	if len(page) != 2 || page[0].LastName != "Hopper" || page[1].LastName != "Hopper" || page[0].ID > page[1].ID {
+		t.Fatalf("first page: got %+v", page)
+	}
+
+	last := page[1]
+	page, err = s.GetAllUsers(ctx, list.UserListRequest{
+		Sort:  sort,
+		After: &list.Cursor{Values: []string{last.LastName}, ID: last.ID},
+		Limit: 10,
+	})
+	check(t, err)
+	var names []string
+	for _, u := range page {
+		names = append(names, u.LastName)
+	}
+	if fmt.Sprint(names) != "[Lamarr Lovelace Turing]" {
+		t.Fatalf("second page: got %v", names)
+	}
+
+	n, err := s.CountUsers(ctx, list.UserListRequest{Search: "LOVE"})
+	check(t, err)
+	if n != 1 {
+		t.Fatalf("searching: got %d users, want 1", n)
+	}
+
+	n, err = s.CountUsers(ctx, list.UserListRequest{Search: "%"})
+	check(t, err)
+	if n != 0 {
+		t.Fatalf("searching for a wildcard: got %d users, want 0", n)
+	}
+}
+
+func testAttributes(t *testing.T, s Storage) {
+	ctx := context.Background()
+	u := createUser(t, s, "ada@example.com", "Ada", "Lovelace")
+
+	check(t, s.SaveAttributeDefinition(ctx, attribute.Definition{
+		Name:    "clearance",
+		Type:    "string",
+		Default: "low",
+		Values:  []string{"low", "high"},
+	}))
+	defs, err := s.ListAttributeDefinitions(ctx)
+	check(t, err)
+	if len(defs) != 1 || defs[0].Default != "low" || fmt.Sprint(defs[0].Values) != "[low high]" {
+		t.Fatalf("got %+v", defs)
+	}
+
+	check(t, s.SetUserAttributes(ctx, u.ID, map[string]interface{}{"clearance": "high", "level": 3}))
+	attrs, err := s.GetUserAttributes(ctx, u.ID)
+	check(t, err)
+	if attrs["level"] != json.Number("3") || attrs["clearance"] != "high" {
+		t.Fatalf("got %#v", attrs)
+	}
+	check(t, s.WithinTx(ctx, func(ctx context.Context) error {
+		attrs, err = s.GetUserAttributesForUpdate(ctx, u.ID)
+		return err
+	}))
+	if attrs["clearance"] != "high" {
+		t.Fatalf("locked for update: got %#v", attrs)
+	}
+
+	check(t, s.DeleteAttributeDefinition(ctx, "clearance"))
+	attrs, err = s.GetUserAttributes(ctx, u.ID)
+	check(t, err)
+	if _, ok := attrs["clearance"]; ok || len(attrs) != 1 {
+		t.Fatalf("the values of a deleted definition are kept: %#v", attrs)
+	}
+	if err := s.DeleteAttributeDefinition(ctx, "clearance"); err != sql.ErrNoRows {
+		t.Fatalf("deleting a missing definition: got %v, want %v", err, sql.ErrNoRows)
+	}
+}
+
+func testGroups(t *testing.T, s Storage) {
+	ctx := context.Background()
+	ada := createUser(t, s, "ada@example.com", "Ada", "Lovelace")
+	alan := createUser(t, s, "alan@example.com", "Alan", "Turing")
+
+	changed, err := s.SyncGroupMembers(ctx, "admins", []string{ada.Email, alan.Email, "nobody@example.com"})
+	check(t, err)
+	if !changed {
+		t.Fatal("adding members is not reported as a change")
+	}
+	changed, err = s.SyncGroupMembers(ctx, "admins", []string{alan.Email})
+	check(t, err)
+	if !changed {
+		t.Fatal("removing a member is not reported as a change")
+	}
+	changed, err = s.SyncGroupMembers(ctx, "admins", []string{alan.Email})
+	check(t, err)
+	if changed {
+		t.Fatal("syncing the same members is reported as a change")
+	}
+
+	sub, err := s.GetSubject(ctx, ada.Email)
+	check(t, err)
+	if len(sub.Groups) != 0 {
+		t.Fatalf("a removed member keeps the group: %v", sub.Groups)
+	}
+
+	exists, err := s.GroupExists(ctx, "admins")
+	check(t, err)
+	if !exists {
+		t.Fatal("the synced group does not exist")
+	}
+
+	id, err := s.CreateGroup(ctx, "readers")
+	check(t, err)
+	check(t, s.ReplaceGroupMembers(ctx, id, []int{ada.ID, alan.ID}))
+	check(t, s.RemoveGroupMembers(ctx, id, []int{alan.ID}))
+
+	g, err := s.GetGroupWithMembers(ctx, id)
+	check(t, err)
+	if len(g.Members) != 1 || g.Members[0].ID != ada.ID {
+		t.Fatalf("got %+v", g)
+	}
+
+	check(t, s.DeleteGroup(ctx, id))
+	if _, err := s.GetGroupWithMembers(ctx, id); err != sql.ErrNoRows {
+		t.Fatalf("getting a deleted group: got %v, want %v", err, sql.ErrNoRows)
+	}
+
+	added, err := s.AddUserToGroups(ctx, alan.ID, []string{"staff", "admins", "eng"})
+	check(t, err)
+	if len(added) != 2 || added[0] != "eng" || added[1] != "staff" {
+		t.Fatalf("added to %v, want [eng staff]", added)
+	}
+	added, err = s.AddUserToGroups(ctx, alan.ID, []string{"eng"})
+	check(t, err)
+	if len(added) != 0 {
+		t.Fatalf("adding a member again added it to %v", added)
+	}
+}
+
+func testResources(t *testing.T, s Storage) {
+	ctx := context.Background()
+	u := createUser(t, s, "ada@example.com", "Ada", "Lovelace")
+
+	folder, created, err := s.UpsertResource(ctx, resource.Resource{Type: "folder", ExternalID: "f", OwnerID: &u.ID})
+	check(t, err)
+	if !created || folder.ID == 0 {
+		t.Fatalf("got %+v, created %v", folder, created)
+	}
+
+	doc := resource.Resource{Type: "doc", ExternalID: "d", Parent: &resource.Ref{Type: "folder", ExternalID: "f"}}
+	if _, created, err = s.UpsertResource(ctx, doc); err != nil || !created {
+		t.Fatalf("creating the child: created %v, err %v", created, err)
+	}
+
+	doc.Attributes = map[string]interface{}{"pages": 12}
+	saved, created, err := s.UpsertResource(ctx, doc)
+	check(t, err)
+	if created || saved.Attributes["pages"] != 12 {
+		t.Fatalf("updating: got %+v, created %v", saved, created)
+	}
+
+	cycle := resource.Resource{Type: "folder", ExternalID: "f", Parent: &resource.Ref{Type: "doc", ExternalID: "d"}}
+	if _, _, err := s.UpsertResource(ctx, cycle); err != resource.CycleErr {
+		t.Fatalf("creating a cycle: got %v, want %v", err, resource.CycleErr)
+	}
+
+	missing := 1000 + u.ID
+	if _, _, err := s.UpsertResource(ctx, resource.Resource{Type: "doc", ExternalID: "x", OwnerID: &missing}); err != resource.OwnerNotFoundErr {
+		t.Fatalf("saving with a missing owner: got %v, want %v", err, resource.OwnerNotFoundErr)
+	}
+
+	chain, err := s.GetResourceChain(ctx, resource.Ref{Type: "doc", ExternalID: "d"}, resource.MaxDepth)
+	check(t, err)
+	if len(chain) != 2 || chain[1].ID != folder.ID || chain[0].Attributes["pages"] != json.Number("12") {
+		t.Fatalf("got %+v", chain)
+	}
+
+	if err := s.DeleteResource(ctx, resource.Ref{Type: "folder", ExternalID: "f"}); err != resource.HasChildrenErr {
+		t.Fatalf("deleting a parent: got %v, want %v", err, resource.HasChildrenErr)
+	}
+
+	// the owner is unset when the user is purged
+	check(t, s.DeleteUser(ctx, u.ID))
+	_, err = s.PurgeDeletedUsers(ctx, time.Now().Add(time.Hour))
+	check(t, err)
+	got, err := s.GetResource(ctx, resource.Ref{Type: "folder", ExternalID: "f"})
+	check(t, err)
+	if got.OwnerID != nil {
+		t.Fatalf("the owner of a purged user's resource is %d", *got.OwnerID)
+	}
+}
+
+func testAudit(t *testing.T, s Storage) {
+	ctx := context.Background()
+	svc := audit.NewService(s, []byte("key"))
+
+	for _, typ := range []string{"login", "logout", "login"} {
+		svc.Record(ctx, audit.Event{Type: typ, Actor: "ada@example.com", Result: "success", Details: map[string]interface{}{"n": 1}})
+	}
+	if _, err := svc.Checkpoint(ctx); err != nil {
+		t.Fatal(err)
+	}
+	svc.Record(ctx, audit.Event{Type: "login", Result: "failure"})
+
+	report, err := svc.Verify(ctx)
+	check(t, err)
+	if !report.OK || report.EventsChecked != 4 || report.CheckpointsChecked != 1 {
+		t.Fatalf("got %+v", report)
+	}
+
+	events, err := s.ListAuditEvents(ctx, audit.ListRequest{Type: "login", Limit: 10})
+	check(t, err)
+	if len(events) != 3 || events[0].Result != "failure" || events[0].ID < events[1].ID {
+		t.Fatalf("got %+v", events)
+	}
+}
+
+func testOutbox(t *testing.T, s Storage) {
+	ctx := context.Background()
+	for i := 0; i < 3; i++ {
+		check(t, s.AppendEvent(ctx, event.New("user.created", event.UserSubject(i), map[string]interface{}{"id": i})))
+	}
+
+	claimed, err := s.ClaimEvents(ctx, 2, time.Minute)
+	check(t, err)
+	if len(claimed) != 2 || claimed[0].ID > claimed[1].ID {
+		t.Fatalf("got %+v", claimed)
+	}
+
+	// claimed events are leased
+	rest, err := s.ClaimEvents(ctx, 10, time.Minute)
+	check(t, err)
+	if len(rest) != 1 {
+		t.Fatalf("claimed %d events again", len(rest))
+	}
+
+	check(t, s.MarkEventPublished(ctx, claimed[0].ID))
+	check(t, s.RetryEvent(ctx, claimed[1].ID, time.Now().Add(-time.Second), "unavailable", []string{"log"}))
+
+	retried, err := s.ClaimEvents(ctx, 10, time.Minute)
+	check(t, err)
+	if len(retried) != 1 || retried[0].ID != claimed[1].ID || retried[0].Attempts != 1 || fmt.Sprint(retried[0].PublishedTo) != "[log]" {
+		t.Fatalf("got %+v", retried)
+	}
+
+	// a later event of the subject waits for the pending one
+	check(t, s.AppendEvent(ctx, event.New("user.updated", claimed[1].Subject, nil)))
+	check(t, s.RetryEvent(ctx, claimed[1].ID, time.Now().Add(time.Hour), "unavailable", []string{"log"}))
+	if held, err := s.ClaimEvents(ctx, 10, time.Minute); err != nil || len(held) != 0 {
+		t.Fatalf("claimed %+v (%v) while an earlier event of the subject is pending", held, err)
+	}
+	check(t, s.MarkEventPublished(ctx, claimed[1].ID))
+	next, err := s.ClaimEvents(ctx, 10, time.Minute)
+	check(t, err)
+	if len(next) != 1 || next[0].Type != "user.updated" || len(next[0].PublishedTo) != 0 {
+		t.Fatalf("got %+v", next)
+	}
+
+	n, err := s.PurgePublishedEvents(ctx, time.Now().Add(time.Hour))
+	check(t, err)
+	if n != 2 {
+		t.Fatalf("purged %d events, want 2", n)
+	}
+	if err := s.MarkEventPublished(ctx, claimed[0].ID); err != sql.ErrNoRows {
+		t.Fatalf("publishing a purged event: got %v, want %v", err, sql.ErrNoRows)
+	}
+
+	latest, err := s.LatestEvent(ctx, "user.created")
+	check(t, err)
+	if latest.Subject != event.UserSubject(2) {
+		t.Fatalf("got %+v", latest)
+	}
+}
+
+func testWebhooks(t *testing.T, s Storage) {
+	ctx := context.Background()
+	sub, err := s.CreateSubscription(ctx, webhook.Subscription{
+		URL:        "https://example.com/hook",
+		EventTypes: []string{"user.created"},
+		Active:     true,
+		Secret:     "secret",
+	})
+	check(t, err)
+	if sub.ID == 0 || sub.CreatedAt.IsZero() || fmt.Sprint(sub.EventTypes) != "[user.created]" {
+		t.Fatalf("got %+v", sub)
+	}
+
+	e := event.New("user.created", event.UserSubject(1), nil)
+	e.ID = 1
+	check(t, s.EnqueueDeliveries(ctx, e, []byte(`{"id":1}`)))
+	check(t, s.EnqueueDeliveries(ctx, e, []byte(`{"id":1}`)))
+	e.ID, e.Type = 2, "user.deleted"
+	check(t, s.EnqueueDeliveries(ctx, e, []byte(`{}`)))
+
+	claimed, err := s.ClaimDeliveries(ctx, 10, time.Minute)
+	check(t, err)
+	if len(claimed) != 1 || claimed[0].URL != sub.URL || claimed[0].Secret != "secret" || string(claimed[0].Payload) != `{"id":1}` {
+		t.Fatalf("got %+v", claimed)
+	}
+
+	check(t, s.RecordAttempt(ctx, webhook.Attempt{DeliveryID: claimed[0].ID, Status: webhook.Succeeded, StatusCode: 200}))
+	deliveries, err := s.ListDeliveries(ctx, webhook.DeliveryListRequest{SubscriptionID: sub.ID, Limit: 10})
+	check(t, err)
+	if len(deliveries) != 1 || deliveries[0].DeliveredAt == nil || *deliveries[0].LastStatusCode != 200 || deliveries[0].LastError != nil {
+		t.Fatalf("got %+v", deliveries)
+	}
+
+	d, err := s.RedeliverDelivery(ctx, sub.ID, claimed[0].ID)
+	check(t, err)
+	if d.Status != webhook.Pending || d.Attempts != 0 {
+		t.Fatalf("got %+v", d)
+	}
+	if _, err := s.RedeliverDelivery(ctx, sub.ID+1, claimed[0].ID); err != webhook.DeliveryNotFoundErr {
+		t.Fatalf("redelivering for another subscription: got %v, want %v", err, webhook.DeliveryNotFoundErr)
+	}
+
+	check(t, s.DeleteSubscription(ctx, sub.ID))
+	if _, err := s.GetSubscription(ctx, sub.ID); err != webhook.NotFoundErr {
+		t.Fatalf("getting a deleted subscription: got %v, want %v", err, webhook.NotFoundErr)
+	}
+}
+
+func testTransactions(t *testing.T, s Storage) {
+	ctx := context.Background()
+	failed := errors.New("failed")
+
+	err := s.WithinTx(ctx, func(ctx context.Context) error {
+		if _, err := s.CreateUser(ctx, userRequest("ada@example.com", "Ada", "Lovelace")); err != nil {
+			return err
+		}
+		return s.WithinTx(ctx, func(ctx context.Context) error {
+			if _, err := s.CreateUser(ctx, userRequest("alan@example.com", "Alan", "Turing")); err != nil {
+				return err
+			}
+			if err := s.AppendEvent(ctx, event.New("user.created", "", nil)); err != nil {
+				return err
+			}
+			return failed
+		})
+	})
+	if err != failed {
+		t.Fatalf("got %v, want %v", err, failed)
+	}
+
+	for _, email := range []string{"ada@example.com", "alan@example.com"} {
+		exists, err := s.CheckUserExists(ctx, register.UserRegisterRequest{Email: email})
+		check(t, err)
+		if exists {
+			t.Fatalf("%s was created in a rolled back transaction", email)
+		}
+	}
+	if _, err := s.LatestEvent(ctx, "user.created"); err != sql.ErrNoRows {
+		t.Fatalf("getting a rolled back event: got %v, want %v", err, sql.ErrNoRows)
+	}
+}
+
+func testBulkImport(t *testing.T, s Storage) {
+	ctx := context.Background()
+	u := createUser(t, s, "ada@example.com", "Ada", "Lovelace")
+
+	rows := []bulk.ImportRow{
+		{Line: 2, Email: "ada@example.com", FirstName: "Augusta", LastName: "Lovelace"},
+		{Line: 3, Email: "alan@example.com", FirstName: "Alan", LastName: "Turing", Password: "secret"},
+	}
+
+	imported, err := s.UpsertUsers(ctx, rows, true)
+	check(t, err)
+	if created, updated := countImported(imported); created != 1 || updated != 1 {
+		t.Fatalf("dry run: created %d, updated %d", created, updated)
+	}
+	exists, err := s.CheckUserExists(ctx, register.UserRegisterRequest{Email: "alan@example.com"})
+	check(t, err)
+	if exists {
+		t.Fatal("a dry run created a user")
+	}
+
+	imported, err = s.UpsertUsers(ctx, rows, false)
+	check(t, err)
+	if created, updated := countImported(imported); created != 1 || updated != 1 {
+		t.Fatalf("created %d, updated %d", created, updated)
+	}
+	for _, iu := range imported {
+		if iu.Created {
+			continue
+		}
+		if iu.ID != u.ID || iu.Email != u.Email {
+			t.Fatalf("updated user %d %s, want %d %s", iu.ID, iu.Email, u.ID, u.Email)
+		}
+	}
+	got, err := s.GetUserByID(ctx, u.ID)
+	check(t, err)
+	if got.FirstName != "Augusta" || got.Version != 2 {
+		t.Fatalf("got %+v", got)
+	}
+
+	check(t, s.DeleteUser(ctx, u.ID))
+	_, err = s.UpsertUsers(ctx, rows, false)
+	var rowErr *bulk.RowErr
+	if !errors.As(err, &rowErr) || rowErr.Line != 2 || rowErr.Err != bulk.DeletedUserErr {
+		t.Fatalf("importing a deleted user: got %v", err)
+	}
+
+	var exported []string
+	check(t, s.ExportUsers(ctx, func(r bulk.ExportRow) error {
+		exported = append(exported, r.Email)
+		return nil
+	}))
+	if fmt.Sprint(exported) != "[alan@example.com]" {
+		t.Fatalf("got %v", exported)
+	}
+}
+
+func testSCIM(t *testing.T, s Storage) {
+	ctx := context.Background()
+	ada := createUser(t, s, "ada@example.com", "Ada", "Lovelace")
+	createUser(t, s, "alan@example.com", "Alan", "Turing")
+	_, err := s.AddUserToGroups(ctx, ada.ID, []string{"admins"})
+	check(t, err)
+	check(t, s.SetUserDisabled(ctx, ada.ID, true))
+
+	for _, tt := range []struct {
+		filter string
+		want   int
+	}{
+		{`userName eq "ADA@example.com"`, 1},
+		{`name.familyName sw "tur"`, 1},
+		{`emails co "example"`, 2},
+		{`active eq true`, 1},
+		{`not (active eq false) or userName ew "ada@example.com"`, 2},
+		{`userName co "_"`, 0},
+	} {
+		f, err := scim.ParseFilter(tt.filter)
+		check(t, err)
+		users, total, err := s.FilterUsers(ctx, f, 0, 10)
+		check(t, err)
+		if total != tt.want || len(users) != tt.want {
+			t.Errorf("%s: got %d users of %d, want %d", tt.filter, len(users), total, tt.want)
+		}
+	}
+
+	u, err := s.GetUserWithGroups(ctx, ada.ID)
+	check(t, err)
+	if u.Active || len(u.Groups) != 1 || u.Groups[0].Name != "admins" {
+		t.Fatalf("got %+v", u)
+	}
+
+	users, total, err := s.FilterUsers(ctx, nil, 1, 1)
+	check(t, err)
+	if total != 2 || len(users) != 1 || users[0].Email != "alan@example.com" {
+		t.Fatalf("paging: got %+v of %d", users, total)
+	}
+}
+
+func testWebAuthn(t *testing.T, s Storage) {
+	ctx := context.Background()
+	u := createUser(t, s, "ada@example.com", "Ada", "Lovelace")
+
+	check(t, s.SaveChallenge(ctx, webauthn.Challenge{Challenge: "c", UserID: u.ID, Ceremony: "registration", ExpiresAt: time.Now().Add(time.Minute)}))
+	c, err := s.ConsumeChallenge(ctx, "c")
+	check(t, err)
+	if c.UserID != u.ID || c.Ceremony != "registration" || c.ExpiresAt.Before(time.Now()) {
+		t.Fatalf("got %+v", c)
+	}
+	if _, err := s.ConsumeChallenge(ctx, "c"); err != sql.ErrNoRows {
+		t.Fatalf("consuming twice: got %v, want %v", err, sql.ErrNoRows)
+	}
+
+	id, err := s.CreateCredential(ctx, webauthn.Credential{UserID: u.ID, CredentialID: []byte{1, 2}, PublicKey: []byte{3}})
+	check(t, err)
+	check(t, s.UpdateCredentialSignCount(ctx, id, 7))
+
+	cred, err := s.GetCredentialByCredentialID(ctx, []byte{1, 2})
+	check(t, err)
+	if cred.ID != id || cred.Email != u.Email || cred.SignCount != 7 {
+		t.Fatalf("got %+v", cred)
+	}
+}
+
+func createUser(t *testing.T, s Storage, email, firstName, lastName string) register.UserRegisterResponse {
+	t.Helper()
+	u, err := s.CreateUser(context.Background(), userRequest(email, firstName, lastName))
+	check(t, err)
+	return u
+}
+
+func userRequest(email, firstName, lastName string) register.UserRegisterRequest {
+	return register.UserRegisterRequest{Email: email, Password: "password", FirstName: firstName, LastName: lastName}
+}
+
+func countImported(users []bulk.ImportedUser) (created, updated int) {
+	for _, u := range users {
+		if u.Created {
+			created++
+		} else {
+			updated++
+		}
+	}
+	return created, updated
+}
+
+func check(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
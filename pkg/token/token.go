@@ -0,0 +1,174 @@
+package token
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/raisultan/abac/pkg/metrics"
+)
+
+const (
+	AccessType  = "access"
+	RefreshType = "refresh"
+)
+
+var defaultKey = []byte("23a93f6d2673b09c1d3d063cf7a97fc20d0054dfce65c3737455dbec25439938")
+var InvalidTokenErr = errors.New("Invalid token received")
+
+// current holds the Config tokens are issued and verified with.
+var current atomic.Value
+
+func init() {
+	Configure(Config{AccessTTL: 5 * time.Minute, RefreshTTL: 30 * time.Minute})
+}
+
+// Config is how long issued tokens are valid and the keys they are signed
+// with. Key signs new tokens, PreviousKey is still accepted so that tokens
+// issued before a rotation keep working until they expire.
+type Config struct {
+	AccessTTL  time.Duration
+	RefreshTTL time.Duration
+
+	// Key defaults to the built-in development key when empty
+	Key         []byte
+	PreviousKey []byte
+}
+
+// Configure replaces the configuration, it is safe to call while tokens are
+// issued and verified.
+func Configure(c Config) {
+	if len(c.Key) == 0 {
+		c.Key = defaultKey
+	}
+	current.Store(c)
+}
+
+func config() Config {
+	return current.Load().(Config)
+}
+
+// Payload is the set of claims carried by every token issued by the server.
+type Payload struct {
+	ID           string
+	Email        string
+	Expiration   uint64
+	IssuedAt     uint64
+	IsAuthorized bool
+	Type         string
+	Scope        string
+}
+
+func CreateAccessToken(email string) (string, error) {
+	return create(email, AccessType, config().AccessTTL)
+}
+
+func CreateRefreshToken(email string) (string, error) {
+	return create(email, RefreshType, config().RefreshTTL)
+}
+
+func create(email, tType string, ttl time.Duration) (string, error) {
+	jti, err := newID()
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	claims := jwt.MapClaims{}
+	claims["jti"] = jti
+	claims["isAuthorized"] = true
+	claims["email"] = email
+	claims["type"] = tType
+	claims["iat"] = now.Unix()
+	claims["exp"] = now.Add(ttl).Unix()
+
+	t := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	signed, err := t.SignedString(config().Key)
+	if err != nil {
+		return "", err
+	}
+	metrics.TokensIssued.WithLabelValues(tType).Inc()
+
+	return signed, nil
+}
+
+// Parse verifies the signature and expiration of tokenStr and extracts its payload.
+func Parse(tokenStr string) (*Payload, error) {
+	c := config()
+	t, err := parse(tokenStr, c.Key)
+	if err != nil && len(c.PreviousKey) > 0 {
+		if pt, perr := parse(tokenStr, c.PreviousKey); perr == nil {
+			t, err = pt, nil
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	claims, ok := t.Claims.(jwt.MapClaims)
+	if !ok || !t.Valid {
+		return nil, InvalidTokenErr
+	}
+
+	email, ok := claims["email"].(string)
+	if !ok {
+		return nil, InvalidTokenErr
+	}
+
+	exp, err := strconv.ParseUint(fmt.Sprintf("%.f", claims["exp"]), 10, 64)
+	if err != nil {
+		return nil, InvalidTokenErr
+	}
+
+	isAuth, ok := claims["isAuthorized"].(bool)
+	if !ok {
+		return nil, InvalidTokenErr
+	}
+
+	tType, ok := claims["type"].(string)
+	if !ok {
+		return nil, InvalidTokenErr
+	}
+
+	// jti, iat and scope are optional so that tokens issued before
+	// they were introduced keep working until they expire
+	jti, _ := claims["jti"].(string)
+	scope, _ := claims["scope"].(string)
+	var iat uint64
+	if v, ok := claims["iat"].(float64); ok {
+		iat = uint64(v)
+	}
+
+	tp := Payload{
+		ID:           jti,
+		Email:        email,
+		Expiration:   exp,
+		IssuedAt:     iat,
+		IsAuthorized: isAuth,
+		Type:         tType,
+		Scope:        scope,
+	}
+	return &tp, nil
+}
+
+func parse(tokenStr string, key []byte) (*jwt.Token, error) {
+	return jwt.Parse(tokenStr, func(t *jwt.Token) (interface{}, error) {
+		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
+		}
+		return key, nil
+	})
+}
+
+func newID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,82 @@
+package tracing
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+
+	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Querier is implemented by both *sql.DB and *sql.Tx.
+type Querier interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// SQL wraps q so that every query gets a span, system names the database.
+// Queries outside of a trace, such as the polls of background jobs, are not
+// traced so that they do not start a trace each.
+func SQL(q Querier, system string) Querier {
+	return sqlQuerier{q, system}
+}
+
+type sqlQuerier struct {
+	q      Querier
+	system string
+}
+
+func (s sqlQuerier) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	ctx, span, ok := s.start(ctx, query)
+	if !ok {
+		return s.q.ExecContext(ctx, query, args...)
+	}
+
+	res, err := s.q.ExecContext(ctx, query, args...)
+	End(span, err)
+	return res, err
+}
+
+// QueryContext spans running the query, not reading its rows.
+func (s sqlQuerier) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	ctx, span, ok := s.start(ctx, query)
+	if !ok {
+		return s.q.QueryContext(ctx, query, args...)
+	}
+
+	rows, err := s.q.QueryContext(ctx, query, args...)
+	End(span, err)
+	return rows, err
+}
+
+func (s sqlQuerier) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	ctx, span, ok := s.start(ctx, query)
+	if !ok {
+		return s.q.QueryRowContext(ctx, query, args...)
+	}
+
+	row := s.q.QueryRowContext(ctx, query, args...)
+	End(span, row.Err())
+	return row
+}
+
+func (s sqlQuerier) start(ctx context.Context, query string) (context.Context, trace.Span, bool) {
+	if !trace.SpanContextFromContext(ctx).IsValid() {
+		return ctx, nil, false
+	}
+
+	op := query
+	if fields := strings.Fields(query); len(fields) > 0 {
+		op = strings.ToUpper(fields[0])
+	}
+	ctx, span := Start(
+		ctx,
+		s.system+" "+op,
+		semconv.DBSystemKey.String(s.system),
+		semconv.DBOperationKey.String(op),
+		semconv.DBStatementKey.String(query),
+	)
+	return ctx, span, true
+}
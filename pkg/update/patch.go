@@ -0,0 +1,54 @@
+package update
+
+import (
+	"encoding/json"
+	"errors"
+)
+
+var InvalidPatchErr = errors.New("Invalid merge patch")
+var ReadOnlyFieldErr = errors.New("Patch changes a read-only field")
+
+var readOnlyFields = map[string]bool{
+	"id":         true,
+	"email":      true,
+	"isAdmin":    true,
+	"isApproved": true,
+	"createdAt":  true,
+	"updatedAt":  true,
+}
+
+// ParsePatch reads a JSON Merge Patch (RFC 7396) document. Members that are
+// left out stay unchanged, firstName and lastName are required so removing
+// them with null is reported by validation like an empty value.
+func ParsePatch(doc []byte) (UserPatchRequest, error) {
+	var members map[string]json.RawMessage
+	if err := json.Unmarshal(doc, &members); err != nil || members == nil {
+		return UserPatchRequest{}, InvalidPatchErr
+	}
+
+	p := UserPatchRequest{}
+	for k, v := range members {
+		var field **string
+		switch k {
+		case "firstName":
+			field = &p.FirstName
+		case "lastName":
+			field = &p.LastName
+		default:
+			if readOnlyFields[k] {
+				return UserPatchRequest{}, ReadOnlyFieldErr
+			}
+			return UserPatchRequest{}, InvalidPatchErr
+		}
+
+		s := ""
+		if string(v) != "null" {
+			if err := json.Unmarshal(v, &s); err != nil {
+				return UserPatchRequest{}, InvalidPatchErr
+			}
+		}
+		*field = &s
+	}
+
+	return p, nil
+}
@@ -1,11 +1,36 @@
 package update
 
+import (
+	"context"
+	"errors"
+
+	"github.com/raisultan/abac/pkg/event"
+	"github.com/raisultan/abac/pkg/retrieve"
+	"github.com/raisultan/abac/pkg/storage"
+)
+
+var VersionMismatchErr = errors.New("User has been modified")
+
 type Service interface {
-	UpdateUser(UserUpdateRequest) (UserRetrieveResponse, error)
+	UpdateUser(context.Context, UserUpdateRequest) (UserRetrieveResponse, error)
+	PatchUser(context.Context, UserPatchRequest) (UserRetrieveResponse, error)
+	ApproveUser(ctx context.Context, id int) (UserRetrieveResponse, error)
 }
 
 type Repository interface {
-	UpdateUser(UserUpdateRequest) (UserRetrieveResponse, error)
+	storage.Transactor
+
+	GetUserByID(ctx context.Context, id int) (retrieve.UserRetrieveResponse, error)
+
+	// UpdateUser returns VersionMismatchErr when the user exists but its
+	// version differs from a non-zero r.Version.
+	UpdateUser(ctx context.Context, r UserPatchRequest) (UserRetrieveResponse, error)
+
+	// ApproveUser returns sql.ErrNoRows when there is no such user and
+	// reports whether the user was not approved before.
+	ApproveUser(ctx context.Context, id int) (u UserRetrieveResponse, changed bool, err error)
+
+	AppendEvent(context.Context, event.Event) error
 }
 
 type service struct {
@@ -16,6 +41,59 @@ func NewService(r Repository) Service {
 	return &service{r}
 }
 
-func (s *service) UpdateUser(r UserUpdateRequest) (UserRetrieveResponse, error) {
-	return s.r.UpdateUser(r)
+func (s *service) UpdateUser(ctx context.Context, r UserUpdateRequest) (UserRetrieveResponse, error) {
+	return s.PatchUser(ctx, UserPatchRequest{
+		ID:        r.ID,
+		FirstName: &r.FirstName,
+		LastName:  &r.LastName,
+		Version:   r.Version,
+	})
+}
+
+// PatchUser changes the fields set by r. A patch without any leaves the
+// user as it is, keeping its version and emitting no event.
+func (s *service) PatchUser(ctx context.Context, r UserPatchRequest) (UserRetrieveResponse, error) {
+	if r.FirstName == nil && r.LastName == nil {
+		u, err := s.r.GetUserByID(ctx, r.ID)
+		if err != nil {
+			return UserRetrieveResponse{}, err
+		}
+		if r.Version != 0 && u.Version != r.Version {
+			return UserRetrieveResponse{}, VersionMismatchErr
+		}
+		return UserRetrieveResponse(u), nil
+	}
+
+	var u UserRetrieveResponse
+	err := s.r.WithinTx(ctx, func(ctx context.Context) error {
+		var err error
+		if u, err = s.r.UpdateUser(ctx, r); err != nil {
+			return err
+		}
+		return s.r.AppendEvent(ctx, event.New(event.UserUpdated, event.UserSubject(u.ID), u))
+	})
+	if err != nil {
+		return UserRetrieveResponse{}, err
+	}
+
+	return u, nil
+}
+
+// ApproveUser approves a user, approving an approved user changes nothing
+// and emits no event.
+func (s *service) ApproveUser(ctx context.Context, id int) (UserRetrieveResponse, error) {
+	var u UserRetrieveResponse
+	err := s.r.WithinTx(ctx, func(ctx context.Context) error {
+		var changed bool
+		var err error
+		if u, changed, err = s.r.ApproveUser(ctx, id); err != nil || !changed {
+			return err
+		}
+		return s.r.AppendEvent(ctx, event.New(event.UserApproved, event.UserSubject(u.ID), u))
+	})
+	if err != nil {
+		return UserRetrieveResponse{}, err
+	}
+
+	return u, nil
 }
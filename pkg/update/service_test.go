@@ -0,0 +1,58 @@
+package update_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/raisultan/abac/pkg/register"
+	"github.com/raisultan/abac/pkg/storage/memory"
+	"github.com/raisultan/abac/pkg/update"
+)
+
+func TestEmptyPatchKeepsVersion(t *testing.T) {
+	ctx := context.Background()
+	s := memory.NewStorage()
+	created, err := s.CreateUser(ctx, register.UserRegisterRequest{Email: "ada@example.com", Password: "password", FirstName: "Ada"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	before, err := s.GetUserByID(ctx, created.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.ClaimEvents(ctx, 10, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	svc := update.NewService(s)
+
+	patch, err := update.ParsePatch([]byte(`{}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	patch.ID, patch.Version = created.ID, before.Version
+	u, err := svc.PatchUser(ctx, patch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Version != before.Version || !u.UpdatedAt.Equal(before.UpdatedAt) || u.FirstName != "Ada" {
+		t.Errorf("got %+v, want the user unchanged at version %d", u, before.Version)
+	}
+	if events, err := s.ClaimEvents(ctx, 10, time.Hour); err != nil || len(events) != 0 {
+		t.Errorf("empty patch emitted %+v (%v)", events, err)
+	}
+
+	patch.Version = before.Version + 1
+	if _, err := svc.PatchUser(ctx, patch); err != update.VersionMismatchErr {
+		t.Errorf("empty patch of another version: got %v, want %v", err, update.VersionMismatchErr)
+	}
+
+	name := "Augusta"
+	u, err = svc.PatchUser(ctx, update.UserPatchRequest{ID: created.ID, FirstName: &name, Version: before.Version})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Version == before.Version || u.FirstName != name {
+		t.Errorf("got %+v, want the first name changed in a new version", u)
+	}
+}
@@ -1,5 +1,7 @@
 package update
 
+import "time"
+
 type UserUpdateRequest struct {
 	ID int `json:"-"`
 
@@ -8,14 +10,30 @@ type UserUpdateRequest struct {
 	LastName   string `json:"lastName" validate:"required"`
 	IsAdmin    bool   `json:"-"`
 	IsApproved bool   `json:"-"`
+
+	// Version the change is based on, zero skips the check
+	Version int `json:"-"`
+}
+
+// UserPatchRequest changes only the fields that are set.
+type UserPatchRequest struct {
+	ID int `json:"-"`
+
+	FirstName *string `json:"firstName" validate:"omitempty,min=1"`
+	LastName  *string `json:"lastName" validate:"omitempty,min=1"`
+
+	// Version the change is based on, zero skips the check
+	Version int `json:"-"`
 }
 
 type UserRetrieveResponse struct {
 	ID int `json:"id"`
 
-	Email      string `json:"email"`
-	FirstName  string `json:"firstName"`
-	LastName   string `json:"lastName"`
-	IsAdmin    bool   `json:"isAdmin"`
-	IsApproved bool   `json:"isApproved"`
+	Email      string    `json:"email"`
+	FirstName  string    `json:"firstName"`
+	LastName   string    `json:"lastName"`
+	IsAdmin    bool      `json:"isAdmin"`
+	IsApproved bool      `json:"isApproved"`
+	UpdatedAt  time.Time `json:"updatedAt"`
+	Version    int       `json:"-"`
 }
@@ -0,0 +1,20 @@
+package webauthn
+
+import "time"
+
+// Config describes the relying party credentials are scoped to.
+type Config struct {
+	RPID    string
+	RPName  string
+	Origins []string
+
+	// RequireUserVerification rejects assertions where the authenticator
+	// did not verify the user, e.g. with a PIN or biometrics.
+	RequireUserVerification bool
+
+	Timeout time.Duration
+}
+
+func (c Config) Enabled() bool {
+	return c.RPID != ""
+}
@@ -0,0 +1,344 @@
+package webauthn
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/raisultan/abac/pkg/token"
+)
+
+const (
+	ceremonyRegister = "webauthn.create"
+	ceremonyLogin    = "webauthn.get"
+)
+
+var InvalidChallengeErr = errors.New("Invalid or expired challenge")
+var InvalidOriginErr = errors.New("Invalid origin")
+var InvalidRPErr = errors.New("Invalid relying party")
+var UserNotPresentErr = errors.New("User presence was not confirmed")
+var UserNotVerifiedErr = errors.New("User verification is required")
+var UnknownCredentialErr = errors.New("Unknown credential")
+var DuplicateCredentialErr = errors.New("Credential is already registered")
+var SignCountErr = errors.New("Signature counter did not increase, the authenticator may be cloned")
+var DisabledUserErr = errors.New("User is disabled")
+
+type Service interface {
+	BeginRegistration(ctx context.Context, email string) (CredentialCreationOptions, error)
+	FinishRegistration(ctx context.Context, email string, r AttestationResponse) (CredentialRegisterResponse, error)
+	BeginLogin(context.Context, UserLoginBeginRequest) (CredentialRequestOptions, error)
+	FinishLogin(context.Context, AssertionResponse) (UserLoginJWTResponse, error)
+}
+
+type Repository interface {
+	GetUserIDByEmail(context.Context, string) (int, error)
+	IsUserDisabled(context.Context, string) (bool, error)
+
+	SaveChallenge(context.Context, Challenge) error
+	ConsumeChallenge(context.Context, string) (Challenge, error)
+
+	CreateCredential(context.Context, Credential) (int, error)
+	GetCredentialsByUserID(context.Context, int) ([]Credential, error)
+	GetCredentialByCredentialID(context.Context, []byte) (Credential, error)
+	UpdateCredentialSignCount(ctx context.Context, id int, signCount uint32) error
+}
+
+type service struct {
+	r Repository
+	c Config
+}
+
+func NewService(r Repository, c Config) Service {
+	return &service{r, c}
+}
+
+func (s *service) BeginRegistration(ctx context.Context, email string) (CredentialCreationOptions, error) {
+	userID, err := s.r.GetUserIDByEmail(ctx, email)
+	if err != nil {
+		return CredentialCreationOptions{}, err
+	}
+
+	challenge, err := s.newChallenge(ctx, userID, ceremonyRegister)
+	if err != nil {
+		return CredentialCreationOptions{}, err
+	}
+
+	existing, err := s.descriptors(ctx, userID)
+	if err != nil {
+		return CredentialCreationOptions{}, err
+	}
+
+	opts := CredentialCreationOptions{
+		Challenge: challenge,
+		RP:        RelyingParty{ID: s.c.RPID, Name: s.c.RPName},
+		User: UserEntity{
+			ID:          []byte(strconv.Itoa(userID)),
+			Name:        email,
+			DisplayName: email,
+		},
+		PubKeyCredParams: []CredentialParameter{
+			{Type: "public-key", Alg: coseAlgES256},
+			{Type: "public-key", Alg: coseAlgEdDSA},
+			{Type: "public-key", Alg: coseAlgRS256},
+		},
+		Timeout:            s.c.Timeout.Milliseconds(),
+		Attestation:        "none",
+		ExcludeCredentials: existing,
+		AuthenticatorSelection: AuthenticatorSelection{
+			ResidentKey:      "preferred",
+			UserVerification: s.userVerification(),
+		},
+	}
+	return opts, nil
+}
+
+func (s *service) FinishRegistration(ctx context.Context, email string, r AttestationResponse) (CredentialRegisterResponse, error) {
+	userID, err := s.r.GetUserIDByEmail(ctx, email)
+	if err != nil {
+		return CredentialRegisterResponse{}, err
+	}
+
+	if _, err := s.verifyClientData(ctx, r.Response.ClientDataJSON, ceremonyRegister, userID); err != nil {
+		return CredentialRegisterResponse{}, err
+	}
+
+	var att attestationObject
+	if err := cbor.Unmarshal(r.Response.AttestationObject, &att); err != nil {
+		return CredentialRegisterResponse{}, MalformedDataErr
+	}
+
+	// attestation "none" is requested, so the attestation statement is not
+	// verified and the key is trusted on first use
+	ad, err := s.verifyAuthenticatorData(att.AuthData)
+	if err != nil {
+		return CredentialRegisterResponse{}, err
+	}
+	if ad.CredentialID == nil || !bytes.Equal(ad.CredentialID, r.RawID) {
+		return CredentialRegisterResponse{}, MalformedDataErr
+	}
+	if _, _, err := parsePublicKey(ad.PublicKey); err != nil {
+		return CredentialRegisterResponse{}, err
+	}
+
+	if _, err := s.r.GetCredentialByCredentialID(ctx, ad.CredentialID); err != sql.ErrNoRows {
+		if err == nil {
+			return CredentialRegisterResponse{}, DuplicateCredentialErr
+		}
+		return CredentialRegisterResponse{}, err
+	}
+
+	id, err := s.r.CreateCredential(ctx, Credential{
+		UserID:       userID,
+		CredentialID: ad.CredentialID,
+		PublicKey:    ad.PublicKey,
+		SignCount:    ad.SignCount,
+	})
+	if err != nil {
+		return CredentialRegisterResponse{}, err
+	}
+
+	return CredentialRegisterResponse{ID: id, CredentialID: ad.CredentialID}, nil
+}
+
+func (s *service) BeginLogin(ctx context.Context, r UserLoginBeginRequest) (CredentialRequestOptions, error) {
+	// without an email the authenticator is expected to offer a discoverable credential
+	var userID int
+	allowed := []CredentialDescriptor{}
+	if r.Email != "" {
+		var err error
+		userID, err = s.r.GetUserIDByEmail(ctx, r.Email)
+		if err != nil {
+			return CredentialRequestOptions{}, err
+		}
+		if allowed, err = s.descriptors(ctx, userID); err != nil {
+			return CredentialRequestOptions{}, err
+		}
+	}
+
+	challenge, err := s.newChallenge(ctx, userID, ceremonyLogin)
+	if err != nil {
+		return CredentialRequestOptions{}, err
+	}
+
+	opts := CredentialRequestOptions{
+		Challenge:        challenge,
+		RPID:             s.c.RPID,
+		Timeout:          s.c.Timeout.Milliseconds(),
+		AllowCredentials: allowed,
+		UserVerification: s.userVerification(),
+	}
+	return opts, nil
+}
+
+func (s *service) FinishLogin(ctx context.Context, r AssertionResponse) (UserLoginJWTResponse, error) {
+	cred, err := s.r.GetCredentialByCredentialID(ctx, r.RawID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return UserLoginJWTResponse{}, UnknownCredentialErr
+		}
+		return UserLoginJWTResponse{}, err
+	}
+
+	ch, err := s.verifyClientData(ctx, r.Response.ClientDataJSON, ceremonyLogin, cred.UserID)
+	if err != nil {
+		return UserLoginJWTResponse{}, err
+	}
+	if ch.UserID != 0 && ch.UserID != cred.UserID {
+		return UserLoginJWTResponse{}, UnknownCredentialErr
+	}
+	if len(r.Response.UserHandle) > 0 && string(r.Response.UserHandle) != strconv.Itoa(cred.UserID) {
+		return UserLoginJWTResponse{}, UnknownCredentialErr
+	}
+
+	ad, err := s.verifyAuthenticatorData(r.Response.AuthenticatorData)
+	if err != nil {
+		return UserLoginJWTResponse{}, err
+	}
+
+	err = verifySignature(
+		cred.PublicKey,
+		r.Response.AuthenticatorData,
+		r.Response.ClientDataJSON,
+		r.Response.Signature,
+	)
+	if err != nil {
+		return UserLoginJWTResponse{}, err
+	}
+
+	// authenticators that do not implement a counter always report zero
+	if ad.SignCount != 0 || cred.SignCount != 0 {
+		if ad.SignCount <= cred.SignCount {
+			return UserLoginJWTResponse{}, SignCountErr
+		}
+		if err := s.r.UpdateCredentialSignCount(ctx, cred.ID, ad.SignCount); err != nil {
+			return UserLoginJWTResponse{}, err
+		}
+	}
+
+	disabled, err := s.r.IsUserDisabled(ctx, cred.Email)
+	if err != nil {
+		return UserLoginJWTResponse{}, err
+	}
+	if disabled {
+		return UserLoginJWTResponse{}, DisabledUserErr
+	}
+
+	at, err := token.CreateAccessToken(cred.Email)
+	if err != nil {
+		return UserLoginJWTResponse{}, err
+	}
+
+	rt, err := token.CreateRefreshToken(cred.Email)
+	if err != nil {
+		return UserLoginJWTResponse{}, err
+	}
+
+	return UserLoginJWTResponse{Access: at, Refresh: rt}, nil
+}
+
+// verifyClientData checks the ceremony type and origin and consumes the
+// challenge, so that every challenge can be answered only once.
+func (s *service) verifyClientData(ctx context.Context, raw []byte, ceremony string, userID int) (Challenge, error) {
+	var cd clientData
+	if err := json.Unmarshal(raw, &cd); err != nil {
+		return Challenge{}, MalformedDataErr
+	}
+	if cd.Type != ceremony {
+		return Challenge{}, MalformedDataErr
+	}
+	if !s.allowedOrigin(cd.Origin) {
+		return Challenge{}, InvalidOriginErr
+	}
+
+	ch, err := s.r.ConsumeChallenge(ctx, cd.Challenge)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return Challenge{}, InvalidChallengeErr
+		}
+		return Challenge{}, err
+	}
+	if ch.Ceremony != ceremony || time.Now().After(ch.ExpiresAt) {
+		return Challenge{}, InvalidChallengeErr
+	}
+	if ceremony == ceremonyRegister && ch.UserID != userID {
+		return Challenge{}, InvalidChallengeErr
+	}
+
+	return ch, nil
+}
+
+func (s *service) verifyAuthenticatorData(raw []byte) (authenticatorData, error) {
+	ad, err := parseAuthenticatorData(raw)
+	if err != nil {
+		return authenticatorData{}, err
+	}
+
+	rpIDHash := sha256.Sum256([]byte(s.c.RPID))
+	if !bytes.Equal(ad.RPIDHash, rpIDHash[:]) {
+		return authenticatorData{}, InvalidRPErr
+	}
+	if ad.Flags&flagUserPresent == 0 {
+		return authenticatorData{}, UserNotPresentErr
+	}
+	if s.c.RequireUserVerification && ad.Flags&flagUserVerified == 0 {
+		return authenticatorData{}, UserNotVerifiedErr
+	}
+
+	return ad, nil
+}
+
+func (s *service) newChallenge(ctx context.Context, userID int, ceremony string) ([]byte, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+
+	err := s.r.SaveChallenge(ctx, Challenge{
+		Challenge: base64.RawURLEncoding.EncodeToString(b),
+		UserID:    userID,
+		Ceremony:  ceremony,
+		ExpiresAt: time.Now().Add(s.c.Timeout),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return b, nil
+}
+
+func (s *service) descriptors(ctx context.Context, userID int) ([]CredentialDescriptor, error) {
+	creds, err := s.r.GetCredentialsByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	descriptors := []CredentialDescriptor{}
+	for _, c := range creds {
+		descriptors = append(descriptors, CredentialDescriptor{Type: "public-key", ID: c.CredentialID})
+	}
+	return descriptors, nil
+}
+
+func (s *service) allowedOrigin(origin string) bool {
+	for _, o := range s.c.Origins {
+		if o == origin {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *service) userVerification() string {
+	if s.c.RequireUserVerification {
+		return "required"
+	}
+	return "preferred"
+}
@@ -0,0 +1,289 @@
+package webauthn_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/raisultan/abac/pkg/register"
+	"github.com/raisultan/abac/pkg/storage/memory"
+	"github.com/raisultan/abac/pkg/token"
+	"github.com/raisultan/abac/pkg/webauthn"
+)
+
+const (
+	rpID   = "example.org"
+	origin = "https://example.org"
+	email  = "ann@example.org"
+)
+
+// authenticator is a software authenticator holding a single ES256
+// credential, with a counter that increases on every assertion.
+type authenticator struct {
+	key       *ecdsa.PrivateKey
+	id        []byte
+	signCount uint32
+}
+
+// ceremony is what the browser and the authenticator put into a response,
+// tests change it to forge responses.
+type ceremony struct {
+	typ       string
+	challenge []byte
+	origin    string
+	rpID      string
+}
+
+func newAuthenticator(t *testing.T) *authenticator {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := make([]byte, 16)
+	rand.Read(id)
+	return &authenticator{key: key, id: id}
+}
+
+func (a *authenticator) clientData(c ceremony) []byte {
+	b, _ := json.Marshal(map[string]string{
+		"type":      c.typ,
+		"challenge": base64.RawURLEncoding.EncodeToString(c.challenge),
+		"origin":    c.origin,
+	})
+	return b
+}
+
+func (a *authenticator) authData(c ceremony, flags byte, attested []byte) []byte {
+	rpIDHash := sha256.Sum256([]byte(c.rpID))
+	b := append([]byte{}, rpIDHash[:]...)
+	b = append(b, flags)
+	b = append(b, 0, 0, 0, 0)
+	binary.BigEndian.PutUint32(b[33:37], a.signCount)
+	return append(b, attested...)
+}
+
+func (a *authenticator) create(t *testing.T, c ceremony) webauthn.AttestationResponse {
+	coseKey, err := cbor.Marshal(map[int]interface{}{
+		1:  2,  // EC2
+		3:  -7, // ES256
+		-1: 1,  // P-256
+		-2: a.key.X.FillBytes(make([]byte, 32)),
+		-3: a.key.Y.FillBytes(make([]byte, 32)),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	attested := make([]byte, 16)
+	attested = append(attested, byte(len(a.id)>>8), byte(len(a.id)))
+	attested = append(attested, a.id...)
+	attested = append(attested, coseKey...)
+
+	att, err := cbor.Marshal(map[string]interface{}{
+		"fmt":      "none",
+		"attStmt":  map[string]interface{}{},
+		"authData": a.authData(c, 0x41, attested),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var r webauthn.AttestationResponse
+	r.RawID = a.id
+	r.Type = "public-key"
+	r.Response.ClientDataJSON = a.clientData(c)
+	r.Response.AttestationObject = att
+	return r
+}
+
+func (a *authenticator) get(t *testing.T, c ceremony) webauthn.AssertionResponse {
+	a.signCount++
+	authData := a.authData(c, 0x01, nil)
+	clientData := a.clientData(c)
+
+	clientDataHash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(append([]byte{}, authData...), clientDataHash[:]...))
+	sig, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var r webauthn.AssertionResponse
+	r.RawID = a.id
+	r.Type = "public-key"
+	r.Response.ClientDataJSON = clientData
+	r.Response.AuthenticatorData = authData
+	r.Response.Signature = sig
+	return r
+}
+
+func newService(t *testing.T) (webauthn.Service, *memory.Storage) {
+	s := memory.NewStorage()
+	if _, err := s.CreateUser(context.Background(), register.UserRegisterRequest{Email: email, Password: "password"}); err != nil {
+		t.Fatal(err)
+	}
+	return webauthn.NewService(s, webauthn.Config{
+		RPID:    rpID,
+		RPName:  "Example",
+		Origins: []string{origin},
+		Timeout: time.Minute,
+	}), s
+}
+
+// enroll runs a registration ceremony, forge changes the response.
+func enroll(t *testing.T, svc webauthn.Service, a *authenticator, forge func(*ceremony)) error {
+	opts, err := svc.BeginRegistration(context.Background(), email)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := ceremony{typ: "webauthn.create", challenge: opts.Challenge, origin: origin, rpID: opts.RP.ID}
+	if forge != nil {
+		forge(&c)
+	}
+	_, err = svc.FinishRegistration(context.Background(), email, a.create(t, c))
+	return err
+}
+
+// login runs an authentication ceremony, forge changes the response.
+func login(t *testing.T, svc webauthn.Service, a *authenticator, forge func(*ceremony)) (webauthn.UserLoginJWTResponse, error) {
+	opts, err := svc.BeginLogin(context.Background(), webauthn.UserLoginBeginRequest{Email: email})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := ceremony{typ: "webauthn.get", challenge: opts.Challenge, origin: origin, rpID: opts.RPID}
+	if forge != nil {
+		forge(&c)
+	}
+	return svc.FinishLogin(context.Background(), a.get(t, c))
+}
+
+func TestRegisterAndLogin(t *testing.T) {
+	svc, _ := newService(t)
+	a := newAuthenticator(t)
+
+	if err := enroll(t, svc, a, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		resp, err := login(t, svc, a, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tp, err := token.Parse(resp.Access)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tp.Email != email {
+			t.Errorf("access token of %s, want %s", tp.Email, email)
+		}
+	}
+
+	if err := enroll(t, svc, a, nil); err != webauthn.DuplicateCredentialErr {
+		t.Errorf("registering the credential again: got %v, want %v", err, webauthn.DuplicateCredentialErr)
+	}
+}
+
+func TestRegisterRejectsForgedResponses(t *testing.T) {
+	for name, tc := range map[string]struct {
+		forge func(*ceremony)
+		want  error
+	}{
+		"challenge mismatch": {func(c *ceremony) { c.challenge = []byte("other") }, webauthn.InvalidChallengeErr},
+		"wrong origin":       {func(c *ceremony) { c.origin = "https://evil.example" }, webauthn.InvalidOriginErr},
+		"wrong rp id hash":   {func(c *ceremony) { c.rpID = "evil.example" }, webauthn.InvalidRPErr},
+		"wrong ceremony":     {func(c *ceremony) { c.typ = "webauthn.get" }, webauthn.MalformedDataErr},
+	} {
+		t.Run(name, func(t *testing.T) {
+			svc, _ := newService(t)
+			if err := enroll(t, svc, newAuthenticator(t), tc.forge); err != tc.want {
+				t.Errorf("got %v, want %v", err, tc.want)
+			}
+		})
+	}
+}
+
+func TestLoginRejectsForgedResponses(t *testing.T) {
+	for name, tc := range map[string]struct {
+		forge func(*ceremony)
+		want  error
+	}{
+		"challenge mismatch": {func(c *ceremony) { c.challenge = []byte("other") }, webauthn.InvalidChallengeErr},
+		"wrong origin":       {func(c *ceremony) { c.origin = "https://evil.example" }, webauthn.InvalidOriginErr},
+		"wrong rp id hash":   {func(c *ceremony) { c.rpID = "evil.example" }, webauthn.InvalidRPErr},
+	} {
+		t.Run(name, func(t *testing.T) {
+			svc, _ := newService(t)
+			a := newAuthenticator(t)
+			if err := enroll(t, svc, a, nil); err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := login(t, svc, a, tc.forge); err != tc.want {
+				t.Errorf("got %v, want %v", err, tc.want)
+			}
+		})
+	}
+}
+
+func TestLoginRejectsReplayedChallenge(t *testing.T) {
+	svc, _ := newService(t)
+	a := newAuthenticator(t)
+	if err := enroll(t, svc, a, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	opts, err := svc.BeginLogin(context.Background(), webauthn.UserLoginBeginRequest{Email: email})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := ceremony{typ: "webauthn.get", challenge: opts.Challenge, origin: origin, rpID: rpID}
+	if _, err := svc.FinishLogin(context.Background(), a.get(t, c)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.FinishLogin(context.Background(), a.get(t, c)); err != webauthn.InvalidChallengeErr {
+		t.Errorf("got %v, want %v", err, webauthn.InvalidChallengeErr)
+	}
+}
+
+func TestLoginRejectsSignCountRegression(t *testing.T) {
+	svc, _ := newService(t)
+	a := newAuthenticator(t)
+	if err := enroll(t, svc, a, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := login(t, svc, a, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// a cloned authenticator reports a counter the server already saw
+	a.signCount = 0
+	if _, err := login(t, svc, a, nil); err != webauthn.SignCountErr {
+		t.Errorf("got %v, want %v", err, webauthn.SignCountErr)
+	}
+}
+
+func TestLoginRejectsInvalidSignature(t *testing.T) {
+	svc, _ := newService(t)
+	a := newAuthenticator(t)
+	if err := enroll(t, svc, a, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// the same credential ID signed with another key
+	b := newAuthenticator(t)
+	b.id = a.id
+	if _, err := login(t, svc, b, nil); err != webauthn.InvalidSignatureErr {
+		t.Errorf("got %v, want %v", err, webauthn.InvalidSignatureErr)
+	}
+}
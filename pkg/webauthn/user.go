@@ -0,0 +1,129 @@
+package webauthn
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+// URLEncodedBase64 is binary data encoded as unpadded base64url in JSON,
+// the encoding browsers use for WebAuthn payloads.
+type URLEncodedBase64 []byte
+
+func (b URLEncodedBase64) MarshalJSON() ([]byte, error) {
+	return json.Marshal(base64.RawURLEncoding.EncodeToString(b))
+}
+
+func (b *URLEncodedBase64) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+
+	decoded, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+	if err != nil {
+		return err
+	}
+	*b = decoded
+	return nil
+}
+
+type Credential struct {
+	ID           int
+	UserID       int
+	Email        string
+	CredentialID []byte
+	PublicKey    []byte
+	SignCount    uint32
+}
+
+type Challenge struct {
+	Challenge string
+	UserID    int
+	Ceremony  string
+	ExpiresAt time.Time
+}
+
+type RelyingParty struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type UserEntity struct {
+	ID          URLEncodedBase64 `json:"id"`
+	Name        string           `json:"name"`
+	DisplayName string           `json:"displayName"`
+}
+
+type CredentialParameter struct {
+	Type string `json:"type"`
+	Alg  int    `json:"alg"`
+}
+
+type CredentialDescriptor struct {
+	Type string           `json:"type"`
+	ID   URLEncodedBase64 `json:"id"`
+}
+
+type AuthenticatorSelection struct {
+	ResidentKey      string `json:"residentKey"`
+	UserVerification string `json:"userVerification"`
+}
+
+// CredentialCreationOptions is passed to navigator.credentials.create().
+type CredentialCreationOptions struct {
+	Challenge              URLEncodedBase64       `json:"challenge"`
+	RP                     RelyingParty           `json:"rp"`
+	User                   UserEntity             `json:"user"`
+	PubKeyCredParams       []CredentialParameter  `json:"pubKeyCredParams"`
+	Timeout                int64                  `json:"timeout"`
+	Attestation            string                 `json:"attestation"`
+	ExcludeCredentials     []CredentialDescriptor `json:"excludeCredentials"`
+	AuthenticatorSelection AuthenticatorSelection `json:"authenticatorSelection"`
+}
+
+// CredentialRequestOptions is passed to navigator.credentials.get().
+type CredentialRequestOptions struct {
+	Challenge        URLEncodedBase64       `json:"challenge"`
+	RPID             string                 `json:"rpId"`
+	Timeout          int64                  `json:"timeout"`
+	AllowCredentials []CredentialDescriptor `json:"allowCredentials"`
+	UserVerification string                 `json:"userVerification"`
+}
+
+type UserLoginBeginRequest struct {
+	Email string `json:"email" validate:"omitempty,email"`
+}
+
+// AttestationResponse is the serialized result of navigator.credentials.create().
+type AttestationResponse struct {
+	RawID    URLEncodedBase64 `json:"rawId" validate:"required"`
+	Type     string           `json:"type" validate:"required"`
+	Response struct {
+		ClientDataJSON    URLEncodedBase64 `json:"clientDataJSON" validate:"required"`
+		AttestationObject URLEncodedBase64 `json:"attestationObject" validate:"required"`
+	} `json:"response"`
+}
+
+// AssertionResponse is the serialized result of navigator.credentials.get().
+type AssertionResponse struct {
+	RawID    URLEncodedBase64 `json:"rawId" validate:"required"`
+	Type     string           `json:"type" validate:"required"`
+	Response struct {
+		ClientDataJSON    URLEncodedBase64 `json:"clientDataJSON" validate:"required"`
+		AuthenticatorData URLEncodedBase64 `json:"authenticatorData" validate:"required"`
+		Signature         URLEncodedBase64 `json:"signature" validate:"required"`
+		UserHandle        URLEncodedBase64 `json:"userHandle"`
+	} `json:"response"`
+}
+
+type CredentialRegisterResponse struct {
+	ID           int              `json:"id"`
+	CredentialID URLEncodedBase64 `json:"credentialId"`
+}
+
+type UserLoginJWTResponse struct {
+	Access  string `json:"access"`
+	Refresh string `json:"refresh"`
+}
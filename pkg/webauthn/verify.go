@@ -0,0 +1,175 @@
+package webauthn
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"math/big"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+const (
+	flagUserPresent            = 0x01
+	flagUserVerified           = 0x04
+	flagAttestedCredentialData = 0x40
+
+	coseKeyTypeOKP = 1
+	coseKeyTypeEC2 = 2
+	coseKeyTypeRSA = 3
+
+	coseAlgES256 = -7
+	coseAlgEdDSA = -8
+	coseAlgRS256 = -257
+)
+
+var MalformedDataErr = errors.New("Malformed authenticator data")
+var UnsupportedKeyErr = errors.New("Unsupported credential public key")
+var InvalidSignatureErr = errors.New("Invalid assertion signature")
+
+type clientData struct {
+	Type      string `json:"type"`
+	Challenge string `json:"challenge"`
+	Origin    string `json:"origin"`
+}
+
+type attestationObject struct {
+	Fmt      string          `cbor:"fmt"`
+	AttStmt  cbor.RawMessage `cbor:"attStmt"`
+	AuthData []byte          `cbor:"authData"`
+}
+
+type authenticatorData struct {
+	RPIDHash  []byte
+	Flags     byte
+	SignCount uint32
+
+	// only present in registration ceremonies
+	CredentialID []byte
+	PublicKey    []byte
+}
+
+func parseAuthenticatorData(b []byte) (authenticatorData, error) {
+	if len(b) < 37 {
+		return authenticatorData{}, MalformedDataErr
+	}
+
+	ad := authenticatorData{
+		RPIDHash:  b[:32],
+		Flags:     b[32],
+		SignCount: binary.BigEndian.Uint32(b[33:37]),
+	}
+	if ad.Flags&flagAttestedCredentialData == 0 {
+		return ad, nil
+	}
+
+	// attested credential data: 16 byte AAGUID, 2 byte length, credential ID, COSE key
+	rest := b[37:]
+	if len(rest) < 18 {
+		return authenticatorData{}, MalformedDataErr
+	}
+	idLen := int(binary.BigEndian.Uint16(rest[16:18]))
+	rest = rest[18:]
+	if len(rest) < idLen {
+		return authenticatorData{}, MalformedDataErr
+	}
+	ad.CredentialID = rest[:idLen]
+
+	// the key may be followed by extension data, so only the first item is read
+	var key cbor.RawMessage
+	if err := cbor.NewDecoder(bytes.NewReader(rest[idLen:])).Decode(&key); err != nil {
+		return authenticatorData{}, MalformedDataErr
+	}
+	ad.PublicKey = key
+
+	return ad, nil
+}
+
+// parsePublicKey decodes a COSE_Key (RFC 8152) into a public key.
+func parsePublicKey(raw []byte) (crypto.PublicKey, int, error) {
+	var m map[int]cbor.RawMessage
+	if err := cbor.Unmarshal(raw, &m); err != nil {
+		return nil, 0, UnsupportedKeyErr
+	}
+
+	var kty, alg int
+	if err := cbor.Unmarshal(m[1], &kty); err != nil {
+		return nil, 0, UnsupportedKeyErr
+	}
+	if err := cbor.Unmarshal(m[3], &alg); err != nil {
+		return nil, 0, UnsupportedKeyErr
+	}
+
+	switch {
+	case kty == coseKeyTypeEC2 && alg == coseAlgES256:
+		var crv int
+		var x, y []byte
+		if cbor.Unmarshal(m[-1], &crv) != nil || cbor.Unmarshal(m[-2], &x) != nil || cbor.Unmarshal(m[-3], &y) != nil {
+			return nil, 0, UnsupportedKeyErr
+		}
+		if crv != 1 {
+			return nil, 0, UnsupportedKeyErr
+		}
+		pub := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !pub.Curve.IsOnCurve(pub.X, pub.Y) {
+			return nil, 0, UnsupportedKeyErr
+		}
+		return pub, alg, nil
+	case kty == coseKeyTypeRSA && alg == coseAlgRS256:
+		var n, e []byte
+		if cbor.Unmarshal(m[-1], &n) != nil || cbor.Unmarshal(m[-2], &e) != nil {
+			return nil, 0, UnsupportedKeyErr
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, alg, nil
+	case kty == coseKeyTypeOKP && alg == coseAlgEdDSA:
+		var crv int
+		var x []byte
+		if cbor.Unmarshal(m[-1], &crv) != nil || cbor.Unmarshal(m[-2], &x) != nil {
+			return nil, 0, UnsupportedKeyErr
+		}
+		if crv != 6 || len(x) != ed25519.PublicKeySize {
+			return nil, 0, UnsupportedKeyErr
+		}
+		return ed25519.PublicKey(x), alg, nil
+	}
+
+	return nil, 0, UnsupportedKeyErr
+}
+
+// verifySignature checks an assertion signature, which covers the
+// authenticator data followed by the SHA-256 hash of the client data.
+func verifySignature(rawKey, authData, clientDataJSON, sig []byte) error {
+	pub, _, err := parsePublicKey(rawKey)
+	if err != nil {
+		return err
+	}
+
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	signed := append(append([]byte{}, authData...), clientDataHash[:]...)
+	digest := sha256.Sum256(signed)
+
+	switch k := pub.(type) {
+	case *ecdsa.PublicKey:
+		if !ecdsa.VerifyASN1(k, digest[:], sig) {
+			return InvalidSignatureErr
+		}
+	case *rsa.PublicKey:
+		if err := rsa.VerifyPKCS1v15(k, crypto.SHA256, digest[:], sig); err != nil {
+			return InvalidSignatureErr
+		}
+	case ed25519.PublicKey:
+		if !ed25519.Verify(k, signed, sig) {
+			return InvalidSignatureErr
+		}
+	default:
+		return UnsupportedKeyErr
+	}
+
+	return nil
+}
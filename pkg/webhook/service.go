@@ -0,0 +1,304 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/raisultan/abac/pkg/event"
+)
+
+const (
+	DefaultLimit = 50
+	MaxLimit     = 200
+
+	// MaxAttempts failed attempts make a delivery dead
+	MaxAttempts = 8
+
+	deliverBatchSize = 50
+	claimLease       = time.Minute
+	minRetryDelay    = 10 * time.Second
+	maxRetryDelay    = 6 * time.Hour
+)
+
+var (
+	UnknownEventTypeErr = errors.New("Unknown event type")
+	NotFoundErr         = errors.New("Webhook not found")
+	DeliveryNotFoundErr = errors.New("Delivery not found")
+)
+
+type Service interface {
+	ListSubscriptions(ctx context.Context) ([]Subscription, error)
+	GetSubscription(ctx context.Context, id int) (Subscription, error)
+	CreateSubscription(context.Context, SubscriptionRequest) (Subscription, error)
+	UpdateSubscription(ctx context.Context, id int, sr SubscriptionRequest) (Subscription, error)
+	DeleteSubscription(ctx context.Context, id int) error
+
+	ListDeliveries(context.Context, DeliveryListRequest) (DeliveryListResponse, error)
+
+	// Redeliver makes a delivery pending again, whatever its status.
+	Redeliver(ctx context.Context, subscriptionID int, id int64) (Delivery, error)
+
+	// Enqueue creates a pending delivery of e for every active
+	// subscription to its type, at most once per subscription.
+	Enqueue(ctx context.Context, e event.Event) error
+
+	// Deliver sends a batch of due deliveries and returns how many were
+	// attempted.
+	Deliver(ctx context.Context) (int, error)
+
+	// PurgeDeliveries removes succeeded deliveries delivered before the
+	// given time.
+	PurgeDeliveries(ctx context.Context, before time.Time) (int64, error)
+}
+
+// Repository returns NotFoundErr and DeliveryNotFoundErr for missing
+// subscriptions and deliveries.
+type Repository interface {
+	ListSubscriptions(ctx context.Context) ([]Subscription, error)
+	GetSubscription(ctx context.Context, id int) (Subscription, error)
+	CreateSubscription(context.Context, Subscription) (Subscription, error)
+	UpdateSubscription(context.Context, Subscription) (Subscription, error)
+	DeleteSubscription(ctx context.Context, id int) error
+
+	EnqueueDeliveries(ctx context.Context, e event.Event, payload []byte) error
+	ClaimDeliveries(ctx context.Context, limit int, lease time.Duration) ([]Delivery, error)
+	RecordAttempt(context.Context, Attempt) error
+	ListDeliveries(context.Context, DeliveryListRequest) ([]Delivery, error)
+	RedeliverDelivery(ctx context.Context, subscriptionID int, id int64) (Delivery, error)
+	PurgeDeliveries(ctx context.Context, before time.Time) (int64, error)
+}
+
+type service struct {
+	r      Repository
+	client *http.Client
+}
+
+// NewService sends deliveries with client, or with a client timing out
+// after 10 seconds when it is nil.
+func NewService(r Repository, client *http.Client) Service {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	return &service{r, client}
+}
+
+func (s *service) ListSubscriptions(ctx context.Context) ([]Subscription, error) {
+	return s.r.ListSubscriptions(ctx)
+}
+
+func (s *service) GetSubscription(ctx context.Context, id int) (Subscription, error) {
+	return s.r.GetSubscription(ctx, id)
+}
+
+func (s *service) CreateSubscription(ctx context.Context, sr SubscriptionRequest) (Subscription, error) {
+	if err := checkEventTypes(sr.EventTypes); err != nil {
+		return Subscription{}, err
+	}
+
+	secret, err := newSecret()
+	if err != nil {
+		return Subscription{}, err
+	}
+
+	sub, err := s.r.CreateSubscription(ctx, Subscription{
+		URL:        sr.URL,
+		EventTypes: sr.EventTypes,
+		Active:     sr.Active == nil || *sr.Active,
+		Secret:     secret,
+	})
+	if err != nil {
+		return Subscription{}, err
+	}
+
+	sub.Secret = secret
+	return sub, nil
+}
+
+func (s *service) UpdateSubscription(ctx context.Context, id int, sr SubscriptionRequest) (Subscription, error) {
+	if err := checkEventTypes(sr.EventTypes); err != nil {
+		return Subscription{}, err
+	}
+
+	return s.r.UpdateSubscription(ctx, Subscription{
+		ID:         id,
+		URL:        sr.URL,
+		EventTypes: sr.EventTypes,
+		Active:     sr.Active == nil || *sr.Active,
+	})
+}
+
+func (s *service) DeleteSubscription(ctx context.Context, id int) error {
+	return s.r.DeleteSubscription(ctx, id)
+}
+
+func (s *service) ListDeliveries(ctx context.Context, lr DeliveryListRequest) (DeliveryListResponse, error) {
+	if _, err := s.r.GetSubscription(ctx, lr.SubscriptionID); err != nil {
+		return DeliveryListResponse{}, err
+	}
+
+	if lr.Limit <= 0 {
+		lr.Limit = DefaultLimit
+	}
+	if lr.Limit > MaxLimit {
+		lr.Limit = MaxLimit
+	}
+
+	limit := lr.Limit
+	lr.Limit++
+	deliveries, err := s.r.ListDeliveries(ctx, lr)
+	if err != nil {
+		return DeliveryListResponse{}, err
+	}
+
+	resp := DeliveryListResponse{Data: deliveries}
+	if len(deliveries) > limit {
+		resp.Data = deliveries[:limit]
+		resp.NextBefore = resp.Data[limit-1].ID
+	}
+
+	return resp, nil
+}
+
+func (s *service) Redeliver(ctx context.Context, subscriptionID int, id int64) (Delivery, error) {
+	return s.r.RedeliverDelivery(ctx, subscriptionID, id)
+}
+
+func (s *service) Enqueue(ctx context.Context, e event.Event) error {
+	payload, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	return s.r.EnqueueDeliveries(ctx, e, payload)
+}
+
+func (s *service) Deliver(ctx context.Context) (int, error) {
+	deliveries, err := s.r.ClaimDeliveries(ctx, deliverBatchSize, claimLease)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, d := range deliveries {
+		a := s.send(ctx, d)
+		if err := s.r.RecordAttempt(ctx, a); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(deliveries), nil
+}
+
+// send posts a delivery and decides what happens to it next, anything but
+// a 2xx response is a failure.
+func (s *service) send(ctx context.Context, d Delivery) Attempt {
+	a := Attempt{DeliveryID: d.ID, Status: Succeeded}
+
+	req, err := http.NewRequest(http.MethodPost, d.URL, bytes.NewReader(d.Payload))
+	if err == nil {
+		req = req.WithContext(ctx)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("User-Agent", "abac-webhooks/1")
+		req.Header.Set("X-Webhook-Id", strconv.FormatInt(d.ID, 10))
+		req.Header.Set("X-Event-Type", d.EventType)
+		req.Header.Set(SignatureHeader, Sign(d.Secret, time.Now(), d.Payload))
+
+		var resp *http.Response
+		resp, err = s.client.Do(req)
+		if err == nil {
+			io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 64<<10))
+			resp.Body.Close()
+
+			a.StatusCode = resp.StatusCode
+			if resp.StatusCode < 200 || resp.StatusCode > 299 {
+				err = fmt.Errorf("receiver responded with %s", resp.Status)
+			}
+		}
+	}
+
+	if err != nil {
+		a.Error = err.Error()
+		if d.Attempts+1 >= MaxAttempts {
+			a.Status = Dead
+		} else {
+			a.Status = Pending
+			a.NextAttemptAt = time.Now().Add(retryDelay(d.Attempts))
+		}
+	}
+
+	return a
+}
+
+func (s *service) PurgeDeliveries(ctx context.Context, before time.Time) (int64, error) {
+	return s.r.PurgeDeliveries(ctx, before)
+}
+
+func checkEventTypes(types []string) error {
+	for _, t := range types {
+		if !event.IsType(t) {
+			return fmt.Errorf("%w: %s", UnknownEventTypeErr, t)
+		}
+	}
+	return nil
+}
+
+// retryDelay doubles with every failed attempt, up to maxRetryDelay.
+func retryDelay(attempts int) time.Duration {
+	d := minRetryDelay
+	for i := 0; i < attempts && d < maxRetryDelay; i++ {
+		d *= 2
+	}
+	if d > maxRetryDelay {
+		d = maxRetryDelay
+	}
+	return d
+}
+
+// Sink fans the events published from the outbox out into deliveries.
+type Sink struct {
+	s Service
+}
+
+func NewSink(s Service) Sink {
+	return Sink{s}
+}
+
+func (k Sink) Publish(ctx context.Context, e event.Event) error {
+	return k.s.Enqueue(ctx, e)
+}
+
+// RunDeliveries sends due deliveries every interval and removes succeeded
+// deliveries older than retention, until ctx is done.
+func RunDeliveries(ctx context.Context, s Service, interval, retention time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		for {
+			n, err := s.Deliver(ctx)
+			if err != nil {
+				log.Println("delivering webhooks failed:", err)
+			}
+			if err != nil || n < deliverBatchSize {
+				break
+			}
+		}
+
+		if _, err := s.PurgeDeliveries(ctx, time.Now().Add(-retention)); err != nil {
+			log.Println("purging webhook deliveries failed:", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
@@ -0,0 +1,212 @@
+package webhook_test
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/raisultan/abac/pkg/event"
+	"github.com/raisultan/abac/pkg/storage/memory"
+	"github.com/raisultan/abac/pkg/webhook"
+)
+
+// receiver is a local webhook endpoint verifying the signature of every
+// request and answering with status.
+type receiver struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	status   int
+	secret   string
+	received int
+	verified int
+}
+
+func newReceiver(t *testing.T, status int) *receiver {
+	rc := &receiver{status: status}
+	rc.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Error(err)
+		}
+
+		rc.mu.Lock()
+		defer rc.mu.Unlock()
+		rc.received++
+		if webhook.Verify(rc.secret, r.Header.Get(webhook.SignatureHeader), body, time.Minute) == nil {
+			rc.verified++
+		}
+		if r.Header.Get("X-Event-Type") != event.UserCreated {
+			t.Errorf("event type %q, want %q", r.Header.Get("X-Event-Type"), event.UserCreated)
+		}
+		w.WriteHeader(rc.status)
+	}))
+	t.Cleanup(rc.Close)
+	return rc
+}
+
+func (rc *receiver) counts() (received, verified int) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	return rc.received, rc.verified
+}
+
+// dueNow makes failed deliveries due again right away and keeps the
+// delays they were scheduled with. The storage truncates its clock, so
+// they are made due a moment in the past.
+type dueNow struct {
+	*memory.Storage
+	delays []time.Duration
+}
+
+func (r *dueNow) RecordAttempt(ctx context.Context, a webhook.Attempt) error {
+	if a.Status == webhook.Pending {
+		r.delays = append(r.delays, time.Until(a.NextAttemptAt))
+		a.NextAttemptAt = time.Now().Add(-time.Second)
+	}
+	return r.Storage.RecordAttempt(ctx, a)
+}
+
+func setup(t *testing.T, rc *receiver) (webhook.Service, *dueNow, webhook.Subscription) {
+	r := &dueNow{Storage: memory.NewStorage()}
+	svc := webhook.NewService(r, rc.Client())
+
+	sub, err := svc.CreateSubscription(context.Background(), webhook.SubscriptionRequest{
+		URL:        rc.URL,
+		EventTypes: []string{event.UserCreated},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rc.secret = sub.Secret
+
+	e := event.New(event.UserCreated, event.UserSubject(1), map[string]interface{}{"id": 1})
+	e.ID = 1
+	if err := svc.Enqueue(context.Background(), e); err != nil {
+		t.Fatal(err)
+	}
+	return svc, r, sub
+}
+
+func deliveryOf(t *testing.T, svc webhook.Service, sub webhook.Subscription) webhook.Delivery {
+	resp, err := svc.ListDeliveries(context.Background(), webhook.DeliveryListRequest{SubscriptionID: sub.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Data) != 1 {
+		t.Fatalf("%d deliveries, want 1", len(resp.Data))
+	}
+	return resp.Data[0]
+}
+
+func TestDeliverSignsPayload(t *testing.T) {
+	rc := newReceiver(t, http.StatusNoContent)
+	svc, _, sub := setup(t, rc)
+
+	if n, err := svc.Deliver(context.Background()); err != nil || n != 1 {
+		t.Fatalf("delivered %d (%v), want 1", n, err)
+	}
+	if received, verified := rc.counts(); received != 1 || verified != 1 {
+		t.Errorf("%d requests with %d valid signatures, want 1 and 1", received, verified)
+	}
+
+	d := deliveryOf(t, svc, sub)
+	if d.Status != webhook.Succeeded || d.Attempts != 1 || d.DeliveredAt == nil {
+		t.Errorf("delivery %s after %d attempts, want succeeded after 1", d.Status, d.Attempts)
+	}
+	if n, _ := svc.Deliver(context.Background()); n != 0 {
+		t.Errorf("delivered %d again, want 0", n)
+	}
+}
+
+func TestVerifyRejectsTampering(t *testing.T) {
+	body := []byte(`{"id":1}`)
+	header := webhook.Sign("secret", time.Now(), body)
+
+	if err := webhook.Verify("secret", header, body, time.Minute); err != nil {
+		t.Errorf("valid signature: %v", err)
+	}
+	if err := webhook.Verify("other", header, body, time.Minute); err != webhook.InvalidSignatureErr {
+		t.Errorf("wrong secret: got %v, want %v", err, webhook.InvalidSignatureErr)
+	}
+	if err := webhook.Verify("secret", header, []byte(`{"id":2}`), time.Minute); err != webhook.InvalidSignatureErr {
+		t.Errorf("changed body: got %v, want %v", err, webhook.InvalidSignatureErr)
+	}
+	old := webhook.Sign("secret", time.Now().Add(-time.Hour), body)
+	if err := webhook.Verify("secret", old, body, time.Minute); err != webhook.InvalidSignatureErr {
+		t.Errorf("old timestamp: got %v, want %v", err, webhook.InvalidSignatureErr)
+	}
+}
+
+func TestDeliverRetriesUntilDead(t *testing.T) {
+	rc := newReceiver(t, http.StatusInternalServerError)
+	svc, r, sub := setup(t, rc)
+
+	for i := 1; i < webhook.MaxAttempts; i++ {
+		if n, err := svc.Deliver(context.Background()); err != nil || n != 1 {
+			t.Fatalf("attempt %d: delivered %d (%v), want 1", i, n, err)
+		}
+		if d := deliveryOf(t, svc, sub); d.Status != webhook.Pending || d.Attempts != i {
+			t.Fatalf("after attempt %d: %s after %d attempts, want pending", i, d.Status, d.Attempts)
+		}
+	}
+	for i := 1; i < len(r.delays); i++ {
+		if r.delays[i] <= r.delays[i-1] {
+			t.Errorf("retry delays %v do not grow", r.delays)
+			break
+		}
+	}
+
+	if n, err := svc.Deliver(context.Background()); err != nil || n != 1 {
+		t.Fatalf("last attempt: delivered %d (%v), want 1", n, err)
+	}
+	d := deliveryOf(t, svc, sub)
+	if d.Status != webhook.Dead || d.Attempts != webhook.MaxAttempts {
+		t.Errorf("%s after %d attempts, want dead after %d", d.Status, d.Attempts, webhook.MaxAttempts)
+	}
+	if d.LastStatusCode == nil || *d.LastStatusCode != http.StatusInternalServerError {
+		t.Errorf("last status code %v, want 500", d.LastStatusCode)
+	}
+	if n, _ := svc.Deliver(context.Background()); n != 0 {
+		t.Errorf("dead delivery was attempted again")
+	}
+	if received, verified := rc.counts(); received != webhook.MaxAttempts || verified != received {
+		t.Errorf("%d requests with %d valid signatures, want %d", received, verified, webhook.MaxAttempts)
+	}
+
+	// once the receiver is fixed the dead delivery is sent by hand
+	rc.mu.Lock()
+	rc.status = http.StatusOK
+	rc.mu.Unlock()
+
+	d, err := svc.Redeliver(context.Background(), sub.ID, d.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Status != webhook.Pending || d.Attempts != 0 {
+		t.Errorf("redelivery %s after %d attempts, want pending after 0", d.Status, d.Attempts)
+	}
+	if n, err := svc.Deliver(context.Background()); err != nil || n != 1 {
+		t.Fatalf("redelivered %d (%v), want 1", n, err)
+	}
+	if d := deliveryOf(t, svc, sub); d.Status != webhook.Succeeded {
+		t.Errorf("redelivery %s, want succeeded", d.Status)
+	}
+}
+
+func TestRedeliverUnknownDelivery(t *testing.T) {
+	rc := newReceiver(t, http.StatusOK)
+	svc, _, sub := setup(t, rc)
+
+	d := deliveryOf(t, svc, sub)
+	if _, err := svc.Redeliver(context.Background(), sub.ID+1, d.ID); err != webhook.DeliveryNotFoundErr {
+		t.Errorf("other subscription: got %v, want %v", err, webhook.DeliveryNotFoundErr)
+	}
+	if _, err := svc.Redeliver(context.Background(), sub.ID, d.ID+1); err != webhook.DeliveryNotFoundErr {
+		t.Errorf("unknown delivery: got %v, want %v", err, webhook.DeliveryNotFoundErr)
+	}
+}
@@ -0,0 +1,74 @@
+package webhook
+
+import (
+	"encoding/json"
+	"time"
+)
+
+const (
+	Pending   = "pending"
+	Succeeded = "succeeded"
+	// Dead deliveries are not retried anymore, they can be redelivered by hand
+	Dead = "dead"
+)
+
+// Subscription delivers the events of EventTypes to URL. The secret signing
+// the payloads is only returned when the subscription is created.
+type Subscription struct {
+	ID         int       `json:"id"`
+	URL        string    `json:"url"`
+	EventTypes []string  `json:"eventTypes"`
+	Active     bool      `json:"active"`
+	Secret     string    `json:"secret,omitempty"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+type SubscriptionRequest struct {
+	URL        string   `json:"url" validate:"required,url"`
+	EventTypes []string `json:"eventTypes" validate:"required,min=1,dive,required"`
+	Active     *bool    `json:"active"`
+}
+
+// Delivery is one event sent to one subscription, with the outcome of the
+// last attempt.
+type Delivery struct {
+	ID             int64           `json:"id"`
+	SubscriptionID int             `json:"subscriptionId"`
+	EventID        int64           `json:"eventId"`
+	EventType      string          `json:"eventType"`
+	Payload        json.RawMessage `json:"payload"`
+	Status         string          `json:"status"`
+	Attempts       int             `json:"attempts"`
+	NextAttemptAt  *time.Time      `json:"nextAttemptAt,omitempty"`
+	LastStatusCode *int            `json:"lastStatusCode,omitempty"`
+	LastError      *string         `json:"lastError,omitempty"`
+	CreatedAt      time.Time       `json:"createdAt"`
+	DeliveredAt    *time.Time      `json:"deliveredAt,omitempty"`
+
+	// target of a claimed delivery
+	URL    string `json:"-"`
+	Secret string `json:"-"`
+}
+
+// Attempt is the outcome of sending a delivery.
+type Attempt struct {
+	DeliveryID    int64
+	Status        string
+	StatusCode    int
+	Error         string
+	NextAttemptAt time.Time
+}
+
+type DeliveryListRequest struct {
+	SubscriptionID int
+	Status         string
+	Before         int64
+	Limit          int
+}
+
+type DeliveryListResponse struct {
+	Data []Delivery `json:"data"`
+	Next string     `json:"next,omitempty"`
+
+	NextBefore int64 `json:"-"`
+}